@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"netflow-collector/internal/api"
@@ -19,19 +22,41 @@ var (
 	// Flags
 	port        int
 	maxFlows    int
+	maxMemoryMB int
+	maxAge      time.Duration
 	refreshRate time.Duration
 	simple      bool
 	topKPercent float64
 	lruWindow   time.Duration
+	policySpecs []string
 	prefixLen   int
 	apiPort     int
 	debugFlows  bool
+	clockFix    bool
+
+	// Deduplizierung Flags
+	dedupWindow  time.Duration
+	primarySpecs []string
 
 	// Technitium DNS Flags
 	dnsServer   string
 	dnsToken    string
 	dnsAppName  string
 	dnsPollRate time.Duration
+
+	// Archiv Flags
+	archiveDir     string
+	archiveSegment time.Duration
+	archiveMaxAge  time.Duration
+	archiveMaxMB   int
+
+	// SQLite Historie Flags
+	historyDB     string
+	historyMaxAge time.Duration
+
+	// Snapshot Flags
+	snapshotFile     string
+	snapshotInterval time.Duration
 )
 
 func main() {
@@ -39,7 +64,8 @@ func main() {
 		Use:   "netflow-collector",
 		Short: "NetFlow/IPFIX Collector mit interaktiver TUI",
 		Long: `Ein performanter NetFlow/IPFIX Collector der unterstützt:
-  - NetFlow v5 (festes Format)
+  - NetFlow v1, v5, v7 (festes Format)
+  - NetFlow v8 (Router-Aggregation)
   - NetFlow v9 (Template-basiert)
   - IPFIX v10 (Template-basiert)
 
@@ -51,11 +77,19 @@ DNS-Auflösung und Service-Namen-Mapping.`,
 	// Flags definieren
 	rootCmd.Flags().IntVarP(&port, "port", "p", 2055, "UDP Port zum Lauschen")
 	rootCmd.Flags().IntVarP(&maxFlows, "max-flows", "m", 100000, "Maximale Flows im Speicher")
+	rootCmd.Flags().IntVar(&maxMemoryMB, "max-memory", 0, "Speicherbudget für Flows in MB, ersetzt --max-flows falls dieses nicht gesetzt ist (0 = deaktiviert)")
+	rootCmd.Flags().DurationVar(&maxAge, "max-age", 0, "Flows älter als diese Dauer aus dem Speicher entfernen (0 = unbegrenzt)")
 	rootCmd.Flags().DurationVarP(&refreshRate, "refresh", "r", 500*time.Millisecond, "Display-Aktualisierungsrate")
 	rootCmd.Flags().BoolVarP(&simple, "simple", "s", false, "Simple CLI statt interaktiver TUI verwenden")
 	rootCmd.Flags().Float64Var(&topKPercent, "topk-percent", 1.0, "Prozent der max-flows die als Elephant-Flows geschützt werden (1.0 = 1%)")
 	rootCmd.Flags().DurationVar(&lruWindow, "lru-window", 5*time.Minute, "Kürzlich angesehene Flows für diese Dauer schützen")
+	rootCmd.Flags().StringArrayVar(&policySpecs, "eviction-policy", nil, "Eviction-Policy in Reihenfolge, mehrfach angebbar: topk[:prozent], lru, watch:netz[,netz], pin:filter, sample:prozent, age:dauer (Standard: topk, lru)")
 	rootCmd.Flags().IntVar(&prefixLen, "prefix-len", 56, "IPv6 Präfixlänge für eigene Netzwerk-Erkennung (48, 56, 60, 64)")
+	rootCmd.Flags().BoolVar(&clockFix, "clock-correct", false, "Flow-Zeitstempel um den gemessenen Uhren-Offset des Exporters korrigieren")
+
+	// Deduplizierung über Exporter hinweg
+	rootCmd.Flags().DurationVar(&dedupWindow, "dedup-window", 0, "Gleichen Flow von mehreren Exportern innerhalb dieses Zeitfensters nur einmal zählen (0 = deaktiviert, z.B. 30s)")
+	rootCmd.Flags().StringArrayVar(&primarySpecs, "primary-exporter", nil, "Bevorzugter Exporter für Flows von oder zu einem Präfix, mehrfach angebbar: präfix=exporter (z.B. 10.0.0.0/8=192.168.1.1)")
 
 	// Technitium DNS Integration Flags
 	rootCmd.Flags().StringVar(&dnsServer, "dns-server", "", "Technitium DNS Server URL (z.B. http://192.168.1.1:5380)")
@@ -63,6 +97,20 @@ DNS-Auflösung und Service-Namen-Mapping.`,
 	rootCmd.Flags().StringVar(&dnsAppName, "dns-app", "Query Logs (Sqlite)", "Technitium DNS App-Name für Query Logs")
 	rootCmd.Flags().DurationVar(&dnsPollRate, "dns-poll", 5*time.Second, "Wie oft Technitium nach neuen DNS-Queries abgefragt wird")
 
+	// Archiv Flags
+	rootCmd.Flags().StringVar(&archiveDir, "archive-dir", "", "Flows komprimiert in diesem Verzeichnis archivieren (leer = deaktiviert)")
+	rootCmd.Flags().DurationVar(&archiveSegment, "archive-segment", store.DefaultSegmentDuration, "Zeitraum pro Archiv-Segmentdatei")
+	rootCmd.Flags().DurationVar(&archiveMaxAge, "archive-max-age", 7*24*time.Hour, "Archiv-Segmente älter als diese Dauer löschen (0 = unbegrenzt)")
+	rootCmd.Flags().IntVar(&archiveMaxMB, "archive-max-mb", 1024, "Maximale Archivgröße in MB, älteste Segmente werden gelöscht (0 = unbegrenzt)")
+
+	// SQLite Historie Flags
+	rootCmd.Flags().StringVar(&historyDB, "history-db", "", "Flows in dieser SQLite-Datenbank speichern, abfragbar über /api/v1/history (leer = deaktiviert)")
+	rootCmd.Flags().DurationVar(&historyMaxAge, "history-max-age", 30*24*time.Hour, "Flows älter als diese Dauer aus der Historie löschen (0 = unbegrenzt)")
+
+	// Snapshot Flags
+	rootCmd.Flags().StringVar(&snapshotFile, "snapshot-file", "", "Flow-Store beim Beenden und periodisch in diese Datei sichern und beim Start laden (leer = deaktiviert)")
+	rootCmd.Flags().DurationVar(&snapshotInterval, "snapshot-interval", 5*time.Minute, "Intervall für periodische Snapshots (0 = nur beim Beenden)")
+
 	// API Server Flag
 	rootCmd.Flags().IntVar(&apiPort, "api-port", 0, "HTTP API Server auf diesem Port aktivieren (0 = deaktiviert)")
 
@@ -120,12 +168,106 @@ func runCollector(cmd *cobra.Command, args []string) {
 	evictionConfig := store.EvictionConfig{
 		TopKPercent: topKPercent,
 		LRUWindow:   lruWindow,
+		MaxMemory:   int64(maxMemoryMB) * 1024 * 1024,
+		MaxAge:      maxAge,
+	}
+
+	// Eviction-Policies in der angegebenen Reihenfolge
+	for _, spec := range policySpecs {
+		policy, err := store.ParseEvictionPolicy(spec, evictionConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ungültige Eviction-Policy %q: %v\n", spec, err)
+			os.Exit(1)
+		}
+		evictionConfig.Policies = append(evictionConfig.Policies, policy)
+	}
+
+	// Mit Speicherbudget gilt --max-flows nur, wenn es explizit gesetzt wurde
+	if maxMemoryMB > 0 && !cmd.Flags().Changed("max-flows") {
+		maxFlows = 0
 	}
 
 	// Komponenten erstellen
 	udpListener := listener.New(port)
 	flowParser := parser.New()
 	flowStore := store.NewWithConfig(maxFlows, evictionConfig)
+	flowStore.SetClockCorrection(clockFix)
+
+	// Deduplizierung konfigurieren
+	if len(primarySpecs) > 0 && dedupWindow <= 0 {
+		fmt.Fprintln(os.Stderr, "--primary-exporter benötigt --dedup-window")
+		os.Exit(1)
+	}
+	if dedupWindow > 0 {
+		dedupConfig := store.DedupConfig{Window: dedupWindow}
+		for _, spec := range primarySpecs {
+			primary, err := store.ParsePrimaryExporter(spec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Ungültiger primärer Exporter %q: %v\n", spec, err)
+				os.Exit(1)
+			}
+			dedupConfig.Primary = append(dedupConfig.Primary, primary)
+		}
+		flowStore.SetDedup(dedupConfig)
+	}
+
+	// Flow-Archiv öffnen falls konfiguriert
+	var archive *store.Archive
+	if archiveDir != "" {
+		var err error
+		archive, err = store.OpenArchive(store.ArchiveConfig{
+			Dir:             archiveDir,
+			SegmentDuration: archiveSegment,
+			MaxAge:          archiveMaxAge,
+			MaxSize:         int64(archiveMaxMB) * 1024 * 1024,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Öffnen des Archivs: %v\n", err)
+			os.Exit(1)
+		}
+		flowStore.SetArchive(archive)
+	}
+
+	// SQLite-Historie öffnen falls konfiguriert
+	var history *store.History
+	if historyDB != "" {
+		var err error
+		history, err = store.OpenHistory(store.HistoryConfig{
+			Path:   historyDB,
+			MaxAge: historyMaxAge,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Öffnen der Historie: %v\n", err)
+			os.Exit(1)
+		}
+		flowStore.SetHistory(history)
+	}
+
+	// Snapshot vom letzten Lauf laden, bevor neue Flows eintreffen
+	if snapshotFile != "" {
+		flowStore.SetSnapshotFile(snapshotFile)
+		info, err := flowStore.LoadSnapshot()
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Erster Start
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warnung: Snapshot nicht geladen: %v\n", err)
+		default:
+			fmt.Printf("Snapshot geladen: %d Flows vom %s\n", info.Flows, info.Created.Format("02.01.2006 15:04:05"))
+		}
+
+		if snapshotInterval > 0 {
+			go func() {
+				ticker := time.NewTicker(snapshotInterval)
+				defer ticker.Stop()
+				for range ticker.C {
+					if _, err := flowStore.SaveSnapshot(); err != nil && debugFlows {
+						fmt.Fprintf(os.Stderr, "[DEBUG] Snapshot error: %v\n", err)
+					}
+				}
+			}()
+		}
+	}
 
 	// UDP Listener starten
 	if err := udpListener.Start(); err != nil {
@@ -133,6 +275,25 @@ func runCollector(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// Abgelaufene Flows auch ohne eingehende Pakete entfernen und
+	// zurückgehaltene Duplikat-Kandidaten freigeben
+	if maxAge > 0 || dedupWindow > 0 {
+		interval := time.Minute
+		if maxAge > 0 {
+			interval = max(maxAge/8, time.Second)
+		}
+		if dedupWindow > 0 {
+			interval = min(interval, max(dedupWindow/4, time.Second))
+		}
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				flowStore.ExpireFlows()
+			}
+		}()
+	}
+
 	// Pakete im Hintergrund verarbeiten
 	go func() {
 		for packet := range udpListener.Packets() {
@@ -185,11 +346,24 @@ func runCollector(cmd *cobra.Command, args []string) {
 		fmt.Printf("API Server gestartet auf http://localhost:%d\n", apiPort)
 	}
 
+	// Bei SIGINT/SIGTERM die Anzeige beenden, damit Archiv, Historie und
+	// Snapshot unten noch geschrieben werden
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopDisplay := func(stop func()) {
+		go func() {
+			<-signals
+			signal.Stop(signals) // Ein zweites Signal beendet sofort
+			stop()
+		}()
+	}
+
 	if simple {
 		// Simple CLI Modus
 		cli := display.New(flowStore, refreshRate)
+		stopDisplay(cli.Stop)
 		fmt.Printf("NetFlow/IPFIX Collector gestartet auf UDP Port %d (Simple Modus)\n", port)
-		fmt.Println("Unterstützte Versionen: NetFlow v5, v9, IPFIX (v10)")
+		fmt.Println("Unterstützte Versionen: NetFlow v1, v5, v7, v8, v9, IPFIX (v10)")
 		fmt.Println("Drücke Strg+C zum Beenden")
 		fmt.Println()
 
@@ -198,6 +372,7 @@ func runCollector(cmd *cobra.Command, args []string) {
 	} else {
 		// Interaktiver TUI Modus (verwendet den gleichen Resolver)
 		tui := display.NewTUIWithResolver(flowStore, refreshRate, prefixLen, dnsResolver)
+		stopDisplay(tui.Stop)
 
 		// TUI ausführen (blockiert bis Beenden)
 		if err := tui.Run(); err != nil {
@@ -219,6 +394,30 @@ func runCollector(cmd *cobra.Command, args []string) {
 	// Aufräumen
 	udpListener.Stop()
 
+	// Noch ausstehende Flows an Archiv und Historie übergeben
+	flowStore.Close()
+
+	// Aktuellen Stand für den nächsten Start sichern
+	if snapshotFile != "" {
+		if info, err := flowStore.SaveSnapshot(); err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Schreiben des Snapshots: %v\n", err)
+		} else {
+			fmt.Printf("Snapshot gespeichert: %d Flows in %s\n", info.Flows, info.Path)
+		}
+	}
+
+	// Gepufferte Flows ins Archiv schreiben
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Schreiben des Archivs: %v\n", err)
+		}
+	}
+	if history != nil {
+		if err := history.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Fehler beim Schreiben der Historie: %v\n", err)
+		}
+	}
+
 	// Endstatistiken ausgeben
 	stats := flowStore.GetStats()
 	evictStats := flowStore.GetEvictionStats()
@@ -229,10 +428,14 @@ func runCollector(cmd *cobra.Command, args []string) {
 	fmt.Printf("  NetFlow v5: %d\n", stats.V5Flows)
 	fmt.Printf("  NetFlow v9: %d\n", stats.V9Flows)
 	fmt.Printf("  IPFIX: %d\n", stats.IPFIXFlows)
+	if stats.LegacyFlows > 0 {
+		fmt.Printf("  NetFlow v1/v7/v8: %d\n", stats.LegacyFlows)
+	}
 	if evictStats.TotalEvicted > 0 {
 		fmt.Printf("\nEviction-Statistiken:\n")
 		fmt.Printf("  Gesamt Entfernt: %d\n", evictStats.TotalEvicted)
-		fmt.Printf("  TopK Geschützt: %d\n", evictStats.TopKProtected)
-		fmt.Printf("  LRU Geschützt: %d\n", evictStats.LRUProtected)
+		for _, p := range evictStats.Policies {
+			fmt.Printf("  Policy %s: %d geschützt, %d entfernt\n", p.Name, p.Protected, p.Evicted)
+		}
 	}
 }
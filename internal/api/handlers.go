@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -56,6 +58,61 @@ func parseTimeRange(s string) time.Duration {
 	return d
 }
 
+// parseTimeParam parst absolute Zeitangaben: RFC3339, "2006-01-02T15:04" oder
+// "2006-01-02" (beide in lokaler Zeit)
+func parseTimeParam(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected RFC3339 or YYYY-MM-DD[THH:MM])", s)
+}
+
+// rejectFlowTimeRange antwortet mit 400, wenn from/to an einem Endpunkt ohne
+// Flow-Zeitraum angegeben sind, statt sie stillschweigend zu ignorieren
+func rejectFlowTimeRange(w http.ResponseWriter, r *http.Request, reason string) bool {
+	query := r.URL.Query()
+	if !query.Has("from") && !query.Has("to") {
+		return false
+	}
+	writeError(w, http.StatusBadRequest, "from/to not supported", reason)
+	return true
+}
+
+// parseFlowTimeRange parst from/to als Zeitraum auf Flow-Start und -Ende. Flows, die über
+// eine Grenze reichen, werden auf den Zeitraum gekürzt und Bytes/Pakete anteilig gezählt.
+func parseFlowTimeRange(query url.Values) (from, to time.Time, err error) {
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if s := query.Get(param); s != "" {
+			t, err := parseTimeParam(s)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("%s: %w", param, err)
+			}
+			*target = t
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// withFlowTimeRange setzt from/to im Filter und legt bei Bedarf einen leeren Filter an
+func withFlowTimeRange(filter *store.Filter, from, to time.Time) *store.Filter {
+	if from.IsZero() && to.IsZero() {
+		return filter
+	}
+	if filter == nil {
+		filter = &store.Filter{}
+	}
+	filter.From, filter.To = from, to
+	return filter
+}
+
 // HandleSankey returns aggregated flow data for Sankey visualization
 func (h *Handlers) HandleSankey(w http.ResponseWriter, r *http.Request) {
 	mode := r.URL.Query().Get("mode")
@@ -102,8 +159,22 @@ func (h *Handlers) HandleSankey(w http.ResponseWriter, r *http.Request) {
 	var cutoffTime time.Time
 	if timeRange > 0 {
 		cutoffTime = time.Now().Add(-timeRange)
+
+		// Zeitraum an den Store geben, damit ältere Flows aus dem Archiv gelesen werden
+		if filter == nil {
+			filter = &store.Filter{}
+		}
+		filter.Since = cutoffTime
 	}
 
+	// Absoluter Zeitraum auf Flow-Start/-Ende
+	from, to, err := parseFlowTimeRange(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	filter = withFlowTimeRange(filter, from, to)
+
 	// Interface-Parameter für Firewall-Modus parsen
 	var leftIF, rightIF uint16
 	if l, err := strconv.ParseUint(r.URL.Query().Get("leftIF"), 10, 16); err == nil {
@@ -261,8 +332,11 @@ func (h *Handlers) aggregateIPtoService(filter *store.Filter, topN int, cutoffTi
 			continue
 		}
 
-		// Determine service from destination port (most common case)
-		service := resolver.GetServiceName(f.DstPort, f.Protocol)
+		// Prefer the application reported by the exporter, then the destination port (most common case)
+		service := f.AppName
+		if service == "" {
+			service = resolver.GetServiceName(f.DstPort, f.Protocol)
+		}
 		if service == "" {
 			// Try source port (for responses)
 			service = resolver.GetServiceName(f.SrcPort, f.Protocol)
@@ -348,6 +422,8 @@ func (h *Handlers) aggregateIPtoService(filter *store.Filter, topN int, cutoffTi
 }
 
 // HandleFlows gibt rohe Flows mit optionalem Filter/Limit zurück
+// Parameter: filter, since (Dauer), from/to (Zeitpunkt, Flow-Start/-Ende), limit, sort, asc,
+// cursor (Flows nach dieser Sequenznummer in Speicherreihenfolge, 0 = ab dem ältesten)
 func (h *Handlers) HandleFlows(w http.ResponseWriter, r *http.Request) {
 	filterStr := r.URL.Query().Get("filter")
 	limit := 100
@@ -384,7 +460,40 @@ func (h *Handlers) HandleFlows(w http.ResponseWriter, r *http.Request) {
 		filter = &f
 	}
 
-	flows := h.store.Query(filter, sortBy, ascending, limit)
+	// Optionaler Zeitraum (z.B. "1h"), reicht bei aktivem Archiv über den Speicher hinaus
+	if since := parseTimeRange(r.URL.Query().Get("since")); since > 0 {
+		if filter == nil {
+			filter = &store.Filter{}
+		}
+		filter.Since = time.Now().Add(-since)
+	}
+
+	// Absoluter Zeitraum auf Flow-Start/-Ende
+	from, to, err := parseFlowTimeRange(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	filter = withFlowTimeRange(filter, from, to)
+
+	// Mit cursor stabile Seiten in Speicherreihenfolge statt sortierter Momentaufnahme
+	var page *store.FlowPage
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		cursor, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid cursor", "Expected the nextCursor of a previous response or 0")
+			return
+		}
+		p := h.store.QueryAfter(filter, cursor, limit)
+		page = &p
+	}
+
+	var flows []types.Flow
+	if page != nil {
+		flows = page.Flows
+	} else {
+		flows = h.store.Query(filter, sortBy, ascending, limit)
+	}
 	total := h.store.GetFlowCount()
 	filtered := h.store.GetFilteredCount(filter)
 
@@ -395,10 +504,293 @@ func (h *Handlers) HandleFlows(w http.ResponseWriter, r *http.Request) {
 		Generated: time.Now(),
 		Filter:    filterStr,
 	}
+	if page != nil {
+		response.NextCursor = &page.Next
+		response.HasMore = page.More
+		response.LatestSeq = page.Latest
+	}
+
+	for i := range flows {
+		f := &flows[i]
+		service := f.AppName
+		if service == "" {
+			service = resolver.GetServiceName(f.DstPort, f.Protocol)
+		}
+		if service == "" {
+			service = resolver.GetServiceName(f.SrcPort, f.Protocol)
+		}
+		response.Flows[i] = FlowToResponse(f, service)
+		for _, o := range h.store.Observations(f) {
+			response.Flows[i].Observations = append(response.Flows[i].Observations, ObservationInfo{
+				Exporter:  o.Exporter.String(),
+				InputIf:   o.InputIf,
+				OutputIf:  o.OutputIf,
+				Canonical: o.Canonical,
+				Flows:     o.Flows,
+				Bytes:     o.Bytes,
+				LastSeen:  o.LastSeen,
+			})
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// HandleSessions fügt aufeinanderfolgende Datensätze desselben 5-Tupels und Exporters
+// zu Sitzungen zusammen (z.B. lange Transfers, die der Router pro Active Timeout aufteilt)
+// Parameter: filter, since (Dauer), from/to (Zeitpunkt), gap (maximale Pause, Standard 2m), limit, sort, asc
+func (h *Handlers) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filterStr := query.Get("filter")
+	limit := 100
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	sortBy := store.SortByTime
+	switch query.Get("sort") {
+	case "bytes":
+		sortBy = store.SortByBytes
+	case "packets":
+		sortBy = store.SortByPackets
+	case "src":
+		sortBy = store.SortBySrcIP
+	case "dst":
+		sortBy = store.SortByDstIP
+	case "proto":
+		sortBy = store.SortByProtocol
+	}
+	ascending := query.Get("asc") == "true"
+
+	gap := store.DefaultSessionGap
+	if s := query.Get("gap"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid gap", "Use a positive duration like 30s or 5m")
+			return
+		}
+		gap = d
+	}
+
+	var filter *store.Filter
+	if filterStr != "" {
+		f := store.ParseFilter(filterStr)
+		if !f.IsValid() {
+			writeError(w, http.StatusBadRequest, "Invalid filter", f.Error)
+			return
+		}
+		filter = &f
+	}
+
+	// Optionaler Zeitraum, reicht bei aktivem Archiv über den Speicher hinaus
+	if since := parseTimeRange(query.Get("since")); since > 0 {
+		if filter == nil {
+			filter = &store.Filter{}
+		}
+		filter.Since = time.Now().Add(-since)
+	}
+
+	// Absoluter Zeitraum auf Flow-Start/-Ende
+	from, to, err := parseFlowTimeRange(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	filter = withFlowTimeRange(filter, from, to)
+
+	sessions := h.store.QuerySessions(filter, gap, sortBy, ascending, limit)
+
+	response := SessionsResponse{
+		Sessions:  make([]SessionResponse, len(sessions)),
+		Gap:       gap.String(),
+		Generated: time.Now(),
+		Filter:    filterStr,
+	}
+	for i := range sessions {
+		s := &sessions[i]
+		service := s.AppName
+		if service == "" {
+			service = resolver.GetServiceName(s.DstPort, s.Protocol)
+		}
+		if service == "" {
+			service = resolver.GetServiceName(s.SrcPort, s.Protocol)
+		}
+		response.Sessions[i] = SessionResponse{
+			FlowResponse: FlowToResponse(&s.Flow, service),
+			Exporter:     s.ExporterIP.String(),
+			Records:      s.Records,
+			DurationMs:   s.Duration().Milliseconds(),
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// streamHeartbeat ist das Intervall für Keep-Alive-Kommentare im Flow-Stream
+const streamHeartbeat = 15 * time.Second
+
+// HandleFlowStream liefert neue Flows live als Server-Sent Events (ein Event pro Flow)
+// Parameter: filter, buffer (Puffergröße in Flows)
+// Verworfene Flows eines zu langsamen Clients werden als Event "dropped" gemeldet.
+// from/to werden abgelehnt: der Stream liefert nur neu empfangene Flows.
+func (h *Handlers) HandleFlowStream(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "The stream only delivers newly received flows, use /api/v1/flows for a time range") {
+		return
+	}
+	var filter *store.Filter
+	filterStr := r.URL.Query().Get("filter")
+	if filterStr != "" {
+		f := store.ParseFilter(filterStr)
+		if !f.IsValid() {
+			writeError(w, http.StatusBadRequest, "Invalid filter", f.Error)
+			return
+		}
+		filter = &f
+	}
+	buffer, _ := strconv.Atoi(r.URL.Query().Get("buffer"))
+
+	// Der Stream läuft unbegrenzt, das Server-WriteTimeout gilt nicht
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	sub := h.store.Subscribe("api "+r.RemoteAddr, filter, buffer)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case f, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if dropped := sub.Dropped(); dropped != reported {
+				reported = dropped
+				if err := writeEvent(w, "dropped", StreamDropped{Dropped: dropped}); err != nil {
+					return
+				}
+			}
+			service := f.AppName
+			if service == "" {
+				service = resolver.GetServiceName(f.DstPort, f.Protocol)
+			}
+			if service == "" {
+				service = resolver.GetServiceName(f.SrcPort, f.Protocol)
+			}
+			if err := writeEvent(w, "", FlowToResponse(&f, service)); err != nil {
+				return
+			}
+			// Flows eines Pakets kommen gebündelt, erst danach senden
+			if len(sub.C) > 0 {
+				continue
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent schreibt ein Server-Sent Event mit JSON-Daten
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return err
+}
+
+// HandleHistory durchsucht die SQLite-Historie mit der gleichen Filter-Syntax wie die TUI
+// Parameter: filter, since (Dauer), from/to (Zeitpunkt, Flow-Start/-Ende), limit, sort, asc
+func (h *Handlers) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	history := h.store.History()
+	if history == nil {
+		writeError(w, http.StatusServiceUnavailable, "History not enabled", "Start the collector with --history-db")
+		return
+	}
+
+	query := r.URL.Query()
+	filterStr := query.Get("filter")
+	limit := 1000
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	sortBy := store.SortByTime
+	switch query.Get("sort") {
+	case "bytes":
+		sortBy = store.SortByBytes
+	case "packets":
+		sortBy = store.SortByPackets
+	case "src":
+		sortBy = store.SortBySrcIP
+	case "dst":
+		sortBy = store.SortByDstIP
+	case "proto":
+		sortBy = store.SortByProtocol
+	}
+	ascending := query.Get("asc") == "true"
+
+	filter := store.ParseFilter(filterStr)
+	if !filter.IsValid() {
+		writeError(w, http.StatusBadRequest, "Invalid filter", filter.Error)
+		return
+	}
+
+	// Zeitraum: since (relativ, Empfangszeit) oder from/to (absolut, Flow-Start/-Ende)
+	if since := parseTimeRange(query.Get("since")); since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+	from, to, err := parseFlowTimeRange(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	filter.From, filter.To = from, to
+
+	flows, err := history.Query(&filter, sortBy, ascending, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "History query failed", err.Error())
+		return
+	}
+
+	if from.IsZero() {
+		from = filter.Since
+	}
+	response := HistoryResponse{
+		Flows:     make([]FlowResponse, len(flows)),
+		Count:     len(flows),
+		From:      from,
+		To:        to,
+		Generated: time.Now(),
+		Filter:    filterStr,
+	}
 
 	for i := range flows {
 		f := &flows[i]
-		service := resolver.GetServiceName(f.DstPort, f.Protocol)
+		service := f.AppName
+		if service == "" {
+			service = resolver.GetServiceName(f.DstPort, f.Protocol)
+		}
 		if service == "" {
 			service = resolver.GetServiceName(f.SrcPort, f.Protocol)
 		}
@@ -408,9 +800,313 @@ func (h *Handlers) HandleFlows(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, response)
 }
 
+// HandleTimeSeries gibt Bytes/Pakete/Flows über die Zeit zurück
+// Parameter: filter, timeRange (Dauer, Standard 1h, Empfangszeit) oder from/to (Zeitpunkt,
+// Flow-Start/-Ende), step, groupBy (exporter,inif,outif,protocol)
+// Mit from/to kommt die Zeitreihe aus den gespeicherten Flows: sie werden auf den Zeitraum
+// gekürzt und anteilig auf die Zeitpunkte ihrer Dauer verteilt.
+func (h *Handlers) HandleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filterStr := query.Get("filter")
+
+	var q store.TimeSeriesQuery
+	if filterStr != "" {
+		f := store.ParseFilter(filterStr)
+		if !f.IsValid() {
+			writeError(w, http.StatusBadRequest, "Invalid filter", f.Error)
+			return
+		}
+		q.Filter = &f
+	}
+
+	if timeRange := parseTimeRange(query.Get("timeRange")); timeRange > 0 {
+		q.Since = time.Now().Add(-timeRange)
+	}
+	from, to, err := parseFlowTimeRange(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	if !from.IsZero() || !to.IsZero() {
+		q.Since, q.Until, q.FlowTime = from, to, true
+	}
+
+	if s := query.Get("step"); s != "" {
+		step, err := time.ParseDuration(s)
+		if err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid step", "Expected a duration like 10s, 1m or 1h")
+			return
+		}
+		q.Step = step
+	}
+
+	if groupBy := query.Get("groupBy"); groupBy != "" {
+		q.GroupBy = strings.Split(groupBy, ",")
+	}
+
+	result, err := h.store.QueryTimeSeries(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time series query", err.Error())
+		return
+	}
+
+	response := TimeSeriesResponse{
+		Tier:      result.Tier,
+		StepSec:   result.Step.Seconds(),
+		From:      result.Since,
+		To:        result.Until,
+		FromFlows: result.FromFlows,
+		FlowTime:  result.FlowTime,
+		Series:    make([]TimeSeriesInfo, 0, len(result.Series)),
+		Generated: time.Now(),
+		Filter:    filterStr,
+	}
+
+	for _, s := range result.Series {
+		info := TimeSeriesInfo{
+			Labels:  s.Labels,
+			Bytes:   s.Total.Bytes,
+			Packets: s.Total.Packets,
+			Flows:   s.Total.Flows,
+			Points:  make([]TimePointInfo, len(s.Points)),
+		}
+		for i, p := range s.Points {
+			info.Points[i] = TimePointInfo{Time: p.Time, Bytes: p.Bytes, Packets: p.Packets, Flows: p.Flows}
+		}
+		response.Series = append(response.Series, info)
+	}
+
+	writeJSON(w, response)
+}
+
+// HandleAggregate gruppiert die gespeicherten Flows nach beliebigen Feldern und
+// berechnet Metriken pro Gruppe
+// Parameter: groupBy (src, dst, src/24, sport, dport, proto, service, inif, outif,
+// exporter, srcas, dstas, time/5m), metrics (bytes, packets, flows, count,
+// distinct(feld), avg/min/max/pN(bytes|packets|duration|bps)), filter,
+// timeRange oder from/to, sort, order (asc/desc), limit (Standard 100, 0 = alle)
+func (h *Handlers) HandleAggregate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filterStr := query.Get("filter")
+
+	var q store.AggregateQuery
+	filter := store.Filter{}
+	if filterStr != "" {
+		filter = store.ParseFilter(filterStr)
+		if !filter.IsValid() {
+			writeError(w, http.StatusBadRequest, "Invalid filter", filter.Error)
+			return
+		}
+	}
+	if timeRange := parseTimeRange(query.Get("timeRange")); timeRange > 0 {
+		filter.Since = time.Now().Add(-timeRange)
+	}
+	from, to, err := parseFlowTimeRange(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	filter.From, filter.To = from, to
+	if !filter.IsEmpty() {
+		q.Filter = &filter
+	}
+
+	if groupBy := query.Get("groupBy"); groupBy != "" {
+		q.GroupBy = strings.Split(groupBy, ",")
+	}
+	if metrics := query.Get("metrics"); metrics != "" {
+		q.Metrics = strings.Split(metrics, ",")
+	}
+	q.Sort = query.Get("sort")
+	q.Ascending = query.Get("order") == "asc"
+	q.Limit = 100
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n >= 0 {
+		q.Limit = n
+	}
+
+	result, err := h.store.Aggregate(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid aggregation", err.Error())
+		return
+	}
+
+	response := AggregateResponse{
+		GroupBy:   result.GroupBy,
+		Metrics:   result.Metrics,
+		Matched:   result.Matched,
+		Groups:    result.Groups,
+		Rows:      make([]AggregateRowInfo, len(result.Rows)),
+		Total:     make(map[string]float64, len(result.Metrics)),
+		Generated: time.Now(),
+		Filter:    filterStr,
+	}
+	for i, name := range result.Metrics {
+		response.Total[name] = result.Total[i]
+	}
+	for i, row := range result.Rows {
+		info := AggregateRowInfo{
+			Keys:   make(map[string]string, len(result.GroupBy)),
+			Values: make(map[string]float64, len(result.Metrics)),
+		}
+		for k, name := range result.GroupBy {
+			info.Keys[name] = row.Keys[k]
+		}
+		for m, name := range result.Metrics {
+			info.Values[name] = row.Values[m]
+		}
+		response.Rows[i] = info
+	}
+
+	writeJSON(w, response)
+}
+
+// HandleHeavyHitters liefert die Top-Talker eines Zeitfensters, unabhängig davon,
+// welche Flows noch im Speicher sind
+// Parameter: dimension (src, dst, conversation, port, as), window (1m, 5m, 15m, 1h), limit
+// from/to werden abgelehnt: die Fenster zählen nach Empfangszeit bis jetzt.
+func (h *Handlers) HandleHeavyHitters(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "Heavy hitters are counted in sliding windows up to now, use window") {
+		return
+	}
+	query := r.URL.Query()
+	dimension := query.Get("dimension")
+	if dimension == "" {
+		dimension = "src"
+	}
+	window := query.Get("window")
+	if window == "" {
+		window = "5m"
+	}
+	limit := 20
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	result, err := h.store.QueryHeavyHitters(dimension, window, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid heavy hitter query", err.Error())
+		return
+	}
+
+	response := HeavyHittersResponse{
+		Dimension:    result.Dimension,
+		Window:       result.Window,
+		From:         result.Since,
+		TotalBytes:   result.Total.Bytes,
+		TotalPackets: result.Total.Packets,
+		TotalFlows:   result.Total.Flows,
+		Hitters:      make([]HeavyHitterInfo, len(result.Hitters)),
+		Generated:    time.Now(),
+	}
+	for i, hh := range result.Hitters {
+		info := HeavyHitterInfo{
+			Key:     hh.Key,
+			Filter:  hh.Filter,
+			Bytes:   hh.Bytes,
+			Error:   hh.Error,
+			Packets: hh.Packets,
+			Flows:   hh.Flows,
+			Share:   hh.Share,
+		}
+		if hh.Addr.IsValid() {
+			if name := h.resolveIP(net.IP(hh.Addr.AsSlice())); name != hh.Addr.String() {
+				info.Hostname = name
+			}
+		}
+		if hh.Port != 0 || hh.Protocol != 0 {
+			info.Service = resolver.GetServiceName(hh.Port, hh.Protocol)
+		}
+		response.Hitters[i] = info
+	}
+
+	writeJSON(w, response)
+}
+
+// HandleCardinality liefert die geschätzte Anzahl unterschiedlicher Hosts pro
+// Quell-/Ziel-Host, Interface oder Exporter in einem Zeitfenster (HyperLogLog)
+// Parameter: dimension (src, dst, interface, exporter), window (5m, 15m, 1h), limit,
+// host (nur src/dst: nur diesen Host statt der Schlüssel mit den meisten Hosts)
+// from/to werden abgelehnt: die Fenster zählen nach Empfangszeit bis jetzt.
+func (h *Handlers) HandleCardinality(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "Cardinality is estimated in sliding windows up to now, use window") {
+		return
+	}
+	query := r.URL.Query()
+	dimension := query.Get("dimension")
+	if dimension == "" {
+		dimension = "src"
+	}
+	window := query.Get("window")
+	if window == "" {
+		window = "1h"
+	}
+	limit := 20
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	var result store.CardinalityResult
+	var err error
+	if host := query.Get("host"); host != "" {
+		addr, parseErr := netip.ParseAddr(host)
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, "Invalid host", parseErr.Error())
+			return
+		}
+		result, err = h.store.DistinctPeers(dimension, window, []netip.Addr{addr})
+	} else {
+		result, err = h.store.QueryCardinality(dimension, window, limit)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid cardinality query", err.Error())
+		return
+	}
+
+	response := CardinalityResponse{
+		Dimension: result.Dimension,
+		Window:    result.Window,
+		From:      result.Since,
+		Keys:      result.Keys,
+		Skipped:   result.Skipped,
+		Entries:   make([]CardinalityInfo, len(result.Entries)),
+		Generated: time.Now(),
+	}
+	for i, e := range result.Entries {
+		info := CardinalityInfo{
+			Key:      e.Key,
+			Filter:   e.Filter,
+			Distinct: e.Distinct,
+		}
+		switch result.Dimension {
+		case "src", "dst":
+			if name := h.resolveIP(net.IP(e.Addr.AsSlice())); name != e.Addr.String() {
+				info.Hostname = name
+			}
+		case "interface":
+			info.Exporter = e.Addr.String()
+			info.Interface = e.Interface
+			info.Direction = "in"
+			if e.Output {
+				info.Direction = "out"
+			}
+		case "exporter":
+			info.Exporter = e.Addr.String()
+		}
+		response.Entries[i] = info
+	}
+
+	writeJSON(w, response)
+}
+
 // HandleStats returns flow store statistics
+// from/to werden abgelehnt: die Zähler gelten seit dem Start.
 func (h *Handlers) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "Statistics count since the start, use /api/v1/aggregate for a time range") {
+		return
+	}
 	stats := h.store.GetStats()
+	evictionConfig := h.store.GetEvictionConfig()
+	evictionStats := h.store.GetEvictionStats()
 
 	response := StatsResponse{
 		TotalFlows:      stats.TotalFlows,
@@ -421,15 +1117,174 @@ func (h *Handlers) HandleStats(w http.ResponseWriter, r *http.Request) {
 		V5Flows:         stats.V5Flows,
 		V9Flows:         stats.V9Flows,
 		IPFIXFlows:      stats.IPFIXFlows,
+		LegacyFlows:     stats.LegacyFlows,
 		UniqueExporters: stats.UniqueExporters,
 		CurrentFlows:    h.store.GetFlowCount(),
 		MaxFlows:        h.store.GetMaxFlows(),
+		MemoryBytes:     h.store.GetMemoryUsage(),
+		MaxMemory:       evictionConfig.MaxMemory,
+		AgeEvicted:      evictionStats.AgeEvicted,
+		Eviction: EvictionInfo{
+			TotalEvicted: evictionStats.TotalEvicted,
+			FIFOEvicted:  evictionStats.FIFOEvicted,
+			Policies:     make([]PolicyInfo, 0, len(evictionStats.Policies)),
+		},
+		Generated: time.Now(),
+	}
+	for _, p := range evictionStats.Policies {
+		response.Eviction.Policies = append(response.Eviction.Policies, PolicyInfo{
+			Name:      p.Name,
+			Protected: p.Protected,
+			Evicted:   p.Evicted,
+		})
+	}
+	if evictionConfig.MaxAge > 0 {
+		response.MaxAge = evictionConfig.MaxAge.String()
+	}
+
+	if archive, ok := h.store.GetArchiveStats(); ok {
+		response.Archive = &ArchiveInfo{
+			Dir:          archive.Dir,
+			Segments:     archive.Segments,
+			Bytes:        archive.Bytes,
+			Oldest:       archive.Oldest,
+			Newest:       archive.Newest,
+			FlowsWritten: archive.FlowsWritten,
+			Pending:      archive.Pending,
+			Dropped:      archive.Dropped,
+			Deleted:      archive.Deleted,
+			LastError:    archive.LastError,
+		}
+	}
+
+	if dedup, ok := h.store.GetDedupStats(); ok {
+		response.Dedup = &DedupInfo{
+			Window:         dedup.Window.String(),
+			Tracked:        dedup.Tracked,
+			Duplicates:     dedup.Duplicates,
+			DuplicateBytes: dedup.DuplicateBytes,
+			Held:           dedup.Held,
+			Released:       dedup.Released,
+		}
+		for _, p := range dedup.Primary {
+			response.Dedup.Primary = append(response.Dedup.Primary, p.String())
+		}
+	}
+
+	if snapshot, ok := h.store.LastSnapshot(); ok {
+		info := snapshotInfo(snapshot)
+		response.Snapshot = &info
+	}
+
+	subscriptions := h.store.GetSubscriptionStats()
+	response.Subscriptions = make([]SubscriptionInfo, len(subscriptions))
+	for i, sub := range subscriptions {
+		response.Subscriptions[i] = SubscriptionInfo{
+			Name:      sub.Name,
+			Filter:    sub.Filter,
+			Created:   sub.Created,
+			Buffer:    sub.Buffer,
+			Queued:    sub.Queued,
+			Delivered: sub.Delivered,
+			Dropped:   sub.Dropped,
+		}
+	}
+
+	if history := h.store.History(); history != nil {
+		hs := history.Stats()
+		response.History = &HistoryInfo{
+			Path:         hs.Path,
+			FlowsWritten: hs.FlowsWritten,
+			Pending:      hs.Pending,
+			Dropped:      hs.Dropped,
+			Deleted:      hs.Deleted,
+			Oldest:       hs.Oldest,
+			LastError:    hs.LastError,
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// HandleExporters gibt Uhren-Offset und Drift pro Exporter zurück
+// from/to werden abgelehnt: Offset und Drift beschreiben den aktuellen Stand.
+func (h *Handlers) HandleExporters(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "Clock offset and drift describe the current state of each exporter") {
+		return
+	}
+	exporters := h.store.GetExporterStats()
+
+	response := ExportersResponse{
+		Exporters:       make([]ExporterClockInfo, 0, len(exporters)),
+		ClockCorrection: h.store.ClockCorrection(),
 		Generated:       time.Now(),
 	}
 
+	for _, exp := range exporters {
+		response.Exporters = append(response.Exporters, ExporterClockInfo{
+			IP:           exp.Address,
+			Flows:        exp.Flows,
+			Packets:      exp.Packets,
+			FirstSeen:    exp.FirstSeen,
+			LastSeen:     exp.LastSeen,
+			OffsetMs:     exp.Offset.Milliseconds(),
+			LastOffsetMs: exp.LastOffset.Milliseconds(),
+			DriftMsPerH:  exp.Drift,
+			Corrected:    exp.Corrected,
+		})
+	}
+
 	writeJSON(w, response)
 }
 
+// HandleSnapshot lädt einen Snapshot des Flow-Stores herunter (GET) oder
+// schreibt ihn in die konfigurierte Snapshot-Datei (POST)
+// from/to werden abgelehnt: ein Snapshot enthält immer den ganzen Store.
+func (h *Handlers) HandleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if rejectFlowTimeRange(w, r, "A snapshot always contains the whole store, use /api/v1/flows for a time range") {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		// Große Stores brauchen länger als das Server-WriteTimeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		name := fmt.Sprintf("flows-%s.nfsnap", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if _, err := h.store.WriteSnapshot(w); err != nil {
+			// Header sind bereits gesendet, die Verbindung bricht ab
+			fmt.Printf("API Snapshot Fehler: %v\n", err)
+		}
+
+	case http.MethodPost:
+		if h.store.SnapshotFile() == "" {
+			writeError(w, http.StatusServiceUnavailable, "Snapshots not enabled", "Start the collector with --snapshot-file")
+			return
+		}
+		info, err := h.store.SaveSnapshot()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Snapshot failed", err.Error())
+			return
+		}
+		writeJSON(w, snapshotInfo(info))
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "Use GET to download or POST to write a snapshot")
+	}
+}
+
+func snapshotInfo(info store.SnapshotInfo) SnapshotInfo {
+	return SnapshotInfo{
+		Path:       info.Path,
+		Created:    info.Created,
+		Flows:      info.Flows,
+		Bytes:      info.Bytes,
+		DurationMs: info.Duration.Milliseconds(),
+	}
+}
+
 // Helper functions
 
 func writeJSON(w http.ResponseWriter, data interface{}) {
@@ -534,7 +1389,10 @@ func convertIPtoService(flows []types.Flow, topN int) ([]SankeyNode, []SankeyLin
 
 	for i := range flows {
 		f := &flows[i]
-		service := resolver.GetServiceName(f.DstPort, f.Protocol)
+		service := f.AppName
+		if service == "" {
+			service = resolver.GetServiceName(f.DstPort, f.Protocol)
+		}
 		if service == "" {
 			service = resolver.GetServiceName(f.SrcPort, f.Protocol)
 		}
@@ -977,22 +1835,21 @@ func guessWANFromFlows(flows []types.Flow) uint16 {
 }
 
 // isPrivateIP checks if an IP is in a private range
-func isPrivateIP(ip net.IP) bool {
-	if ip == nil {
+func isPrivateIP(ip netip.Addr) bool {
+	if !ip.IsValid() {
 		return false
 	}
-	ip4 := ip.To4()
-	if ip4 == nil {
-		if len(ip) >= 1 {
-			if ip[0] == 0xfd {
-				return true
-			}
-			if ip[0] == 0xfe && len(ip) >= 2 && (ip[1]&0xc0) == 0x80 {
-				return true
-			}
+	if !ip.Is4() {
+		ip16 := ip.As16()
+		if ip16[0] == 0xfd {
+			return true
+		}
+		if ip16[0] == 0xfe && (ip16[1]&0xc0) == 0x80 {
+			return true
 		}
 		return false
 	}
+	ip4 := ip.As4()
 	if ip4[0] == 10 {
 		return true
 	}
@@ -1006,22 +1863,20 @@ func isPrivateIP(ip net.IP) bool {
 }
 
 // ipToSubnet converts an IP to its /24 (IPv4) or /64 (IPv6) subnet
-func ipToSubnet(ip net.IP) string {
-	if ip == nil {
+func ipToSubnet(ip netip.Addr) string {
+	if !ip.IsValid() {
 		return "unknown"
 	}
-	ip4 := ip.To4()
-	if ip4 != nil {
+	if ip.Is4() {
+		ip4 := ip.As4()
 		return fmt.Sprintf("%d.%d.%d.0/24", ip4[0], ip4[1], ip4[2])
 	}
-	if len(ip) >= 8 {
-		return fmt.Sprintf("%x:%x:%x:%x::/64",
-			uint16(ip[0])<<8|uint16(ip[1]),
-			uint16(ip[2])<<8|uint16(ip[3]),
-			uint16(ip[4])<<8|uint16(ip[5]),
-			uint16(ip[6])<<8|uint16(ip[7]))
-	}
-	return ip.String()
+	ip16 := ip.As16()
+	return fmt.Sprintf("%x:%x:%x:%x::/64",
+		uint16(ip16[0])<<8|uint16(ip16[1]),
+		uint16(ip16[2])<<8|uint16(ip16[3]),
+		uint16(ip16[4])<<8|uint16(ip16[5]),
+		uint16(ip16[6])<<8|uint16(ip16[7]))
 }
 
 // isSubnetPrivate checks if a subnet string represents a private network
@@ -1054,7 +1909,12 @@ func isSubnetPrivate(subnet string) bool {
 
 // HandleInterfaces gibt eine Liste aller bekannten Interfaces zurück, gruppiert nach Exporter
 func (h *Handlers) HandleInterfaces(w http.ResponseWriter, r *http.Request) {
-	flows := h.store.Query(nil, store.SortByBytes, false, 0)
+	from, to, err := parseFlowTimeRange(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range", err.Error())
+		return
+	}
+	flows := h.store.Query(withFlowTimeRange(nil, from, to), store.SortByBytes, false, 0)
 
 	// Interface-Statistiken pro Exporter sammeln
 	type ifStats struct {
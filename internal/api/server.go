@@ -3,7 +3,9 @@ package api
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"netflow-collector/internal/resolver"
@@ -31,8 +33,17 @@ func NewServerWithResolver(flowStore *store.FlowStore, port int, res *resolver.R
 	// API v1 Endpoints
 	mux.HandleFunc("/api/v1/sankey", corsMiddleware(handlers.HandleSankey))
 	mux.HandleFunc("/api/v1/flows", corsMiddleware(handlers.HandleFlows))
+	mux.HandleFunc("/api/v1/flows/stream", corsMiddleware(handlers.HandleFlowStream))
+	mux.HandleFunc("/api/v1/sessions", corsMiddleware(handlers.HandleSessions))
 	mux.HandleFunc("/api/v1/stats", corsMiddleware(handlers.HandleStats))
 	mux.HandleFunc("/api/v1/interfaces", corsMiddleware(handlers.HandleInterfaces))
+	mux.HandleFunc("/api/v1/exporters", corsMiddleware(handlers.HandleExporters))
+	mux.HandleFunc("/api/v1/history", corsMiddleware(handlers.HandleHistory))
+	mux.HandleFunc("/api/v1/timeseries", corsMiddleware(handlers.HandleTimeSeries))
+	mux.HandleFunc("/api/v1/heavyhitters", corsMiddleware(handlers.HandleHeavyHitters))
+	mux.HandleFunc("/api/v1/cardinality", corsMiddleware(handlers.HandleCardinality))
+	mux.HandleFunc("/api/v1/aggregate", corsMiddleware(handlers.HandleAggregate))
+	mux.HandleFunc("/api/v1/snapshot", corsMiddleware(handlers.HandleSnapshot))
 
 	// Health Check
 	mux.HandleFunc("/health", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -40,13 +51,18 @@ func NewServerWithResolver(flowStore *store.FlowStore, port int, res *resolver.R
 		w.Write([]byte("OK"))
 	}))
 
+	// Beim Stoppen laufende Streams beenden, Shutdown wartet sonst auf sie
+	ctx, cancel := context.WithCancel(context.Background())
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		Handler:      mux,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return ctx },
 	}
+	server.RegisterOnShutdown(cancel)
 
 	return &Server{
 		server:   server,
@@ -77,13 +93,25 @@ func (s *Server) Port() int {
 	return s.port
 }
 
-// corsMiddleware fügt CORS-Header für Cross-Origin-Anfragen hinzu
+// corsMiddleware fügt CORS-Header für Cross-Origin-Anfragen hinzu. Lesende
+// Anfragen sind von allen Origins erlaubt, schreibende (POST /api/v1/snapshot)
+// nur ohne Origin (curl, Skripte) oder vom selben Origin. Browser senden
+// einfache POST-Anfragen ohne Preflight, deshalb prüft der Server den Origin
+// selbst, statt sich auf die CORS-Header zu verlassen.
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Alle Origins für lokale Entwicklung erlauben
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			// Alle Origins für lokale Entwicklung erlauben
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
+		default:
+			if !sameOrigin(r) {
+				writeError(w, http.StatusForbidden, "Cross-origin request not allowed", "Only GET is allowed from other origins")
+				return
+			}
+		}
 
 		// Preflight-Anfragen behandeln
 		if r.Method == "OPTIONS" {
@@ -94,3 +122,13 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// sameOrigin meldet, ob die Anfrage keinen oder den eigenen Origin trägt
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
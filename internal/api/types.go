@@ -35,6 +35,7 @@ type SankeyData struct {
 
 // FlowResponse ist ein einzelner Flow für /api/v1/flows
 type FlowResponse struct {
+	Seq        uint64    `json:"seq,omitempty"` // Fortlaufende Nummer im Store, Cursor für die Paginierung
 	SrcAddr    string    `json:"srcAddr"`
 	DstAddr    string    `json:"dstAddr"`
 	SrcPort    uint16    `json:"srcPort"`
@@ -43,8 +44,34 @@ type FlowResponse struct {
 	Bytes      uint64    `json:"bytes"`
 	Packets    uint64    `json:"packets"`
 	Service    string    `json:"service,omitempty"`
+	AppID      string    `json:"appId,omitempty"`     // Application-ID vom Exporter (engine:selector)
+	AppName    string    `json:"appName,omitempty"`   // Applikationsname vom Exporter (NBAR, App-ID)
+	State      string    `json:"state,omitempty"`     // Verbindungszustand (completed, reset, half-open, ...)
+	EndReason  string    `json:"endReason,omitempty"` // flowEndReason vom Exporter
 	ReceivedAt time.Time `json:"receivedAt"`
 	Version    string    `json:"version"`
+
+	// NetFlow v8 Router-Aggregation (leer bei Einzel-Flows)
+	Aggregation string `json:"aggregation,omitempty"`
+	FlowCount   uint32 `json:"flowCount,omitempty"`
+
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	TimeImplausible bool      `json:"timeImplausible,omitempty"` // Zeitstempel passen nicht zu receivedAt
+
+	// Beobachtungspunkte, falls mehrere Exporter den Flow gemeldet haben (--dedup-window)
+	Observations []ObservationInfo `json:"observations,omitempty"`
+}
+
+// ObservationInfo beschreibt einen Exporter, der einen Flow gesehen hat
+type ObservationInfo struct {
+	Exporter  string    `json:"exporter"`
+	InputIf   uint16    `json:"inputIf"`
+	OutputIf  uint16    `json:"outputIf"`
+	Canonical bool      `json:"canonical"` // Gespeicherte Datensätze stammen von diesem Exporter
+	Flows     uint64    `json:"flows"`     // Empfangene Datensätze inkl. verworfener Duplikate
+	Bytes     uint64    `json:"bytes"`
+	LastSeen  time.Time `json:"lastSeen"`
 }
 
 // FlowsResponse ist die Antwort für /api/v1/flows
@@ -54,6 +81,133 @@ type FlowsResponse struct {
 	Filtered  int            `json:"filtered"`
 	Generated time.Time      `json:"generated"`
 	Filter    string         `json:"filter,omitempty"`
+
+	// Nur mit cursor: Cursor der nächsten Seite, weitere Flows vorhanden, zuletzt vergebene Nummer
+	NextCursor *uint64 `json:"nextCursor,omitempty"`
+	HasMore    bool    `json:"hasMore,omitempty"`
+	LatestSeq  uint64  `json:"latestSeq,omitempty"`
+}
+
+// SessionResponse ist eine aus mehreren Datensätzen zusammengefügte Sitzung.
+// startTime/endTime sind Beginn und Ende der Sitzung, bytes/packets die Summen.
+type SessionResponse struct {
+	FlowResponse
+	Exporter   string `json:"exporter"`
+	Records    int    `json:"records"`    // Zusammengefügte Datensätze
+	DurationMs int64  `json:"durationMs"` // Dauer der Sitzung
+}
+
+// SessionsResponse ist die Antwort für /api/v1/sessions
+type SessionsResponse struct {
+	Sessions  []SessionResponse `json:"sessions"`
+	Gap       string            `json:"gap"` // Maximale Pause zwischen zwei Datensätzen einer Sitzung
+	Generated time.Time         `json:"generated"`
+	Filter    string            `json:"filter,omitempty"`
+}
+
+// HistoryResponse ist die Antwort für /api/v1/history
+type HistoryResponse struct {
+	Flows     []FlowResponse `json:"flows"`
+	Count     int            `json:"count"`
+	From      time.Time      `json:"from,omitempty"`
+	To        time.Time      `json:"to,omitempty"`
+	Generated time.Time      `json:"generated"`
+	Filter    string         `json:"filter,omitempty"`
+}
+
+// TimeSeriesResponse ist die Antwort für /api/v1/timeseries
+type TimeSeriesResponse struct {
+	Tier      string           `json:"tier,omitempty"` // Verwendete Rollup-Stufe (10s, 1m, 5m, 1h)
+	StepSec   float64          `json:"stepSec"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	FromFlows bool             `json:"fromFlows"` // Filter auf Flow-Felder, aus gespeicherten Flows berechnet
+	FlowTime  bool             `json:"flowTime"`  // from/to: Zeitpunkte nach Flow-Start/-Ende statt Empfangszeit
+	Series    []TimeSeriesInfo `json:"series"`
+	Generated time.Time        `json:"generated"`
+	Filter    string           `json:"filter,omitempty"`
+}
+
+// TimeSeriesInfo ist eine Zeitreihe einer Gruppe
+type TimeSeriesInfo struct {
+	Labels  map[string]string `json:"labels"` // Gruppenwerte, z.B. {"exporter": "10.0.0.1"}
+	Bytes   uint64            `json:"bytes"`  // Summe über den Zeitraum
+	Packets uint64            `json:"packets"`
+	Flows   uint64            `json:"flows"`
+	Points  []TimePointInfo   `json:"points"`
+}
+
+// HeavyHittersResponse ist die Antwort für /api/v1/heavyhitters
+type HeavyHittersResponse struct {
+	Dimension    string            `json:"dimension"` // src, dst, conversation, port oder as
+	Window       string            `json:"window"`    // 1m, 5m, 15m oder 1h
+	From         time.Time         `json:"from"`      // Beginn des erfassten Zeitraums (Fenster plus laufender Abschnitt)
+	TotalBytes   uint64            `json:"totalBytes"`
+	TotalPackets uint64            `json:"totalPackets"`
+	TotalFlows   uint64            `json:"totalFlows"`
+	Hitters      []HeavyHitterInfo `json:"hitters"`
+	Generated    time.Time         `json:"generated"`
+}
+
+// HeavyHitterInfo ist ein Top-Talker; Bytes sind eine Schätzung aus Sketches
+type HeavyHitterInfo struct {
+	Key      string  `json:"key"`                // z.B. "10.0.0.1", "443/TCP", "AS64500"
+	Hostname string  `json:"hostname,omitempty"` // Nur src/dst, aus dem DNS-Cache
+	Service  string  `json:"service,omitempty"`  // Nur port
+	Filter   string  `json:"filter,omitempty"`   // Filter-Ausdruck für die Flows dieses Schlüssels
+	Bytes    uint64  `json:"bytes"`              // Obergrenze
+	Error    uint64  `json:"error"`              // Maximale Überschätzung: tatsächlich zwischen bytes-error und bytes
+	Packets  uint64  `json:"packets"`            // Untergrenze
+	Flows    uint64  `json:"flows"`              // Untergrenze
+	Share    float64 `json:"share"`              // Anteil am Gesamtvolumen in Prozent
+}
+
+// AggregateResponse ist die Antwort für /api/v1/aggregate
+type AggregateResponse struct {
+	GroupBy   []string           `json:"groupBy"` // Normalisierte Gruppenfelder, z.B. "src/24", "time/5m"
+	Metrics   []string           `json:"metrics"` // Normalisierte Metriken, z.B. "bytes", "p95(bytes)"
+	Matched   uint64             `json:"matched"` // Anzahl aggregierter Flow-Datensätze
+	Groups    int                `json:"groups"`  // Anzahl Gruppen vor dem Limit
+	Rows      []AggregateRowInfo `json:"rows"`
+	Total     map[string]float64 `json:"total"` // Metriken über alle passenden Flows
+	Generated time.Time          `json:"generated"`
+	Filter    string             `json:"filter,omitempty"`
+}
+
+// AggregateRowInfo ist eine Gruppe der Aggregation
+type AggregateRowInfo struct {
+	Keys   map[string]string  `json:"keys"`   // Gruppenwerte, z.B. {"src/24": "10.0.0.0/24", "dport": "443"}
+	Values map[string]float64 `json:"values"` // Metriken, z.B. {"bytes": 1234, "distinct(dst)": 17}
+}
+
+// CardinalityResponse ist die Antwort für /api/v1/cardinality
+type CardinalityResponse struct {
+	Dimension string            `json:"dimension"` // src, dst, interface oder exporter
+	Window    string            `json:"window"`    // 5m, 15m oder 1h
+	From      time.Time         `json:"from"`      // Beginn des erfassten Zeitraums (Fenster plus laufender Abschnitt)
+	Keys      int               `json:"keys"`      // Anzahl Schlüssel im Zeitraum
+	Skipped   uint64            `json:"skipped"`   // Wegen des Speicherlimits nicht gezählte Einträge
+	Entries   []CardinalityInfo `json:"entries"`
+	Generated time.Time         `json:"generated"`
+}
+
+// CardinalityInfo ist die geschätzte Anzahl unterschiedlicher Hosts eines Schlüssels
+type CardinalityInfo struct {
+	Key       string `json:"key"`                 // z.B. "10.0.0.1", "192.0.2.1 if 3 out"
+	Hostname  string `json:"hostname,omitempty"`  // Nur src/dst, aus dem DNS-Cache
+	Filter    string `json:"filter,omitempty"`    // Filter-Ausdruck für die Flows dieses Schlüssels
+	Exporter  string `json:"exporter,omitempty"`  // Nur interface/exporter
+	Interface uint16 `json:"interface,omitempty"` // Nur interface
+	Direction string `json:"direction,omitempty"` // Nur interface: "in" (Quellen) oder "out" (Ziele)
+	Distinct  uint64 `json:"distinct"`            // Geschätzte Anzahl unterschiedlicher Hosts (±3%)
+}
+
+// TimePointInfo ist ein Punkt einer Zeitreihe
+type TimePointInfo struct {
+	Time    time.Time `json:"time"`
+	Bytes   uint64    `json:"bytes"`
+	Packets uint64    `json:"packets"`
+	Flows   uint64    `json:"flows"`
 }
 
 // StatsResponse ist die Antwort für /api/v1/stats
@@ -66,10 +220,99 @@ type StatsResponse struct {
 	V5Flows         uint64    `json:"v5Flows"`
 	V9Flows         uint64    `json:"v9Flows"`
 	IPFIXFlows      uint64    `json:"ipfixFlows"`
+	LegacyFlows     uint64    `json:"legacyFlows"` // NetFlow v1, v7 und v8
 	UniqueExporters int       `json:"uniqueExporters"`
 	CurrentFlows    int       `json:"currentFlows"`
-	MaxFlows        int       `json:"maxFlows"`
+	MaxFlows        int       `json:"maxFlows"`            // Bei Speicherbudget aus der mittleren Flow-Größe geschätzt
+	MemoryBytes     int64     `json:"memoryBytes"`         // Geschätzter Speicherbedarf der Flows
+	MaxMemory       int64     `json:"maxMemory,omitempty"` // Speicherbudget (--max-memory)
+	MaxAge          string    `json:"maxAge,omitempty"`    // Retention (--max-age)
+	AgeEvicted      uint64    `json:"ageEvicted"`          // Durch max-age entfernte Flows
 	Generated       time.Time `json:"generated"`
+
+	Eviction EvictionInfo `json:"eviction"`
+	Archive  *ArchiveInfo `json:"archive,omitempty"` // Nur bei aktivem Archiv
+	History  *HistoryInfo `json:"history,omitempty"` // Nur bei aktiver SQLite-Historie
+	Dedup    *DedupInfo   `json:"dedup,omitempty"`   // Nur bei aktiver Deduplizierung
+
+	Snapshot *SnapshotInfo `json:"snapshot,omitempty"` // Zuletzt geschriebener oder geladener Snapshot
+
+	Subscriptions []SubscriptionInfo `json:"subscriptions"` // Aktive Live-Abonnements (z.B. /api/v1/flows/stream)
+}
+
+// DedupInfo beschreibt die Deduplizierung über Exporter hinweg
+type DedupInfo struct {
+	Window         string   `json:"window"`
+	Primary        []string `json:"primary,omitempty"` // Bevorzugte Exporter als präfix=exporter
+	Tracked        int      `json:"tracked"`           // Flows mit Dedup-Zustand
+	Duplicates     uint64   `json:"duplicates"`        // Als Duplikat verworfene Datensätze
+	DuplicateBytes uint64   `json:"duplicateBytes"`
+	Held           int      `json:"held"`     // Auf den primären Exporter wartende Datensätze
+	Released       uint64   `json:"released"` // Gespeichert, weil der primäre Exporter den Flow nicht gemeldet hat
+}
+
+// SubscriptionInfo beschreibt ein Live-Abonnement neuer Flows
+type SubscriptionInfo struct {
+	Name      string    `json:"name"`
+	Filter    string    `json:"filter,omitempty"`
+	Created   time.Time `json:"created"`
+	Buffer    int       `json:"buffer"`    // Puffergröße in Flows
+	Queued    int       `json:"queued"`    // Noch nicht abgeholte Flows
+	Delivered uint64    `json:"delivered"` // Zugestellte Flows
+	Dropped   uint64    `json:"dropped"`   // Verworfen, weil der Puffer voll war
+}
+
+// StreamDropped meldet im Flow-Stream verworfene Flows (Event "dropped")
+type StreamDropped struct {
+	Dropped uint64 `json:"dropped"` // Seit Beginn des Streams verworfene Flows
+}
+
+// SnapshotInfo beschreibt einen Snapshot des Flow-Stores
+type SnapshotInfo struct {
+	Path       string    `json:"path"`
+	Created    time.Time `json:"created"` // Zeitpunkt der Aufnahme
+	Flows      int       `json:"flows"`
+	Bytes      int64     `json:"bytes"`      // Dateigröße (komprimiert)
+	DurationMs int64     `json:"durationMs"` // Dauer zum Schreiben bzw. Laden
+}
+
+// EvictionInfo beschreibt die Verdrängung aus dem Speicher
+type EvictionInfo struct {
+	TotalEvicted uint64       `json:"totalEvicted"`
+	FIFOEvicted  uint64       `json:"fifoEvicted"` // Von keiner Policy geschützt
+	Policies     []PolicyInfo `json:"policies"`    // In Auswertungsreihenfolge, leer vor der ersten Verdrängung
+}
+
+// PolicyInfo enthält die Statistik einer Eviction-Policy
+type PolicyInfo struct {
+	Name      string `json:"name"`
+	Protected int    `json:"protected"` // Nach dem letzten Schritt geschützte Flows
+	Evicted   uint64 `json:"evicted"`   // Von der Policy entfernte Flows (age, max-age)
+}
+
+// HistoryInfo beschreibt die SQLite-Historie
+type HistoryInfo struct {
+	Path         string    `json:"path"`
+	FlowsWritten uint64    `json:"flowsWritten"`
+	Pending      int       `json:"pending"`          // Noch nicht geschriebene Flows
+	Dropped      uint64    `json:"dropped"`          // Verworfen weil die Datenbank nicht nachkam
+	Deleted      uint64    `json:"deleted"`          // Durch Retention gelöscht
+	Oldest       time.Time `json:"oldest,omitempty"` // Empfangszeit des ältesten Flows
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// ArchiveInfo beschreibt das Flow-Archiv auf der Festplatte
+type ArchiveInfo struct {
+	Dir          string    `json:"dir"`
+	Segments     int       `json:"segments"`
+	Bytes        int64     `json:"bytes"`
+	Oldest       time.Time `json:"oldest,omitempty"` // Beginn des ältesten Segments
+	Newest       time.Time `json:"newest,omitempty"` // Beginn des neuesten Segments
+	FlowsWritten uint64    `json:"flowsWritten"`     // Seit dem Start archivierte Flows
+	Pending      int       `json:"pending"`          // Noch nicht geschriebene Flows (auch nach Schreibfehlern)
+	Dropped      uint64    `json:"dropped"`          // Nach wiederholten Schreibfehlern verworfen
+	Deleted      int       `json:"deleted"`          // Durch Retention gelöschte Segmente
+	LastError    string    `json:"lastError,omitempty"`
 }
 
 // ErrorResponse wird bei Fehlern zurückgegeben
@@ -100,6 +343,26 @@ type ExporterInfo struct {
 	WanID      uint16          `json:"wanId"` // WAN-Interface dieses Exporters
 }
 
+// ExporterClockInfo beschreibt die Uhr eines Exporters relativ zum Collector
+type ExporterClockInfo struct {
+	IP           string    `json:"ip"`
+	Flows        uint64    `json:"flows"`
+	Packets      uint64    `json:"packets"` // Export-Pakete (unterschiedliche Header-Zeiten)
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+	OffsetMs     int64     `json:"offsetMs"`       // Geglätteter Offset (positiv = Exporter-Uhr geht vor)
+	LastOffsetMs int64     `json:"lastOffsetMs"`   // Offset des letzten Pakets
+	DriftMsPerH  float64   `json:"driftMsPerHour"` // Änderung des Offsets pro Stunde
+	Corrected    bool      `json:"corrected"`      // Flow-Zeiten werden um -offsetMs korrigiert
+}
+
+// ExportersResponse ist die Antwort für /api/v1/exporters
+type ExportersResponse struct {
+	Exporters       []ExporterClockInfo `json:"exporters"`
+	ClockCorrection bool                `json:"clockCorrection"` // Korrektur aktiviert (--clock-correct)
+	Generated       time.Time           `json:"generated"`
+}
+
 // InterfacesResponse ist die Antwort für /api/v1/interfaces
 type InterfacesResponse struct {
 	Exporters  []ExporterInfo  `json:"exporters"`            // Gruppiert nach Exporter
@@ -111,6 +374,7 @@ type InterfacesResponse struct {
 // FlowToResponse konvertiert einen types.Flow zu FlowResponse
 func FlowToResponse(f *types.Flow, serviceName string) FlowResponse {
 	return FlowResponse{
+		Seq:        f.Seq,
 		SrcAddr:    f.SrcAddr.String(),
 		DstAddr:    f.DstAddr.String(),
 		SrcPort:    f.SrcPort,
@@ -119,7 +383,42 @@ func FlowToResponse(f *types.Flow, serviceName string) FlowResponse {
 		Bytes:      f.Bytes,
 		Packets:    f.Packets,
 		Service:    serviceName,
+		AppID:      f.AppID.String(),
+		AppName:    f.AppName,
+		State:      stateString(f.State()),
+		EndReason:  endReasonString(f.EndReason),
 		ReceivedAt: f.ReceivedAt,
 		Version:    f.Version.String(),
+
+		Aggregation: aggregationString(f.Aggregation),
+		FlowCount:   f.FlowCount,
+
+		StartTime:       f.StartTime,
+		EndTime:         f.EndTime,
+		TimeImplausible: f.TimeImplausible,
+	}
+}
+
+// stateString returns the connection state, empty if unknown
+func stateString(s types.FlowState) string {
+	if s == types.StateUnknown {
+		return ""
+	}
+	return s.String()
+}
+
+// aggregationString returns the v8 aggregation scheme, empty for single flows
+func aggregationString(a types.Aggregation) string {
+	if a == types.AggregationNone {
+		return ""
+	}
+	return a.String()
+}
+
+// endReasonString returns the flow end reason, empty if not exported
+func endReasonString(r types.EndReason) string {
+	if r == types.EndReasonUnknown {
+		return ""
 	}
+	return r.String()
 }
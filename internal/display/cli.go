@@ -272,6 +272,7 @@ func (c *CLI) renderDetailedStats() {
 	fmt.Println()
 	fmt.Printf("Unique Exporters:        %d\n", stats.UniqueExporters)
 	fmt.Printf("Flows in Memory:         %d\n", c.store.GetFlowCount())
+	fmt.Printf("Memory (estimated):      %s\n", formatBytes(uint64(c.store.GetMemoryUsage())))
 }
 
 func (c *CLI) renderFooter(width int) {
@@ -1,7 +1,7 @@
 package display
 
 import (
-	"net"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -77,7 +77,7 @@ type TUI struct {
 	// Interface statistics page
 	interfaceTable      *tview.Table
 	interfaceLayout     *tview.Flex
-	currentPage         int                            // 0 = flows, 1 = interfaces, 2 = services
+	currentPage         int                            // 0 = flows, 1 = interfaces, 2 = services, 3 = exporters, 4 = talkers
 	interfaceStats      map[InterfaceKey]*InterfaceStats // Cumulative interface statistics (by ID+direction)
 	lastInterfaceUpdate time.Time                      // Track when we last updated stats
 	selectedInterfaces  map[InterfaceKey]bool          // Interfaces marked with Space for filtering
@@ -89,6 +89,18 @@ type TUI struct {
 	serviceSortAsc      bool
 	currentServiceStats []*ServiceStats
 
+	// Exporter page (clock offset/drift)
+	exporterTable    *tview.Table
+	exporterLayout   *tview.Flex
+	currentExporters []store.ExporterStats
+
+	// Top talkers page (heavy-hitter sketches)
+	talkerTable     *tview.Table
+	talkerLayout    *tview.Flex
+	talkerDimension int // Index into store.HeavyHitterDimensions
+	talkerWindow    int // Index into store.DefaultHeavyHitterWindows
+	currentTalkers  []store.HeavyHitter
+
 	// IP detail modal state
 	ipDetailTable    *tview.Table
 	ipDetailIfaceKey InterfaceKey
@@ -105,7 +117,9 @@ type TUI struct {
 	showVersion  bool           // Version column hidden by default
 	dnsMode      DNSDisplayMode // DNS display mode (Off, All, Reverse, Technitium, mDNS)
 	showService  bool           // Show service names for ports
-	filterActive bool // Is filter input focused
+	filterActive bool           // Is filter input focused
+	timeFrom     time.Time      // Absolute time range on flow start/end (zero = open)
+	timeTo       time.Time
 	refreshRate  time.Duration
 	stopChan     chan struct{}
 
@@ -122,8 +136,8 @@ type TUI struct {
 	currentConversations []types.Conversation
 
 	// Detail view state
-	detailFlowKey    string // FlowKey of flow being shown in detail
-	detailConvKey    string // ConversationKey being shown in detail
+	detailFlowKey    types.FlowKey         // FlowKey of flow being shown in detail (zero if none)
+	detailConvKey    types.ConversationKey // ConversationKey being shown in detail (zero if none)
 	convDetailLeft   *tview.TextView
 	convDetailRight  *tview.TextView
 	convDetailBottom *tview.TextView
@@ -134,6 +148,12 @@ type TUI struct {
 	// Flow aggregation (merge flows with same 5-tuple)
 	aggregateFlows bool
 
+	// Session stitching (join contiguous records of long-lived flows), takes
+	// precedence over aggregation
+	sessionFlows       bool
+	currentSessions    []store.Session
+	detailSessionStart time.Time // Start of the session shown in detail (session mode only)
+
 	// Own IPv6 prefix (learned from flow data - most common prefix)
 	ownIPv6Prefix  string                     // Our prefix (e.g. /56)
 	ownPrefixLen   int                        // Configured prefix length (default 56)
@@ -262,11 +282,29 @@ func (t *TUI) setupUI() {
 		AddItem(serviceTopRow, 7, 0, false).
 		AddItem(t.serviceTable, 0, 1, true)
 
+	// Exporter table and layout (Exporters page)
+	t.setupExporterTable()
+	exporterTopRow := tview.NewFlex().
+		AddItem(t.statsView, 0, 1, false)
+	t.exporterLayout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(exporterTopRow, 5, 0, false).
+		AddItem(t.exporterTable, 0, 1, true)
+
+	// Top talkers table and layout (Top Talkers page)
+	t.setupTalkerTable()
+	talkerTopRow := tview.NewFlex().
+		AddItem(t.statsView, 0, 1, false)
+	t.talkerLayout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(talkerTopRow, 5, 0, false).
+		AddItem(t.talkerTable, 0, 1, true)
+
 	// Pages for page switching and overlay support
 	t.pages = tview.NewPages().
 		AddPage("flows", t.layout, true, true).
 		AddPage("interfaces", t.interfaceLayout, true, false).
-		AddPage("services", t.serviceLayout, true, false)
+		AddPage("services", t.serviceLayout, true, false).
+		AddPage("exporters", t.exporterLayout, true, false).
+		AddPage("talkers", t.talkerLayout, true, false)
 
 	// Setup table headers
 	t.setupTableHeaders()
@@ -383,6 +421,9 @@ func (t *TUI) setupKeyBindings() {
 			case 'a':
 				t.aggregateFlows = !t.aggregateFlows
 				return nil
+			case 's':
+				t.sessionFlows = !t.sessionFlows
+				return nil
 			case 'c':
 				t.filter = store.Filter{}
 				t.filterInput.SetText("")
@@ -390,6 +431,9 @@ func (t *TUI) setupKeyBindings() {
 			case 'f':
 				t.app.SetFocus(t.filterInput)
 				return nil
+			case 't':
+				t.showTimeRangePicker()
+				return nil
 			}
 		}
 		return event
@@ -401,7 +445,7 @@ func (t *TUI) setupKeyBindings() {
 			t.app.Stop()
 			return nil
 		}
-		// F1/F2/F3 switch pages
+		// F1-F5 switch pages
 		if event.Key() == tcell.KeyF1 {
 			t.switchToPage(0)
 			return nil
@@ -414,6 +458,14 @@ func (t *TUI) setupKeyBindings() {
 			t.switchToPage(2)
 			return nil
 		}
+		if event.Key() == tcell.KeyF4 {
+			t.switchToPage(3)
+			return nil
+		}
+		if event.Key() == tcell.KeyF5 {
+			t.switchToPage(4)
+			return nil
+		}
 		// F12 toggles BiFlow mode
 		if event.Key() == tcell.KeyF12 {
 			t.biflowMode = !t.biflowMode
@@ -426,7 +478,7 @@ func (t *TUI) setupKeyBindings() {
 	})
 }
 
-// switchToPage switches to the specified page (0=flows, 1=interfaces, 2=services)
+// switchToPage switches to the specified page (0=flows, 1=interfaces, 2=services, 3=exporters, 4=talkers)
 func (t *TUI) switchToPage(page int) {
 	if t.currentPage == page {
 		return
@@ -442,6 +494,13 @@ func (t *TUI) switchToPage(page int) {
 	case 2:
 		t.pages.SwitchToPage("services")
 		t.app.SetFocus(t.serviceTable)
+	case 3:
+		t.pages.SwitchToPage("exporters")
+		t.app.SetFocus(t.exporterTable)
+	case 4:
+		t.pages.SwitchToPage("talkers")
+		t.app.SetFocus(t.talkerTable)
+		t.updateTalkerTable()
 	}
 }
 
@@ -454,9 +513,9 @@ type columnDef struct {
 
 // updateTableTitle updates the flow table title based on current mode
 func (t *TUI) updateTableTitle() {
-	title := " Flows [F2=Interfaces] [F3=Services] [F12=BiFlow] "
+	title := " Flows [F2=Interfaces] [F3=Services] [F4=Exporters] [F5=Talkers] [F12=BiFlow] "
 	if t.biflowMode {
-		title = " BiFlow [F2=Interfaces] [F3=Services] [F12=Flows] "
+		title = " BiFlow [F2=Interfaces] [F3=Services] [F4=Exporters] [F5=Talkers] [F12=Flows] "
 	}
 	t.table.SetTitle(title)
 }
@@ -497,8 +556,9 @@ func (t *TUI) getColumns() []columnDef {
 		columnDef{protoCol, 8, false},      // 3
 		columnDef{"Bytes", 8, false},       // 4
 		columnDef{"Packets", 7, false},     // 5
-		columnDef{"Time", 8, false},        // 6
-		columnDef{"Age", 6, false},         // 7
+		columnDef{"State", 9, false},       // 6
+		columnDef{"Time", 8, false},        // 7
+		columnDef{"Age", 6, false},         // 8
 	)
 	return cols
 }
@@ -628,6 +688,16 @@ func (t *TUI) refresh() {
 		t.updateServiceTable()
 	}
 
+	// Update exporter table display if on that page
+	if t.currentPage == 3 {
+		t.updateExporterTable()
+	}
+
+	// Update top talkers display if on that page
+	if t.currentPage == 4 {
+		t.updateTalkerTable()
+	}
+
 	// Update IP detail modal if visible
 	if t.ipDetailVisible {
 		t.updateIPDetailTable()
@@ -670,8 +740,8 @@ func (t *TUI) Stop() {
 
 // isInternalIP checks if an IP is "internal" - either a private IP or
 // belongs to our own IPv6 prefix (fetched from external service)
-func (t *TUI) isInternalIP(ip net.IP) bool {
-	if ip == nil {
+func (t *TUI) isInternalIP(ip netip.Addr) bool {
+	if !ip.IsValid() {
 		return false
 	}
 
@@ -681,7 +751,7 @@ func (t *TUI) isInternalIP(ip net.IP) bool {
 	}
 
 	// For IPv6, check if it matches our own prefix
-	if ip.To4() == nil && t.ownIPv6Prefix != "" {
+	if !ip.Is4() && t.ownIPv6Prefix != "" {
 		if ipMatchesPrefix(ip, t.ownIPv6Prefix) {
 			return true
 		}
@@ -691,8 +761,8 @@ func (t *TUI) isInternalIP(ip net.IP) bool {
 }
 
 // learnIPv6Prefix records an IPv6 address and updates the most common prefix
-func (t *TUI) learnIPv6Prefix(ip net.IP) {
-	if ip == nil || ip.To4() != nil {
+func (t *TUI) learnIPv6Prefix(ip netip.Addr) {
+	if !ip.IsValid() || ip.Is4() {
 		return // Only IPv6
 	}
 	if isPrivateIP(ip) {
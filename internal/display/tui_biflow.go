@@ -22,7 +22,7 @@ func (t *TUI) showConversationDetail() {
 	conv := t.currentConversations[row-1]
 	t.showDetail = true
 	t.detailConvKey = conv.Key()
-	t.detailFlowKey = "" // Clear flow key
+	t.detailFlowKey = types.FlowKey{} // Clear flow key
 
 	// Create reusable views if not already created
 	if t.convDetailLeft == nil {
@@ -147,7 +147,7 @@ func (t *TUI) updateConversationDetailContent(conv *types.Conversation) {
 // updateTableBiFlow updates the table with conversation/biflow data
 func (t *TUI) updateTableBiFlow() {
 	// Get conversations with current filter and sort
-	conversations := t.store.QueryConversations(&t.filter, t.sortField, t.sortAsc, 1000)
+	conversations := t.store.QueryConversations(t.queryFilter(), t.sortField, t.sortAsc, 1000)
 
 	// Save for detail view access
 	t.currentConversations = conversations
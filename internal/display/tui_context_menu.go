@@ -188,7 +188,7 @@ func (t *TUI) buildContextMenuItems(flow types.Flow) []ContextMenuItem {
 	})
 
 	// Source hostname (if resolved)
-	if srcHostname, _, found := t.resolver.GetCachedWithSource(flow.SrcAddr); found {
+	if srcHostname, _, found := t.resolver.GetCachedWithSource(net.IP(flow.SrcAddr.AsSlice())); found {
 		items = append(items, ContextMenuItem{
 			Label: fmt.Sprintf("Src Host: %s", truncateForMenu(srcHostname, 28)),
 			Value: srcHostname,
@@ -212,7 +212,7 @@ func (t *TUI) buildContextMenuItems(flow types.Flow) []ContextMenuItem {
 	})
 
 	// Destination hostname (if resolved)
-	if dstHostname, _, found := t.resolver.GetCachedWithSource(flow.DstAddr); found {
+	if dstHostname, _, found := t.resolver.GetCachedWithSource(net.IP(flow.DstAddr.AsSlice())); found {
 		items = append(items, ContextMenuItem{
 			Label: fmt.Sprintf("Dst Host: %s", truncateForMenu(dstHostname, 28)),
 			Value: dstHostname,
@@ -0,0 +1,117 @@
+package display
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"netflow-collector/internal/store"
+)
+
+// setupExporterTable initializes the exporter table (clock offset and drift per exporter)
+func (t *TUI) setupExporterTable() {
+	t.exporterTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	t.exporterTable.SetBorder(true).SetTitle(" Exporters [F1=Flows] [F2=Interfaces] [F3=Services] [F5=Talkers] [Enter=Filter] ")
+
+	headers := []string{"Exporter", "Flows", "Packets", "Clock Offset", "Last Offset", "Drift/h", "Last Seen", "Correction"}
+	for i, h := range headers {
+		cell := tview.NewTableCell(h).
+			SetTextColor(tcell.ColorYellow).
+			SetSelectable(false).
+			SetAlign(tview.AlignLeft)
+		if i >= 1 && i <= 6 { // Right-align numeric columns
+			cell.SetAlign(tview.AlignRight)
+		}
+		t.exporterTable.SetCell(0, i, cell)
+	}
+
+	t.exporterTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case ' ':
+				t.paused = !t.paused
+				return nil
+			case 'q':
+				t.app.Stop()
+				return nil
+			}
+		case tcell.KeyEnter:
+			// Show flows of the selected exporter
+			row, _ := t.exporterTable.GetSelection()
+			if row > 0 && row <= len(t.currentExporters) {
+				t.filterInput.SetText("exporter=" + t.currentExporters[row-1].Address)
+				t.applyFilter()
+				t.switchToPage(0)
+				return nil
+			}
+		}
+		return event
+	})
+}
+
+// updateExporterTable updates the exporter table with current clock statistics
+func (t *TUI) updateExporterTable() {
+	if t.paused {
+		return
+	}
+
+	exporters := t.store.GetExporterStats()
+	t.currentExporters = exporters
+	correcting := t.store.ClockCorrection()
+
+	// Clear old rows (keep header)
+	for row := t.exporterTable.GetRowCount() - 1; row > 0; row-- {
+		t.exporterTable.RemoveRow(row)
+	}
+
+	now := time.Now()
+	for i, exp := range exporters {
+		row := i + 1
+
+		correction := "[gray]off[white]"
+		if correcting {
+			correction = "[gray]-[white]"
+			if exp.Corrected {
+				correction = fmt.Sprintf("[yellow]%s[white]", formatOffset(-exp.Offset))
+			}
+		}
+
+		t.exporterTable.SetCell(row, 0, tview.NewTableCell(exp.Address).SetTextColor(tcell.ColorAqua).SetExpansion(1))
+		t.exporterTable.SetCell(row, 1, tview.NewTableCell(formatNumber(int(exp.Flows))).SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 2, tview.NewTableCell(formatNumber(int(exp.Packets))).SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 3, tview.NewTableCell(formatOffset(exp.Offset)).SetTextColor(offsetColor(exp.Offset)).SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 4, tview.NewTableCell(formatOffset(exp.LastOffset)).SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%+.0f ms", exp.Drift)).SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 6, tview.NewTableCell(formatAge(now.Sub(exp.LastSeen))+" ago").SetAlign(tview.AlignRight))
+		t.exporterTable.SetCell(row, 7, tview.NewTableCell(correction))
+	}
+}
+
+// formatOffset formats a clock offset with sign, e.g. "+3.2s" or "-120ms"
+func formatOffset(d time.Duration) string {
+	if d > -time.Second && d < time.Second {
+		return fmt.Sprintf("%+dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%+.1fs", d.Seconds())
+}
+
+// offsetColor highlights offsets that are large enough to be corrected
+func offsetColor(d time.Duration) tcell.Color {
+	if d < 0 {
+		d = -d
+	}
+	switch {
+	case d >= time.Minute:
+		return tcell.ColorRed
+	case d >= store.MinClockCorrection:
+		return tcell.ColorYellow
+	default:
+		return tcell.ColorGreen
+	}
+}
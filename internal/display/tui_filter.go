@@ -136,6 +136,17 @@ func (t *TUI) getFilterSuggestions(currentText string) []string {
 	// Always include current text as first option (so Enter preserves what user typed)
 	suggestions = append(suggestions, currentText)
 
+	// Inside an unclosed set "field in {a, b": complete the last member
+	if field, head, member, ok := openSetMember(currentText); ok {
+		for _, v := range t.getFieldValueSuggestions(field, member) {
+			suggestions = append(suggestions, head+v)
+		}
+		if member != "" {
+			suggestions = append(suggestions, currentText+"}")
+		}
+		return dedupSuggestions(suggestions)
+	}
+
 	// Parse input to understand context
 	words := strings.Fields(currentText)
 	if len(words) == 0 {
@@ -173,38 +184,33 @@ func (t *TUI) getFilterSuggestions(currentText string) []string {
 		}
 	}
 
-	// Check if we're completing a field value (after = or :)
-	if strings.Contains(fieldPart, "=") || strings.Contains(fieldPart, ":") {
-		// Split on = or :
-		var parts []string
-		var sep string
-		if strings.Contains(fieldPart, "=") {
-			parts = strings.SplitN(fieldPart, "=", 2)
-			sep = "="
-		} else {
-			parts = strings.SplitN(fieldPart, ":", 2)
-			sep = ":"
-		}
-
-		if len(parts) == 2 {
-			field := parts[0]
-			valuePart := parts[1]
-
-			values := t.getFieldValueSuggestions(field, valuePart)
-			for _, v := range values {
-				suggestion := existingText + negationPrefix + field + sep + v
-				if suggestion != currentText {
-					suggestions = append(suggestions, suggestion)
-				}
+	// Check if we're completing a field value (after =, :, != or a comparison)
+	if field, sep, valuePart, ok := store.SplitCondition(fieldPart); ok {
+		values := t.getFieldValueSuggestions(field, valuePart)
+		for _, v := range values {
+			suggestion := existingText + negationPrefix + field + sep + v
+			if suggestion != currentText {
+				suggestions = append(suggestions, suggestion)
 			}
 		}
 	} else {
+		// Numeric field typed completely: offer the comparisons
+		if store.NumericFields[fieldPart] {
+			for _, op := range []string{">", ">=", "<", "<=", "="} {
+				suggestions = append(suggestions, existingText+negationPrefix+fieldPart+op)
+			}
+		}
+		if store.SetFields[fieldPart] {
+			suggestions = append(suggestions, existingText+negationPrefix+fieldPart+" in {")
+		}
+
 		// Suggest field names
 		fieldNames := []string{
-			"src=", "dst=", "ip=", "host=",
+			"src=", "dst=", "ip=", "ip~", "host=",
 			"port:", "srcport:", "dstport:",
-			"proto=", "service=", "svc=",
-			"if=", "inif=", "outif=",
+			"proto=", "service=", "svc=", "app=", "state=",
+			"if=", "inif=", "outif=", "exporter=",
+			"bytes>", "packets<", "duration>", "bps>", "srcas=", "dstas=",
 		}
 
 		for _, f := range fieldNames {
@@ -235,7 +241,37 @@ func (t *TUI) getFilterSuggestions(currentText string) []string {
 		}
 	}
 
-	// Deduplicate and limit
+	return dedupSuggestions(suggestions)
+}
+
+// openSetMember finds an unclosed set at the end of the filter text and returns
+// its field, the text up to the last member and the member typed so far
+func openSetMember(text string) (field, head, member string, ok bool) {
+	open := strings.LastIndexByte(text, '{')
+	if open < 0 || strings.ContainsRune(text[open:], '}') {
+		return "", "", "", false
+	}
+	words := strings.Fields(text[:open])
+	if len(words) < 2 || !strings.EqualFold(words[len(words)-1], "in") {
+		return "", "", "", false
+	}
+	field = strings.ToLower(strings.TrimLeft(words[len(words)-2], "!-("))
+	if !store.SetFields[field] {
+		return "", "", "", false
+	}
+	start := open + 1
+	if comma := strings.LastIndexByte(text, ','); comma > open {
+		start = comma + 1
+	}
+	for start < len(text) && text[start] == ' ' {
+		start++
+	}
+	return field, text[:start], text[start:], true
+}
+
+// dedupSuggestions removes duplicates and limits the suggestions, nil if only
+// the current text is left
+func dedupSuggestions(suggestions []string) []string {
 	seen := make(map[string]bool)
 	unique := []string{}
 	for _, s := range suggestions {
@@ -280,6 +316,23 @@ func (t *TUI) getFieldValueSuggestions(field, valuePart string) []string {
 			}
 		}
 
+	case "state":
+		states := []string{"completed", "reset", "half-open", "idle-timeout", "active-timeout"}
+		for _, st := range states {
+			if valuePart == "" || strings.HasPrefix(st, valuePart) {
+				values = append(values, st)
+			}
+		}
+
+	case "app", "application":
+		// Get exporter-reported applications from current flows
+		apps := t.getSeenApps()
+		for _, a := range apps {
+			if valuePart == "" || strings.HasPrefix(strings.ToLower(a), valuePart) {
+				values = append(values, a)
+			}
+		}
+
 	case "port", "srcport", "dstport":
 		// Get ports from current flows
 		ports := t.getSeenPorts()
@@ -298,6 +351,35 @@ func (t *TUI) getFieldValueSuggestions(field, valuePart string) []string {
 			}
 		}
 
+	case "exporter", "exp":
+		for _, exp := range t.store.GetExporterStats() {
+			if valuePart == "" || strings.HasPrefix(exp.Address, valuePart) {
+				values = append(values, exp.Address)
+			}
+		}
+
+	case "bytes", "bps":
+		// Typical magnitudes (k/M/G = 1000, 1000², 1000³)
+		for _, v := range []string{"1k", "100k", "1M", "10M", "100M", "1G"} {
+			if valuePart == "" || strings.HasPrefix(strings.ToLower(v), valuePart) {
+				values = append(values, v)
+			}
+		}
+
+	case "packets", "pkts":
+		for _, v := range []string{"1", "3", "10", "100", "1k"} {
+			if valuePart == "" || strings.HasPrefix(v, valuePart) {
+				values = append(values, v)
+			}
+		}
+
+	case "duration", "dur":
+		for _, v := range []string{"100ms", "1s", "10s", "1m", "5m", "1h"} {
+			if valuePart == "" || strings.HasPrefix(v, valuePart) {
+				values = append(values, v)
+			}
+		}
+
 	case "if", "inif", "outif":
 		// Get interfaces from current flows
 		ifaces := t.getSeenInterfaces()
@@ -324,12 +406,12 @@ func (t *TUI) updateFilterView() {
 	}
 
 	// Update filter input label with status
-	if t.filter.String() != "" {
+	if t.filter.String() != "" || t.formatTimeRange() != "" {
 		if !t.filter.IsValid() {
 			t.filterInput.SetLabel(" Filter [ERR]: ")
 			t.filterInput.SetLabelColor(tcell.ColorRed)
 		} else {
-			matchCount := t.store.GetFilteredCount(&t.filter)
+			matchCount := t.store.GetFilteredCount(t.queryFilter())
 			if matchCount == 0 {
 				t.filterInput.SetLabel(" Filter [0]: ")
 				t.filterInput.SetLabelColor(tcell.ColorYellow)
@@ -365,10 +447,14 @@ func (t *TUI) updateFilterView() {
 	if t.aggregateFlows {
 		aggStatus = "[green]on[white]"
 	}
+	sessStatus := "[gray]off[white]"
+	if t.sessionFlows {
+		sessStatus = "[green]on[white]"
+	}
 
 	// Shortcuts hint
 	sortLine := "[gray]1[white]=src [gray]2[white]=dst [gray]3[white]=proto [gray]4[white]=bytes [gray]5[white]=pkts [gray]6[white]=time [gray]r[white]=rev"
-	optionsLine := "[gray]n[white]=dns:%s [gray]e[white]=svc:%s [gray]a[white]=agg:%s [gray]v[white]=ver [gray]c[white]=clear"
+	optionsLine := "[gray]n[white]=dns:%s [gray]e[white]=svc:%s [gray]a[white]=agg:%s [gray]s[white]=sess:%s [gray]v[white]=ver [gray]t[white]=time [gray]c[white]=clear"
 
 	text := fmt.Sprintf(
 		"[yellow]Sort:[white] %s %s\n%s\n"+optionsLine,
@@ -378,7 +464,11 @@ func (t *TUI) updateFilterView() {
 		dnsStatus,
 		svcStatus,
 		aggStatus,
+		sessStatus,
 	)
+	if timeRange := t.formatTimeRange(); timeRange != "" {
+		text += "\n[yellow]Time:[white] " + timeRange
+	}
 	t.filterView.SetText(text)
 }
 
@@ -402,14 +492,26 @@ func (t *TUI) getHelpText() string {
   Enter           Apply filter
   Esc             Return to table
   c               Clear filter
+  t               Time range on flow start/end
 
 [green]Filter Syntax:[white]
-  src=192.168     Source IP contains
-  dst=10.0        Dest IP contains
-  ip=8.8          Either src or dst
+  src=10.0.0.1    Source IP (exact)
+  dst=10.0.0.0/8  Dest IP in prefix
+  ip=8.8.8.8      Either src or dst
+  src=10.0.0.5-10.0.0.50  Address range
+  src=10.*.0.1    Wildcard per octet
+  ip~192.168      Address contains (text)
   port:443        Either port
+  port<1024       Comparisons: < <= > >= on ports, if,
+                  bytes, packets, duration, bps, srcas/dstas
+  bytes>1M        Units k/M/G; duration>5m (ms/s/m/h)
   proto=tcp       Protocol
   service=https   Service name
+  app=ms-teams    Application (NBAR/App-ID)
+  state=reset     Connection state
+  exporter=10.0.0.1  Exporter IP
+  port in {80,443,8000-8999}  Set with ranges (ports, if,
+                  proto, srcas/dstas, addresses and prefixes)
 
 [green]Filter Operators:[white]
   && or space     AND
@@ -418,13 +520,17 @@ func (t *TUI) getHelpText() string {
   ( )             Grouping
 
 [green]Examples:[white]
-  src=192.168 proto=tcp
+  src=192.168.0.0/16 proto=tcp
   port:80 || port:443
   !src=10.0.0.1 && service=dns
+  proto in {tcp,udp} ip in {10.0.0.0/8, 192.168.0.0/16}
 
 [green]Pages:[white]
   F1              Flow table
   F2              Interface statistics
+  F3              Service statistics
+  F4              Exporters and clock offset
+  F5              Top talkers (src, dst, conversation, port, AS)
   F12             Toggle BiFlow mode
 
 [green]Display:[white]
@@ -432,6 +538,7 @@ func (t *TUI) getHelpText() string {
   e               Toggle service names
   v               Toggle version column
   a               Toggle flow aggregation
+  s               Toggle session stitching
   Space           Pause/Resume
   ?               This help
   q               Quit
@@ -478,6 +585,17 @@ func (t *TUI) toggleSort(field store.SortField) {
 	t.setupTableHeaders()
 }
 
+// policyLabels are the short eviction policy names in the status bar
+var policyLabels = map[string]string{
+	"topk":    "TopK",
+	"lru":     "LRU",
+	"watch":   "Watch",
+	"pin":     "Pin",
+	"sample":  "Sample",
+	"age":     "Age",
+	"max-age": "MaxAge",
+}
+
 // updateStats updates the statistics display
 func (t *TUI) updateStats() {
 	stats := t.store.GetStats()
@@ -503,6 +621,10 @@ func (t *TUI) updateStats() {
 		versionParts = append(versionParts, fmt.Sprintf("IPFIX:%d", stats.IPFIXFlows))
 		versionCount++
 	}
+	if stats.LegacyFlows > 0 {
+		versionParts = append(versionParts, fmt.Sprintf("v1/7/8:%d", stats.LegacyFlows))
+		versionCount++
+	}
 
 	versionText := "[gray]none[white]"
 	if len(versionParts) > 0 {
@@ -533,9 +655,15 @@ func (t *TUI) updateStats() {
 	flowCount := t.store.GetFlowCount()
 	maxFlows := t.store.GetMaxFlows()
 	memText := fmt.Sprintf("%s/%s", formatNumber(flowCount), formatNumber(maxFlows))
-	if flowCount >= maxFlows {
+	usage := float64(flowCount) / float64(max(maxFlows, 1))
+	if maxMemory := t.store.GetEvictionConfig().MaxMemory; maxMemory > 0 {
+		memory := t.store.GetMemoryUsage()
+		memText += fmt.Sprintf(" (%s/%s)", formatBytes(uint64(memory)), formatBytes(uint64(maxMemory)))
+		usage = max(usage, float64(memory)/float64(maxMemory))
+	}
+	if usage >= 1 {
 		memText = "[red]" + memText + "[white]"
-	} else if flowCount > maxFlows*80/100 {
+	} else if usage > 0.8 {
 		memText = "[yellow]" + memText + "[white]"
 	}
 
@@ -543,10 +671,22 @@ func (t *TUI) updateStats() {
 	evictionStats := t.store.GetEvictionStats()
 	evictionText := ""
 	if evictionStats.TotalEvicted > 0 {
-		evictionText = fmt.Sprintf("  [yellow]Evicted:[white] %s [gray](TopK:%d LRU:%d)[white]",
+		// Protected flows per policy, dropped flows for the age policies
+		var parts []string
+		for _, p := range evictionStats.Policies {
+			label, ok := policyLabels[p.Name]
+			if !ok {
+				label = p.Name
+			}
+			if p.Name == "age" || p.Name == "max-age" {
+				parts = append(parts, fmt.Sprintf("%s:-%s", label, formatNumber(int(p.Evicted))))
+			} else {
+				parts = append(parts, fmt.Sprintf("%s:%d", label, p.Protected))
+			}
+		}
+		evictionText = fmt.Sprintf("  [yellow]Evicted:[white] %s [gray](%s)[white]",
 			formatNumber(int(evictionStats.TotalEvicted)),
-			evictionStats.TopKProtected,
-			evictionStats.LRUProtected)
+			strings.Join(parts, " "))
 	}
 
 	// Self-traffic stats (src == dst)
@@ -23,19 +23,25 @@ func (t *TUI) showFlowDetail() {
 	flow := t.currentFlows[row-1] // -1 for header row
 	t.showDetail = true
 	t.detailFlowKey = flow.FlowKey()
-	t.detailConvKey = "" // Clear conversation key
+	t.detailConvKey = types.ConversationKey{} // Clear conversation key
 
 	// Mark this flow as accessed for LRU protection
 	t.store.MarkFlowAccessed(flow.FlowKey())
 
-	t.updateFlowDetailContent(&flow)
+	records := 0
+	if t.sessionFlows && row <= len(t.currentSessions) {
+		t.detailSessionStart = flow.StartTime
+		records = t.currentSessions[row-1].Records
+	}
+	t.updateFlowDetailContent(&flow, records)
 	t.layout.Clear()
 	t.layout.AddItem(t.detailView, 0, 1, true)
 	t.app.SetFocus(t.detailView)
 }
 
-// updateFlowDetailContent updates the content of the flow detail view
-func (t *TUI) updateFlowDetailContent(flow *types.Flow) {
+// updateFlowDetailContent updates the content of the flow detail view; records
+// is the number of stitched records when showing a session, 0 otherwise
+func (t *TUI) updateFlowDetailContent(flow *types.Flow, records int) {
 	text := fmt.Sprintf(`[yellow]═══ Network Layer ═══[white]
 [green]Source IP:[white]      %s
 [green]Destination IP:[white] %s
@@ -45,11 +51,14 @@ func (t *TUI) updateFlowDetailContent(flow *types.Flow) {
 [green]Source Port:[white]    %d  %s
 [green]Dest Port:[white]      %d  %s
 [green]TCP Flags:[white]      %s
+[green]State:[white]          %s
+[green]End Reason:[white]     %s
+[green]Application:[white]    %s
 
 [yellow]═══ Statistics ═══[white]
 [green]Bytes:[white]          %s
 [green]Packets:[white]        %d
-[green]Duration:[white]       %v
+[green]Duration:[white]       %v%s
 
 [yellow]═══ Routing Info ═══[white]
 [green]Source AS:[white]      %d
@@ -59,10 +68,11 @@ func (t *TUI) updateFlowDetailContent(flow *types.Flow) {
 
 [yellow]═══ Metadata ═══[white]
 [green]NetFlow Version:[white] %s
-[green]Exporter IP:[white]    %s
+[green]Aggregation:[white]    %s
+[green]Exporter IP:[white]    %s%s
 [green]Flow Start:[white]     %s
 [green]Flow End:[white]       %s
-[green]Received:[white]       %s
+[green]Received:[white]       %s%s
 
 [gray]Press Esc to close[white]`,
 		flow.SrcAddr,
@@ -71,18 +81,25 @@ func (t *TUI) updateFlowDetailContent(flow *types.Flow) {
 		flow.SrcPort, resolver.GetServiceName(flow.SrcPort, flow.Protocol),
 		flow.DstPort, resolver.GetServiceName(flow.DstPort, flow.Protocol),
 		flow.TCPFlagsString(),
+		flow.State(),
+		flow.EndReason,
+		formatApplication(flow),
 		formatBytes(flow.Bytes),
 		flow.Packets,
 		flow.Duration(),
+		formatSessionRecords(records),
 		flow.SrcAS,
 		flow.DstAS,
 		flow.InputIf,
 		flow.OutputIf,
 		flow.Version.String(),
+		formatAggregation(flow),
 		flow.ExporterIP,
+		formatObservations(t.store.Observations(flow)),
 		flow.StartTime.Format("2006-01-02 15:04:05"),
 		flow.EndTime.Format("2006-01-02 15:04:05"),
 		flow.ReceivedAt.Format("2006-01-02 15:04:05"),
+		formatTimeNotes(flow),
 	)
 	t.detailView.SetText(text)
 }
@@ -90,8 +107,8 @@ func (t *TUI) updateFlowDetailContent(flow *types.Flow) {
 // hideFlowDetail hides the flow detail view and returns to the main view
 func (t *TUI) hideFlowDetail() {
 	t.showDetail = false
-	t.detailFlowKey = ""
-	t.detailConvKey = ""
+	t.detailFlowKey = types.FlowKey{}
+	t.detailConvKey = types.ConversationKey{}
 	t.layout.Clear()
 	topRow := tview.NewFlex().
 		AddItem(t.statsView, 0, 2, false).
@@ -106,10 +123,17 @@ func (t *TUI) hideFlowDetail() {
 func (t *TUI) updateTableFlows() {
 	// Get flows with current filter and sort
 	var flows []types.Flow
-	if t.aggregateFlows {
-		flows = t.store.QueryAggregatedFlows(&t.filter, t.sortField, t.sortAsc, 1000)
-	} else {
-		flows = t.store.Query(&t.filter, t.sortField, t.sortAsc, 1000)
+	switch {
+	case t.sessionFlows:
+		t.currentSessions = t.store.QuerySessions(t.queryFilter(), 0, t.sortField, t.sortAsc, 1000)
+		flows = make([]types.Flow, len(t.currentSessions))
+		for i := range t.currentSessions {
+			flows[i] = t.currentSessions[i].Flow
+		}
+	case t.aggregateFlows:
+		flows = t.store.QueryAggregatedFlows(t.queryFilter(), t.sortField, t.sortAsc, 1000)
+	default:
+		flows = t.store.Query(t.queryFilter(), t.sortField, t.sortAsc, 1000)
 	}
 
 	// Save for detail view access
@@ -153,11 +177,15 @@ func (t *TUI) updateTableFlows() {
 		dst := t.formatFlowEndpoint(flow.DstAddr.String(), flow.DstPort, flow.Protocol)
 		timeStr := flow.ReceivedAt.Format("15:04:05")
 		ageStr := formatAge(time.Since(flow.ReceivedAt))
+		state := flow.State()
 
-		// Detect service (use the lower port as it's usually the server)
+		// Detect service: prefer the application reported by the exporter,
+		// otherwise use the lower port as it's usually the server
 		service := ""
 		if t.showService {
-			if flow.SrcPort < flow.DstPort && flow.SrcPort > 0 {
+			if flow.AppName != "" {
+				service = flow.AppName
+			} else if flow.SrcPort < flow.DstPort && flow.SrcPort > 0 {
 				service = resolver.GetServiceName(flow.SrcPort, flow.Protocol)
 			} else if flow.DstPort > 0 {
 				service = resolver.GetServiceName(flow.DstPort, flow.Protocol)
@@ -186,11 +214,11 @@ func (t *TUI) updateTableFlows() {
 		// Determine colors based on internal/external IP
 		// Internal = private IP OR learned IPv6 prefix (seen as source on input interface)
 		srcColor := tcell.ColorOrange // public/external
-		if flow.SrcAddr != nil && t.isInternalIP(flow.SrcAddr) {
+		if t.isInternalIP(flow.SrcAddr) {
 			srcColor = tcell.ColorGreen // private/internal
 		}
 		dstColor := tcell.ColorOrange // public/external
-		if flow.DstAddr != nil && t.isInternalIP(flow.DstAddr) {
+		if t.isInternalIP(flow.DstAddr) {
 			dstColor = tcell.ColorGreen // private/internal
 		}
 
@@ -205,6 +233,8 @@ func (t *TUI) updateTableFlows() {
 		col++
 		t.table.SetCell(row, col, tview.NewTableCell(formatCol(fmt.Sprintf("%d", flow.Packets), col, cols[col], false)).SetAlign(tview.AlignRight).SetExpansion(1))
 		col++
+		t.table.SetCell(row, col, tview.NewTableCell(formatCol(state.String(), col, cols[col], false)).SetTextColor(stateColor(state)).SetExpansion(1))
+		col++
 		t.table.SetCell(row, col, tview.NewTableCell(formatCol(timeStr, col, cols[col], false)).SetExpansion(1))
 		col++
 		t.table.SetCell(row, col, tview.NewTableCell(formatCol(ageStr, col, cols[col], false)).SetExpansion(1))
@@ -309,6 +339,24 @@ func (t *TUI) getSeenServices() []string {
 	return services
 }
 
+// getSeenApps returns unique application names reported by exporters in current flows
+func (t *TUI) getSeenApps() []string {
+	seen := make(map[string]bool)
+	var apps []string
+
+	for _, flow := range t.currentFlows {
+		if flow.AppName != "" && !seen[flow.AppName] {
+			seen[flow.AppName] = true
+			apps = append(apps, flow.AppName)
+		}
+	}
+
+	if len(apps) > 15 {
+		apps = apps[:15]
+	}
+	return apps
+}
+
 // getSeenPorts returns unique port numbers from current flows as strings
 func (t *TUI) getSeenPorts() []string {
 	seen := make(map[uint16]bool)
@@ -384,7 +432,7 @@ func (t *TUI) refreshDetailContent() {
 	emptyFilter := store.Filter{}
 
 	// Check which type of detail is being shown based on which key is set
-	if t.detailConvKey != "" {
+	if t.detailConvKey != (types.ConversationKey{}) {
 		// Refresh conversation data and find matching one
 		conversations := t.store.QueryConversations(&emptyFilter, t.sortField, t.sortAsc, 10000)
 		for i := range conversations {
@@ -393,12 +441,21 @@ func (t *TUI) refreshDetailContent() {
 				return
 			}
 		}
-	} else if t.detailFlowKey != "" {
+	} else if t.detailFlowKey != (types.FlowKey{}) && t.sessionFlows {
+		// Refresh session data; the start identifies the session while it grows
+		sessions := t.store.QuerySessions(&emptyFilter, 0, t.sortField, t.sortAsc, 10000)
+		for i := range sessions {
+			if sessions[i].FlowKey() == t.detailFlowKey && sessions[i].StartTime.Equal(t.detailSessionStart) {
+				t.updateFlowDetailContent(&sessions[i].Flow, sessions[i].Records)
+				return
+			}
+		}
+	} else if t.detailFlowKey != (types.FlowKey{}) {
 		// Refresh flow data and find matching one
 		flows := t.store.Query(&emptyFilter, t.sortField, t.sortAsc, 10000)
 		for i := range flows {
 			if flows[i].FlowKey() == t.detailFlowKey {
-				t.updateFlowDetailContent(&flows[i])
+				t.updateFlowDetailContent(&flows[i], 0)
 				return
 			}
 		}
@@ -3,14 +3,19 @@ package display
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"os/exec"
 	"runtime"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/gdamore/tcell/v2"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
+
+	"netflow-collector/internal/store"
+	"netflow-collector/pkg/types"
 )
 
 // Locale-aware number formatter
@@ -58,6 +63,34 @@ func formatAge(d time.Duration) string {
 	return fmt.Sprintf("%dd", int(d.Hours()/24))
 }
 
+// formatApplication formats the exporter-reported application for the detail view
+func formatApplication(flow *types.Flow) string {
+	switch {
+	case flow.AppName != "" && !flow.AppID.IsZero():
+		return fmt.Sprintf("%s (%s)", flow.AppName, flow.AppID)
+	case flow.AppName != "":
+		return flow.AppName
+	case !flow.AppID.IsZero():
+		return flow.AppID.String()
+	default:
+		return "-"
+	}
+}
+
+// stateColor returns the display color for a derived connection state
+func stateColor(state types.FlowState) tcell.Color {
+	switch state {
+	case types.StateCompleted:
+		return tcell.ColorGreen
+	case types.StateReset:
+		return tcell.ColorRed
+	case types.StateHalfOpen:
+		return tcell.ColorYellow
+	default:
+		return tcell.ColorGray
+	}
+}
+
 // truncateEndpoint truncates an endpoint string while preserving the port
 // e.g. "very-long-hostname.domain.com:443" -> "very-long-hostn…:443"
 func truncateEndpoint(s string, maxLen int) string {
@@ -93,27 +126,24 @@ func parseIP(s string) net.IP {
 }
 
 // isPrivateIP checks if an IP is in a private/local range
-func isPrivateIP(ip net.IP) bool {
-	if ip == nil {
+func isPrivateIP(ip netip.Addr) bool {
+	if !ip.IsValid() {
 		return false
 	}
-	// Convert to 4-byte representation for IPv4
-	ip4 := ip.To4()
-	if ip4 == nil {
+	if !ip.Is4() {
 		// IPv6 checks
-		if len(ip) < 1 {
-			return false
-		}
+		ip16 := ip.As16()
 		// ULA (Unique Local Address) fd00::/8 (fc00::/7 but only fd00::/8 is used in practice)
-		if ip[0] == 0xfd {
+		if ip16[0] == 0xfd {
 			return true
 		}
 		// Link-local fe80::/10
-		if ip[0] == 0xfe && (ip[1]&0xc0) == 0x80 {
+		if ip16[0] == 0xfe && (ip16[1]&0xc0) == 0x80 {
 			return true
 		}
 		return false
 	}
+	ip4 := ip.As4()
 	// 10.0.0.0/8
 	if ip4[0] == 10 {
 		return true
@@ -341,32 +371,21 @@ func commonPrefixBitsV6(a, b net.IP) int {
 
 // getIPv6Prefix64 extracts the /64 prefix from an IPv6 address as a string
 // Returns empty string for IPv4 or invalid addresses
-func getIPv6Prefix64(ip net.IP) string {
+func getIPv6Prefix64(ip netip.Addr) string {
 	return getIPv6PrefixN(ip, 64)
 }
 
 // getIPv6PrefixN extracts a prefix of given length from an IPv6 address
-func getIPv6PrefixN(ip net.IP, prefixLen int) string {
-	if ip == nil || prefixLen < 0 || prefixLen > 128 {
-		return ""
-	}
+func getIPv6PrefixN(ip netip.Addr, prefixLen int) string {
 	// Make sure it's IPv6 (not IPv4-mapped)
-	if ip.To4() != nil {
+	if !ip.Is6() || ip.Is4In6() {
 		return ""
 	}
-	// Ensure 16-byte representation
-	if len(ip) != 16 {
-		ip = ip.To16()
-		if ip == nil {
-			return ""
-		}
+	network, err := ip.Prefix(prefixLen)
+	if err != nil {
+		return ""
 	}
-
-	// Create network mask and apply it
-	mask := net.CIDRMask(prefixLen, 128)
-	network := ip.Mask(mask)
-
-	return fmt.Sprintf("%s/%d", network.String(), prefixLen)
+	return network.String()
 }
 
 // getIPv6Prefix48 extracts the /48 prefix from an IPv6 address as a string
@@ -390,8 +409,8 @@ func getIPv6Prefix48(ip net.IP) string {
 }
 
 // ipMatchesPrefix checks if an IP matches a given prefix (e.g. "2001:db8::/64")
-func ipMatchesPrefix(ip net.IP, prefixStr string) bool {
-	_, network, err := net.ParseCIDR(prefixStr)
+func ipMatchesPrefix(ip netip.Addr, prefixStr string) bool {
+	network, err := netip.ParsePrefix(prefixStr)
 	if err != nil {
 		return false
 	}
@@ -465,3 +484,44 @@ func copyToClipboard(text string) error {
 
 	return cmd.Run()
 }
+
+// formatAggregation describes the NetFlow v8 aggregation scheme of a flow record
+func formatAggregation(flow *types.Flow) string {
+	if flow.Aggregation == types.AggregationNone {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%d flows)", flow.Aggregation, flow.FlowCount)
+}
+
+// formatTimeNotes returns detail-view notes about clock correction and implausible timestamps
+func formatTimeNotes(flow *types.Flow) string {
+	notes := ""
+	if flow.ClockCorrection != 0 {
+		notes += fmt.Sprintf("\n[green]Clock Corrected:[white] %s (exporter clock offset)", formatOffset(flow.ClockCorrection))
+	}
+	if flow.TimeImplausible {
+		notes += "\n[red]Timestamps implausible relative to receive time (exporter clock or uptime?)[white]"
+	}
+	return notes
+}
+
+// formatObservations lists the exporters that reported a flow, marking the one whose records are stored
+func formatObservations(observations []store.Observation) string {
+	notes := ""
+	for _, o := range observations {
+		marker := ""
+		if o.Canonical {
+			marker = " [green](stored)[white]"
+		}
+		notes += fmt.Sprintf("\n[green]Observed At:[white]    %s if %d->%d, %d records%s", o.Exporter, o.InputIf, o.OutputIf, o.Flows, marker)
+	}
+	return notes
+}
+
+// formatSessionRecords returns the detail-view line for a stitched session, empty for single records
+func formatSessionRecords(records int) string {
+	if records == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n[green]Records:[white]        %d (stitched session)", records)
+}
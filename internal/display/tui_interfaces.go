@@ -3,6 +3,7 @@ package display
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/rivo/tview"
 
 	"netflow-collector/internal/store"
+	"netflow-collector/pkg/types"
 )
 
 // InterfaceDirection indicates whether interface is used for input or output
@@ -20,6 +22,9 @@ const (
 	DirectionOut InterfaceDirection = 1
 )
 
+// ipDetailPeerWindow is the cardinality window of the peer counts in the IP detail view
+const ipDetailPeerWindow = "1h"
+
 // InterfaceKey uniquely identifies an interface entry (ID + direction)
 type InterfaceKey struct {
 	ID        uint16
@@ -37,6 +42,8 @@ type InterfaceStats struct {
 	PrivateIPv6s    map[string]bool // Set of private/ULA IPv6s seen on this interface
 	PublicIPs       map[string]bool // Set of public IPv4s seen on this interface
 	PublicIPv6s     map[string]bool // Set of public IPv6s seen on this interface
+	Rejected        map[string]int  // Per host: TCP connections ended by RST
+	Unanswered      map[string]int  // Per host: TCP connections with SYN but no answer (half-open)
 	BytesToPublic   uint64          // Bytes sent to public destinations (for WAN detection)
 	FlowsToPublic   int             // Flows to public destinations
 	LastSubnet      string          // Last calculated IPv4 subnet
@@ -96,6 +103,8 @@ func (t *TUI) updateInterfaceStats() {
 					PrivateIPv6s: make(map[string]bool),
 					PublicIPs:    make(map[string]bool),
 					PublicIPv6s:  make(map[string]bool),
+					Rejected:     make(map[string]int),
+					Unanswered:   make(map[string]int),
 				}
 			}
 			stats := t.interfaceStats[key]
@@ -103,7 +112,10 @@ func (t *TUI) updateInterfaceStats() {
 			stats.Bytes += flow.Bytes
 			stats.Packets += uint64(flow.Packets)
 			// Collect source IPs (the network behind this input interface)
-			if flow.SrcAddr != nil && !flow.SrcAddr.IsUnspecified() {
+			if flow.SrcAddr.IsValid() && !flow.SrcAddr.IsUnspecified() {
+				// Clients behind this interface whose connections fail
+				countFailedConnection(stats, flow.SrcAddr.String(), flow.State())
+
 				// Learn IPv6 prefixes only from ROUTED flows (InIf + OutIf)
 				// These are flows from internal devices going to the internet
 				if flow.OutputIf > 0 {
@@ -112,13 +124,13 @@ func (t *TUI) updateInterfaceStats() {
 
 				// Classify using isInternalIP (private IPs + our own IPv6 prefix)
 				if t.isInternalIP(flow.SrcAddr) {
-					if flow.SrcAddr.To4() != nil {
+					if flow.SrcAddr.Is4() {
 						stats.PrivateIPs[flow.SrcAddr.String()] = true
 					} else {
 						stats.PrivateIPv6s[flow.SrcAddr.String()] = true
 					}
 				} else {
-					if flow.SrcAddr.To4() != nil {
+					if flow.SrcAddr.Is4() {
 						stats.PublicIPs[flow.SrcAddr.String()] = true
 					} else {
 						stats.PublicIPv6s[flow.SrcAddr.String()] = true
@@ -138,6 +150,8 @@ func (t *TUI) updateInterfaceStats() {
 					PrivateIPv6s: make(map[string]bool),
 					PublicIPs:    make(map[string]bool),
 					PublicIPv6s:  make(map[string]bool),
+					Rejected:     make(map[string]int),
+					Unanswered:   make(map[string]int),
 				}
 			}
 			stats := t.interfaceStats[key]
@@ -145,10 +159,13 @@ func (t *TUI) updateInterfaceStats() {
 			stats.Bytes += flow.Bytes
 			stats.Packets += uint64(flow.Packets)
 			// Collect dest IPs (the network behind this output interface)
-			if flow.DstAddr != nil && !flow.DstAddr.IsUnspecified() {
+			if flow.DstAddr.IsValid() && !flow.DstAddr.IsUnspecified() {
+				// Services behind this interface that reject or ignore connections
+				countFailedConnection(stats, flow.DstAddr.String(), flow.State())
+
 				// Use isInternalIP which includes learned prefixes
 				if t.isInternalIP(flow.DstAddr) {
-					if flow.DstAddr.To4() != nil {
+					if flow.DstAddr.Is4() {
 						stats.PrivateIPs[flow.DstAddr.String()] = true
 					} else {
 						stats.PrivateIPv6s[flow.DstAddr.String()] = true
@@ -157,7 +174,7 @@ func (t *TUI) updateInterfaceStats() {
 					// Track traffic to public destinations (for WAN detection)
 					stats.BytesToPublic += flow.Bytes
 					stats.FlowsToPublic++
-					if flow.DstAddr.To4() != nil {
+					if flow.DstAddr.Is4() {
 						stats.PublicIPs[flow.DstAddr.String()] = true
 					} else {
 						stats.PublicIPv6s[flow.DstAddr.String()] = true
@@ -170,6 +187,16 @@ func (t *TUI) updateInterfaceStats() {
 	t.lastInterfaceUpdate = time.Now()
 }
 
+// countFailedConnection counts rejected (RST) and unanswered (SYN only) connections per host
+func countFailedConnection(stats *InterfaceStats, host string, state types.FlowState) {
+	switch state {
+	case types.StateReset:
+		stats.Rejected[host]++
+	case types.StateHalfOpen:
+		stats.Unanswered[host]++
+	}
+}
+
 // getInterfaceStats returns sorted interface statistics
 // Sorted by: Interface ID ascending, then Direction (In before Out)
 func (t *TUI) getInterfaceStats() []InterfaceStats {
@@ -441,7 +468,7 @@ func (t *TUI) showInterfaceDetail(key InterfaceKey) {
 		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 			AddItem(nil, 0, 1, false).
 			AddItem(t.ipDetailTable, 0, 2, true).
-			AddItem(nil, 0, 1, false), 70, 0, true).
+			AddItem(nil, 0, 1, false), 80, 0, true).
 		AddItem(nil, 0, 1, false)
 
 	// Handle keys
@@ -517,6 +544,30 @@ func (t *TUI) updateIPDetailTable() {
 		allEntries = append(allEntries, ipEntry{ip, false})
 	}
 
+	// Distinct peers per host from the cardinality sketches: destinations of the
+	// sources behind an input interface, sources of the destinations behind an
+	// output interface
+	peerDimension := "src"
+	if t.ipDetailIfaceKey.Direction == DirectionOut {
+		peerDimension = "dst"
+	}
+	hosts := make([]netip.Addr, 0, len(allEntries))
+	for _, e := range allEntries {
+		if addr, err := netip.ParseAddr(e.ip); err == nil {
+			hosts = append(hosts, addr)
+		}
+	}
+	peers := make(map[string]uint64)
+	if result, err := t.store.DistinctPeers(peerDimension, ipDetailPeerWindow, hosts); err == nil {
+		for _, e := range result.Entries {
+			peers[e.Addr.String()] = e.Distinct
+		}
+	}
+	hostsText := ""
+	if n, err := t.store.DistinctInterfaceHosts(ipDetailPeerWindow, t.ipDetailIfaceKey.ID, t.ipDetailIfaceKey.Direction == DirectionOut); err == nil && n > 0 {
+		hostsText = fmt.Sprintf(" - ~%s Hosts/%s", formatNumber(int(n)), ipDetailPeerWindow)
+	}
+
 	// Remember selection position
 	selectedRow, _ := t.ipDetailTable.GetSelection()
 
@@ -528,13 +579,28 @@ func (t *TUI) updateIPDetailTable() {
 	if t.ipDetailIfaceKey.Direction == DirectionOut {
 		dirStr = "Out"
 	}
-	t.ipDetailTable.SetBorder(true).SetTitle(fmt.Sprintf(" Interface %d (%s) - %d Int / %d Ext [Space=Mark] [Enter=Filter] [Esc=Close] ", t.ipDetailIfaceKey.ID, dirStr, intCount, extCount))
+	// Totals of failed connections across all hosts on this interface
+	rejectedTotal, unansweredTotal := 0, 0
+	for _, n := range stats.Rejected {
+		rejectedTotal += n
+	}
+	for _, n := range stats.Unanswered {
+		unansweredTotal += n
+	}
+	failedText := ""
+	if rejectedTotal > 0 || unansweredTotal > 0 {
+		failedText = fmt.Sprintf(" - %d Rej / %d Unans", rejectedTotal, unansweredTotal)
+	}
+	t.ipDetailTable.SetBorder(true).SetTitle(fmt.Sprintf(" Interface %d (%s) - %d Int / %d Ext%s%s [Space=Mark] [Enter=Filter] [Esc=Close] ", t.ipDetailIfaceKey.ID, dirStr, intCount, extCount, hostsText, failedText))
 
 	// Header row
 	t.ipDetailTable.SetCell(0, 0, tview.NewTableCell(" ").SetTextColor(tcell.ColorYellow).SetSelectable(false))
 	t.ipDetailTable.SetCell(0, 1, tview.NewTableCell("Type").SetTextColor(tcell.ColorYellow).SetSelectable(false))
 	t.ipDetailTable.SetCell(0, 2, tview.NewTableCell("IP Address").SetTextColor(tcell.ColorYellow).SetSelectable(false).SetExpansion(1))
 	t.ipDetailTable.SetCell(0, 3, tview.NewTableCell("Hostname").SetTextColor(tcell.ColorYellow).SetSelectable(false).SetExpansion(2))
+	t.ipDetailTable.SetCell(0, 4, tview.NewTableCell("Rej").SetTextColor(tcell.ColorYellow).SetSelectable(false).SetAlign(tview.AlignRight))
+	t.ipDetailTable.SetCell(0, 5, tview.NewTableCell("Unans").SetTextColor(tcell.ColorYellow).SetSelectable(false).SetAlign(tview.AlignRight))
+	t.ipDetailTable.SetCell(0, 6, tview.NewTableCell("Peers "+ipDetailPeerWindow).SetTextColor(tcell.ColorYellow).SetSelectable(false).SetAlign(tview.AlignRight))
 
 	for i, entry := range allEntries {
 		row := i + 1 // +1 for header
@@ -575,6 +641,9 @@ func (t *TUI) updateIPDetailTable() {
 		t.ipDetailTable.SetCell(row, 1, tview.NewTableCell(typeStr).SetTextColor(typeColor))
 		t.ipDetailTable.SetCell(row, 2, tview.NewTableCell(entry.ip).SetExpansion(1))
 		t.ipDetailTable.SetCell(row, 3, tview.NewTableCell(hostname).SetTextColor(tcell.ColorAqua).SetExpansion(2))
+		t.ipDetailTable.SetCell(row, 4, failedCountCell(stats.Rejected[entry.ip], tcell.ColorRed))
+		t.ipDetailTable.SetCell(row, 5, failedCountCell(stats.Unanswered[entry.ip], tcell.ColorYellow))
+		t.ipDetailTable.SetCell(row, 6, tview.NewTableCell(formatPeers(peers[entry.ip])).SetAlign(tview.AlignRight))
 	}
 
 	// Fix selection to skip header
@@ -588,6 +657,22 @@ func (t *TUI) updateIPDetailTable() {
 	}
 }
 
+// formatPeers formats an estimated distinct peer count, blank when unknown
+func formatPeers(n uint64) string {
+	if n == 0 {
+		return ""
+	}
+	return "~" + formatNumber(int(n))
+}
+
+// failedCountCell formats a failed-connection count, blank when zero
+func failedCountCell(n int, color tcell.Color) *tview.TableCell {
+	if n == 0 {
+		return tview.NewTableCell("").SetAlign(tview.AlignRight)
+	}
+	return tview.NewTableCell(formatNumber(n)).SetTextColor(color).SetAlign(tview.AlignRight)
+}
+
 // toggleIPDetailSelection toggles selection of current IP
 func (t *TUI) toggleIPDetailSelection() {
 	if !t.ipDetailVisible || t.ipDetailTable == nil {
@@ -16,6 +16,7 @@ type ServiceStats struct {
 	Port        uint16
 	Protocol    uint8
 	ServiceName string
+	IsApp       bool // ServiceName was reported by the exporter (NBAR/App-ID), not guessed from the port
 	FlowCount   int
 	Bytes       uint64
 	Packets     uint64
@@ -95,7 +96,9 @@ func (t *TUI) setupServiceTable() {
 			if row > 0 && row <= len(t.currentServiceStats) {
 				svc := t.currentServiceStats[row-1]
 				var filterStr string
-				if svc.ServiceName != "" {
+				if svc.IsApp {
+					filterStr = fmt.Sprintf("app=%s", svc.ServiceName)
+				} else if svc.ServiceName != "" {
 					filterStr = fmt.Sprintf("service=%s", svc.ServiceName)
 				} else {
 					filterStr = fmt.Sprintf("port=%d", svc.Port)
@@ -133,10 +136,10 @@ func (t *TUI) updateServiceTable() {
 
 	// Get flows (filtered if filter active)
 	var flows []types.Flow
-	if t.filter.IsEmpty() || !t.filter.IsValid() {
+	if filter := t.queryFilter(); filter.IsEmpty() || !filter.IsValid() {
 		flows = t.store.Query(nil, 0, false, 0)
 	} else {
-		flows = t.store.Query(&t.filter, 0, false, 0)
+		flows = t.store.Query(filter, 0, false, 0)
 	}
 
 	// Aggregate by service/port
@@ -150,7 +153,24 @@ func (t *TUI) updateServiceTable() {
 		// Create a key combining port and protocol
 		key := fmt.Sprintf("%d/%d", port, proto)
 
+		// Exporter-reported applications are grouped by name regardless of port
+		if flow.AppName != "" {
+			key = "app/" + flow.AppName
+		}
+
 		stats, exists := serviceMap[key]
+		if !exists && flow.AppName != "" {
+			stats = &ServiceStats{
+				Port:        port,
+				Protocol:    proto,
+				ServiceName: flow.AppName,
+				IsApp:       true,
+				UniqueSrc:   make(map[string]bool),
+				UniqueDst:   make(map[string]bool),
+			}
+			serviceMap[key] = stats
+			exists = true
+		}
 		if !exists {
 			serviceName := resolver.GetServiceName(port, proto)
 			if serviceName == "" {
@@ -226,16 +246,24 @@ func (t *TUI) updateServiceTable() {
 	for i, svc := range serviceList {
 		row := i + 1
 
-		// Port
-		t.serviceTable.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", svc.Port)).
+		// Port (applications may span several ports)
+		portStr := fmt.Sprintf("%d", svc.Port)
+		if svc.IsApp {
+			portStr = "[gray]app[white]"
+		}
+		t.serviceTable.SetCell(row, 0, tview.NewTableCell(portStr).
 			SetAlign(tview.AlignRight))
 
-		// Service name
+		// Service name (exporter-reported applications highlighted)
 		serviceName := svc.ServiceName
 		if serviceName == "" {
 			serviceName = "[gray]-[white]"
 		}
-		t.serviceTable.SetCell(row, 1, tview.NewTableCell(serviceName))
+		cell := tview.NewTableCell(serviceName)
+		if svc.IsApp {
+			cell.SetTextColor(tcell.ColorLightGreen)
+		}
+		t.serviceTable.SetCell(row, 1, cell)
 
 		// Protocol
 		protoName := protocolName(svc.Protocol)
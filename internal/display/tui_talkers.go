@@ -0,0 +1,131 @@
+package display
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"netflow-collector/internal/resolver"
+	"netflow-collector/internal/store"
+)
+
+// talkerLimit is the number of heavy hitters shown on the top talkers page
+const talkerLimit = 100
+
+// setupTalkerTable initializes the top talkers table (heavy-hitter sketches)
+func (t *TUI) setupTalkerTable() {
+	t.talkerTable = tview.NewTable().
+		SetBorders(false).
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	t.talkerTable.SetBorder(true)
+	t.updateTalkerTitle()
+
+	headers := []string{"#", "Key", "Name", "Bytes", "± Error", "Share", "Packets", "Flows"}
+	for i, h := range headers {
+		cell := tview.NewTableCell(h).
+			SetTextColor(tcell.ColorYellow).
+			SetSelectable(false).
+			SetAlign(tview.AlignLeft)
+		if i == 0 || i >= 3 { // Right-align numeric columns
+			cell.SetAlign(tview.AlignRight)
+		}
+		t.talkerTable.SetCell(0, i, cell)
+	}
+
+	t.talkerTable.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case ' ':
+				t.paused = !t.paused
+				return nil
+			case 'q':
+				t.app.Stop()
+				return nil
+			case 'd':
+				t.talkerDimension = (t.talkerDimension + 1) % len(store.HeavyHitterDimensions)
+				t.updateTalkerTitle()
+				t.updateTalkerTable()
+				return nil
+			case 'w':
+				t.talkerWindow = (t.talkerWindow + 1) % len(store.DefaultHeavyHitterWindows)
+				t.updateTalkerTitle()
+				t.updateTalkerTable()
+				return nil
+			}
+			// 1-5 select the dimension directly
+			if r := event.Rune(); r >= '1' && int(r-'1') < len(store.HeavyHitterDimensions) {
+				t.talkerDimension = int(r - '1')
+				t.updateTalkerTitle()
+				t.updateTalkerTable()
+				return nil
+			}
+		case tcell.KeyEnter:
+			// Show flows of the selected talker
+			row, _ := t.talkerTable.GetSelection()
+			if row > 0 && row <= len(t.currentTalkers) && t.currentTalkers[row-1].Filter != "" {
+				t.filterInput.SetText(t.currentTalkers[row-1].Filter)
+				t.applyFilter()
+				t.switchToPage(0)
+				return nil
+			}
+		}
+		return event
+	})
+}
+
+// updateTalkerTitle shows the selected dimension and window in the table title
+func (t *TUI) updateTalkerTitle() {
+	t.talkerTable.SetTitle(fmt.Sprintf(" Top Talkers [%s, %s] [1-5/d=Dimension] [w=Window] [Enter=Filter] ",
+		store.HeavyHitterDimensions[t.talkerDimension], store.DefaultHeavyHitterWindows[t.talkerWindow].Name))
+}
+
+// updateTalkerTable updates the top talkers from the heavy-hitter sketches
+func (t *TUI) updateTalkerTable() {
+	if t.paused {
+		return
+	}
+
+	result, err := t.store.QueryHeavyHitters(store.HeavyHitterDimensions[t.talkerDimension],
+		store.DefaultHeavyHitterWindows[t.talkerWindow].Name, talkerLimit)
+	if err != nil {
+		return
+	}
+	t.currentTalkers = result.Hitters
+
+	// Clear old rows (keep header)
+	for row := t.talkerTable.GetRowCount() - 1; row > 0; row-- {
+		t.talkerTable.RemoveRow(row)
+	}
+
+	for i, hh := range result.Hitters {
+		row := i + 1
+
+		name := ""
+		switch {
+		case hh.Addr.IsValid():
+			if display := t.formatFlowEndpoint(hh.Addr.String(), 0, 0); display != hh.Addr.String() {
+				name = display
+			}
+		case hh.Port != 0 || hh.Protocol != 0:
+			name = resolver.GetServiceName(hh.Port, hh.Protocol)
+		}
+
+		// Estimates with a large error relative to the count are dimmed
+		color := tcell.ColorWhite
+		if hh.Error > hh.Bytes/10 {
+			color = tcell.ColorGray
+		}
+
+		t.talkerTable.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d", row)).SetAlign(tview.AlignRight))
+		t.talkerTable.SetCell(row, 1, tview.NewTableCell(hh.Key).SetTextColor(tcell.ColorAqua).SetExpansion(1))
+		t.talkerTable.SetCell(row, 2, tview.NewTableCell(name).SetExpansion(1))
+		t.talkerTable.SetCell(row, 3, tview.NewTableCell(formatBytes(hh.Bytes)).SetTextColor(color).SetAlign(tview.AlignRight))
+		t.talkerTable.SetCell(row, 4, tview.NewTableCell(formatBytes(hh.Error)).SetTextColor(tcell.ColorGray).SetAlign(tview.AlignRight))
+		t.talkerTable.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%.1f%%", hh.Share)).SetAlign(tview.AlignRight))
+		t.talkerTable.SetCell(row, 6, tview.NewTableCell(formatNumber(int(hh.Packets))).SetAlign(tview.AlignRight))
+		t.talkerTable.SetCell(row, 7, tview.NewTableCell(formatNumber(int(hh.Flows))).SetAlign(tview.AlignRight))
+	}
+}
@@ -0,0 +1,122 @@
+package display
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+
+	"netflow-collector/internal/store"
+)
+
+// timeRangeLayout is the input and display format of the time range picker
+const timeRangeLayout = "2006-01-02 15:04"
+
+// queryFilter returns the current filter restricted to the absolute time range
+func (t *TUI) queryFilter() *store.Filter {
+	filter := t.filter
+	filter.From, filter.To = t.timeFrom, t.timeTo
+	return &filter
+}
+
+// parseTimeRangeInput parses a picker field, empty means open
+func parseTimeRangeInput(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{timeRangeLayout, "2006-01-02 15:04:05", "15:04", "2006-01-02"} {
+		ts, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "15:04" {
+			// Time of day only: today
+			now := time.Now()
+			ts = time.Date(now.Year(), now.Month(), now.Day(), ts.Hour(), ts.Minute(), 0, 0, time.Local)
+		}
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected YYYY-MM-DD HH:MM)", s)
+}
+
+// formatTimeRange returns the time range for the status display, empty if not set
+func (t *TUI) formatTimeRange() string {
+	if t.timeFrom.IsZero() && t.timeTo.IsZero() {
+		return ""
+	}
+	from, to := "…", "now"
+	if !t.timeFrom.IsZero() {
+		from = t.timeFrom.Format(timeRangeLayout)
+	}
+	if !t.timeTo.IsZero() {
+		to = t.timeTo.Format(timeRangeLayout)
+	}
+	return from + " – " + to
+}
+
+// showTimeRangePicker opens a modal to set the absolute time range on flow start/end
+func (t *TUI) showTimeRangePicker() {
+	form := tview.NewForm()
+	form.SetBorder(true).
+		SetTitle(" Time Range (YYYY-MM-DD HH:MM, empty = open) ").
+		SetTitleAlign(tview.AlignLeft)
+
+	from, to := "", ""
+	if !t.timeFrom.IsZero() {
+		from = t.timeFrom.Format(timeRangeLayout)
+	}
+	if !t.timeTo.IsZero() {
+		to = t.timeTo.Format(timeRangeLayout)
+	}
+	form.AddInputField("From", from, 20, nil, nil)
+	form.AddInputField("To", to, 20, nil, nil)
+	status := tview.NewTextView().SetDynamicColors(true)
+
+	closePicker := func() {
+		t.pages.RemovePage("timerange")
+		t.app.SetFocus(t.table)
+	}
+
+	form.AddButton("Apply", func() {
+		fromTime, err := parseTimeRangeInput(form.GetFormItemByLabel("From").(*tview.InputField).GetText())
+		if err != nil {
+			status.SetText("[red]From: " + err.Error())
+			return
+		}
+		toTime, err := parseTimeRangeInput(form.GetFormItemByLabel("To").(*tview.InputField).GetText())
+		if err != nil {
+			status.SetText("[red]To: " + err.Error())
+			return
+		}
+		if !fromTime.IsZero() && !toTime.IsZero() && !fromTime.Before(toTime) {
+			status.SetText("[red]From must be before To")
+			return
+		}
+		t.timeFrom, t.timeTo = fromTime, toTime
+		closePicker()
+	})
+	form.AddButton("Clear", func() {
+		t.timeFrom, t.timeTo = time.Time{}, time.Time{}
+		closePicker()
+	})
+	form.AddButton("Cancel", closePicker)
+	form.SetCancelFunc(closePicker)
+
+	box := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(form, 9, 0, true).
+		AddItem(status, 1, 0, false)
+
+	// Center the modal
+	flex := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(box, 10, 0, true).
+			AddItem(nil, 0, 1, false), 60, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	t.pages.AddPage("timerange", flex, true, true)
+	t.app.SetFocus(form)
+}
@@ -32,14 +32,9 @@ const (
 	IPFIX_IP_NEXT_HOP_IPV4       = 15
 	IPFIX_BGP_SOURCE_AS          = 16
 	IPFIX_BGP_DEST_AS            = 17
-	IPFIX_FLOW_START_SYS_UP_TIME = 22
-	IPFIX_FLOW_END_SYS_UP_TIME   = 21
 	IPFIX_SOURCE_IPV6_ADDRESS    = 27
 	IPFIX_DEST_IPV6_ADDRESS      = 28
-	IPFIX_FLOW_START_MILLISEC    = 152
-	IPFIX_FLOW_END_MILLISEC      = 153
-	IPFIX_FLOW_START_MICROSEC    = 154
-	IPFIX_FLOW_END_MICROSEC      = 155
+	IPFIX_FLOW_END_REASON        = 136
 )
 
 // IPFIX Header:
@@ -63,7 +58,12 @@ func (p *Parser) parseIPFIX(data []byte, sourceAddr *net.UDPAddr) ([]types.Flow,
 		return nil, fmt.Errorf("IPFIX packet length mismatch: header says %d, got %d", length, len(data))
 	}
 
-	baseTime := time.Unix(int64(exportTime), 0)
+	// IPFIX headers carry no sysUptime; uptime fields are relative to the
+	// system init time, which the exporter may announce via options data
+	clock := exportClock{
+		exportTime: time.Unix(int64(exportTime), 0),
+		initTime:   p.initTimes[observationDomainID],
+	}
 
 	// Ensure template map exists for this observation domain
 	if p.ipfixTemplates[observationDomainID] == nil {
@@ -89,12 +89,18 @@ func (p *Parser) parseIPFIX(data []byte, sourceAddr *net.UDPAddr) ([]types.Flow,
 			// Template Set
 			p.parseIPFIXTemplates(setData, observationDomainID)
 		case setID == 3:
-			// Options Template Set (skip for now)
+			// Options Template Set
+			p.parseIPFIXOptionsTemplates(setData, observationDomainID)
 		case setID >= 256:
 			// Data Set
 			template := p.ipfixTemplates[observationDomainID][setID]
-			if template != nil {
-				parsedFlows := p.parseIPFIXDataSet(setData, template, sourceAddr, baseTime)
+			if template == nil {
+				break
+			}
+			if template.Options {
+				p.parseOptionsDataSet(setData, template, observationDomainID)
+			} else {
+				parsedFlows := p.parseIPFIXDataSet(setData, template, sourceAddr, clock)
 				flows = append(flows, parsedFlows...)
 			}
 		}
@@ -102,6 +108,8 @@ func (p *Parser) parseIPFIX(data []byte, sourceAddr *net.UDPAddr) ([]types.Flow,
 		offset += int(setLen)
 	}
 
+	p.resolveAppNames(flows, observationDomainID)
+
 	return flows, nil
 }
 
@@ -118,40 +126,57 @@ func (p *Parser) parseIPFIXTemplates(data []byte, observationDomainID uint32) {
 			FieldDefs: make([]FieldDef, 0, fieldCount),
 		}
 
-		for i := 0; i < int(fieldCount) && offset+4 <= len(data); i++ {
-			fieldType := binary.BigEndian.Uint16(data[offset:])
-			fieldLen := binary.BigEndian.Uint16(data[offset+2:])
-
-			// Handle enterprise bit (bit 15 of field type)
-			isEnterprise := (fieldType & 0x8000) != 0
-			fieldType = fieldType & 0x7FFF
-
-			offset += 4
-
-			// Skip enterprise number if present
-			if isEnterprise && offset+4 <= len(data) {
-				offset += 4
+		for i := 0; i < int(fieldCount); i++ {
+			field, next, ok := readIPFIXFieldSpec(data, offset)
+			if !ok {
+				break
 			}
-
-			template.FieldDefs = append(template.FieldDefs, FieldDef{Type: fieldType, Length: fieldLen})
-			template.Length += int(fieldLen)
+			offset = next
+			template.addField(field)
 		}
 
 		p.ipfixTemplates[observationDomainID][templateID] = template
 	}
 }
 
-func (p *Parser) parseIPFIXDataSet(data []byte, template *Template, sourceAddr *net.UDPAddr, baseTime time.Time) []types.Flow {
+// readIPFIXFieldSpec reads a field specifier at offset and returns the offset of the next one
+func readIPFIXFieldSpec(data []byte, offset int) (FieldDef, int, bool) {
+	if offset+4 > len(data) {
+		return FieldDef{}, offset, false
+	}
+	fieldType := binary.BigEndian.Uint16(data[offset:])
+	fieldLen := binary.BigEndian.Uint16(data[offset+2:])
+	offset += 4
+
+	// Handle enterprise bit (bit 15 of field type)
+	field := FieldDef{Type: fieldType & 0x7FFF, Length: fieldLen}
+	if fieldType&0x8000 != 0 {
+		if offset+4 > len(data) {
+			return FieldDef{}, offset, false
+		}
+		field.Enterprise = binary.BigEndian.Uint32(data[offset:])
+		offset += 4
+	}
+
+	return field, offset, true
+}
+
+func (p *Parser) parseIPFIXDataSet(data []byte, template *Template, sourceAddr *net.UDPAddr, clock exportClock) []types.Flow {
 	var flows []types.Flow
 
-	recordLen := template.Length
-	if recordLen == 0 {
+	if template.Length == 0 {
 		return flows
 	}
 
-	for offset := 0; offset+recordLen <= len(data); offset += recordLen {
-		record := data[offset : offset+recordLen]
-		flow := p.parseIPFIXRecord(record, template, sourceAddr, baseTime)
+	// Records may have different lengths with variable-length fields; trailing bytes are padding
+	for offset := 0; offset+template.Length <= len(data); {
+		values, n, ok := splitRecord(data[offset:], template)
+		if !ok {
+			break
+		}
+		offset += n
+
+		flow := p.parseIPFIXRecord(values, template, sourceAddr, clock)
 		if flow != nil {
 			flows = append(flows, *flow)
 		}
@@ -160,44 +185,45 @@ func (p *Parser) parseIPFIXDataSet(data []byte, template *Template, sourceAddr *
 	return flows
 }
 
-func (p *Parser) parseIPFIXRecord(record []byte, template *Template, sourceAddr *net.UDPAddr, baseTime time.Time) *types.Flow {
+func (p *Parser) parseIPFIXRecord(values [][]byte, template *Template, sourceAddr *net.UDPAddr, clock exportClock) *types.Flow {
 	flow := &types.Flow{
 		Version:    types.IPFIX,
-		ExporterIP: sourceAddr.IP,
+		ExporterIP: exporterAddr(sourceAddr),
+		ExportTime: clock.exportTime,
 		ReceivedAt: time.Now(),
 	}
+	var times recordTimes
 
-	offset := 0
-	for _, field := range template.FieldDefs {
-		if offset+int(field.Length) > len(record) {
-			return nil
-		}
+	for i, field := range template.FieldDefs {
+		fieldData := values[i]
 
-		fieldData := record[offset : offset+int(field.Length)]
+		// Vendor-specific fields share type numbers with IANA fields
+		if field.Enterprise != 0 {
+			parseIPFIXEnterpriseField(flow, field, fieldData)
+			continue
+		}
 
 		switch field.Type {
 		case IPFIX_SOURCE_IPV4_ADDRESS:
-			flow.SrcAddr = net.IP(fieldData)
+			flow.SrcAddr = readAddr(fieldData)
 		case IPFIX_DEST_IPV4_ADDRESS:
-			flow.DstAddr = net.IP(fieldData)
+			flow.DstAddr = readAddr(fieldData)
 		case IPFIX_SOURCE_IPV6_ADDRESS:
-			flow.SrcAddr = net.IP(fieldData)
+			flow.SrcAddr = readAddr(fieldData)
 		case IPFIX_DEST_IPV6_ADDRESS:
-			flow.DstAddr = net.IP(fieldData)
+			flow.DstAddr = readAddr(fieldData)
 		case IPFIX_SOURCE_TRANSPORT_PORT:
-			flow.SrcPort = binary.BigEndian.Uint16(fieldData)
+			flow.SrcPort = uint16(readUint(fieldData))
 		case IPFIX_DEST_TRANSPORT_PORT:
-			flow.DstPort = binary.BigEndian.Uint16(fieldData)
+			flow.DstPort = uint16(readUint(fieldData))
 		case IPFIX_PROTOCOL_IDENTIFIER:
-			flow.Protocol = fieldData[0]
+			flow.Protocol = uint8(readUint(fieldData))
 		case IPFIX_OCTET_DELTA_COUNT:
 			flow.Bytes = readUint(fieldData)
 		case IPFIX_PACKET_DELTA_COUNT:
 			flow.Packets = readUint(fieldData)
 		case IPFIX_TCP_CONTROL_BITS:
-			if len(fieldData) >= 1 {
-				flow.TCPFlags = fieldData[len(fieldData)-1]
-			}
+			flow.TCPFlags = uint8(readUint(fieldData))
 		case IPFIX_BGP_SOURCE_AS:
 			flow.SrcAS = uint32(readUint(fieldData))
 		case IPFIX_BGP_DEST_AS:
@@ -206,22 +232,28 @@ func (p *Parser) parseIPFIXRecord(record []byte, template *Template, sourceAddr
 			flow.InputIf = uint16(readUint(fieldData))
 		case IPFIX_EGRESS_INTERFACE:
 			flow.OutputIf = uint16(readUint(fieldData))
-		case IPFIX_FLOW_START_SYS_UP_TIME:
-			uptime := binary.BigEndian.Uint32(fieldData)
-			flow.StartTime = baseTime.Add(-time.Duration(uptime) * time.Millisecond)
-		case IPFIX_FLOW_END_SYS_UP_TIME:
-			uptime := binary.BigEndian.Uint32(fieldData)
-			flow.EndTime = baseTime.Add(-time.Duration(uptime) * time.Millisecond)
-		case IPFIX_FLOW_START_MILLISEC:
-			ms := binary.BigEndian.Uint64(fieldData)
-			flow.StartTime = time.UnixMilli(int64(ms))
-		case IPFIX_FLOW_END_MILLISEC:
-			ms := binary.BigEndian.Uint64(fieldData)
-			flow.EndTime = time.UnixMilli(int64(ms))
+		case IPFIX_FLOW_END_REASON:
+			flow.EndReason = types.EndReason(readUint(fieldData))
+		case FIELD_APPLICATION_ID:
+			flow.AppID = parseAppID(fieldData)
+		case FIELD_APPLICATION_NAME:
+			flow.AppName = readString(fieldData)
+		default:
+			times.decode(flow, field.Type, fieldData, clock)
 		}
-
-		offset += int(field.Length)
 	}
 
+	times.apply(flow, clock)
+
 	return flow
 }
+
+// parseIPFIXEnterpriseField decodes the vendor-specific fields we know about
+func parseIPFIXEnterpriseField(flow *types.Flow, field FieldDef, fieldData []byte) {
+	switch field.Enterprise {
+	case PAN_ENTERPRISE_NUMBER:
+		if field.Type == PAN_APP_ID&0x7FFF {
+			flow.AppName = readString(fieldData)
+		}
+	}
+}
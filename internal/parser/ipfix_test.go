@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+var testExporter = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2055}
+
+// testExportTime is the header export time of the test packets
+var testExportTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// ipfixPacket assembles an IPFIX message for observation domain 1
+func ipfixPacket(sets ...[]byte) []byte {
+	body := bytes.Join(sets, nil)
+	return bytes.Join([][]byte{
+		u16(10), u16(uint16(ipfixHeaderSize + len(body))), u32(uint32(testExportTime.Unix())), u32(1), u32(1), body,
+	}, nil)
+}
+
+// ipfixSet assembles a set with its header
+func ipfixSet(id uint16, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	return bytes.Join([][]byte{u16(id), u16(uint16(ipfixSetHeaderSize + len(body))), body}, nil)
+}
+
+// fields encodes field specifiers as (type, length) pairs
+func fields(specs ...uint16) []byte {
+	var b []byte
+	for _, s := range specs {
+		b = binary.BigEndian.AppendUint16(b, s)
+	}
+	return b
+}
+
+// varField encodes a variable-length value with its length prefix
+func varField(value []byte) []byte {
+	if len(value) < 255 {
+		return append([]byte{byte(len(value))}, value...)
+	}
+	return append(append([]byte{255}, u16(uint16(len(value)))...), value...)
+}
+
+func TestIPFIXVariableLengthFields(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	template := ipfixSet(2, u16(256), u16(4), fields(
+		IPFIX_SOURCE_IPV4_ADDRESS, 4,
+		FIELD_APPLICATION_NAME, ipfixVariableLength,
+		IPFIX_OCTET_DELTA_COUNT, 8,
+		IPFIX_PROTOCOL_IDENTIFIER, 1,
+	))
+	record := func(src byte, name string, octets uint64) []byte {
+		return bytes.Join([][]byte{{10, 0, 0, src}, varField([]byte(name)), binary.BigEndian.AppendUint64(nil, octets), {6}}, nil)
+	}
+	data := ipfixSet(256,
+		record(1, "ssl", 100),
+		record(2, long, 200), // 255 escape with a 2-byte length
+		record(3, "", 300),
+		record(4, "dns\x00\x00", 400), // NUL padding is dropped
+		[]byte{0, 0, 0},               // Set padding, shorter than a record
+	)
+
+	flows, err := New().Parse(ipfixPacket(template, data), testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		src   string
+		name  string
+		bytes uint64
+	}{
+		{"10.0.0.1", "ssl", 100},
+		{"10.0.0.2", long, 200},
+		{"10.0.0.3", "", 300},
+		{"10.0.0.4", "dns", 400},
+	}
+	if len(flows) != len(want) {
+		t.Fatalf("got %d flows, want %d", len(flows), len(want))
+	}
+	for i, w := range want {
+		f := flows[i]
+		if f.SrcAddr != netip.MustParseAddr(w.src) || f.AppName != w.name || f.Bytes != w.bytes || f.Protocol != 6 {
+			t.Errorf("flow %d = %v %q %d bytes proto %d, want %s %q %d bytes proto 6",
+				i, f.SrcAddr, f.AppName, f.Bytes, f.Protocol, w.src, w.name, w.bytes)
+		}
+		if f.Version != types.IPFIX || f.ExporterIP != netip.MustParseAddr("192.0.2.1") {
+			t.Errorf("flow %d: version %v exporter %v", i, f.Version, f.ExporterIP)
+		}
+	}
+}
+
+func TestIPFIXVariableLengthIntegers(t *testing.T) {
+	// Integer IEs declared variable-length may carry any number of bytes, including none
+	template := ipfixSet(2, u16(256), u16(6), fields(
+		IPFIX_SOURCE_TRANSPORT_PORT, ipfixVariableLength,
+		IPFIX_DEST_TRANSPORT_PORT, ipfixVariableLength,
+		IPFIX_PROTOCOL_IDENTIFIER, ipfixVariableLength,
+		IPFIX_TCP_CONTROL_BITS, ipfixVariableLength,
+		IPFIX_OCTET_DELTA_COUNT, ipfixVariableLength,
+		FIELD_APPLICATION_ID, ipfixVariableLength,
+	))
+	data := ipfixSet(256,
+		varField(nil), varField(nil), varField(nil), varField(nil), varField(nil), varField(nil),
+		varField(u16(443)), varField([]byte{0, 0, 0x1f, 0x90}), varField([]byte{17}), varField(u16(0x12)),
+		varField([]byte{1, 0, 0, 0, 0, 0, 0, 0, 5}), varField([]byte{13, 0, 0, 80}),
+	)
+
+	flows, err := New().Parse(ipfixPacket(template, data), testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("got %d flows, want 2", len(flows))
+	}
+	if f := flows[0]; f.SrcPort != 0 || f.DstPort != 0 || f.Protocol != 0 || f.TCPFlags != 0 || f.Bytes != 0 || !f.AppID.IsZero() {
+		t.Errorf("empty values: %+v", f)
+	}
+	f := flows[1]
+	if f.SrcPort != 443 || f.DstPort != 8080 || f.Protocol != 17 || f.TCPFlags != 0x12 || f.Bytes != 5 {
+		t.Errorf("ports %d/%d proto %d flags %#x bytes %d", f.SrcPort, f.DstPort, f.Protocol, f.TCPFlags, f.Bytes)
+	}
+	if f.AppID != (types.AppID{Engine: 13, Selector: 80}) {
+		t.Errorf("app ID %v, want 13:80", f.AppID)
+	}
+}
+
+func TestNetFlowV9ZeroLengthFields(t *testing.T) {
+	// A template may declare fields of length 0; they decode as 0
+	template := bytes.Join([][]byte{u16(0), u16(4 + 4 + 5*4), u16(256), u16(5), fields(
+		NF9_L4_SRC_PORT, 0,
+		NF9_L4_DST_PORT, 0,
+		NF9_PROTOCOL, 0,
+		NF9_TCP_FLAGS, 0,
+		NF9_IPV4_SRC_ADDR, 4,
+	)}, nil)
+	data := bytes.Join([][]byte{u16(256), u16(4 + 4), {10, 0, 0, 1}}, nil)
+	packet := bytes.Join([][]byte{u16(9), u16(2), u32(1000), u32(uint32(testExportTime.Unix())), u32(1), u32(7), template, data}, nil)
+
+	flows, err := New().Parse(packet, testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 || flows[0].SrcAddr != netip.MustParseAddr("10.0.0.1") || flows[0].SrcPort != 0 || flows[0].Protocol != 0 {
+		t.Errorf("flows = %+v", flows)
+	}
+}
+
+func TestIPFIXTruncatedRecords(t *testing.T) {
+	template := ipfixSet(2, u16(256), u16(2), fields(
+		IPFIX_SOURCE_IPV4_ADDRESS, 4,
+		FIELD_APPLICATION_NAME, ipfixVariableLength,
+	))
+	valid := bytes.Join([][]byte{{10, 0, 0, 1}, varField([]byte("ssl"))}, nil)
+
+	for name, tc := range map[string]struct {
+		data  []byte
+		flows int
+	}{
+		"length beyond set":      {ipfixSet(256, valid, []byte{10, 0, 0, 2, 200}, bytes.Repeat([]byte("x"), 10)), 1},
+		"escape without length":  {ipfixSet(256, valid, []byte{10, 0, 0, 2, 255, 1}), 1},
+		"long length beyond set": {ipfixSet(256, valid, []byte{10, 0, 0, 2, 255, 1, 0}, bytes.Repeat([]byte("x"), 255)), 1},
+		"record cut short":       {ipfixSet(256, valid, valid[:3]), 1},
+	} {
+		flows, err := New().Parse(ipfixPacket(template, tc.data), testExporter)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if len(flows) != tc.flows {
+			t.Errorf("%s: got %d flows, want %d", name, len(flows), tc.flows)
+		}
+	}
+
+	// No prefix of a packet panics, also with the header length fixed up to the cut
+	packet := ipfixPacket(template, ipfixSet(256, valid, valid))
+	for cut := range len(packet) {
+		New().Parse(packet[:cut], testExporter)
+		if cut >= 4 {
+			truncated := bytes.Clone(packet[:cut])
+			binary.BigEndian.PutUint16(truncated[2:4], uint16(cut))
+			New().Parse(truncated, testExporter)
+		}
+	}
+	if _, err := New().Parse(packet[:len(packet)-1], testExporter); err == nil {
+		t.Error("packet shorter than its header length: no error")
+	}
+}
+
+func TestOptionsTemplateAppNames(t *testing.T) {
+	// Cisco exports the application table as options data: scope observation
+	// domain, applicationId and applicationName
+	options := ipfixSet(3, u16(300), u16(3), u16(1), fields(
+		149, 4,
+		FIELD_APPLICATION_ID, 4,
+		FIELD_APPLICATION_NAME, ipfixVariableLength,
+	))
+	table := ipfixSet(300,
+		u32(1), []byte{13, 0, 0, 80}, varField([]byte("http")),
+		u32(1), []byte{13, 0, 1, 187}, varField([]byte("ssl")),
+		u32(1), []byte{0, 0, 0, 0}, varField([]byte("unknown")), // No ID, ignored
+	)
+	template := ipfixSet(2, u16(256), u16(2), fields(
+		IPFIX_SOURCE_IPV4_ADDRESS, 4,
+		FIELD_APPLICATION_ID, 4,
+	))
+	data := ipfixSet(256,
+		[]byte{10, 0, 0, 1}, []byte{13, 0, 0, 80},
+		[]byte{10, 0, 0, 2}, []byte{13, 0, 1, 187},
+		[]byte{10, 0, 0, 3}, []byte{13, 0, 0, 99}, // Not in the table
+	)
+
+	p := New()
+	if flows, err := p.Parse(ipfixPacket(options, table), testExporter); err != nil || len(flows) != 0 {
+		t.Fatalf("options data: %v, %d flows", err, len(flows))
+	}
+	flows, err := p.Parse(ipfixPacket(template, data), testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http", "ssl", ""}
+	if len(flows) != len(want) {
+		t.Fatalf("got %d flows, want %d", len(flows), len(want))
+	}
+	for i, name := range want {
+		if flows[i].AppName != name {
+			t.Errorf("flow %d: app name %q, want %q", i, flows[i].AppName, name)
+		}
+	}
+
+	// Names learned in one observation domain don't apply to another
+	other := ipfixPacket(template, data)
+	binary.BigEndian.PutUint32(other[12:16], 2)
+	flows, _ = p.Parse(other, testExporter)
+	if len(flows) == 0 || flows[0].AppName != "" {
+		t.Errorf("other domain: %+v", flows)
+	}
+}
+
+func TestNetFlowV9OptionsAppNames(t *testing.T) {
+	options := bytes.Join([][]byte{u16(1), u16(4 + 6 + 3*4), u16(300), u16(4), u16(8), fields(
+		1, 4, // Scope: system
+		FIELD_APPLICATION_ID, 4,
+		FIELD_APPLICATION_NAME, 8,
+	)}, nil)
+	table := bytes.Join([][]byte{u16(300), u16(4 + 16), u32(0), {13, 0, 0, 53}, []byte("dns\x00\x00\x00\x00\x00")}, nil)
+	template := bytes.Join([][]byte{u16(0), u16(4 + 4 + 2*4), u16(256), u16(2), fields(NF9_IPV4_SRC_ADDR, 4, FIELD_APPLICATION_ID, 4)}, nil)
+	data := bytes.Join([][]byte{u16(256), u16(4 + 8), {10, 0, 0, 1}, {13, 0, 0, 53}}, nil)
+	packet := bytes.Join([][]byte{u16(9), u16(4), u32(1000), u32(uint32(testExportTime.Unix())), u32(1), u32(7), options, table, template, data}, nil)
+
+	flows, err := New().Parse(packet, testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 || flows[0].AppName != "dns" || flows[0].AppID != (types.AppID{Engine: 13, Selector: 53}) {
+		t.Errorf("flows = %+v", flows)
+	}
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+const (
+	netflowV1HeaderSize = 16
+	netflowV1RecordSize = 48
+)
+
+// NetFlow v1 Header structure:
+// Bytes 0-1:   Version (1)
+// Bytes 2-3:   Count (number of flows, max 24)
+// Bytes 4-7:   SysUptime (ms since boot)
+// Bytes 8-11:  Unix Secs
+// Bytes 12-15: Unix Nsecs
+
+// NetFlow v1 Record structure:
+// Bytes 0-3:   Source IP
+// Bytes 4-7:   Dest IP
+// Bytes 8-11:  Next Hop
+// Bytes 12-13: Input Interface
+// Bytes 14-15: Output Interface
+// Bytes 16-19: Packets
+// Bytes 20-23: Bytes (Octets)
+// Bytes 24-27: First (SysUptime at start)
+// Bytes 28-31: Last (SysUptime at end)
+// Bytes 32-33: Source Port
+// Bytes 34-35: Dest Port
+// Bytes 36-37: Pad1
+// Byte 38:     Protocol
+// Byte 39:     ToS
+// Byte 40:     TCP Flags
+// Bytes 41-47: Pad2 / Reserved
+
+func (p *Parser) parseNetFlowV1(data []byte, sourceAddr *net.UDPAddr) ([]types.Flow, error) {
+	if len(data) < netflowV1HeaderSize {
+		return nil, fmt.Errorf("NetFlow v1 packet too short for header: %d bytes", len(data))
+	}
+
+	// Parse header
+	count := binary.BigEndian.Uint16(data[2:4])
+	sysUptime := binary.BigEndian.Uint32(data[4:8])
+	unixSecs := binary.BigEndian.Uint32(data[8:12])
+	unixNsecs := binary.BigEndian.Uint32(data[12:16])
+
+	clock := exportClock{
+		exportTime: time.Unix(int64(unixSecs), int64(unixNsecs)),
+		sysUptime:  sysUptime,
+		hasUptime:  true,
+	}
+
+	expectedLen := netflowV1HeaderSize + int(count)*netflowV1RecordSize
+	if len(data) < expectedLen {
+		return nil, fmt.Errorf("NetFlow v1 packet too short: expected %d bytes, got %d", expectedLen, len(data))
+	}
+
+	flows := make([]types.Flow, 0, count)
+
+	for i := 0; i < int(count); i++ {
+		offset := netflowV1HeaderSize + i*netflowV1RecordSize
+		record := data[offset : offset+netflowV1RecordSize]
+
+		firstUptime := binary.BigEndian.Uint32(record[24:28])
+		lastUptime := binary.BigEndian.Uint32(record[28:32])
+
+		flow := types.Flow{
+			Version:    types.NetFlowV1,
+			SrcAddr:    readAddr(record[0:4]),
+			DstAddr:    readAddr(record[4:8]),
+			SrcPort:    binary.BigEndian.Uint16(record[32:34]),
+			DstPort:    binary.BigEndian.Uint16(record[34:36]),
+			Protocol:   record[38],
+			Packets:    uint64(binary.BigEndian.Uint32(record[16:20])),
+			Bytes:      uint64(binary.BigEndian.Uint32(record[20:24])),
+			StartTime:  clock.fromUptime(firstUptime),
+			EndTime:    clock.fromUptime(lastUptime),
+			TCPFlags:   record[40],
+			InputIf:    binary.BigEndian.Uint16(record[12:14]),
+			OutputIf:   binary.BigEndian.Uint16(record[14:16]),
+			ExporterIP: exporterAddr(sourceAddr),
+			ExportTime: clock.exportTime,
+			ReceivedAt: time.Now(),
+		}
+
+		flows = append(flows, flow)
+	}
+
+	return flows, nil
+}
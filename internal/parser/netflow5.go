@@ -58,9 +58,11 @@ func (p *Parser) parseNetFlowV5(data []byte, sourceAddr *net.UDPAddr) ([]types.F
 	unixSecs := binary.BigEndian.Uint32(data[8:12])
 	unixNsecs := binary.BigEndian.Uint32(data[12:16])
 
-	// Calculate base time
-	baseTime := time.Unix(int64(unixSecs), int64(unixNsecs))
-	bootTime := baseTime.Add(-time.Duration(sysUptime) * time.Millisecond)
+	clock := exportClock{
+		exportTime: time.Unix(int64(unixSecs), int64(unixNsecs)),
+		sysUptime:  sysUptime,
+		hasUptime:  true,
+	}
 
 	expectedLen := netflowV5HeaderSize + int(count)*netflowV5RecordSize
 	if len(data) < expectedLen {
@@ -73,27 +75,30 @@ func (p *Parser) parseNetFlowV5(data []byte, sourceAddr *net.UDPAddr) ([]types.F
 		offset := netflowV5HeaderSize + i*netflowV5RecordSize
 		record := data[offset : offset+netflowV5RecordSize]
 
-		// Parse timestamps relative to boot time
+		// Timestamps are sysUptime values, resolved relative to the export time
 		firstUptime := binary.BigEndian.Uint32(record[24:28])
 		lastUptime := binary.BigEndian.Uint32(record[28:32])
 
 		flow := types.Flow{
 			Version:    types.NetFlowV5,
-			SrcAddr:    net.IP(record[0:4]),
-			DstAddr:    net.IP(record[4:8]),
+			SrcAddr:    readAddr(record[0:4]),
+			DstAddr:    readAddr(record[4:8]),
 			SrcPort:    binary.BigEndian.Uint16(record[32:34]),
 			DstPort:    binary.BigEndian.Uint16(record[34:36]),
 			Protocol:   record[38],
 			Packets:    uint64(binary.BigEndian.Uint32(record[16:20])),
 			Bytes:      uint64(binary.BigEndian.Uint32(record[20:24])),
-			StartTime:  bootTime.Add(time.Duration(firstUptime) * time.Millisecond),
-			EndTime:    bootTime.Add(time.Duration(lastUptime) * time.Millisecond),
+			StartTime:  clock.fromUptime(firstUptime),
+			EndTime:    clock.fromUptime(lastUptime),
 			TCPFlags:   record[37],
 			SrcAS:      uint32(binary.BigEndian.Uint16(record[40:42])),
 			DstAS:      uint32(binary.BigEndian.Uint16(record[42:44])),
+			SrcMask:    record[44],
+			DstMask:    record[45],
 			InputIf:    binary.BigEndian.Uint16(record[12:14]),
 			OutputIf:   binary.BigEndian.Uint16(record[14:16]),
-			ExporterIP: sourceAddr.IP,
+			ExporterIP: exporterAddr(sourceAddr),
+			ExportTime: clock.exportTime,
 			ReceivedAt: time.Now(),
 		}
 
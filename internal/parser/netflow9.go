@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"net/netip"
 	"time"
 
 	"netflow-collector/pkg/types"
@@ -40,6 +41,7 @@ const (
 	NF9_ICMP_TYPE         = 32
 	NF9_DIRECTION         = 61
 	NF9_IPV6_NEXT_HOP     = 62
+	NF9_FLOW_END_REASON   = 136
 )
 
 // NetFlow v9 Header:
@@ -61,9 +63,11 @@ func (p *Parser) parseNetFlowV9(data []byte, sourceAddr *net.UDPAddr) ([]types.F
 	unixSecs := binary.BigEndian.Uint32(data[8:12])
 	sourceID := binary.BigEndian.Uint32(data[16:20])
 
-	// Calculate boot time
-	baseTime := time.Unix(int64(unixSecs), 0)
-	bootTime := baseTime.Add(-time.Duration(sysUptime) * time.Millisecond)
+	clock := exportClock{
+		exportTime: time.Unix(int64(unixSecs), 0),
+		sysUptime:  sysUptime,
+		hasUptime:  true,
+	}
 
 	// Ensure template map exists for this source
 	if p.v9Templates[sourceID] == nil {
@@ -89,12 +93,18 @@ func (p *Parser) parseNetFlowV9(data []byte, sourceAddr *net.UDPAddr) ([]types.F
 			// Template FlowSet
 			p.parseV9Templates(flowsetData, sourceID)
 		case flowsetID == 1:
-			// Options Template FlowSet (skip for now)
+			// Options Template FlowSet
+			p.parseV9OptionsTemplates(flowsetData, sourceID)
 		case flowsetID >= 256:
 			// Data FlowSet
 			template := p.v9Templates[sourceID][flowsetID]
-			if template != nil {
-				parsedFlows := p.parseV9DataFlowSet(flowsetData, template, sourceAddr, bootTime)
+			if template == nil {
+				break
+			}
+			if template.Options {
+				p.parseOptionsDataSet(flowsetData, template, sourceID)
+			} else {
+				parsedFlows := p.parseV9DataFlowSet(flowsetData, template, sourceAddr, clock)
 				flows = append(flows, parsedFlows...)
 			}
 		}
@@ -102,6 +112,8 @@ func (p *Parser) parseNetFlowV9(data []byte, sourceAddr *net.UDPAddr) ([]types.F
 		offset += int(flowsetLen)
 	}
 
+	p.resolveAppNames(flows, sourceID)
+
 	return flows, nil
 }
 
@@ -134,7 +146,7 @@ func (p *Parser) parseV9Templates(data []byte, sourceID uint32) {
 	}
 }
 
-func (p *Parser) parseV9DataFlowSet(data []byte, template *Template, sourceAddr *net.UDPAddr, bootTime time.Time) []types.Flow {
+func (p *Parser) parseV9DataFlowSet(data []byte, template *Template, sourceAddr *net.UDPAddr, clock exportClock) []types.Flow {
 	var flows []types.Flow
 
 	recordLen := template.Length
@@ -144,7 +156,7 @@ func (p *Parser) parseV9DataFlowSet(data []byte, template *Template, sourceAddr
 
 	for offset := 0; offset+recordLen <= len(data); offset += recordLen {
 		record := data[offset : offset+recordLen]
-		flow := p.parseV9Record(record, template, sourceAddr, bootTime)
+		flow := p.parseV9Record(record, template, sourceAddr, clock)
 		if flow != nil {
 			flows = append(flows, *flow)
 		}
@@ -153,12 +165,14 @@ func (p *Parser) parseV9DataFlowSet(data []byte, template *Template, sourceAddr
 	return flows
 }
 
-func (p *Parser) parseV9Record(record []byte, template *Template, sourceAddr *net.UDPAddr, bootTime time.Time) *types.Flow {
+func (p *Parser) parseV9Record(record []byte, template *Template, sourceAddr *net.UDPAddr, clock exportClock) *types.Flow {
 	flow := &types.Flow{
 		Version:    types.NetFlowV9,
-		ExporterIP: sourceAddr.IP,
+		ExporterIP: exporterAddr(sourceAddr),
+		ExportTime: clock.exportTime,
 		ReceivedAt: time.Now(),
 	}
+	var times recordTimes
 
 	offset := 0
 	for _, field := range template.FieldDefs {
@@ -170,25 +184,25 @@ func (p *Parser) parseV9Record(record []byte, template *Template, sourceAddr *ne
 
 		switch field.Type {
 		case NF9_IPV4_SRC_ADDR:
-			flow.SrcAddr = net.IP(fieldData)
+			flow.SrcAddr = readAddr(fieldData)
 		case NF9_IPV4_DST_ADDR:
-			flow.DstAddr = net.IP(fieldData)
+			flow.DstAddr = readAddr(fieldData)
 		case NF9_IPV6_SRC_ADDR:
-			flow.SrcAddr = net.IP(fieldData)
+			flow.SrcAddr = readAddr(fieldData)
 		case NF9_IPV6_DST_ADDR:
-			flow.DstAddr = net.IP(fieldData)
+			flow.DstAddr = readAddr(fieldData)
 		case NF9_L4_SRC_PORT:
-			flow.SrcPort = binary.BigEndian.Uint16(fieldData)
+			flow.SrcPort = uint16(readUint(fieldData))
 		case NF9_L4_DST_PORT:
-			flow.DstPort = binary.BigEndian.Uint16(fieldData)
+			flow.DstPort = uint16(readUint(fieldData))
 		case NF9_PROTOCOL:
-			flow.Protocol = fieldData[0]
+			flow.Protocol = uint8(readUint(fieldData))
 		case NF9_IN_BYTES:
 			flow.Bytes = readUint(fieldData)
 		case NF9_IN_PKTS:
 			flow.Packets = readUint(fieldData)
 		case NF9_TCP_FLAGS:
-			flow.TCPFlags = fieldData[0]
+			flow.TCPFlags = uint8(readUint(fieldData))
 		case NF9_SRC_AS:
 			flow.SrcAS = uint32(readUint(fieldData))
 		case NF9_DST_AS:
@@ -197,21 +211,29 @@ func (p *Parser) parseV9Record(record []byte, template *Template, sourceAddr *ne
 			flow.InputIf = uint16(readUint(fieldData))
 		case NF9_OUTPUT_SNMP:
 			flow.OutputIf = uint16(readUint(fieldData))
-		case NF9_FIRST_SWITCHED:
-			uptime := binary.BigEndian.Uint32(fieldData)
-			flow.StartTime = bootTime.Add(time.Duration(uptime) * time.Millisecond)
-		case NF9_LAST_SWITCHED:
-			uptime := binary.BigEndian.Uint32(fieldData)
-			flow.EndTime = bootTime.Add(time.Duration(uptime) * time.Millisecond)
+		case NF9_FLOW_END_REASON:
+			flow.EndReason = types.EndReason(readUint(fieldData))
+		case FIELD_APPLICATION_ID:
+			flow.AppID = parseAppID(fieldData)
+		case FIELD_APPLICATION_NAME:
+			flow.AppName = readString(fieldData)
+		case PAN_APP_ID:
+			flow.AppName = readString(fieldData)
+		default:
+			// FIRST_SWITCHED/LAST_SWITCHED and absolute timestamps (e.g. Cisco ASA)
+			times.decode(flow, field.Type, fieldData, clock)
 		}
 
 		offset += int(field.Length)
 	}
 
+	times.apply(flow, clock)
+
 	return flow
 }
 
-// readUint reads a variable-length unsigned integer
+// readUint reads a variable-length unsigned integer (reduced-size encoding, up to 8 bytes).
+// Fields of any length are safe: an empty value is 0, longer values keep the low bytes.
 func readUint(data []byte) uint64 {
 	switch len(data) {
 	case 1:
@@ -222,7 +244,25 @@ func readUint(data []byte) uint64 {
 		return uint64(binary.BigEndian.Uint32(data))
 	case 8:
 		return binary.BigEndian.Uint64(data)
-	default:
-		return 0
 	}
+	if len(data) > 8 {
+		data = data[len(data)-8:]
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// readAddr converts an IPv4 or IPv6 address field. The result does not reference
+// the packet buffer, so stored flows don't keep whole packets alive.
+func readAddr(data []byte) netip.Addr {
+	addr, _ := netip.AddrFromSlice(data)
+	return addr.Unmap()
+}
+
+// exporterAddr returns the address of the exporter that sent a packet
+func exporterAddr(sourceAddr *net.UDPAddr) netip.Addr {
+	return sourceAddr.AddrPort().Addr().Unmap()
 }
@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"bytes"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Golden packets share the header clock: sysUptime 3600000 ms (0x0036ee80),
+// export time 2024-03-01 12:00:00.5 UTC (0x65e1c340 s, 0x1dcd6500 ns). The
+// records start at uptime 3590000 (0x0036c770) and end at 3599000 (0x0036ea98).
+var (
+	goldenExport = testExportTime.Add(500 * time.Millisecond)
+	goldenStart  = goldenExport.Add(-10 * time.Second)
+	goldenEnd    = goldenExport.Add(-time.Second)
+)
+
+// checkFlows compares parsed flows with the expected ones, ignoring the receive
+// time (and the plausibility check against it) and time zones
+func checkFlows(t *testing.T, got, want []types.Flow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d flows, want %d", len(got), len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		g.ReceivedAt, g.TimeImplausible = time.Time{}, false
+		for _, ts := range []*time.Time{&g.StartTime, &g.EndTime, &g.ExportTime, &w.StartTime, &w.EndTime, &w.ExportTime} {
+			*ts = ts.UTC()
+		}
+		if w.ExporterIP == (netip.Addr{}) {
+			w.ExporterIP = netip.MustParseAddr("192.0.2.1")
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("flow %d:\n got %+v\nwant %+v", i, g, w)
+		}
+	}
+}
+
+func TestNetFlowV1Golden(t *testing.T) {
+	packet := bytes.Join([][]byte{
+		{0x00, 0x01, 0x00, 0x01, 0x00, 0x36, 0xee, 0x80, 0x65, 0xe1, 0xc3, 0x40, 0x1d, 0xcd, 0x65, 0x00},
+		{
+			10, 0, 0, 1, // Source IP
+			192, 168, 1, 10, // Dest IP
+			10, 0, 0, 254, // Next hop
+			0x00, 0x03, 0x00, 0x04, // Input, output interface
+			0x00, 0x00, 0x00, 0x0a, // Packets
+			0x00, 0x00, 0x05, 0xdc, // Bytes
+			0x00, 0x36, 0xc7, 0x70, 0x00, 0x36, 0xea, 0x98, // First, last
+			0xc3, 0x50, 0x00, 0x50, // Ports 50000 -> 80
+			0x00, 0x00, // Pad
+			6, 0, 0x1b, // Protocol, ToS, TCP flags
+			0, 0, 0, 0, 0, 0, 0, // Pad
+		},
+	}, nil)
+
+	flows, err := New().Parse(packet, testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFlows(t, flows, []types.Flow{{
+		Version: types.NetFlowV1, SrcAddr: netip.MustParseAddr("10.0.0.1"), DstAddr: netip.MustParseAddr("192.168.1.10"),
+		SrcPort: 50000, DstPort: 80, Protocol: 6, TCPFlags: 0x1b, Packets: 10, Bytes: 1500, InputIf: 3, OutputIf: 4,
+		StartTime: goldenStart, EndTime: goldenEnd, ExportTime: goldenExport,
+	}})
+
+	if _, err := New().Parse(packet[:len(packet)-1], testExporter); err == nil {
+		t.Error("short record: no error")
+	}
+}
+
+func TestNetFlowV7Golden(t *testing.T) {
+	packet := bytes.Join([][]byte{
+		{0x00, 0x07, 0x00, 0x01, 0x00, 0x36, 0xee, 0x80, 0x65, 0xe1, 0xc3, 0x40, 0x1d, 0xcd, 0x65, 0x00},
+		{0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x00}, // Flow sequence, reserved
+		{
+			172, 16, 5, 20, // Source IP
+			8, 8, 8, 8, // Dest IP
+			0, 0, 0, 0, // Next hop
+			0x00, 0x0b, 0x00, 0x0c, // Input, output interface
+			0x00, 0x00, 0x00, 0x02, // Packets
+			0x00, 0x00, 0x00, 0x8c, // Bytes
+			0x00, 0x36, 0xc7, 0x70, 0x00, 0x36, 0xea, 0x98, // First, last
+			0xd4, 0x31, 0x00, 0x35, // Ports 54321 -> 53
+			0x00, 0x00, 17, 0, // Flags, TCP flags, protocol, ToS
+			0xfc, 0x00, 0x3b, 0x41, // AS 64512 -> 15169
+			24, 32, 0x00, 0x00, // Masks, flags2
+			10, 0, 0, 254, // Router shortcut
+		},
+	}, nil)
+
+	flows, err := New().Parse(packet, testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFlows(t, flows, []types.Flow{{
+		Version: types.NetFlowV7, SrcAddr: netip.MustParseAddr("172.16.5.20"), DstAddr: netip.MustParseAddr("8.8.8.8"),
+		SrcPort: 54321, DstPort: 53, Protocol: 17, Packets: 2, Bytes: 140, InputIf: 11, OutputIf: 12,
+		SrcAS: 64512, DstAS: 15169, SrcMask: 24, DstMask: 32,
+		StartTime: goldenStart, EndTime: goldenEnd, ExportTime: goldenExport,
+	}})
+
+	if _, err := New().Parse(packet[:len(packet)-1], testExporter); err == nil {
+		t.Error("short record: no error")
+	}
+}
+
+func TestNetFlowV8Golden(t *testing.T) {
+	header := func(scheme byte) []byte {
+		return []byte{
+			0x00, 0x08, 0x00, 0x01, 0x00, 0x36, 0xee, 0x80, 0x65, 0xe1, 0xc3, 0x40, 0x1d, 0xcd, 0x65, 0x00,
+			0x00, 0x00, 0x00, 0x2a, // Flow sequence
+			0, 0, scheme, 2, // Engine type and ID, aggregation scheme and version
+			0, 0, 0, 0,
+		}
+	}
+	common := []byte{
+		0x00, 0x00, 0x00, 0x07, // Flows
+		0x00, 0x00, 0x00, 0x64, // Packets
+		0x00, 0x01, 0x86, 0xa0, // Bytes
+		0x00, 0x36, 0xc7, 0x70, 0x00, 0x36, 0xea, 0x98, // First, last
+	}
+	base := types.Flow{
+		Version: types.NetFlowV8, SrcAddr: netip.IPv4Unspecified(), DstAddr: netip.IPv4Unspecified(),
+		FlowCount: 7, Packets: 100, Bytes: 100000,
+		StartTime: goldenStart, EndTime: goldenEnd, ExportTime: goldenExport,
+	}
+	with := func(agg types.Aggregation, set func(*types.Flow)) types.Flow {
+		f := base
+		f.Aggregation = agg
+		set(&f)
+		return f
+	}
+
+	for _, tc := range []struct {
+		name   string
+		scheme byte
+		key    []byte
+		want   types.Flow
+	}{
+		{"AS", 1, []byte{
+			0x0c, 0xf8, 0x3b, 0x41, // AS 3320 -> 15169
+			0x00, 0x01, 0x00, 0x02, // Input, output interface
+		}, with(types.AggregationAS, func(f *types.Flow) {
+			f.SrcAS, f.DstAS, f.InputIf, f.OutputIf = 3320, 15169, 1, 2
+		})},
+		{"protocol-port", 2, []byte{
+			6, 0, 0, 0, // Protocol, pad, reserved
+			0x00, 0x00, 0x01, 0xbb, // Ports 0 -> 443
+		}, with(types.AggregationProtoPort, func(f *types.Flow) {
+			f.Protocol, f.DstPort = 6, 443
+		})},
+		{"source prefix", 3, []byte{
+			10, 1, 0, 0, 16, 0, // Prefix, mask, pad
+			0xfc, 0x00, 0x00, 0x05, 0, 0, // AS 64512, input 5, reserved
+		}, with(types.AggregationSrcPrefix, func(f *types.Flow) {
+			f.SrcAddr, f.SrcMask, f.SrcAS, f.InputIf = netip.MustParseAddr("10.1.0.0"), 16, 64512, 5
+		})},
+		{"destination prefix", 4, []byte{
+			192, 0, 2, 0, 24, 0, // Prefix, mask, pad
+			0x3b, 0x41, 0x00, 0x06, 0, 0, // AS 15169, output 6, reserved
+		}, with(types.AggregationDstPrefix, func(f *types.Flow) {
+			f.DstAddr, f.DstMask, f.DstAS, f.OutputIf = netip.MustParseAddr("192.0.2.0"), 24, 15169, 6
+		})},
+		{"prefix", 5, []byte{
+			10, 1, 0, 0, 192, 0, 2, 0, // Source and dest prefix
+			24, 16, 0, 0, // Dest mask, source mask, reserved
+			0xfc, 0x00, 0x3b, 0x41, // AS 64512 -> 15169
+			0x00, 0x05, 0x00, 0x06, // Input, output interface
+		}, with(types.AggregationPrefix, func(f *types.Flow) {
+			f.SrcAddr, f.DstAddr = netip.MustParseAddr("10.1.0.0"), netip.MustParseAddr("192.0.2.0")
+			f.SrcMask, f.DstMask, f.SrcAS, f.DstAS, f.InputIf, f.OutputIf = 16, 24, 64512, 15169, 5, 6
+		})},
+	} {
+		packet := bytes.Join([][]byte{header(tc.scheme), common, tc.key}, nil)
+		flows, err := New().Parse(packet, testExporter)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) { checkFlows(t, flows, []types.Flow{tc.want}) })
+
+		if _, err := New().Parse(packet[:len(packet)-1], testExporter); err == nil {
+			t.Errorf("%s: short record: no error", tc.name)
+		}
+	}
+
+	// Other schemes (e.g. ToS variants) are rejected instead of misread
+	if _, err := New().Parse(bytes.Join([][]byte{header(9), common, make([]byte, 20)}, nil), testExporter); err == nil {
+		t.Error("scheme 9: no error")
+	}
+}
@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Application identification field types (RFC 6759, shared by NetFlow v9 and IPFIX)
+const (
+	FIELD_APPLICATION_DESCRIPTION = 94
+	FIELD_APPLICATION_ID          = 95
+	FIELD_APPLICATION_NAME        = 96
+)
+
+// Palo Alto Networks vendor fields
+const (
+	PAN_ENTERPRISE_NUMBER = 25461
+	PAN_APP_ID            = 56701 // App-ID as 32-byte string (NetFlow v9 field type)
+	PAN_USER_ID           = 56702
+)
+
+// ipfixVariableLength marks a variable-length field in an IPFIX template (RFC 7011 section 7)
+const ipfixVariableLength = 65535
+
+// NetFlow v9 Options Template (FlowSet ID 1):
+// Bytes 0-1:   Template ID
+// Bytes 2-3:   Option Scope Length (bytes)
+// Bytes 4-5:   Option Length (bytes)
+// Followed by scope field specifiers, then option field specifiers (type, length)
+
+func (p *Parser) parseV9OptionsTemplates(data []byte, sourceID uint32) {
+	offset := 0
+
+	for offset+6 <= len(data) {
+		templateID := binary.BigEndian.Uint16(data[offset:])
+		scopeLen := int(binary.BigEndian.Uint16(data[offset+2:]))
+		optionLen := int(binary.BigEndian.Uint16(data[offset+4:]))
+		offset += 6
+
+		// Remaining bytes are padding
+		if templateID < 256 || offset+scopeLen+optionLen > len(data) {
+			break
+		}
+
+		template := &Template{
+			ID:      templateID,
+			Options: true,
+		}
+
+		end := offset + scopeLen + optionLen
+		for ; offset+4 <= end; offset += 4 {
+			fieldType := binary.BigEndian.Uint16(data[offset:])
+			fieldLen := binary.BigEndian.Uint16(data[offset+2:])
+			template.FieldDefs = append(template.FieldDefs, FieldDef{Type: fieldType, Length: fieldLen})
+			template.Length += int(fieldLen)
+		}
+		offset = end
+
+		p.v9Templates[sourceID][templateID] = template
+	}
+}
+
+// IPFIX Options Template Set (Set ID 3):
+// Bytes 0-1:   Template ID
+// Bytes 2-3:   Field Count
+// Bytes 4-5:   Scope Field Count
+// Followed by field specifiers (with optional enterprise number)
+
+func (p *Parser) parseIPFIXOptionsTemplates(data []byte, observationDomainID uint32) {
+	offset := 0
+
+	for offset+6 <= len(data) {
+		templateID := binary.BigEndian.Uint16(data[offset:])
+		fieldCount := binary.BigEndian.Uint16(data[offset+2:])
+		offset += 6
+
+		// Remaining bytes are padding
+		if templateID < 256 {
+			break
+		}
+
+		template := &Template{
+			ID:        templateID,
+			FieldDefs: make([]FieldDef, 0, fieldCount),
+			Options:   true,
+		}
+
+		for i := 0; i < int(fieldCount); i++ {
+			field, next, ok := readIPFIXFieldSpec(data, offset)
+			if !ok {
+				return
+			}
+			offset = next
+			template.addField(field)
+		}
+
+		p.ipfixTemplates[observationDomainID][templateID] = template
+	}
+}
+
+// parseOptionsDataSet extracts application ID -> name mappings from options data records
+// (Cisco exports these as an "application table" options template) and the exporter's
+// system init time that IPFIX uptime fields are relative to
+func (p *Parser) parseOptionsDataSet(data []byte, template *Template, domain uint32) {
+	if template.Length == 0 {
+		return
+	}
+
+	for offset := 0; offset+template.Length <= len(data); {
+		values, n, ok := splitRecord(data[offset:], template)
+		if !ok {
+			return
+		}
+		offset += n
+
+		var appID types.AppID
+		var appName string
+		for i, field := range template.FieldDefs {
+			if field.Enterprise != 0 {
+				continue
+			}
+			switch field.Type {
+			case FIELD_APPLICATION_ID:
+				appID = parseAppID(values[i])
+			case FIELD_APPLICATION_NAME:
+				appName = readString(values[i])
+			case FIELD_SYSTEM_INIT_TIME_MILLISECOND:
+				p.initTimes[domain] = time.UnixMilli(int64(readUint(values[i])))
+			}
+		}
+
+		if appID.IsZero() || appName == "" {
+			continue
+		}
+		if p.appNames[domain] == nil {
+			p.appNames[domain] = make(map[types.AppID]string)
+		}
+		p.appNames[domain][appID] = appName
+	}
+}
+
+// resolveAppNames fills in application names for flows that only carry an application ID
+func (p *Parser) resolveAppNames(flows []types.Flow, domain uint32) {
+	names := p.appNames[domain]
+	if len(names) == 0 {
+		return
+	}
+	for i := range flows {
+		if flows[i].AppName == "" && !flows[i].AppID.IsZero() {
+			flows[i].AppName = names[flows[i].AppID]
+		}
+	}
+}
+
+// addField appends a field definition and updates the (minimum) record length
+func (t *Template) addField(field FieldDef) {
+	t.FieldDefs = append(t.FieldDefs, field)
+	if field.Length == ipfixVariableLength {
+		// Variable-length fields take at least the 1-byte length prefix
+		t.Variable = true
+		t.Length++
+		return
+	}
+	t.Length += int(field.Length)
+}
+
+// splitRecord splits a data record into its field values and returns the number
+// of bytes consumed. Variable-length IPFIX fields are decoded per RFC 7011 section 7.
+func splitRecord(data []byte, template *Template) ([][]byte, int, bool) {
+	values := make([][]byte, len(template.FieldDefs))
+	offset := 0
+
+	for i, field := range template.FieldDefs {
+		length := int(field.Length)
+		if template.Variable && field.Length == ipfixVariableLength {
+			if offset >= len(data) {
+				return nil, 0, false
+			}
+			length = int(data[offset])
+			offset++
+			if length == 255 {
+				if offset+2 > len(data) {
+					return nil, 0, false
+				}
+				length = int(binary.BigEndian.Uint16(data[offset:]))
+				offset += 2
+			}
+		}
+		if offset+length > len(data) {
+			return nil, 0, false
+		}
+		values[i] = data[offset : offset+length]
+		offset += length
+	}
+
+	return values, offset, true
+}
+
+// parseAppID decodes an RFC 6759 applicationId: 1 byte classification engine ID
+// followed by the selector ID
+func parseAppID(data []byte) types.AppID {
+	if len(data) == 0 {
+		return types.AppID{}
+	}
+	return types.AppID{
+		Engine:   data[0],
+		Selector: readUint(data[1:]),
+	}
+}
+
+// readString reads a fixed or variable-length string field, dropping NUL padding
+func readString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00 ")
+}
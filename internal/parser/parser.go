@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"time"
 
 	"netflow-collector/pkg/types"
 )
@@ -13,19 +14,29 @@ type Parser struct {
 	// Template cache for NetFlow v9 and IPFIX
 	v9Templates   map[uint32]map[uint16]*Template
 	ipfixTemplates map[uint32]map[uint16]*Template
+
+	// Application ID -> name mapping learned from options data records,
+	// keyed by source ID (v9) or observation domain ID (IPFIX)
+	appNames map[uint32]map[types.AppID]string
+
+	// IPFIX systemInitTimeMilliseconds learned from options data, keyed by observation domain ID
+	initTimes map[uint32]time.Time
 }
 
 // Template represents a NetFlow v9 or IPFIX template
 type Template struct {
 	ID        uint16
 	FieldDefs []FieldDef
-	Length    int
+	Length    int  // Record length; minimum length if the template has variable-length fields
+	Variable  bool // Template contains IPFIX variable-length fields
+	Options   bool // Options template (records carry metadata, not flows)
 }
 
 // FieldDef defines a field in a template
 type FieldDef struct {
-	Type   uint16
-	Length uint16
+	Type       uint16
+	Length     uint16
+	Enterprise uint32 // IPFIX Private Enterprise Number, 0 for IANA fields
 }
 
 // New creates a new parser
@@ -33,6 +44,8 @@ func New() *Parser {
 	return &Parser{
 		v9Templates:    make(map[uint32]map[uint16]*Template),
 		ipfixTemplates: make(map[uint32]map[uint16]*Template),
+		appNames:       make(map[uint32]map[types.AppID]string),
+		initTimes:      make(map[uint32]time.Time),
 	}
 }
 
@@ -44,16 +57,31 @@ func (p *Parser) Parse(data []byte, sourceAddr *net.UDPAddr) ([]types.Flow, erro
 
 	version := binary.BigEndian.Uint16(data[0:2])
 
+	var flows []types.Flow
+	var err error
+
 	switch version {
+	case 1:
+		flows, err = p.parseNetFlowV1(data, sourceAddr)
 	case 5:
-		return p.parseNetFlowV5(data, sourceAddr)
+		flows, err = p.parseNetFlowV5(data, sourceAddr)
+	case 7:
+		flows, err = p.parseNetFlowV7(data, sourceAddr)
+	case 8:
+		flows, err = p.parseNetFlowV8(data, sourceAddr)
 	case 9:
-		return p.parseNetFlowV9(data, sourceAddr)
+		flows, err = p.parseNetFlowV9(data, sourceAddr)
 	case 10:
-		return p.parseIPFIX(data, sourceAddr)
+		flows, err = p.parseIPFIX(data, sourceAddr)
 	default:
 		return nil, fmt.Errorf("unsupported NetFlow version: %d", version)
 	}
+
+	for i := range flows {
+		flows[i].TimeImplausible = flows[i].HasImplausibleTimestamps()
+	}
+
+	return flows, err
 }
 
 // GetVersion returns the version from packet data without full parsing
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"encoding/binary"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Timestamp field types shared by IPFIX and NetFlow v9 (RFC 7012 / Cisco ASA NSEL)
+const (
+	FIELD_FLOW_END_SYS_UP_TIME         = 21
+	FIELD_FLOW_START_SYS_UP_TIME       = 22
+	FIELD_FLOW_START_SECONDS           = 150
+	FIELD_FLOW_END_SECONDS             = 151
+	FIELD_FLOW_START_MILLISECONDS      = 152
+	FIELD_FLOW_END_MILLISECONDS        = 153
+	FIELD_FLOW_START_MICROSECONDS      = 154
+	FIELD_FLOW_END_MICROSECONDS        = 155
+	FIELD_FLOW_START_NANOSECONDS       = 156
+	FIELD_FLOW_END_NANOSECONDS         = 157
+	FIELD_FLOW_START_DELTA_MICROSECOND = 158
+	FIELD_FLOW_END_DELTA_MICROSECOND   = 159
+	FIELD_SYSTEM_INIT_TIME_MILLISECOND = 160
+)
+
+// uptimeWrap is the period of a 32-bit millisecond uptime counter (~49.7 days)
+const uptimeWrap = (1 << 32) * time.Millisecond
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 (NTP) and 1970-01-01 (Unix)
+const ntpEpochOffset = 2208988800
+
+// exportClock holds the timing information of one export packet that flow
+// timestamps are relative to
+type exportClock struct {
+	exportTime time.Time // Export time from the packet header
+	sysUptime  uint32    // Exporter uptime at export in ms (NetFlow header)
+	hasUptime  bool      // sysUptime is valid (not available in IPFIX headers)
+	initTime   time.Time // IPFIX systemInitTimeMilliseconds, zero if unknown
+}
+
+// fromUptime converts a sysUptime-relative timestamp (ms) into wall-clock time.
+// The 32-bit counter wraps every 49.7 days, so the result is always chosen
+// relative to the export time rather than by adding the uptime to the boot time.
+func (c exportClock) fromUptime(uptime uint32) time.Time {
+	if !c.initTime.IsZero() {
+		// initTime + uptime is only correct for the first counter period;
+		// move forward by whole wraps until we are closest to the export time
+		t := c.initTime.Add(time.Duration(uptime) * time.Millisecond)
+		if behind := c.exportTime.Sub(t); behind > uptimeWrap/2 {
+			t = t.Add((behind + uptimeWrap/2) / uptimeWrap * uptimeWrap)
+		}
+		return t
+	}
+
+	// Signed modular difference: a flow that started before the counter wrapped
+	// has a larger uptime than the header but still lies in the past
+	delta := int32(c.sysUptime - uptime)
+	return c.exportTime.Add(-time.Duration(delta) * time.Millisecond)
+}
+
+// recordTimes collects the timestamp fields of a single v9/IPFIX record. Uptime
+// values can only be resolved once the whole record (which may carry its own
+// system init time) has been read.
+type recordTimes struct {
+	startUptime, endUptime uint32
+	hasStart, hasEnd       bool
+	initTime               time.Time
+}
+
+// decode handles a timestamp field and reports whether the field type was one
+func (r *recordTimes) decode(flow *types.Flow, fieldType uint16, data []byte, clock exportClock) bool {
+	switch fieldType {
+	case FIELD_FLOW_START_SYS_UP_TIME:
+		r.startUptime, r.hasStart = uint32(readUint(data)), true
+	case FIELD_FLOW_END_SYS_UP_TIME:
+		r.endUptime, r.hasEnd = uint32(readUint(data)), true
+	case FIELD_SYSTEM_INIT_TIME_MILLISECOND:
+		r.initTime = time.UnixMilli(int64(readUint(data)))
+	case FIELD_FLOW_START_SECONDS:
+		flow.StartTime = time.Unix(int64(readUint(data)), 0)
+	case FIELD_FLOW_END_SECONDS:
+		flow.EndTime = time.Unix(int64(readUint(data)), 0)
+	case FIELD_FLOW_START_MILLISECONDS:
+		flow.StartTime = time.UnixMilli(int64(readUint(data)))
+	case FIELD_FLOW_END_MILLISECONDS:
+		flow.EndTime = time.UnixMilli(int64(readUint(data)))
+	case FIELD_FLOW_START_MICROSECONDS, FIELD_FLOW_START_NANOSECONDS:
+		flow.StartTime = readNTPTime(data)
+	case FIELD_FLOW_END_MICROSECONDS, FIELD_FLOW_END_NANOSECONDS:
+		flow.EndTime = readNTPTime(data)
+	case FIELD_FLOW_START_DELTA_MICROSECOND:
+		flow.StartTime = clock.exportTime.Add(-time.Duration(readUint(data)) * time.Microsecond)
+	case FIELD_FLOW_END_DELTA_MICROSECOND:
+		flow.EndTime = clock.exportTime.Add(-time.Duration(readUint(data)) * time.Microsecond)
+	default:
+		return false
+	}
+	return true
+}
+
+// apply resolves the collected uptime values into the flow's start and end time
+func (r *recordTimes) apply(flow *types.Flow, clock exportClock) {
+	if !r.hasStart && !r.hasEnd {
+		return
+	}
+	if !r.initTime.IsZero() {
+		clock.initTime = r.initTime
+	}
+	if clock.initTime.IsZero() && !clock.hasUptime {
+		// IPFIX without systemInitTimeMilliseconds: there is no reference for
+		// the uptime values, so leave the times unset instead of guessing
+		return
+	}
+	if r.hasStart {
+		flow.StartTime = clock.fromUptime(r.startUptime)
+	}
+	if r.hasEnd {
+		flow.EndTime = clock.fromUptime(r.endUptime)
+	}
+}
+
+// readNTPTime decodes an NTP 64-bit timestamp (dateTimeMicroseconds/-Nanoseconds):
+// 32 bit seconds since 1900 followed by a 32 bit binary fraction
+func readNTPTime(data []byte) time.Time {
+	if len(data) < 8 {
+		return time.Time{}
+	}
+	secs := int64(binary.BigEndian.Uint32(data[0:4])) - ntpEpochOffset
+	frac := uint64(binary.BigEndian.Uint32(data[4:8]))
+	nsecs := int64(frac * uint64(time.Second) >> 32)
+	return time.Unix(secs, nsecs)
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestFromUptime(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, tc := range []struct {
+		name      string
+		sysUptime uint32
+		uptime    uint32
+		boot      time.Duration // System init time before export, 0 if unknown
+		want      time.Duration // Relative to the export time
+	}{
+		{"before export", 3600000, 3590000, 0, -10 * time.Second},
+		{"after export", 3600000, 3600500, 0, 500 * time.Millisecond},
+		{"same tick", 3600000, 3600000, 0, 0},
+		{"counter wrapped since start", 1000, 0xfffffc18, 0, -2 * time.Second},
+		{"last tick before wrap", 0, 0xffffffff, 0, -time.Millisecond},
+		{"first tick after wrap", 0xffffffff, 0, 0, time.Millisecond},
+		{"header at wrap", 0xffffffff, 0xfffffffe, 0, -time.Millisecond},
+		{"init time", 0, 590000, 10 * time.Minute, -10 * time.Second},
+		{"init time, one wrap", 0, uint32((60*day - 10*time.Second) / time.Millisecond % (1 << 32)), 60 * day, -10 * time.Second},
+		{"init time, two wraps", 0, uint32((100*day + time.Minute) / time.Millisecond % (1 << 32)), 100 * day, time.Minute},
+		{"init time, start before wrap", 0, 0xffffffff, uptimeWrap + time.Second, -time.Second - time.Millisecond},
+	} {
+		clock := exportClock{exportTime: testExportTime, sysUptime: tc.sysUptime, hasUptime: true}
+		if tc.boot != 0 {
+			clock.initTime = testExportTime.Add(-tc.boot)
+		}
+		if got := clock.fromUptime(tc.uptime).Sub(testExportTime); got != tc.want {
+			t.Errorf("%s: %v from export, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNetFlowV5UptimeWraparound(t *testing.T) {
+	// Header uptime 1000 ms just after the counter wrapped, flow started 2 s
+	// before export (uptime 0xfffffc18) and ended 500 ms before export
+	record := make([]byte, netflowV5RecordSize)
+	copy(record[0:8], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+	binary.BigEndian.PutUint32(record[24:28], 0xfffffc18)
+	binary.BigEndian.PutUint32(record[28:32], 500)
+	packet := bytes.Join([][]byte{
+		{0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x03, 0xe8, 0x65, 0xe1, 0xc3, 0x40, 0x00, 0x00, 0x00, 0x00},
+		make([]byte, 8), record,
+	}, nil)
+
+	flows, err := New().Parse(packet, testExporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("got %d flows", len(flows))
+	}
+	if got := flows[0].StartTime.Sub(testExportTime); got != -2*time.Second {
+		t.Errorf("start %v from export, want -2s", got)
+	}
+	if got := flows[0].EndTime.Sub(testExportTime); got != -500*time.Millisecond {
+		t.Errorf("end %v from export, want -500ms", got)
+	}
+}
+
+func TestIPFIXTimestampFields(t *testing.T) {
+	ntp := func(secs, frac uint32) []byte { return append(u32(secs), u32(frac)...) }
+	exportNTP := uint32(testExportTime.Unix() + ntpEpochOffset)
+	ms := func(d time.Duration) []byte {
+		return binary.BigEndian.AppendUint64(nil, uint64(testExportTime.Add(d).UnixMilli()))
+	}
+
+	for _, tc := range []struct {
+		name       string
+		specs      []uint16
+		values     []byte
+		start, end time.Duration // Relative to the export time
+		unset      bool          // Start and end stay zero
+	}{
+		{"seconds", []uint16{FIELD_FLOW_START_SECONDS, 4, FIELD_FLOW_END_SECONDS, 4},
+			append(u32(uint32(testExportTime.Unix()-30)), u32(uint32(testExportTime.Unix()))...), -30 * time.Second, 0, false},
+		{"milliseconds", []uint16{FIELD_FLOW_START_MILLISECONDS, 8, FIELD_FLOW_END_MILLISECONDS, 8},
+			append(ms(-1500*time.Millisecond), ms(-250*time.Millisecond)...), -1500 * time.Millisecond, -250 * time.Millisecond, false},
+		{"microseconds", []uint16{FIELD_FLOW_START_MICROSECONDS, 8, FIELD_FLOW_END_MICROSECONDS, 8},
+			append(ntp(exportNTP-2, 0x80000000), ntp(exportNTP, 0x40000000)...), -1500 * time.Millisecond, 250 * time.Millisecond, false},
+		{"nanoseconds", []uint16{FIELD_FLOW_START_NANOSECONDS, 8, FIELD_FLOW_END_NANOSECONDS, 8},
+			append(ntp(exportNTP-1, 0x00000001), ntp(exportNTP-1, 0xffffffff)...), -time.Second, -time.Nanosecond, false},
+		{"delta microseconds", []uint16{FIELD_FLOW_START_DELTA_MICROSECOND, 4, FIELD_FLOW_END_DELTA_MICROSECOND, 4},
+			append(u32(1500000), u32(250)...), -1500 * time.Millisecond, -250 * time.Microsecond, false},
+		{"uptime with init time in the record", []uint16{FIELD_SYSTEM_INIT_TIME_MILLISECOND, 8, FIELD_FLOW_START_SYS_UP_TIME, 4, FIELD_FLOW_END_SYS_UP_TIME, 4},
+			bytes.Join([][]byte{ms(-time.Hour), u32(3590000), u32(3599000)}, nil), -10 * time.Second, -time.Second, false},
+		{"uptime without init time", []uint16{FIELD_FLOW_START_SYS_UP_TIME, 4, FIELD_FLOW_END_SYS_UP_TIME, 4},
+			append(u32(3590000), u32(3599000)...), 0, 0, true},
+	} {
+		template := ipfixSet(2, u16(256), u16(uint16(len(tc.specs)/2)), fields(tc.specs...))
+		flows, err := New().Parse(ipfixPacket(template, ipfixSet(256, tc.values)), testExporter)
+		if err != nil || len(flows) != 1 {
+			t.Errorf("%s: %v, %d flows", tc.name, err, len(flows))
+			continue
+		}
+		f := flows[0]
+		if tc.unset {
+			if !f.StartTime.IsZero() || !f.EndTime.IsZero() {
+				t.Errorf("%s: times %v - %v, want unset", tc.name, f.StartTime, f.EndTime)
+			}
+			continue
+		}
+		if got := f.StartTime.Sub(testExportTime); got != tc.start {
+			t.Errorf("%s: start %v from export, want %v", tc.name, got, tc.start)
+		}
+		if got := f.EndTime.Sub(testExportTime); got != tc.end {
+			t.Errorf("%s: end %v from export, want %v", tc.name, got, tc.end)
+		}
+	}
+}
+
+func TestIPFIXInitTimeFromOptions(t *testing.T) {
+	// The exporter announces its system init time once as options data;
+	// later uptime fields of the same observation domain are relative to it
+	options := ipfixSet(3, u16(300), u16(2), u16(1), fields(149, 4, FIELD_SYSTEM_INIT_TIME_MILLISECOND, 8))
+	initTime := ipfixSet(300, u32(1), binary.BigEndian.AppendUint64(nil, uint64(testExportTime.Add(-time.Hour).UnixMilli())))
+	template := ipfixSet(2, u16(256), u16(1), fields(FIELD_FLOW_START_SYS_UP_TIME, 4))
+	data := ipfixSet(256, u32(3590000))
+
+	p := New()
+	p.Parse(ipfixPacket(options, initTime), testExporter)
+	flows, err := p.Parse(ipfixPacket(template, data), testExporter)
+	if err != nil || len(flows) != 1 {
+		t.Fatalf("%v, %d flows", err, len(flows))
+	}
+	if got := flows[0].StartTime.Sub(testExportTime); got != -10*time.Second {
+		t.Errorf("start %v from export, want -10s", got)
+	}
+}
+
+func TestImplausibleTimestamps(t *testing.T) {
+	template := ipfixSet(2, u16(256), u16(2), fields(FIELD_FLOW_START_SECONDS, 4, FIELD_FLOW_END_SECONDS, 4))
+	now := uint32(time.Now().Unix())
+	for _, tc := range []struct {
+		name       string
+		start, end uint32
+		want       bool
+	}{
+		{"recent", now - 60, now - 1, false},
+		{"end before start", now - 1, now - 60, true},
+		{"in the future", now, now + 3600, true},
+		{"days old", now - 3*86400, now - 3*86400 + 60, true},
+	} {
+		flows, err := New().Parse(ipfixPacket(template, ipfixSet(256, u32(tc.start), u32(tc.end))), testExporter)
+		if err != nil || len(flows) != 1 {
+			t.Fatalf("%s: %v, %d flows", tc.name, err, len(flows))
+		}
+		if flows[0].TimeImplausible != tc.want {
+			t.Errorf("%s: implausible = %v, want %v", tc.name, flows[0].TimeImplausible, tc.want)
+		}
+	}
+}
+
+func TestReadNTPTime(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		want time.Time
+	}{
+		{[]byte{0xe9, 0x8c, 0x41, 0xc0, 0, 0, 0, 0}, testExportTime},
+		{[]byte{0xe9, 0x8c, 0x41, 0xc0, 0x80, 0, 0, 0}, testExportTime.Add(500 * time.Millisecond)},
+		{[]byte{0x83, 0xaa, 0x7e, 0x80, 0, 0, 0, 0}, time.Unix(0, 0)},
+		{[]byte{0xe9, 0x8c, 0x41, 0xc0}, time.Time{}}, // Too short
+	} {
+		if got := readNTPTime(tc.data); !got.Equal(tc.want) {
+			t.Errorf("readNTPTime(% x) = %v, want %v", tc.data, got, tc.want)
+		}
+	}
+}
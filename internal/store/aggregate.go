@@ -0,0 +1,660 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"netflow-collector/internal/resolver"
+	"netflow-collector/pkg/types"
+)
+
+// The aggregation engine groups the stored flows by any combination of fields
+// and computes metrics per group, so views and API endpoints don't need their
+// own grouping loops. Group fields:
+//
+//	src, dst         address, optionally as prefix: src/24 (IPv6 /64), src/24/48
+//	sport, dport     ports
+//	proto            protocol
+//	service          application reported by the exporter, else the service of
+//	                 the destination or source port, else the destination port
+//	inif, outif      interfaces
+//	exporter         exporter address
+//	srcas, dstas     AS numbers
+//	time             time bucket of ReceivedAt, time/5m (default 1m)
+//
+// Metrics:
+//
+//	bytes, packets, flows   sums (flows counts router-aggregated v8 flows)
+//	count                   number of flow records
+//	distinct(field)         number of distinct values of a group field
+//	avg(x), min(x), max(x)  of bytes, packets, duration (seconds) or bps
+//	pN(x)                   percentile N of x, e.g. p95(bytes), p99.9(duration)
+
+// AggregateGroupFields lists the group fields without prefix or step suffix
+var AggregateGroupFields = []string{"src", "dst", "sport", "dport", "proto", "service", "inif", "outif", "exporter", "srcas", "dstas", "time"}
+
+// AggregateValueFields lists the fields of avg, min, max and percentile metrics
+var AggregateValueFields = []string{"bytes", "packets", "duration", "bps"}
+
+// defaultAggregateStep is the time bucket of the "time" group field without step
+const defaultAggregateStep = time.Minute
+
+// Group field kinds
+const (
+	aggSrc = iota
+	aggDst
+	aggSport
+	aggDport
+	aggProto
+	aggService
+	aggInIf
+	aggOutIf
+	aggExporter
+	aggSrcAS
+	aggDstAS
+	aggTime
+)
+
+// Metric kinds
+const (
+	metricBytes = iota
+	metricPackets
+	metricFlows
+	metricCount
+	metricDistinct
+	metricAvg
+	metricMin
+	metricMax
+	metricPercentile
+)
+
+// AggregateQuery selects flows and how to group them
+type AggregateQuery struct {
+	Filter    *Filter  // Optional; a time range reaching before the stored flows also reads the archive
+	GroupBy   []string // Group fields, empty = one group over all flows
+	Metrics   []string // Metrics per group (default: bytes, packets, flows)
+	Sort      string   // Metric or group field to sort by (default: first metric)
+	Ascending bool
+	Limit     int // Maximum number of rows, 0 for all
+}
+
+// AggregateRow is one group
+type AggregateRow struct {
+	Keys   []string  // Group values in the order of GroupBy
+	Values []float64 // Metric values in the order of Metrics
+}
+
+// AggregateResult is the answer to Aggregate
+type AggregateResult struct {
+	GroupBy []string // Normalized group fields
+	Metrics []string // Normalized metrics
+	Matched uint64   // Flow records aggregated
+	Groups  int      // Number of groups before the limit
+	Rows    []AggregateRow
+	Total   []float64 // Metrics over all matched flows
+}
+
+// aggGroupField is a parsed group field
+type aggGroupField struct {
+	name  string
+	kind  int
+	bits4 int // Prefix lengths for src/dst, -1 for the full address
+	bits6 int
+	step  time.Duration // Time bucket for time
+}
+
+// aggMetric is a parsed metric
+type aggMetric struct {
+	name       string
+	kind       int
+	field      int // Value field for avg/min/max/percentile, group field index for distinct
+	distinct   *aggGroupField
+	percentile float64 // 0-100
+}
+
+// aggValue is the value of a group field for one group
+type aggValue struct {
+	addr netip.Addr
+	bits int // Prefix length if the address is a prefix, -1 otherwise
+	num  uint64
+	str  string
+	ts   time.Time
+}
+
+// aggGroup accumulates the metrics of one group
+type aggGroup struct {
+	keys                  []aggValue
+	count                 uint64
+	bytes, packets, flows uint64
+	sum, min, max         [4]float64            // Per value field
+	values                [4][]float64          // Per value field, only for percentiles
+	distinct              []map[uint64]struct{} // Value hashes per distinct metric
+}
+
+// aggSeed hashes values for distinct(field)
+var aggSeed = maphash.MakeSeed()
+
+// parseAggregateGroupField validates a group field and returns its normalized form
+func parseAggregateGroupField(s string) (aggGroupField, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	name, suffix, hasSuffix := strings.Cut(s, "/")
+	kind := slices.Index(AggregateGroupFields, name)
+	if kind < 0 {
+		return aggGroupField{}, fmt.Errorf("unknown group field %q (valid: %s)", s, strings.Join(AggregateGroupFields, ", "))
+	}
+	field := aggGroupField{name: name, kind: kind, bits4: -1, bits6: -1}
+
+	switch kind {
+	case aggSrc, aggDst:
+		if !hasSuffix {
+			break
+		}
+		v4, v6, hasV6 := strings.Cut(suffix, "/")
+		bits4, err := strconv.Atoi(v4)
+		if err != nil || bits4 < 0 || bits4 > 32 {
+			return aggGroupField{}, fmt.Errorf("invalid prefix length in %q (IPv4 0-32)", s)
+		}
+		bits6 := 64
+		if hasV6 {
+			bits6, err = strconv.Atoi(v6)
+			if err != nil || bits6 < 0 || bits6 > 128 {
+				return aggGroupField{}, fmt.Errorf("invalid IPv6 prefix length in %q (0-128)", s)
+			}
+		}
+		field.bits4, field.bits6 = bits4, bits6
+		field.name = fmt.Sprintf("%s/%d/%d", name, bits4, bits6)
+		if !hasV6 {
+			field.name = fmt.Sprintf("%s/%d", name, bits4)
+		}
+	case aggTime:
+		field.step = defaultAggregateStep
+		if hasSuffix {
+			step, err := time.ParseDuration(suffix)
+			if err != nil || step < time.Second {
+				return aggGroupField{}, fmt.Errorf("invalid time step in %q (e.g. time/5m, at least 1s)", s)
+			}
+			field.step = step
+		}
+		field.name = "time/" + formatStep(field.step)
+	default:
+		if hasSuffix {
+			return aggGroupField{}, fmt.Errorf("group field %q takes no suffix", name)
+		}
+	}
+	return field, nil
+}
+
+// formatStep formats a duration without zero units (5m instead of 5m0s)
+func formatStep(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// parseAggregateMetric validates a metric and returns its normalized form
+func parseAggregateMetric(s string) (aggMetric, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "bytes":
+		return aggMetric{name: s, kind: metricBytes}, nil
+	case "packets":
+		return aggMetric{name: s, kind: metricPackets}, nil
+	case "flows":
+		return aggMetric{name: s, kind: metricFlows}, nil
+	case "count":
+		return aggMetric{name: s, kind: metricCount}, nil
+	}
+
+	fn, arg, ok := strings.Cut(s, "(")
+	if !ok || !strings.HasSuffix(arg, ")") {
+		return aggMetric{}, fmt.Errorf("unknown metric %q (valid: bytes, packets, flows, count, distinct(field), avg/min/max/pN(%s))",
+			s, strings.Join(AggregateValueFields, "|"))
+	}
+	arg = strings.TrimSpace(strings.TrimSuffix(arg, ")"))
+
+	if fn == "distinct" {
+		field, err := parseAggregateGroupField(arg)
+		if err != nil {
+			return aggMetric{}, err
+		}
+		if field.kind == aggTime {
+			return aggMetric{}, fmt.Errorf("distinct(time) is not supported")
+		}
+		return aggMetric{name: "distinct(" + field.name + ")", kind: metricDistinct, distinct: &field}, nil
+	}
+
+	valueField := slices.Index(AggregateValueFields, arg)
+	if valueField < 0 {
+		return aggMetric{}, fmt.Errorf("unknown field %q in %q (valid: %s)", arg, s, strings.Join(AggregateValueFields, ", "))
+	}
+	metric := aggMetric{name: fn + "(" + arg + ")", field: valueField}
+	switch {
+	case fn == "avg":
+		metric.kind = metricAvg
+	case fn == "min":
+		metric.kind = metricMin
+	case fn == "max":
+		metric.kind = metricMax
+	case strings.HasPrefix(fn, "p"):
+		p, err := strconv.ParseFloat(fn[1:], 64)
+		if err != nil || p <= 0 || p > 100 {
+			return aggMetric{}, fmt.Errorf("invalid percentile in %q (0 < N <= 100, e.g. p95 or p99.9)", s)
+		}
+		metric.kind = metricPercentile
+		metric.percentile = p
+	default:
+		return aggMetric{}, fmt.Errorf("unknown function %q in %q (valid: distinct, avg, min, max, pN)", fn, s)
+	}
+	return metric, nil
+}
+
+// Aggregate groups the flows matching the query's filter and computes the metrics
+func (fs *FlowStore) Aggregate(q AggregateQuery) (AggregateResult, error) {
+	if len(q.Metrics) == 0 {
+		q.Metrics = []string{"bytes", "packets", "flows"}
+	}
+
+	var result AggregateResult
+	fields := make([]aggGroupField, len(q.GroupBy))
+	for i, s := range q.GroupBy {
+		field, err := parseAggregateGroupField(s)
+		if err != nil {
+			return AggregateResult{}, err
+		}
+		fields[i] = field
+		result.GroupBy = append(result.GroupBy, field.name)
+	}
+	metrics := make([]aggMetric, len(q.Metrics))
+	var collect [4]bool // Value fields whose values are kept for percentiles
+	var distincts []*aggGroupField
+	for i, s := range q.Metrics {
+		metric, err := parseAggregateMetric(s)
+		if err != nil {
+			return AggregateResult{}, err
+		}
+		if metric.kind == metricPercentile {
+			collect[metric.field] = true
+		}
+		if metric.kind == metricDistinct {
+			metric.field = len(distincts)
+			distincts = append(distincts, metric.distinct)
+		}
+		metrics[i] = metric
+		result.Metrics = append(result.Metrics, metric.name)
+	}
+
+	// Sort column: a metric (>= 0) or a group field (< 0, -1-index)
+	sortColumn := 0
+	if q.Sort != "" {
+		sortColumn = -len(fields) - 1
+		for i, name := range result.Metrics {
+			if strings.EqualFold(q.Sort, name) {
+				sortColumn = i
+			}
+		}
+		for i, field := range fields {
+			if strings.EqualFold(q.Sort, field.name) || strings.EqualFold(q.Sort, q.GroupBy[i]) {
+				sortColumn = -1 - i
+			}
+		}
+		if sortColumn == -len(fields)-1 {
+			return AggregateResult{}, fmt.Errorf("cannot sort by %q (not a metric or group field of the query)", q.Sort)
+		}
+	}
+
+	newGroup := func(keys []aggValue) *aggGroup {
+		g := &aggGroup{keys: keys, distinct: make([]map[uint64]struct{}, len(distincts))}
+		for i := range g.distinct {
+			g.distinct[i] = make(map[uint64]struct{})
+		}
+		for v := range g.min {
+			g.min[v] = math.Inf(1)
+			g.max[v] = math.Inf(-1)
+		}
+		return g
+	}
+
+	total := newGroup(nil)
+	groups := make(map[string]*aggGroup)
+	var buf []byte
+	fs.forEachMatchWithArchive(q.Filter, func(f *types.Flow) {
+		buf = buf[:0]
+		for i := range fields {
+			buf = fields[i].appendKey(buf, f)
+		}
+		group := groups[string(buf)]
+		if group == nil {
+			keys := make([]aggValue, len(fields))
+			for i := range fields {
+				keys[i] = fields[i].value(f)
+			}
+			group = newGroup(keys)
+			groups[string(buf)] = group
+		}
+		group.add(f, distincts, &collect)
+		total.add(f, distincts, &collect)
+	})
+
+	result.Matched = total.count
+	result.Groups = len(groups)
+	result.Total = total.metrics(metrics)
+
+	list := make([]*aggGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	rows := make([]AggregateRow, len(list))
+	for i, g := range list {
+		rows[i].Values = g.metrics(metrics)
+	}
+
+	// Sort rows with their groups, ties by the group values
+	order := make([]int, len(list))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		var c int
+		if sortColumn >= 0 {
+			c = compareFloat(rows[i].Values[sortColumn], rows[j].Values[sortColumn])
+		} else {
+			k := -1 - sortColumn
+			c = fields[k].compare(list[i].keys[k], list[j].keys[k])
+		}
+		if c != 0 {
+			if q.Ascending {
+				return c < 0
+			}
+			return c > 0
+		}
+		for k := range fields {
+			if c := fields[k].compare(list[i].keys[k], list[j].keys[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	if q.Limit > 0 && len(order) > q.Limit {
+		order = order[:q.Limit]
+	}
+
+	result.Rows = make([]AggregateRow, len(order))
+	for n, i := range order {
+		keys := make([]string, len(fields))
+		for k := range fields {
+			keys[k] = fields[k].format(list[i].keys[k])
+		}
+		result.Rows[n] = AggregateRow{Keys: keys, Values: rows[i].Values}
+	}
+	return result, nil
+}
+
+// forEachMatchWithArchive is forEachMatch plus archived flows when the filter's
+// time range reaches back before the flows in memory, like Query
+func (fs *FlowStore) forEachMatchWithArchive(filter *Filter, fn func(*types.Flow)) {
+	fs.forEachMatch(filter, fn)
+
+	fs.mu.RLock()
+	archive := fs.archive
+	fs.mu.RUnlock()
+	if filter != nil && !filter.receivedSince().IsZero() && archive != nil {
+		archived := fs.queryArchive(archive, filter)
+		for i := range archived {
+			fn(&archived[i])
+		}
+	}
+}
+
+// add counts a flow into the group
+func (g *aggGroup) add(f *types.Flow, distincts []*aggGroupField, collect *[4]bool) {
+	flows := uint64(1)
+	if f.FlowCount > 1 {
+		flows = uint64(f.FlowCount) // NetFlow v8 aggregates
+	}
+	g.count++
+	g.bytes += f.Bytes
+	g.packets += f.Packets
+	g.flows += flows
+
+	values := [4]float64{float64(f.Bytes), float64(f.Packets), flowDuration(f), f.BytesPerSecond()}
+	for v, x := range values {
+		g.sum[v] += x
+		g.min[v] = min(g.min[v], x)
+		g.max[v] = max(g.max[v], x)
+		if collect[v] {
+			g.values[v] = append(g.values[v], x)
+		}
+	}
+
+	for i, field := range distincts {
+		g.distinct[i][field.hash(f)] = struct{}{}
+	}
+}
+
+// metrics returns the metric values of the group
+func (g *aggGroup) metrics(metrics []aggMetric) []float64 {
+	for v := range g.values {
+		slices.Sort(g.values[v])
+	}
+
+	out := make([]float64, len(metrics))
+	for i, m := range metrics {
+		switch m.kind {
+		case metricBytes:
+			out[i] = float64(g.bytes)
+		case metricPackets:
+			out[i] = float64(g.packets)
+		case metricFlows:
+			out[i] = float64(g.flows)
+		case metricCount:
+			out[i] = float64(g.count)
+		case metricDistinct:
+			out[i] = float64(len(g.distinct[m.field]))
+		case metricAvg:
+			if g.count > 0 {
+				out[i] = g.sum[m.field] / float64(g.count)
+			}
+		case metricMin:
+			if g.count > 0 {
+				out[i] = g.min[m.field]
+			}
+		case metricMax:
+			if g.count > 0 {
+				out[i] = g.max[m.field]
+			}
+		case metricPercentile:
+			out[i] = percentile(g.values[m.field], m.percentile)
+		}
+	}
+	return out
+}
+
+// percentile returns percentile p (0-100) of sorted values, interpolating
+// linearly between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// addr returns the (masked) address of src/dst fields
+func (field *aggGroupField) addr(f *types.Flow) (netip.Addr, int) {
+	addr := f.SrcAddr
+	if field.kind == aggDst {
+		addr = f.DstAddr
+	}
+	bits := field.bits4
+	if addr.Is6() {
+		bits = field.bits6
+	}
+	if bits >= 0 && addr.IsValid() {
+		if prefix, err := addr.Prefix(bits); err == nil {
+			return prefix.Addr(), bits
+		}
+	}
+	return addr, -1
+}
+
+// num returns the value of numeric fields
+func (field *aggGroupField) num(f *types.Flow) uint64 {
+	switch field.kind {
+	case aggSport:
+		return uint64(f.SrcPort)
+	case aggDport:
+		return uint64(f.DstPort)
+	case aggProto:
+		return uint64(f.Protocol)
+	case aggInIf:
+		return uint64(f.InputIf)
+	case aggOutIf:
+		return uint64(f.OutputIf)
+	case aggSrcAS:
+		return uint64(f.SrcAS)
+	case aggDstAS:
+		return uint64(f.DstAS)
+	case aggTime:
+		return uint64(f.ReceivedAt.Truncate(field.step).Unix())
+	}
+	return 0
+}
+
+// appendKey appends the field's value of a flow to a group key
+func (field *aggGroupField) appendKey(buf []byte, f *types.Flow) []byte {
+	switch field.kind {
+	case aggSrc, aggDst, aggExporter:
+		addr := f.ExporterIP
+		if field.kind != aggExporter {
+			addr, _ = field.addr(f)
+		}
+		a := addr.As16()
+		family := byte(0)
+		if addr.Is4() {
+			family = 4
+		} else if addr.Is6() {
+			family = 6
+		}
+		return append(append(buf, family), a[:]...)
+	case aggService:
+		s := flowService(f)
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		return append(buf, s...)
+	}
+	return binary.LittleEndian.AppendUint64(buf, field.num(f))
+}
+
+// value returns the field's value of a flow
+func (field *aggGroupField) value(f *types.Flow) aggValue {
+	switch field.kind {
+	case aggSrc, aggDst:
+		addr, bits := field.addr(f)
+		return aggValue{addr: addr, bits: bits}
+	case aggExporter:
+		return aggValue{addr: f.ExporterIP, bits: -1}
+	case aggService:
+		return aggValue{str: flowService(f)}
+	case aggTime:
+		return aggValue{ts: f.ReceivedAt.Truncate(field.step)}
+	}
+	return aggValue{num: field.num(f)}
+}
+
+// hash returns a hash of the field's value of a flow, for distinct(field)
+func (field *aggGroupField) hash(f *types.Flow) uint64 {
+	switch field.kind {
+	case aggSrc, aggDst:
+		addr, _ := field.addr(f)
+		return maphash.Comparable(aggSeed, addr.As16())
+	case aggExporter:
+		return maphash.Comparable(aggSeed, f.ExporterIP.As16())
+	case aggService:
+		return maphash.String(aggSeed, flowService(f))
+	}
+	return maphash.Comparable(aggSeed, field.num(f))
+}
+
+// format returns the display form of a value
+func (field *aggGroupField) format(v aggValue) string {
+	switch field.kind {
+	case aggSrc, aggDst, aggExporter:
+		if !v.addr.IsValid() {
+			return ""
+		}
+		if v.bits >= 0 {
+			return netip.PrefixFrom(v.addr, v.bits).String()
+		}
+		return v.addr.String()
+	case aggService:
+		return v.str
+	case aggProto:
+		return (&types.Flow{Protocol: uint8(v.num)}).ProtocolName()
+	case aggTime:
+		return v.ts.Format(time.RFC3339)
+	}
+	return strconv.FormatUint(v.num, 10)
+}
+
+// compare orders two values of the field
+func (field *aggGroupField) compare(a, b aggValue) int {
+	switch field.kind {
+	case aggSrc, aggDst, aggExporter:
+		return a.addr.Compare(b.addr)
+	case aggService:
+		return strings.Compare(a.str, b.str)
+	case aggTime:
+		return a.ts.Compare(b.ts)
+	}
+	switch {
+	case a.num < b.num:
+		return -1
+	case a.num > b.num:
+		return 1
+	}
+	return 0
+}
+
+// flowService returns the service of a flow like the services page: the
+// application reported by the exporter, else the service of the destination
+// or source port, else the destination port
+func flowService(f *types.Flow) string {
+	if f.AppName != "" {
+		return f.AppName
+	}
+	if name := resolver.GetServiceName(f.DstPort, f.Protocol); name != "" {
+		return name
+	}
+	if name := resolver.GetServiceName(f.SrcPort, f.Protocol); name != "" {
+		return name
+	}
+	return strconv.Itoa(int(f.DstPort))
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// aggregateSums are the expected metrics of one group
+type aggregateSums struct {
+	bytes, packets, flows, count uint64
+	maxPackets                   uint64
+	dsts                         map[netip.Addr]struct{}
+}
+
+func (s *aggregateSums) add(f *types.Flow) {
+	flows := uint64(1)
+	if f.FlowCount > 1 {
+		flows = uint64(f.FlowCount)
+	}
+	s.bytes += f.Bytes
+	s.packets += f.Packets
+	s.flows += flows
+	s.count++
+	s.maxPackets = max(s.maxPackets, f.Packets)
+	if s.dsts == nil {
+		s.dsts = make(map[netip.Addr]struct{})
+	}
+	s.dsts[f.DstAddr] = struct{}{}
+}
+
+// values returns the sums in the order of aggregateMetrics
+func (s *aggregateSums) values() []float64 {
+	return []float64{float64(s.bytes), float64(s.packets), float64(s.flows), float64(s.count),
+		float64(len(s.dsts)), float64(s.bytes) / float64(s.count), float64(s.maxPackets)}
+}
+
+var aggregateMetrics = []string{"bytes", "packets", "flows", "count", "distinct(dst)", "avg(bytes)", "max(packets)"}
+
+// aggregateFlows returns flows with some router-aggregated (v8) records
+func aggregateFlows() []types.Flow {
+	flows := generateFlows(5000, 7)
+	for i := range flows {
+		if i%10 == 0 {
+			flows[i].FlowCount = uint32(2 + i%7)
+		}
+	}
+	return flows
+}
+
+func TestAggregateTotals(t *testing.T) {
+	flows := aggregateFlows()
+	fs := New(len(flows))
+	fs.Add(flows)
+
+	for _, tc := range []struct {
+		name    string
+		filter  string
+		groupBy []string
+		key     func(f *types.Flow) string // Expected group keys, joined by "|"
+	}{
+		{"no groups", "", nil, func(*types.Flow) string { return "" }},
+		{"dport", "", []string{"dport"}, func(f *types.Flow) string {
+			return strconv.Itoa(int(f.DstPort))
+		}},
+		{"src prefix and proto", "", []string{"src/24", "proto"}, func(f *types.Flow) string {
+			return netip.PrefixFrom(f.SrcAddr, 24).Masked().String() + "|" + f.ProtocolName()
+		}},
+		{"exporter and interfaces", "", []string{"exporter", "inif", "outif"}, func(f *types.Flow) string {
+			return f.ExporterIP.String() + "|" + strconv.Itoa(int(f.InputIf)) + "|" + strconv.Itoa(int(f.OutputIf))
+		}},
+		{"time buckets", "", []string{"time/1s", "exporter"}, func(f *types.Flow) string {
+			return f.ReceivedAt.Truncate(time.Second).Format(time.RFC3339) + "|" + f.ExporterIP.String()
+		}},
+		{"filtered", "dport=443 && proto=tcp", []string{"src/16"}, func(f *types.Flow) string {
+			return netip.PrefixFrom(f.SrcAddr, 16).Masked().String()
+		}},
+	} {
+		var filter *Filter
+		var total aggregateSums
+		want := make(map[string]*aggregateSums)
+		if tc.filter != "" {
+			parsed := ParseFilter(tc.filter)
+			if !parsed.IsValid() {
+				t.Fatalf("%s: %s", tc.name, parsed.Error)
+			}
+			filter = &parsed
+		}
+		for i := range flows {
+			f := &flows[i]
+			if filter != nil && !filter.Matches(f) {
+				continue
+			}
+			key := tc.key(f)
+			if want[key] == nil {
+				want[key] = &aggregateSums{}
+			}
+			want[key].add(f)
+			total.add(f)
+		}
+
+		result, err := fs.Aggregate(AggregateQuery{Filter: filter, GroupBy: tc.groupBy, Metrics: aggregateMetrics})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if result.Matched != total.count || result.Groups != len(want) || len(result.Rows) != len(want) {
+			t.Fatalf("%s: %d flows in %d groups (%d rows), want %d in %d",
+				tc.name, result.Matched, result.Groups, len(result.Rows), total.count, len(want))
+		}
+		checkAggregateValues(t, tc.name+" total", result.Total, total.values())
+
+		for i, row := range result.Rows {
+			key := strings.Join(row.Keys, "|")
+			sums := want[key]
+			if sums == nil {
+				t.Errorf("%s: unexpected group %q", tc.name, key)
+				continue
+			}
+			checkAggregateValues(t, tc.name+" "+key, row.Values, sums.values())
+			delete(want, key)
+
+			// Sorted by the first metric, largest first
+			if i > 0 && row.Values[0] > result.Rows[i-1].Values[0] {
+				t.Errorf("%s: row %d not sorted by bytes", tc.name, i)
+			}
+		}
+		for key := range want {
+			t.Errorf("%s: missing group %q", tc.name, key)
+		}
+	}
+}
+
+func TestAggregateLimit(t *testing.T) {
+	flows := aggregateFlows()
+	fs := New(len(flows))
+	fs.Add(flows)
+
+	all, err := fs.Aggregate(AggregateQuery{GroupBy: []string{"src/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := fs.Aggregate(AggregateQuery{GroupBy: []string{"src/24"}, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit cuts the rows, not the groups or the total
+	if len(limited.Rows) != 5 || limited.Groups != all.Groups || limited.Matched != all.Matched {
+		t.Fatalf("%d rows of %d groups, %d flows; without limit %d groups, %d flows",
+			len(limited.Rows), limited.Groups, limited.Matched, all.Groups, all.Matched)
+	}
+	checkAggregateValues(t, "total", limited.Total, all.Total)
+	for i, row := range limited.Rows {
+		if strings.Join(row.Keys, "|") != strings.Join(all.Rows[i].Keys, "|") {
+			t.Errorf("row %d: %v, without limit %v", i, row.Keys, all.Rows[i].Keys)
+		}
+	}
+
+	// The rows add up to the total
+	sums := make([]float64, len(all.Total))
+	for _, row := range all.Rows {
+		for i, v := range row.Values {
+			sums[i] += v
+		}
+	}
+	checkAggregateValues(t, "sum of rows", sums, all.Total)
+}
+
+func checkAggregateValues(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: %d values, want %d", name, len(got), len(want))
+		return
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9*max(1, math.Abs(want[i])) {
+			t.Errorf("%s: value %d = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Archive segment files:
+//   flows-YYYYMMDD-HHMMSS.nfa   (UTC start of the segment's receive-time window)
+//
+// A segment is a sequence of gzip members. Every flush appends one member whose
+// payload starts with archiveMagic followed by length-prefixed flow records
+// (see codec.go). Readers decode member by member, so a member truncated by a
+// crash only loses its own records.
+
+const (
+	archiveMagic      = "NFA\x01" // Format identifier + version
+	archivePrefix     = "flows-"
+	archiveSuffix     = ".nfa"
+	archiveTimeLayout = "20060102-150405"
+
+	DefaultSegmentDuration = 5 * time.Minute
+	DefaultFlushInterval   = 5 * time.Second
+
+	// archiveMaxPending is how many bytes of encoded records are kept for the
+	// next flush when writing fails; records beyond it are dropped
+	archiveMaxPending = 64 << 20
+)
+
+// ArchiveConfig configures the on-disk flow archive
+type ArchiveConfig struct {
+	Dir             string        // Directory for segment files
+	SegmentDuration time.Duration // Receive-time window per segment file (default 5m)
+	FlushInterval   time.Duration // How often buffered flows are written (default 5s)
+	MaxAge          time.Duration // Delete segments older than this (0 = unlimited)
+	MaxSize         int64         // Delete oldest segments above this total size in bytes (0 = unlimited)
+}
+
+// ArchiveStats describes the archive state
+type ArchiveStats struct {
+	Dir          string
+	Segments     int
+	Bytes        int64
+	Oldest       time.Time // Start of the oldest segment
+	Newest       time.Time // Start of the newest segment
+	FlowsWritten uint64
+	Pending      int    // Flows waiting for the next flush (including failed writes)
+	Dropped      uint64 // Flows dropped because writing failed repeatedly
+	Deleted      int    // Segments removed by retention
+	LastError    string
+}
+
+// archiveSegment is one segment file on disk
+type archiveSegment struct {
+	start time.Time
+	path  string
+	size  int64
+}
+
+// archiveBuffer holds encoded records of one segment that are not yet on disk
+type archiveBuffer struct {
+	records []byte
+	flows   int
+}
+
+// Archive is an append-only, compressed, time-partitioned flow archive
+type Archive struct {
+	cfg ArchiveConfig
+
+	mu       sync.Mutex
+	pending  map[time.Time]archiveBuffer // Per segment start
+	segments []archiveSegment            // Sorted by start
+	stats    ArchiveStats
+
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// OpenArchive opens (or creates) an archive directory and starts the background flusher
+func OpenArchive(cfg ArchiveConfig) (*Archive, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("archive directory not set")
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = DefaultSegmentDuration
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	a := &Archive{
+		cfg:      cfg,
+		pending:  make(map[time.Time]archiveBuffer),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	a.stats.Dir = cfg.Dir
+
+	if err := a.scan(); err != nil {
+		return nil, err
+	}
+	a.applyRetention(time.Now())
+
+	go a.flushLoop()
+
+	return a, nil
+}
+
+// scan loads the list of existing segment files
+func (a *Archive) scan() error {
+	entries, err := os.ReadDir(a.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	for _, e := range entries {
+		start, ok := parseSegmentName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		a.segments = append(a.segments, archiveSegment{
+			start: start,
+			path:  filepath.Join(a.cfg.Dir, e.Name()),
+			size:  info.Size(),
+		})
+	}
+
+	sort.Slice(a.segments, func(i, j int) bool {
+		return a.segments[i].start.Before(a.segments[j].start)
+	})
+	return nil
+}
+
+// Append buffers flows for the next flush. Flows are partitioned by ReceivedAt.
+func (a *Archive) Append(flows []types.Flow) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range flows {
+		start := flows[i].ReceivedAt.UTC().Truncate(a.cfg.SegmentDuration)
+		buf := a.pending[start]
+		buf.records = appendFlow(buf.records, &flows[i])
+		buf.flows++
+		a.pending[start] = buf
+	}
+}
+
+// flushLoop periodically writes buffered flows to disk
+func (a *Archive) flushLoop() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopChan:
+			return
+		case <-ticker.C:
+			a.Flush()
+		}
+	}
+}
+
+// Flush writes all buffered flows to their segment files and applies retention.
+// Records whose write failed are buffered again for the next flush, up to
+// archiveMaxPending bytes; the rest is dropped and counted.
+func (a *Archive) Flush() error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[time.Time]archiveBuffer)
+	a.mu.Unlock()
+
+	var firstErr error
+	var written uint64
+	failed := make(map[time.Time]archiveBuffer)
+	for start, buf := range pending {
+		if err := a.writeMember(start, buf.records); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed[start] = buf
+			continue
+		}
+		written += uint64(buf.flows)
+	}
+
+	a.mu.Lock()
+	a.stats.FlowsWritten += written
+	if firstErr != nil {
+		a.stats.LastError = firstErr.Error()
+	}
+	kept := 0
+	for _, buf := range a.pending {
+		kept += len(buf.records)
+	}
+	for start, buf := range failed {
+		if kept+len(buf.records) > archiveMaxPending {
+			a.stats.Dropped += uint64(buf.flows)
+			continue
+		}
+		kept += len(buf.records)
+
+		// Failed records are older than those appended meanwhile
+		newer := a.pending[start]
+		a.pending[start] = archiveBuffer{
+			records: append(buf.records, newer.records...),
+			flows:   buf.flows + newer.flows,
+		}
+	}
+	a.applyRetention(time.Now())
+	a.mu.Unlock()
+
+	return firstErr
+}
+
+// writeMember appends one gzip member with the given records to a segment file
+func (a *Archive) writeMember(start time.Time, records []byte) error {
+	path := filepath.Join(a.cfg.Dir, segmentName(start))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(archiveMagic))
+	zw.Write(records)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err == nil {
+		_, err = file.Write(buf.Bytes())
+		if err != nil {
+			// A partial member would hide the members written after it from readers
+			file.Truncate(info.Size())
+		}
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+
+	a.mu.Lock()
+	a.addSegment(start, path, int64(buf.Len()))
+	a.mu.Unlock()
+	return nil
+}
+
+// addSegment records a write to a segment. Must be called with a.mu held.
+func (a *Archive) addSegment(start time.Time, path string, written int64) {
+	i := sort.Search(len(a.segments), func(i int) bool {
+		return !a.segments[i].start.Before(start)
+	})
+	if i < len(a.segments) && a.segments[i].start.Equal(start) {
+		a.segments[i].size += written
+		return
+	}
+	a.segments = append(a.segments, archiveSegment{})
+	copy(a.segments[i+1:], a.segments[i:])
+	a.segments[i] = archiveSegment{start: start, path: path, size: written}
+}
+
+// applyRetention deletes segments exceeding the age or size limit, oldest first.
+// The segment currently being written is never deleted. Must be called with a.mu held.
+func (a *Archive) applyRetention(now time.Time) {
+	current := now.UTC().Truncate(a.cfg.SegmentDuration)
+
+	var total int64
+	for _, seg := range a.segments {
+		total += seg.size
+	}
+
+	removed := 0
+	for _, seg := range a.segments {
+		if !seg.start.Before(current) {
+			break
+		}
+		tooOld := a.cfg.MaxAge > 0 && now.Sub(seg.start.Add(a.cfg.SegmentDuration)) > a.cfg.MaxAge
+		tooBig := a.cfg.MaxSize > 0 && total > a.cfg.MaxSize
+		if !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			a.stats.LastError = err.Error()
+			break
+		}
+		total -= seg.size
+		removed++
+	}
+
+	if removed > 0 {
+		a.segments = append(a.segments[:0], a.segments[removed:]...)
+		a.stats.Deleted += removed
+	}
+}
+
+// Read calls fn for every archived flow received in [since, until]. A zero until
+// means "up to now". Reading stops early if fn returns false. Flows that have not
+// been flushed yet are not included.
+func (a *Archive) Read(since, until time.Time, fn func(*types.Flow) bool) error {
+	a.mu.Lock()
+	var segments []archiveSegment
+	for _, seg := range a.segments {
+		if !until.IsZero() && seg.start.After(until) {
+			continue
+		}
+		if !since.IsZero() && !seg.start.Add(a.cfg.SegmentDuration).After(since) {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	a.mu.Unlock()
+
+	for _, seg := range segments {
+		more, err := readSegment(seg.path, func(f *types.Flow) bool {
+			if !since.IsZero() && f.ReceivedAt.Before(since) {
+				return true
+			}
+			if !until.IsZero() && f.ReceivedAt.After(until) {
+				return true
+			}
+			return fn(f)
+		})
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readSegment decodes all records of a segment file. It returns false if fn
+// stopped the iteration. A truncated or corrupt trailing member is ignored.
+func readSegment(path string, fn func(*types.Flow) bool) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil // Removed by retention meanwhile
+		}
+		return true, err
+	}
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return true, nil // Empty or corrupt segment
+	}
+	defer zr.Close()
+
+	for {
+		// Read one member at a time so each payload can be checked for the magic
+		zr.Multistream(false)
+		data, err := io.ReadAll(zr)
+		if err != nil || !bytes.HasPrefix(data, []byte(archiveMagic)) {
+			return true, nil // Truncated member (e.g. crash during write)
+		}
+		data = data[len(archiveMagic):]
+
+		for len(data) > 0 {
+			flow, n, err := decodeFlow(data)
+			if err != nil {
+				break
+			}
+			data = data[n:]
+			if !fn(&flow) {
+				return false, nil
+			}
+		}
+
+		if err := zr.Reset(br); err != nil {
+			return true, nil // io.EOF: no more members
+		}
+	}
+}
+
+// Stats returns the current archive statistics
+func (a *Archive) Stats() ArchiveStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.stats
+	stats.Segments = len(a.segments)
+	for _, buf := range a.pending {
+		stats.Pending += buf.flows
+	}
+	for _, seg := range a.segments {
+		stats.Bytes += seg.size
+	}
+	if len(a.segments) > 0 {
+		stats.Oldest = a.segments[0].start
+		stats.Newest = a.segments[len(a.segments)-1].start
+	}
+	return stats
+}
+
+// Close stops the background flusher and writes remaining buffered flows
+func (a *Archive) Close() error {
+	close(a.stopChan)
+	<-a.done
+	return a.Flush()
+}
+
+func segmentName(start time.Time) string {
+	return archivePrefix + start.UTC().Format(archiveTimeLayout) + archiveSuffix
+}
+
+func parseSegmentName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, archivePrefix) || !strings.HasSuffix(name, archiveSuffix) {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix)
+	start, err := time.ParseInLocation(archiveTimeLayout, ts, time.UTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
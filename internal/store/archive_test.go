@@ -0,0 +1,266 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// openTestArchive opens an archive in a temporary directory. The background
+// flusher doesn't run during a test; tests call Flush.
+func openTestArchive(t *testing.T, cfg ArchiveConfig) *Archive {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	cfg.FlushInterval = time.Hour
+	a, err := OpenArchive(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+// archiveFlows returns flows received every 30 s from start
+func archiveFlows(start time.Time, n int) []types.Flow {
+	flows := generateFlows(n, 3)
+	for i := range flows {
+		flows[i].ReceivedAt = start.Add(time.Duration(i) * 30 * time.Second)
+		flows[i].Seq = uint64(i + 1)
+	}
+	return flows
+}
+
+// readArchive returns all flows of the archive received in [since, until]
+func readArchive(t *testing.T, a *Archive, since, until time.Time) []types.Flow {
+	t.Helper()
+	var flows []types.Flow
+	if err := a.Read(since, until, func(f *types.Flow) bool {
+		flows = append(flows, *f)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return flows
+}
+
+func checkArchived(t *testing.T, got, want []types.Flow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("read %d flows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if w := decoded(want[i]); !reflect.DeepEqual(got[i], w) {
+			t.Fatalf("flow %d:\n got %+v\nwant %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	a, err := OpenArchive(ArchiveConfig{Dir: dir, SegmentDuration: 5 * time.Minute, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	flows := archiveFlows(start, 40) // 20 minutes, 4 segments
+
+	// Two flushes append two members to the segments they share
+	a.Append(flows[:25])
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	a.Append(flows[25:])
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkArchived(t, readArchive(t, a, time.Time{}, time.Time{}), flows)
+
+	stats := a.Stats()
+	if stats.Segments != 4 || stats.FlowsWritten != 40 || stats.Pending != 0 || stats.Dropped != 0 || stats.LastError != "" {
+		t.Errorf("stats = %+v", stats)
+	}
+	if !stats.Oldest.Equal(start) || !stats.Newest.Equal(start.Add(15*time.Minute)) {
+		t.Errorf("segments from %v to %v", stats.Oldest, stats.Newest)
+	}
+	var size int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		info, _ := e.Info()
+		size += info.Size()
+	}
+	if stats.Bytes != size {
+		t.Errorf("stats report %d bytes, files have %d", stats.Bytes, size)
+	}
+
+	// Receive-time window, bounds included; segments outside it are skipped
+	since, until := start.Add(4*time.Minute), start.Add(11*time.Minute)
+	checkArchived(t, readArchive(t, a, since, until), flows[8:23])
+	checkArchived(t, readArchive(t, a, since, time.Time{}), flows[8:])
+	checkArchived(t, readArchive(t, a, time.Time{}, until), flows[:23])
+
+	// fn stops the iteration
+	n := 0
+	a.Read(time.Time{}, time.Time{}, func(*types.Flow) bool { n++; return n < 12 })
+	if n != 12 {
+		t.Errorf("read %d flows after stopping at 12", n)
+	}
+
+	// A reopened archive finds its segments
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := openTestArchive(t, ArchiveConfig{Dir: dir, SegmentDuration: 5 * time.Minute})
+	checkArchived(t, readArchive(t, b, time.Time{}, time.Time{}), flows)
+	if s := b.Stats(); s.Segments != 4 || s.Bytes != size {
+		t.Errorf("reopened: %+v", s)
+	}
+}
+
+func TestArchiveTruncatedMember(t *testing.T) {
+	a := openTestArchive(t, ArchiveConfig{SegmentDuration: time.Hour})
+	start := time.Now().UTC().Truncate(time.Hour)
+	flows := archiveFlows(start, 30)
+	for i := 0; i < len(flows); i += 10 {
+		a.Append(flows[i : i+10])
+		a.Flush()
+	}
+
+	// A crash during the third write leaves a partial member
+	path := filepath.Join(a.cfg.Dir, segmentName(start))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-20); err != nil {
+		t.Fatal(err)
+	}
+	checkArchived(t, readArchive(t, a, time.Time{}, time.Time{}), flows[:20])
+
+	// Garbage instead of a gzip member
+	os.WriteFile(path, []byte("not gzip"), 0644)
+	if got := readArchive(t, a, time.Time{}, time.Time{}); len(got) != 0 {
+		t.Errorf("read %d flows from a corrupt segment", len(got))
+	}
+}
+
+func TestArchiveRetention(t *testing.T) {
+	a := openTestArchive(t, ArchiveConfig{SegmentDuration: time.Hour})
+	now := time.Now()
+	current := now.UTC().Truncate(time.Hour)
+	var flows []types.Flow
+	for h := 5; h >= 0; h-- {
+		flows = append(flows, archiveFlows(current.Add(-time.Duration(h)*time.Hour), 10)...)
+	}
+	a.Append(flows)
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Stats(); s.Segments != 6 || s.Deleted != 0 {
+		t.Fatalf("before retention: %+v", s)
+	}
+
+	// By age: segments that ended more than MaxAge ago
+	a.cfg.MaxAge = now.Sub(current.Add(-2*time.Hour)) - time.Minute
+	a.Flush()
+	if s := a.Stats(); s.Segments != 3 || s.Deleted != 3 || !s.Oldest.Equal(current.Add(-2*time.Hour)) {
+		t.Errorf("after age retention: %+v", s)
+	}
+	checkArchived(t, readArchive(t, a, time.Time{}, time.Time{}), flows[30:])
+
+	// By size: oldest first, down to the limit
+	segSize := a.Stats().Bytes / 3
+	a.cfg.MaxSize = 2*segSize + segSize/2
+	a.Flush()
+	if s := a.Stats(); s.Segments != 2 || s.Deleted != 4 || s.Bytes > a.cfg.MaxSize {
+		t.Errorf("after size retention: %+v", s)
+	}
+
+	// The segment being written is kept even above the limit
+	a.cfg.MaxSize = 1
+	a.Flush()
+	if s := a.Stats(); s.Segments != 1 || !s.Oldest.Equal(current) {
+		t.Errorf("current segment: %+v", s)
+	}
+	checkArchived(t, readArchive(t, a, time.Time{}, time.Time{}), flows[50:])
+	if entries, _ := os.ReadDir(a.cfg.Dir); len(entries) != 1 {
+		t.Errorf("%d files left", len(entries))
+	}
+}
+
+func TestArchiveFlushRetry(t *testing.T) {
+	a := openTestArchive(t, ArchiveConfig{SegmentDuration: time.Hour})
+	start := time.Now().UTC().Truncate(time.Hour)
+	flows := archiveFlows(start, 20)
+
+	// A directory in place of the segment file makes the write fail
+	blocker := filepath.Join(a.cfg.Dir, segmentName(start))
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a.Append(flows[:10])
+	if err := a.Flush(); err == nil {
+		t.Fatal("flush into a directory: no error")
+	}
+	if s := a.Stats(); s.Pending != 10 || s.FlowsWritten != 0 || s.Dropped != 0 || s.LastError == "" {
+		t.Errorf("after failed flush: %+v", s)
+	}
+
+	// The failed flows are written first once the disk works again
+	a.Append(flows[10:])
+	os.Remove(blocker)
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Stats(); s.Pending != 0 || s.FlowsWritten != 20 || s.Dropped != 0 {
+		t.Errorf("after retry: %+v", s)
+	}
+	checkArchived(t, readArchive(t, a, time.Time{}, time.Time{}), flows)
+}
+
+func TestQueryReadsEvictedFlowsFromArchive(t *testing.T) {
+	a := openTestArchive(t, ArchiveConfig{SegmentDuration: time.Minute})
+	fs := NewWithConfig(2000, EvictionConfig{})
+	fs.SetArchive(a)
+
+	flows := generateFlows(20000, 4)
+	for i := 0; i < len(flows); i += 500 {
+		fs.Add(flows[i : i+500])
+	}
+	fs.maintain()
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fs.GetFlowCount(); n >= len(flows)/2 {
+		t.Fatalf("%d flows in memory, eviction did not run", n)
+	}
+
+	for _, since := range []time.Time{flows[0].ReceivedAt, flows[15000].ReceivedAt, flows[19990].ReceivedAt} {
+		filter := Filter{Since: since}
+		got := fs.Query(&filter, SortByTime, true, 0)
+
+		// Every flow received since then, exactly once, whether in memory or archived
+		seen := make(map[uint64]bool)
+		for _, f := range got {
+			if seen[f.Seq] {
+				t.Fatalf("since %v: flow %d returned twice", since, f.Seq)
+			}
+			seen[f.Seq] = true
+		}
+		want := 0
+		for i := range flows {
+			if !flows[i].ReceivedAt.Before(since) {
+				want++
+			}
+		}
+		if len(got) != want {
+			t.Errorf("since %v: %d flows, want %d", since, len(got), want)
+		}
+	}
+}
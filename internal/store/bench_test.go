@@ -0,0 +1,331 @@
+package store
+
+import (
+	"flag"
+	"math/rand"
+	"net/netip"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Benchmarks run against a store filled with -store.flows generated flows
+// (default 1 million), e.g.
+//
+//	go test ./internal/store -run '^$' -bench . -benchmem
+//	go test ./internal/store -run '^$' -bench Ingest -cpu 1,4 -store.flows 200000
+
+var benchFlows = flag.Int("store.flows", 1000000, "number of flows in the benchmark store")
+
+var (
+	benchOnce  sync.Once
+	benchFS    *FlowStore
+	benchExtra []types.Flow // Flows not in the store, for ingest benchmarks
+)
+
+// benchStore returns the shared benchmark store. Benchmarks must not add to it.
+func benchStore(b *testing.B) *FlowStore {
+	benchOnce.Do(func() {
+		benchFS = fillStore(New(*benchFlows), *benchFlows, 1)
+		benchExtra = generateFlows(100000, 2)
+	})
+	b.ResetTimer()
+	return benchFS
+}
+
+// fillStore adds n generated flows batch-wise like the collector does and
+// waits for maintenance and the background index builds
+func fillStore(fs *FlowStore, n int, seed int64) *FlowStore {
+	for i := 0; i < n; i += 1000 {
+		fs.Add(generateFlows(min(1000, n-i), seed+int64(i)))
+	}
+	fs.maintain()
+	waitIndexed(fs)
+	return fs
+}
+
+// waitIndexed waits until every sealed segment has its indexes
+func waitIndexed(fs *FlowStore) {
+	for {
+		view := fs.snapshot()
+		done := true
+		for _, seg := range view.segments[:len(view.segments)-1] {
+			if seg.index.Load() == nil {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// heapInUse returns the live heap after a full collection
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// generateFlows creates flows with a skewed mix of addresses, ports and exporters
+func generateFlows(n int, seed int64) []types.Flow {
+	rng := rand.New(rand.NewSource(seed))
+	ports := []uint16{443, 443, 443, 80, 53, 53, 22, 123, 8080, 3389}
+	now := time.Now()
+
+	flows := make([]types.Flow, n)
+	for i := range flows {
+		proto := uint8(6)
+		if rng.Intn(4) == 0 {
+			proto = 17
+		}
+		flows[i] = types.Flow{
+			Version:    types.IPFIX,
+			SrcAddr:    netip.AddrFrom4([4]byte{10, byte(rng.Intn(4)), byte(rng.Intn(16)), byte(rng.Intn(256))}),
+			DstAddr:    netip.AddrFrom4([4]byte{byte(1 + rng.Intn(223)), byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256))}),
+			SrcPort:    uint16(1024 + rng.Intn(60000)),
+			DstPort:    ports[rng.Intn(len(ports))],
+			Protocol:   proto,
+			Bytes:      uint64(rng.ExpFloat64() * 50000),
+			Packets:    uint64(1 + rng.Intn(100)),
+			InputIf:    uint16(1 + rng.Intn(8)),
+			OutputIf:   uint16(1 + rng.Intn(8)),
+			ExporterIP: netip.AddrFrom4([4]byte{192, 0, 2, byte(1 + rng.Intn(4))}),
+			ReceivedAt: now.Add(time.Duration(i-n) * time.Millisecond),
+		}
+	}
+	return flows
+}
+
+// benchFilters are run as is and wrapped in a double negation, which matches
+// the same flows but hides the conditions from the query planner (full scan)
+var benchFilters = []string{
+	"dport=443",
+	"src=10.1.0.0/16 && proto=udp",
+	"ip=10.2.3.0/24",
+	"inif=3 && dport=53",
+	"exporter=192.0.2.2",
+	"proto=tcp",
+}
+
+func BenchmarkFilter(b *testing.B) {
+	fs := benchStore(b)
+	for _, s := range benchFilters {
+		for _, variant := range []struct{ name, expr string }{
+			{"indexed", s},
+			{"scan", "!!(" + s + ")"},
+		} {
+			filter := ParseFilter(variant.expr)
+			if !filter.IsValid() {
+				b.Fatalf("%s: %s", variant.expr, filter.Error)
+			}
+			b.Run(s+"/"+variant.name, func(b *testing.B) {
+				var matches int
+				for b.Loop() {
+					matches = fs.GetFilteredStats(&filter).Count
+				}
+				b.ReportMetric(float64(matches), "matches")
+			})
+		}
+	}
+}
+
+func BenchmarkQueryTop100(b *testing.B) {
+	fs := benchStore(b)
+	filter := ParseFilter("src=10.1.2.0/24 && dport=443")
+	for b.Loop() {
+		fs.Query(&filter, SortByBytes, false, 100)
+	}
+}
+
+// BenchmarkQueryAfter reads the first page after a cursor in the middle of the
+// store, which only scans from the cursor until the page is full
+func BenchmarkQueryAfter(b *testing.B) {
+	fs := benchStore(b)
+	cursor := fs.seq.Load() / 2
+	for _, s := range []string{"", "dport=443"} {
+		filter := ParseFilter(s)
+		name := s
+		if name == "" {
+			name = "all"
+		}
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				fs.QueryAfter(&filter, cursor, 1000)
+			}
+		})
+	}
+}
+
+// ingestStore returns a full store of its own for ingest benchmarks
+func ingestStore(b *testing.B) *FlowStore {
+	benchStore(b)
+	fs := fillStore(New(*benchFlows), *benchFlows, 1)
+	b.ResetTimer()
+	return fs
+}
+
+// BenchmarkAdd adds batches of 30 flows (one export packet) to a full store,
+// so every batch leads to eviction
+func BenchmarkAdd(b *testing.B) {
+	fs := ingestStore(b)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		fs.Add(benchExtra[i : i+30])
+		i = (i + 30) % (len(benchExtra) - 30)
+	}
+}
+
+// BenchmarkIngestWithReaders adds batches of 100 flows to a full store while
+// GOMAXPROCS goroutines run TUI/API-like queries (vary with -cpu), and reports
+// the Add latency percentiles and the query rate
+func BenchmarkIngestWithReaders(b *testing.B) {
+	const batch = 100
+	fs := ingestStore(b)
+	queries := []Filter{
+		ParseFilter(""),
+		ParseFilter("dport=443"),
+		ParseFilter("src=10.1.0.0/16 && proto=udp"),
+		ParseFilter("!!(inif=3)"),
+	}
+
+	var stop atomic.Bool
+	var queryCount atomic.Int64
+	var wg sync.WaitGroup
+	for r := range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := r; !stop.Load(); i++ {
+				q := &queries[i%len(queries)]
+				switch i % 4 {
+				case 0:
+					fs.Query(q, SortByBytes, false, 100)
+				case 1:
+					fs.GetFilteredStats(q)
+				case 2:
+					fs.GetStats()
+				default:
+					fs.QueryConversations(q, SortByBytes, false, 100)
+				}
+				queryCount.Add(1)
+			}
+		}()
+	}
+
+	var latencies []time.Duration
+	start := time.Now()
+	i := 0
+	for b.Loop() {
+		t := time.Now()
+		fs.Add(benchExtra[i : i+batch])
+		latencies = append(latencies, time.Since(t))
+		i = (i + batch) % (len(benchExtra) - batch)
+	}
+	elapsed := time.Since(start)
+	stop.Store(true)
+	wg.Wait()
+
+	slices.Sort(latencies)
+	b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+	b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+	b.ReportMetric(float64(len(latencies)*batch)/elapsed.Seconds(), "flows/s")
+	b.ReportMetric(float64(queryCount.Load())/elapsed.Seconds(), "queries/s")
+}
+
+// BenchmarkFill fills a new store with -store.flows flows and reports the
+// retained heap per flow, including indexes (use -benchtime 1x)
+func BenchmarkFill(b *testing.B) {
+	n := *benchFlows
+	var perFlow, rate float64
+	for b.Loop() {
+		before := heapInUse()
+		start := time.Now()
+		fs := fillStore(New(n), n, 1)
+		rate = float64(n) / time.Since(start).Seconds()
+		perFlow = float64(heapInUse()-before) / float64(n)
+		runtime.KeepAlive(fs)
+	}
+	b.ReportMetric(perFlow, "B/flow")
+	b.ReportMetric(rate, "flows/s")
+}
+
+func BenchmarkAggregation(b *testing.B) {
+	fs := benchStore(b)
+	for _, s := range []string{"", "dport=443"} {
+		filter := ParseFilter(s)
+		name := s
+		if name == "" {
+			name = "all"
+		}
+		queries := []struct {
+			name string
+			run  func()
+		}{
+			{"flows", func() { fs.QueryAggregatedFlows(&filter, SortByBytes, false, 100) }},
+			{"conversations", func() { fs.QueryConversations(&filter, SortByBytes, false, 100) }},
+			{"sessions", func() { fs.QuerySessions(&filter, 0, SortByBytes, false, 100) }},
+		}
+		for _, q := range queries {
+			b.Run(q.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					q.run()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkAggregate(b *testing.B) {
+	fs := benchStore(b)
+	for _, q := range []AggregateQuery{
+		{GroupBy: []string{"src/24", "dport"}, Metrics: []string{"bytes", "flows"}, Limit: 50},
+		{GroupBy: []string{"service"}, Metrics: []string{"bytes", "distinct(src)", "distinct(dst)", "p95(bytes)"}, Limit: 50},
+	} {
+		b.Run(strings.Join(q.GroupBy, ","), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := fs.Aggregate(q); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkQueryCardinality(b *testing.B) {
+	fs := benchStore(b)
+	for _, dim := range []string{"src", "interface"} {
+		b.Run(dim, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := fs.QueryCardinality(dim, "1h", 50); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAddWithDedup is BenchmarkAdd with cross-exporter deduplication,
+// where every flow gets dedup state
+func BenchmarkAddWithDedup(b *testing.B) {
+	fs := ingestStore(b)
+	fs.SetDedup(DedupConfig{Window: 30 * time.Second})
+	b.ReportAllocs()
+	b.ResetTimer()
+	i := 0
+	for b.Loop() {
+		fs.Add(benchExtra[i : i+30])
+		i = (i + 30) % (len(benchExtra) - 30)
+	}
+}
@@ -0,0 +1,582 @@
+package store
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Cardinality estimates count distinct hosts over sliding windows: the peers of
+// each source and destination host, and the hosts behind each interface and
+// exporter. They are fed from every added flow with HyperLogLog sketches, so
+// they cover the whole window even after the flows were evicted.
+//
+// The sketches are kept in slots of cardinalitySlotLength; a window is the union
+// of its completed slots plus the running one. Unions of HyperLogLog sketches
+// are lossless, so all windows share the same slots.
+
+// DefaultCardinalityWindows are the windows distinct counts can be queried for,
+// ordered from short to long. Lengths are multiples of cardinalitySlotLength.
+var DefaultCardinalityWindows = []HeavyHitterWindow{
+	{Name: "5m", Length: 5 * time.Minute},
+	{Name: "15m", Length: 15 * time.Minute},
+	{Name: "1h", Length: time.Hour},
+}
+
+// CardinalityDimensions lists what distinct hosts are counted for
+var CardinalityDimensions = []string{"src", "dst", "interface", "exporter"}
+
+const (
+	// CardinalityMemoryLimit bounds the memory of the sketches. Once reached,
+	// keys not yet seen in the running slot are not counted until old slots
+	// leave the windows.
+	CardinalityMemoryLimit = 64 << 20
+
+	cardinalitySlotLength = 5 * time.Minute
+	cardinalitySlots      = 12 // Completed slots kept, enough for the longest window
+
+	hllPrecision = 10 // 1024 registers, standard error 1.04/sqrt(1024) = 3.3%
+	hllRegisters = 1 << hllPrecision
+	hllSparseMax = hllRegisters / 4 // Sparse entries before switching to dense registers
+
+	cardinalityKeyOverhead = 48 // Estimated bytes per key in a slot map
+	hllOverhead            = 64 // Estimated bytes of a heap-allocated sketch besides its registers
+)
+
+// Cardinality dimensions, indexes into CardinalityDimensions
+const (
+	cardSrc       = iota // Distinct destinations per source host
+	cardDst              // Distinct sources per destination host
+	cardInterface        // Distinct hosts behind an interface (sources in, destinations out)
+	cardExporter         // Distinct hosts seen by an exporter
+	numCardDims
+)
+
+// cardinalityKey identifies what distinct hosts are counted for. For interfaces
+// and exporters addr is the exporter. Without pointers (unlike netip.Addr), so
+// the maps are cheap to hash and not scanned by the GC.
+type cardinalityKey struct {
+	addr    [16]byte
+	ifIndex uint16
+	ipv4    bool
+	output  bool
+}
+
+func newCardinalityKey(addr netip.Addr) cardinalityKey {
+	return cardinalityKey{addr: addr.As16(), ipv4: addr.Is4()}
+}
+
+// netipAddr returns the address of the key
+func (k cardinalityKey) netipAddr() netip.Addr {
+	addr := netip.AddrFrom16(k.addr)
+	if k.ipv4 {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// hll is a HyperLogLog sketch. Small sketches keep the set registers in a
+// sorted list (index<<8 | rank) and switch to a dense register array when the
+// list would take as much memory.
+type hll struct {
+	sparse []uint32
+	dense  []uint8
+}
+
+var hllSeed = maphash.MakeSeed()
+
+// hllHash returns the hash of an address for hll.add
+func hllHash(addr netip.Addr) uint64 {
+	return maphash.Comparable(hllSeed, addr.As16())
+}
+
+// hllEntry returns the register entry (index<<8 | rank) of an hllHash. The
+// rank is at least 1, so entries are never 0.
+func hllEntry(x uint64) uint32 {
+	index := uint32(x >> (64 - hllPrecision))
+	rank := uint32(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	return index<<8 | rank
+}
+
+// set raises a register to the rank of entry. Returns the change in memory use.
+func (h *hll) set(entry uint32) int {
+	index, rank := entry>>8, uint8(entry)
+	if h.dense != nil {
+		if rank > h.dense[index] {
+			h.dense[index] = rank
+		}
+		return 0
+	}
+
+	i, found := slices.BinarySearchFunc(h.sparse, index, func(e, index uint32) int {
+		return int(e>>8) - int(index)
+	})
+	if found {
+		if entry > h.sparse[i] {
+			h.sparse[i] = entry
+		}
+		return 0
+	}
+	if len(h.sparse) < hllSparseMax {
+		before := cap(h.sparse)
+		h.sparse = slices.Insert(h.sparse, i, entry)
+		return 4 * (cap(h.sparse) - before)
+	}
+
+	delta := h.toDense()
+	h.dense[index] = rank
+	return delta
+}
+
+// toDense switches to dense registers. Returns the change in memory use.
+func (h *hll) toDense() int {
+	before := 4 * cap(h.sparse)
+	h.dense = make([]uint8, hllRegisters)
+	for _, e := range h.sparse {
+		h.dense[e>>8] = uint8(e)
+	}
+	h.sparse = nil
+	return hllRegisters - before
+}
+
+// merge adds the registers of another sketch. Returns the change in memory use.
+func (h *hll) merge(other *hll) int {
+	delta := 0
+	if other.dense != nil {
+		if h.dense == nil {
+			delta = h.toDense()
+		}
+		for i, rank := range other.dense {
+			if rank > h.dense[i] {
+				h.dense[i] = rank
+			}
+		}
+		return delta
+	}
+	for _, e := range other.sparse {
+		delta += h.set(e)
+	}
+	return delta
+}
+
+// estimate returns the estimated number of distinct addresses
+func (h *hll) estimate() uint64 {
+	const m = float64(hllRegisters)
+
+	sum, zeros := 0.0, 0
+	if h.dense != nil {
+		for _, rank := range h.dense {
+			sum += math.Ldexp(1, -int(rank))
+			if rank == 0 {
+				zeros++
+			}
+		}
+	} else {
+		for _, e := range h.sparse {
+			sum += math.Ldexp(1, -int(uint8(e)))
+		}
+		zeros = hllRegisters - len(h.sparse)
+		sum += float64(zeros)
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small sets
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// slotSketch is the sketch of a key in a slot. Up to two registers are kept
+// inline, so the many keys that see only a host or two need no allocation and
+// the maps hold no pointers for the GC to scan. Larger sketches are moved to
+// cardinalitySlot.large.
+type slotSketch struct {
+	regs  [2]uint32 // Register entries, 0 if unused
+	large int32     // Index+1 into cardinalitySlot.large, 0 while inline
+}
+
+// cardinalitySlot holds the sketches of one time slot
+type cardinalitySlot struct {
+	start    time.Time
+	sketches [numCardDims]map[cardinalityKey]slotSketch
+	large    []*hll
+	memory   int    // Estimated memory use in bytes
+	skipped  uint64 // Updates not counted because of the memory limit
+}
+
+func newCardinalitySlot(start time.Time) *cardinalitySlot {
+	slot := &cardinalitySlot{start: start}
+	for d := range slot.sketches {
+		slot.sketches[d] = make(map[cardinalityKey]slotSketch)
+	}
+	return slot
+}
+
+// add sets a register entry in the sketch of a key. Returns the change in
+// memory use.
+func (slot *cardinalitySlot) add(dim int, key cardinalityKey, sketch slotSketch, entry uint32) int {
+	if sketch.large > 0 {
+		return slot.large[sketch.large-1].set(entry)
+	}
+
+	for i, e := range sketch.regs {
+		switch {
+		case e == 0:
+			sketch.regs[i] = entry
+		case e>>8 != entry>>8:
+			continue
+		case entry > e:
+			sketch.regs[i] = entry
+		default:
+			return 0 // Register already as high
+		}
+		slot.sketches[dim][key] = sketch
+		return 0
+	}
+
+	// Third register: move to the heap
+	h := &hll{sparse: make([]uint32, 0, 4)}
+	h.set(sketch.regs[0])
+	h.set(sketch.regs[1])
+	h.set(entry)
+	slot.large = append(slot.large, h)
+	slot.sketches[dim][key] = slotSketch{large: int32(len(slot.large))}
+	return hllOverhead + 4*cap(h.sparse)
+}
+
+// mergeInto adds a key's sketch to union
+func (slot *cardinalitySlot) mergeInto(union *hll, sketch slotSketch) {
+	if sketch.large > 0 {
+		union.merge(slot.large[sketch.large-1])
+		return
+	}
+	for _, e := range sketch.regs {
+		if e != 0 {
+			union.set(e)
+		}
+	}
+}
+
+// cardinality maintains the distinct-host sketches. Has its own lock so queries
+// don't hold up the rest of the ingest path.
+type cardinality struct {
+	mu     sync.Mutex
+	slots  []*cardinalitySlot // Oldest first, the last one is running
+	memory int                // Estimated memory use of all slots in bytes
+}
+
+func newCardinality() *cardinality {
+	return &cardinality{}
+}
+
+// add counts the hosts of a flow into the running slot
+func (c *cardinality) add(flow *types.Flow) {
+	src, dst := isHost(flow.SrcAddr), isHost(flow.DstAddr)
+	if !src && !dst {
+		return
+	}
+	var srcKey, dstKey cardinalityKey
+	var srcHash, dstHash uint64
+	if src {
+		srcKey, srcHash = newCardinalityKey(flow.SrcAddr), hllHash(flow.SrcAddr)
+	}
+	if dst {
+		dstKey, dstHash = newCardinalityKey(flow.DstAddr), hllHash(flow.DstAddr)
+	}
+	exporter := newCardinalityKey(flow.ExporterIP)
+
+	c.mu.Lock()
+	slot := c.running(flow.ReceivedAt)
+	if src && dst {
+		c.count(slot, cardSrc, srcKey, dstHash)
+		c.count(slot, cardDst, dstKey, srcHash)
+	}
+
+	// Hosts behind the interfaces, like the interfaces page: sources of the
+	// input interface, destinations of the output interface
+	if flow.InputIf > 0 && src {
+		key := exporter
+		key.ifIndex = flow.InputIf
+		c.count(slot, cardInterface, key, srcHash)
+	}
+	if flow.OutputIf > 0 && dst {
+		key := exporter
+		key.ifIndex, key.output = flow.OutputIf, true
+		c.count(slot, cardInterface, key, dstHash)
+	}
+
+	if flow.ExporterIP.IsValid() {
+		if src {
+			c.count(slot, cardExporter, exporter, srcHash)
+		}
+		if dst {
+			c.count(slot, cardExporter, exporter, dstHash)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// isHost reports whether addr is a host address worth counting
+func isHost(addr netip.Addr) bool {
+	return addr.IsValid() && !addr.IsUnspecified()
+}
+
+// count adds a host (by its hllHash) to the sketch of key. Must be called with
+// c.mu held.
+func (c *cardinality) count(slot *cardinalitySlot, dim int, key cardinalityKey, host uint64) {
+	delta := 0
+	sketch, ok := slot.sketches[dim][key]
+	if !ok {
+		if c.memory >= CardinalityMemoryLimit {
+			slot.skipped++
+			return
+		}
+		delta = cardinalityKeyOverhead
+	}
+	delta += slot.add(dim, key, sketch, hllEntry(host))
+	slot.memory += delta
+	c.memory += delta
+}
+
+// running returns the slot for ts, starting a new one if ts is past the running
+// slot. Slots that left the longest window are dropped. Must be called with
+// c.mu held.
+func (c *cardinality) running(ts time.Time) *cardinalitySlot {
+	start := ts.Truncate(cardinalitySlotLength)
+	if n := len(c.slots); n > 0 && !start.After(c.slots[n-1].start) {
+		// Late flows are counted into the running slot
+		return c.slots[n-1]
+	}
+
+	slot := newCardinalitySlot(start)
+	c.slots = append(c.slots, slot)
+
+	cutoff := start.Add(-cardinalitySlots * cardinalitySlotLength)
+	n := 0
+	for n < len(c.slots) && c.slots[n].start.Before(cutoff) {
+		c.memory -= c.slots[n].memory
+		n++
+	}
+	if n > 0 {
+		c.slots = append(c.slots[:0], c.slots[n:]...)
+	}
+	return slot
+}
+
+// window returns the slots covering a window up to now. Must be called with
+// c.mu held.
+func (c *cardinality) window(length time.Duration) []*cardinalitySlot {
+	running := c.running(time.Now())
+	since := running.start.Add(-length)
+	i := len(c.slots) - 1
+	for i > 0 && !c.slots[i-1].start.Before(since) {
+		i--
+	}
+	return c.slots[i:]
+}
+
+// CardinalityEntry is the distinct count of one key
+type CardinalityEntry struct {
+	Key       string     // Display form, e.g. "10.0.0.1", "192.0.2.1 if 3 out"
+	Filter    string     // Filter expression for the flows of this key
+	Addr      netip.Addr // Host for src and dst, exporter for interface and exporter
+	Interface uint16     // Interface index for the interface dimension
+	Output    bool       // Output interface (destinations behind it)
+	Distinct  uint64     // Estimated distinct hosts
+}
+
+// CardinalityResult is the answer to QueryCardinality
+type CardinalityResult struct {
+	Dimension string
+	Window    string
+	Since     time.Time          // Start of the covered range; the running slot extends the window
+	Keys      int                // Number of keys in the range
+	Skipped   uint64             // Updates not counted because of the memory limit
+	Entries   []CardinalityEntry // Largest first
+}
+
+// cardinalityWindow looks up a window of DefaultCardinalityWindows by name
+func cardinalityWindow(name string) (time.Duration, error) {
+	var names []string
+	for _, w := range DefaultCardinalityWindows {
+		if w.Name == name {
+			return w.Length, nil
+		}
+		names = append(names, w.Name)
+	}
+	return 0, fmt.Errorf("unknown window %q (valid: %s)", name, strings.Join(names, ", "))
+}
+
+// cardinalityDimension looks up a dimension of CardinalityDimensions by name
+func cardinalityDimension(name string) (int, error) {
+	if dim := slices.Index(CardinalityDimensions, name); dim >= 0 {
+		return dim, nil
+	}
+	return 0, fmt.Errorf("unknown dimension %q (valid: %s)", name, strings.Join(CardinalityDimensions, ", "))
+}
+
+// merged returns the union of a key's sketches over slots, nil if not seen
+func merged(slots []*cardinalitySlot, dim int, key cardinalityKey) *hll {
+	var union *hll
+	for _, slot := range slots {
+		if sketch, ok := slot.sketches[dim][key]; ok {
+			if union == nil {
+				union = &hll{}
+			}
+			slot.mergeInto(union, sketch)
+		}
+	}
+	return union
+}
+
+// QueryCardinality returns the keys of a dimension (CardinalityDimensions) with
+// the most distinct hosts in a window (DefaultCardinalityWindows), limit 0 for all
+func (fs *FlowStore) QueryCardinality(dimension, window string, limit int) (CardinalityResult, error) {
+	dim, err := cardinalityDimension(dimension)
+	if err != nil {
+		return CardinalityResult{}, err
+	}
+	length, err := cardinalityWindow(window)
+	if err != nil {
+		return CardinalityResult{}, err
+	}
+
+	c := fs.cardinality
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := c.window(length)
+	result := CardinalityResult{Dimension: dimension, Window: window, Since: slots[0].start}
+
+	unions := make(map[cardinalityKey]*hll)
+	for _, slot := range slots {
+		result.Skipped += slot.skipped
+		for key, sketch := range slot.sketches[dim] {
+			union := unions[key]
+			if union == nil {
+				union = &hll{}
+				unions[key] = union
+			}
+			slot.mergeInto(union, sketch)
+		}
+	}
+	result.Keys = len(unions)
+
+	result.Entries = make([]CardinalityEntry, 0, len(unions))
+	for key, union := range unions {
+		entry := CardinalityEntry{Addr: key.netipAddr(), Interface: key.ifIndex, Output: key.output, Distinct: union.estimate()}
+		entry.Key, entry.Filter = key.label(dim)
+		result.Entries = append(result.Entries, entry)
+	}
+	sort.Slice(result.Entries, func(i, j int) bool {
+		a, b := result.Entries[i], result.Entries[j]
+		if a.Distinct != b.Distinct {
+			return a.Distinct > b.Distinct
+		}
+		return a.Key < b.Key
+	})
+	if limit > 0 && len(result.Entries) > limit {
+		result.Entries = result.Entries[:limit]
+	}
+	return result, nil
+}
+
+// DistinctPeers returns the estimated distinct peers of hosts in a window: the
+// destinations they sent to for dimension "src", the sources they received from
+// for "dst". Entries are in the order of hosts; hosts not seen in the window are
+// left out.
+func (fs *FlowStore) DistinctPeers(dimension, window string, hosts []netip.Addr) (CardinalityResult, error) {
+	dim, err := cardinalityDimension(dimension)
+	if err != nil {
+		return CardinalityResult{}, err
+	}
+	if dim != cardSrc && dim != cardDst {
+		return CardinalityResult{}, fmt.Errorf("dimension %q has no hosts (valid: src, dst)", dimension)
+	}
+	length, err := cardinalityWindow(window)
+	if err != nil {
+		return CardinalityResult{}, err
+	}
+
+	c := fs.cardinality
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := c.window(length)
+	result := CardinalityResult{Dimension: dimension, Window: window, Since: slots[0].start}
+	for _, slot := range slots {
+		result.Skipped += slot.skipped
+	}
+	for _, host := range hosts {
+		key := newCardinalityKey(host)
+		if union := merged(slots, dim, key); union != nil {
+			entry := CardinalityEntry{Addr: key.netipAddr(), Distinct: union.estimate()}
+			entry.Key, entry.Filter = key.label(dim)
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	result.Keys = len(result.Entries)
+	return result, nil
+}
+
+// DistinctInterfaceHosts returns the estimated distinct hosts behind an
+// interface index in a window, over all exporters: sources for the input
+// direction, destinations for the output direction
+func (fs *FlowStore) DistinctInterfaceHosts(window string, ifIndex uint16, output bool) (uint64, error) {
+	length, err := cardinalityWindow(window)
+	if err != nil {
+		return 0, err
+	}
+
+	c := fs.cardinality
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	union := &hll{}
+	for _, slot := range c.window(length) {
+		for key, sketch := range slot.sketches[cardInterface] {
+			if key.ifIndex == ifIndex && key.output == output {
+				slot.mergeInto(union, sketch)
+			}
+		}
+	}
+	return union.estimate(), nil
+}
+
+// CardinalityMemory returns the estimated memory use of the distinct-host
+// sketches in bytes
+func (fs *FlowStore) CardinalityMemory() int {
+	c := fs.cardinality
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.memory
+}
+
+// label returns the display form and the filter expression of a key
+func (k cardinalityKey) label(dim int) (string, string) {
+	addr := k.netipAddr()
+	switch dim {
+	case cardSrc:
+		return addr.String(), "src=" + addr.String()
+	case cardDst:
+		return addr.String(), "dst=" + addr.String()
+	case cardInterface:
+		if k.output {
+			return fmt.Sprintf("%s if %d out", addr, k.ifIndex), fmt.Sprintf("exporter=%s && outif=%d", addr, k.ifIndex)
+		}
+		return fmt.Sprintf("%s if %d in", addr, k.ifIndex), fmt.Sprintf("exporter=%s && inif=%d", addr, k.ifIndex)
+	case cardExporter:
+		return addr.String(), "exporter=" + addr.String()
+	}
+	return "", ""
+}
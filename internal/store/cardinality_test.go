@@ -0,0 +1,274 @@
+package store
+
+import (
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"testing"
+)
+
+// hllStdError is the relative standard error of the estimate
+var hllStdError = 1.04 / math.Sqrt(hllRegisters)
+
+// hllTrials is the number of independent sets estimated per cardinality
+const hllTrials = 8
+
+// hostEntries returns the register entries of n distinct addresses from first on
+func hostEntries(first, n int) []uint32 {
+	entries := make([]uint32, n)
+	for i := range entries {
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], uint32(first+i))
+		entries[i] = hllEntry(hllHash(netip.AddrFrom4(a)))
+	}
+	return entries
+}
+
+// registers returns the registers of a sketch, sparse or dense
+func registers(h *hll) [hllRegisters]uint8 {
+	var regs [hllRegisters]uint8
+	if h.dense != nil {
+		copy(regs[:], h.dense)
+		return regs
+	}
+	for _, e := range h.sparse {
+		regs[e>>8] = uint8(e)
+	}
+	return regs
+}
+
+// newHLL returns a sketch of entries and the registers it should have
+func newHLL(entries []uint32) (*hll, [hllRegisters]uint8) {
+	h := &hll{}
+	var want [hllRegisters]uint8
+	for _, e := range entries {
+		h.set(e)
+		want[e>>8] = max(want[e>>8], uint8(e))
+	}
+	return h, want
+}
+
+// checkEstimate checks that an estimate of n hosts is within six standard
+// errors, small sets within two hosts (register collisions). The hash seed
+// changes with every run, so tighter bounds on a single estimate would fail
+// now and then.
+func checkEstimate(t *testing.T, name string, got uint64, n int) {
+	t.Helper()
+	if diff := math.Abs(float64(got) - float64(n)); diff > max(2, 6*hllStdError*float64(n)) {
+		t.Errorf("%s: estimate %d for %d distinct hosts", name, got, n)
+	}
+}
+
+// checkEstimates checks estimates of independent sets of n hosts: each one as
+// checkEstimate, and their root mean square error within 2.5 standard errors.
+// The error is highest where the estimate switches from linear counting.
+func checkEstimates(t *testing.T, name string, estimates []uint64, n int) {
+	t.Helper()
+	var sq float64
+	for _, got := range estimates {
+		checkEstimate(t, name, got, n)
+		sq += (float64(got) - float64(n)) * (float64(got) - float64(n))
+	}
+	if rms := math.Sqrt(sq / float64(len(estimates))); rms > max(1, 2.5*hllStdError*float64(n)) {
+		t.Errorf("%s: error %.1f (rms) for %d distinct hosts, estimates %v", name, rms, n, estimates)
+	}
+}
+
+func TestHLLEntry(t *testing.T) {
+	for _, tc := range []struct {
+		hash  uint64
+		index uint32
+		rank  uint32
+	}{
+		{0, 0, 64 - hllPrecision + 1}, // No bit set after the index: maximum rank
+		{math.MaxUint64, hllRegisters - 1, 1},
+		{1 << (64 - hllPrecision), 1, 64 - hllPrecision + 1},
+		{1 << (63 - hllPrecision), 0, 1},
+		{1 << (62 - hllPrecision), 0, 2},
+	} {
+		e := hllEntry(tc.hash)
+		if e>>8 != tc.index || e&0xff != tc.rank {
+			t.Errorf("hllEntry(%#x) = index %d rank %d, want %d %d", tc.hash, e>>8, e&0xff, tc.index, tc.rank)
+		}
+	}
+}
+
+func TestHLLSparseToDense(t *testing.T) {
+	h := &hll{}
+	var want [hllRegisters]uint8
+	memory := 0
+	for _, e := range hostEntries(0, 2000) {
+		wasSparse := h.dense == nil
+		memory += h.set(e)
+		want[e>>8] = max(want[e>>8], uint8(e))
+
+		if h.dense == nil {
+			if len(h.sparse) > hllSparseMax {
+				t.Fatalf("%d sparse entries, limit %d", len(h.sparse), hllSparseMax)
+			}
+			for i := 1; i < len(h.sparse); i++ {
+				if h.sparse[i]>>8 <= h.sparse[i-1]>>8 {
+					t.Fatalf("sparse entries out of order at %d", i)
+				}
+			}
+			if memory != 4*cap(h.sparse) {
+				t.Fatalf("memory %d, sparse list takes %d", memory, 4*cap(h.sparse))
+			}
+		} else if wasSparse {
+			// Switched at the limit: the next new register
+			if memory != hllRegisters || len(h.sparse) != 0 {
+				t.Fatalf("after switching: memory %d, %d sparse entries", memory, len(h.sparse))
+			}
+		}
+		if registers(h) != want {
+			t.Fatal("registers differ from the entries set")
+		}
+	}
+	if h.dense == nil {
+		t.Fatal("still sparse after 2000 hosts")
+	}
+
+	// Setting known entries again changes nothing
+	if delta := h.set(hostEntries(0, 1)[0]); delta != 0 || registers(h) != want {
+		t.Errorf("repeated entry: memory delta %d", delta)
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	small := hostEntries(0, 50)             // Sparse
+	overlap := hostEntries(25, 50)          // Sparse, half of it in small
+	large := hostEntries(1000, 5000)        // Dense
+	largeOverlap := hostEntries(3000, 5000) // Dense, 3000 in large
+
+	for _, tc := range []struct {
+		name      string
+		a, b      []uint32
+		distinct  int
+		wantDense bool
+	}{
+		{"sparse into sparse", small, overlap, 75, false},
+		{"sparse into dense", large, small, 5050, true},
+		{"dense into sparse", small, large, 5050, true},
+		{"dense into dense", large, largeOverlap, 7000, true},
+		{"into empty", nil, overlap, 50, false},
+	} {
+		a, wantA := newHLL(tc.a)
+		b, wantB := newHLL(tc.b)
+		delta := 0
+		if a.dense != nil {
+			delta = hllRegisters
+		} else {
+			delta = 4 * cap(a.sparse)
+		}
+		delta += a.merge(b)
+
+		var want [hllRegisters]uint8
+		for i := range want {
+			want[i] = max(wantA[i], wantB[i])
+		}
+		if registers(a) != want {
+			t.Errorf("%s: registers are not the union", tc.name)
+		}
+		if (a.dense != nil) != tc.wantDense {
+			t.Errorf("%s: dense = %v", tc.name, a.dense != nil)
+		}
+		if a.dense != nil && delta != hllRegisters || a.dense == nil && delta != 4*cap(a.sparse) {
+			t.Errorf("%s: memory %d after merge", tc.name, delta)
+		}
+		checkEstimate(t, tc.name, a.estimate(), tc.distinct)
+
+		// The other sketch is unchanged
+		if registers(b) != wantB {
+			t.Errorf("%s: merge modified its argument", tc.name)
+		}
+	}
+}
+
+func TestHLLEstimate(t *testing.T) {
+	if est := (&hll{}).estimate(); est != 0 {
+		t.Errorf("empty sketch: %d", est)
+	}
+
+	// Small sets are in the linear counting range, almost exact; the switch
+	// to the HyperLogLog estimate is at 2.5 * registers
+	for _, n := range []int{1, 2, 10, 100, 500, 2000, 2560, 3000, 10000, 100000, 1000000} {
+		trials := hllTrials
+		if n > 100000 {
+			trials = 1
+		}
+		var estimates []uint64
+		for i := range trials {
+			h, _ := newHLL(hostEntries(i*n, n))
+			estimates = append(estimates, h.estimate())
+
+			// Sparse and dense registers give the same estimate
+			if h.dense == nil {
+				dense := &hll{sparse: append([]uint32(nil), h.sparse...)}
+				dense.toDense()
+				if got, want := dense.estimate(), h.estimate(); got != want {
+					t.Errorf("%d hosts: dense estimate %d, sparse %d", n, got, want)
+				}
+			}
+		}
+		if trials > 1 {
+			checkEstimates(t, "one sketch", estimates, n)
+		} else {
+			checkEstimate(t, "one sketch", estimates[0], n)
+		}
+	}
+
+	// Unions of many sketches, as for a window of slots
+	for _, tc := range []struct{ sketches, perSketch, step int }{
+		{12, 100, 50},      // Small, overlapping slots
+		{12, 20000, 10000}, // Large, overlapping slots
+		{4, 50000, 50000},  // Disjoint
+		{6, 3000, 0},       // The same hosts in every slot
+	} {
+		distinct := (tc.sketches-1)*tc.step + tc.perSketch
+		var estimates []uint64
+		for trial := range hllTrials {
+			union := &hll{}
+			for i := range tc.sketches {
+				h, _ := newHLL(hostEntries(trial*distinct+i*tc.step, tc.perSketch))
+				union.merge(h)
+			}
+			estimates = append(estimates, union.estimate())
+		}
+		checkEstimates(t, "union", estimates, distinct)
+	}
+}
+
+func TestSlotSketch(t *testing.T) {
+	// The first two registers are kept inline, then the sketch moves to the
+	// heap; merging either gives the same union as a plain sketch
+	key := newCardinalityKey(netip.MustParseAddr("10.0.0.1"))
+	for _, n := range []int{1, 2, 3, 200} {
+		slot := newCardinalitySlot(testEpoch)
+		memory := 0
+		entries := hostEntries(0, n)
+		for _, e := range entries {
+			memory += slot.add(cardSrc, key, slot.sketches[cardSrc][key], e)
+		}
+		_, want := newHLL(entries)
+		regs := 0
+		for _, rank := range want {
+			if rank > 0 {
+				regs++
+			}
+		}
+
+		sketch := slot.sketches[cardSrc][key]
+		if large := sketch.large > 0; large != (regs > 2) {
+			t.Errorf("%d hosts in %d registers: large = %v", n, regs, large)
+		}
+		if regs <= 2 && memory != 0 || regs > 2 && memory != hllOverhead+4*cap(slot.large[0].sparse) {
+			t.Errorf("%d hosts: memory %d", n, memory)
+		}
+
+		union := &hll{}
+		slot.mergeInto(union, sketch)
+		if registers(union) != want {
+			t.Errorf("%d hosts: union differs from a plain sketch", n)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Binary flow record encoding used for on-disk storage.
+//
+// Each record is prefixed with its length as uvarint. Integers are (u)varints,
+// IP addresses a length byte followed by 4 or 16 bytes, strings a uvarint length
+// followed by the bytes and timestamps Unix nanoseconds (0 = zero time).
+// Fields are only ever appended at the end; decoders skip unknown trailing bytes.
+
+var errShortRecord = errors.New("truncated flow record")
+
+// appendFlow appends the length-prefixed encoding of a flow to buf
+func appendFlow(buf []byte, f *types.Flow) []byte {
+	var rec []byte
+	rec = binary.AppendUvarint(rec, uint64(f.Version))
+	rec = appendIP(rec, f.SrcAddr)
+	rec = appendIP(rec, f.DstAddr)
+	rec = binary.AppendUvarint(rec, uint64(f.SrcPort))
+	rec = binary.AppendUvarint(rec, uint64(f.DstPort))
+	rec = append(rec, f.Protocol, f.TCPFlags, uint8(f.EndReason), f.SrcMask, f.DstMask)
+	rec = binary.AppendUvarint(rec, f.Bytes)
+	rec = binary.AppendUvarint(rec, f.Packets)
+	rec = appendTime(rec, f.StartTime)
+	rec = appendTime(rec, f.EndTime)
+	rec = binary.AppendUvarint(rec, uint64(f.SrcAS))
+	rec = binary.AppendUvarint(rec, uint64(f.DstAS))
+	rec = binary.AppendUvarint(rec, uint64(f.InputIf))
+	rec = binary.AppendUvarint(rec, uint64(f.OutputIf))
+	rec = appendIP(rec, f.ExporterIP)
+	rec = appendTime(rec, f.ReceivedAt)
+	rec = appendTime(rec, f.ExportTime)
+	rec = binary.AppendVarint(rec, int64(f.ClockCorrection))
+	rec = appendBool(rec, f.TimeImplausible)
+	rec = append(rec, f.AppID.Engine)
+	rec = binary.AppendUvarint(rec, f.AppID.Selector)
+	rec = appendString(rec, f.AppName)
+	rec = append(rec, uint8(f.Aggregation))
+	rec = binary.AppendUvarint(rec, uint64(f.FlowCount))
+	rec = binary.AppendUvarint(rec, f.Seq)
+
+	buf = binary.AppendUvarint(buf, uint64(len(rec)))
+	return append(buf, rec...)
+}
+
+// decodeFlow decodes one length-prefixed flow record and returns the bytes consumed
+func decodeFlow(data []byte) (types.Flow, int, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return types.Flow{}, 0, errShortRecord
+	}
+	f, err := decodeFlowRecord(data[n : n+int(length)])
+	if err != nil {
+		return f, 0, err
+	}
+	return f, n + int(length), nil
+}
+
+// decodeFlowRecord decodes the body of a flow record (without length prefix)
+func decodeFlowRecord(rec []byte) (types.Flow, error) {
+	var f types.Flow
+	d := &decoder{data: rec}
+
+	f.Version = types.FlowVersion(d.uvarint())
+	f.SrcAddr = d.ip()
+	f.DstAddr = d.ip()
+	f.SrcPort = uint16(d.uvarint())
+	f.DstPort = uint16(d.uvarint())
+	f.Protocol = d.byte()
+	f.TCPFlags = d.byte()
+	f.EndReason = types.EndReason(d.byte())
+	f.SrcMask = d.byte()
+	f.DstMask = d.byte()
+	f.Bytes = d.uvarint()
+	f.Packets = d.uvarint()
+	f.StartTime = d.time()
+	f.EndTime = d.time()
+	f.SrcAS = uint32(d.uvarint())
+	f.DstAS = uint32(d.uvarint())
+	f.InputIf = uint16(d.uvarint())
+	f.OutputIf = uint16(d.uvarint())
+	f.ExporterIP = d.ip()
+	f.ReceivedAt = d.time()
+	f.ExportTime = d.time()
+	f.ClockCorrection = time.Duration(d.varint())
+	f.TimeImplausible = d.byte() != 0
+	f.AppID.Engine = d.byte()
+	f.AppID.Selector = d.uvarint()
+	f.AppName = d.string()
+	f.Aggregation = types.Aggregation(d.byte())
+	f.FlowCount = uint32(d.uvarint())
+	if len(d.data) > 0 {
+		f.Seq = d.uvarint() // Absent in records written before sequence numbers
+	}
+
+	return f, d.err
+}
+
+func appendIP(buf []byte, ip netip.Addr) []byte {
+	if !ip.IsValid() {
+		return append(buf, 0)
+	}
+	if ip = ip.Unmap(); ip.Is4() {
+		b := ip.As4()
+		return append(append(buf, 4), b[:]...)
+	}
+	b := ip.As16()
+	return append(append(buf, 16), b[:]...)
+}
+
+func appendTime(buf []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return binary.AppendVarint(buf, 0)
+	}
+	return binary.AppendVarint(buf, t.UnixNano())
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+// decoder reads fields from a single record; the first error sticks
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.data) {
+		d.err = errShortRecord
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) ip() netip.Addr {
+	n := int(d.byte())
+	if n == 0 {
+		return netip.Addr{}
+	}
+	ip, _ := netip.AddrFromSlice(d.take(n))
+	return ip
+}
+
+func (d *decoder) time() time.Time {
+	ns := d.varint()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func (d *decoder) string() string {
+	return string(d.take(int(d.uvarint())))
+}
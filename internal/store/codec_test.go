@@ -0,0 +1,233 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// decoded returns a flow as it comes back from the codec: times without
+// monotonic clock and location, v4-mapped addresses unmapped, no LRU time
+func decoded(f types.Flow) types.Flow {
+	for _, t := range []*time.Time{&f.StartTime, &f.EndTime, &f.ReceivedAt, &f.ExportTime} {
+		if !t.IsZero() {
+			*t = time.Unix(0, t.UnixNano())
+		}
+	}
+	for _, a := range []*netip.Addr{&f.SrcAddr, &f.DstAddr, &f.ExporterIP} {
+		*a = a.Unmap()
+	}
+	f.LastAccessed = time.Time{}
+	return f
+}
+
+// codecFlows are testFlows plus flows with all optional fields set and unset
+func codecFlows() []types.Flow {
+	flows := testFlows()
+	full := types.Flow{
+		Version: types.NetFlowV8, SrcAddr: netip.MustParseAddr("::ffff:10.9.8.7"), DstAddr: netip.MustParseAddr("2001:db8::2"),
+		SrcPort: 65535, DstPort: 1, Protocol: 6, TCPFlags: 0xff, EndReason: types.EndReasonLackOfResources,
+		SrcMask: 24, DstMask: 128, Bytes: 1<<64 - 1, Packets: 1 << 40,
+		StartTime: testEpoch.Add(-time.Hour), EndTime: testEpoch, ReceivedAt: testEpoch.Add(time.Second),
+		ExportTime: testEpoch.Add(-3 * time.Second), ClockCorrection: 3 * time.Second, TimeImplausible: true,
+		SrcAS: 4294967295, DstAS: 1, InputIf: 65535, OutputIf: 65534,
+		ExporterIP:   netip.MustParseAddr("::ffff:192.0.2.1"),
+		LastAccessed: testEpoch.Add(time.Minute),
+		AppID:        types.AppID{Engine: 20, Selector: 1<<56 + 5}, AppName: "ssl/ärger",
+		Aggregation: types.AggregationPrefix, FlowCount: 42, Seq: 1 << 50,
+	}
+	pre := types.Flow{ // Dates before 1970 encode as negative nanoseconds
+		Version: types.NetFlowV5, SrcAddr: netip.MustParseAddr("0.0.0.0"), DstAddr: netip.MustParseAddr("::"),
+		StartTime: time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC), ReceivedAt: testEpoch,
+	}
+	return append(flows, full, pre, types.Flow{})
+}
+
+func TestFlowRecordRoundTrip(t *testing.T) {
+	var buf []byte
+	flows := codecFlows()
+	for i := range flows {
+		buf = appendFlow(buf, &flows[i])
+	}
+
+	for i, want := range flows {
+		got, n, err := decodeFlow(buf)
+		if err != nil {
+			t.Fatalf("flow %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, decoded(want)) {
+			t.Errorf("flow %d:\n got %+v\nwant %+v", i, got, decoded(want))
+		}
+		buf = buf[n:]
+	}
+	if len(buf) != 0 {
+		t.Errorf("%d bytes left after decoding", len(buf))
+	}
+}
+
+func TestFlowRecordCompatibility(t *testing.T) {
+	flow := codecFlows()[7]
+	rec := appendFlow(nil, &flow)
+	length, n := binary.Uvarint(rec)
+	body := rec[n:]
+
+	// Records written before sequence numbers end after FlowCount
+	old := body[:int(length)-len(binary.AppendUvarint(nil, flow.Seq))]
+	got, err := decodeFlowRecord(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decoded(flow)
+	want.Seq = 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record without seq:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Fields added later are skipped
+	got, err = decodeFlowRecord(append(bytes.Clone(body), 1, 2, 3))
+	if err != nil || !reflect.DeepEqual(got, decoded(flow)) {
+		t.Errorf("record with trailing fields: %v %+v", err, got)
+	}
+
+	// Truncation anywhere before Seq is an error
+	for cut := range len(old) {
+		if _, err := decodeFlowRecord(old[:cut]); !errors.Is(err, errShortRecord) {
+			t.Errorf("record cut at %d: err = %v, want errShortRecord", cut, err)
+		}
+	}
+	if _, _, err := decodeFlow(rec[:len(rec)-1]); !errors.Is(err, errShortRecord) {
+		t.Errorf("short length-prefixed record: err = %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	flows := codecFlows()
+	for i := range flows {
+		flows[i].Seq = uint64(i + 1)
+	}
+	const retained = 3
+
+	src := New(1000)
+	state := snapshotState{
+		created: testEpoch,
+		stats:   Stats{TotalFlows: 1234, TotalBytes: 5678, TotalPackets: 90, IPFIXFlows: 1200, LegacyFlows: 34},
+		eviction: EvictionStats{TotalEvicted: 100, FIFOEvicted: 60, AgeEvicted: 40, TopKProtected: 2, LRUProtected: 1,
+			Policies: []PolicyStats{{Name: "topk", Protected: 2, Evicted: 3}}},
+		exporters: make(map[netip.Addr]*exporterClock),
+	}
+	for _, e := range []string{"172.16.0.1", "2001:db8:ffff::1"} {
+		c := &exporterClock{stats: ExporterStats{Address: e}}
+		for i := range 10 {
+			at := testEpoch.Add(time.Duration(i) * time.Minute)
+			c.observe(&types.Flow{ReceivedAt: at, ExportTime: at.Add(5*time.Second + time.Duration(i)*time.Millisecond)})
+		}
+		state.exporters[netip.MustParseAddr(e)] = c
+	}
+	src.restore(&state, append([]types.Flow(nil), flows...), retained)
+
+	var buf bytes.Buffer
+	if _, err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := New(1000)
+	info, err := dst.ReadSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Flows != len(flows) {
+		t.Errorf("restored %d flows, want %d", info.Flows, len(flows))
+	}
+
+	view := dst.snapshot()
+	if dst.retained == nil || dst.retained.len() != retained || view.segments[0] != dst.retained {
+		t.Fatalf("retained segment not restored first")
+	}
+	var got []types.Flow
+	for _, seg := range view.segments {
+		got = append(got, seg.slice()...)
+	}
+	if len(got) != len(flows) {
+		t.Fatalf("restored %d flows, want %d", len(got), len(flows))
+	}
+	for i := range flows {
+		if want := decoded(flows[i]); !reflect.DeepEqual(got[i], want) {
+			t.Errorf("flow %d:\n got %+v\nwant %+v", i, got[i], want)
+		}
+	}
+
+	if s := dst.GetStats(); s.TotalFlows != 1234 || s.TotalBytes != 5678 || s.UniqueExporters != 2 {
+		t.Errorf("stats = %+v", s)
+	}
+	if e := dst.GetEvictionStats(); e.TotalEvicted != 100 || e.AgeEvicted != 40 || len(e.Policies) != 1 || e.Policies[0].Evicted != 3 {
+		t.Errorf("eviction stats = %+v", e)
+	}
+	want, gotClocks := src.GetExporterStats(), dst.GetExporterStats()
+	for i := range want {
+		want[i].FirstSeen, want[i].LastSeen = decodedTime(want[i].FirstSeen), decodedTime(want[i].LastSeen)
+	}
+	if !reflect.DeepEqual(gotClocks, want) {
+		t.Errorf("exporters:\n got %+v\nwant %+v", gotClocks, want)
+	}
+
+	// The drift fit continues where it left off
+	for _, fs := range []*FlowStore{src, dst} {
+		at := testEpoch.Add(10 * time.Minute)
+		fs.exporters[netip.MustParseAddr("172.16.0.1")].observe(&types.Flow{ReceivedAt: at, ExportTime: at.Add(5*time.Second + 10*time.Millisecond)})
+	}
+	if a, b := src.GetExporterStats()[0].Drift, dst.GetExporterStats()[0].Drift; a != b {
+		t.Errorf("drift after restore = %v, want %v", b, a)
+	}
+}
+
+func decodedTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Unix(0, t.UnixNano())
+}
+
+func TestReadSnapshotRejectsCorruptLengths(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := New(10).WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	header := valid[:len(snapshotMagic)+2]
+
+	for name, body := range map[string][]byte{
+		"state length":  binary.AppendUvarint(nil, 1<<40),
+		"record length": append(append(emptyState(t), 0, 1), binary.AppendUvarint(nil, 1<<40)...),
+		"huge count":    append(emptyState(t), 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f),
+		"retained":      append(emptyState(t), 2, 1),
+	} {
+		var file bytes.Buffer
+		file.Write(header)
+		zw := gzip.NewWriter(&file)
+		zw.Write(body)
+		zw.Close()
+		if _, err := New(10).ReadSnapshot(&file); !errors.Is(err, errShortRecord) {
+			t.Errorf("%s: err = %v, want errShortRecord", name, err)
+		}
+	}
+
+	if _, err := New(10).ReadSnapshot(bytes.NewReader([]byte("NFSNAX\x00\x01"))); !errors.Is(err, errNotSnapshot) {
+		t.Errorf("wrong magic: err = %v", err)
+	}
+}
+
+// emptyState returns a length-prefixed state record of an empty store
+func emptyState(t *testing.T) []byte {
+	t.Helper()
+	fs := New(10)
+	fs.mu.RLock()
+	state := fs.appendSnapshotState(nil, testEpoch)
+	fs.mu.RUnlock()
+	return append(binary.AppendUvarint(nil, uint64(len(state))), state...)
+}
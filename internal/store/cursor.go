@@ -0,0 +1,113 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+
+	"netflow-collector/pkg/types"
+)
+
+// Cursor pagination. Every stored flow gets a sequence number on Add that only
+// ever increases (also across snapshot restores). A client pages through the
+// store, or tails it, by asking for the flows after the last number it has
+// seen: flows added meanwhile show up on later pages instead of shifting the
+// current one, evicted flows simply don't.
+
+// FlowPage is one page of flows in storage order
+type FlowPage struct {
+	Flows  []types.Flow
+	Next   uint64 // Cursor for the next page: last sequence number on this page, the request cursor if empty
+	More   bool   // More matching flows are stored after this page
+	Latest uint64 // Last sequence number assigned so far
+}
+
+// QueryAfter returns up to limit flows (0 = all) matching the filter with a
+// sequence number above cursor, in storage order. Cursor 0 starts with the
+// oldest stored flow. Flows from the archive are not included.
+//
+// Apart from the retained segment, segments hold flows in sequence order, so
+// they are read from the cursor on until the page is full. Retained flows
+// (sorted by receive time) are the only ones collected and sorted up front.
+func (fs *FlowStore) QueryAfter(filter *Filter, cursor uint64, limit int) FlowPage {
+	fs.mu.RLock()
+	view := fs.snapshot()
+	retained := fs.retained
+	fs.mu.RUnlock()
+
+	page := FlowPage{Next: cursor, Latest: fs.seq.Load()}
+	if filter != nil && filter.IsEmpty() {
+		filter = nil
+	}
+	match := func(f *types.Flow) (*types.Flow, bool) {
+		if filter == nil {
+			return f, true
+		}
+		if !filter.Matches(f) {
+			return nil, false
+		}
+		return filter.clip(f), true
+	}
+
+	var held []types.Flow
+	if retained != nil {
+		flows := retained.slice()
+		for i := range flows {
+			if flows[i].Seq <= cursor {
+				continue
+			}
+			if f, ok := match(&flows[i]); ok {
+				held = append(held, *f)
+			}
+		}
+		slices.SortFunc(held, func(a, b types.Flow) int {
+			return cmp.Compare(a.Seq, b.Seq)
+		})
+	}
+
+	// One flow beyond the limit tells whether there are more
+	full := func() bool {
+		return limit > 0 && len(page.Flows) > limit
+	}
+	for _, seg := range view.segments {
+		if full() {
+			break
+		}
+		flows := seg.slice()
+		if seg == retained || len(flows) == 0 || flows[len(flows)-1].Seq <= cursor {
+			continue
+		}
+		start, found := slices.BinarySearchFunc(flows, cursor, func(f types.Flow, seq uint64) int {
+			return cmp.Compare(f.Seq, seq)
+		})
+		if found {
+			start++
+		}
+		for i := start; i < len(flows) && !full(); i++ {
+			f, ok := match(&flows[i])
+			if !ok {
+				continue
+			}
+			for len(held) > 0 && held[0].Seq < f.Seq && !full() {
+				page.Flows = append(page.Flows, held[0])
+				held = held[1:]
+			}
+			if full() {
+				break
+			}
+			page.Flows = append(page.Flows, *f)
+		}
+	}
+	for len(held) > 0 && !full() {
+		page.Flows = append(page.Flows, held[0])
+		held = held[1:]
+	}
+
+	if full() {
+		page.Flows = page.Flows[:limit]
+		page.More = true
+	}
+	if n := len(page.Flows); n > 0 {
+		page.Next = page.Flows[n-1].Seq
+	}
+	return page
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"cmp"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"netflow-collector/pkg/types"
+)
+
+// cursorStore returns a store with a retained segment whose flows are
+// interleaved in sequence with those of several sealed segments and the head
+func cursorStore(t *testing.T) *FlowStore {
+	t.Helper()
+	flows := generateFlows(20000, 3)
+	for i := range flows {
+		flows[i].Seq = uint64(i + 1)
+	}
+	var retained, rest []types.Flow
+	for i := range flows {
+		if i%7 == 3 {
+			retained = append(retained, flows[i])
+		} else {
+			rest = append(rest, flows[i])
+		}
+	}
+	rand.New(rand.NewSource(4)).Shuffle(len(retained), func(i, j int) {
+		retained[i], retained[j] = retained[j], retained[i]
+	})
+
+	fs := New(100000)
+	fs.restore(&snapshotState{exporters: make(map[netip.Addr]*exporterClock)}, append(retained, rest...), len(retained))
+	fs.Add(generateFlows(500, 5))
+	if len(fs.snapshot().segments) < 4 || fs.retained == nil {
+		t.Fatalf("store has %d segments, want retained, sealed and head", len(fs.snapshot().segments))
+	}
+	return fs
+}
+
+// queryAfterAll is QueryAfter by collecting and sorting all matching flows
+func queryAfterAll(fs *FlowStore, filter *Filter, cursor uint64, limit int) ([]uint64, bool) {
+	var seqs []uint64
+	for _, seg := range fs.snapshot().segments {
+		for _, f := range seg.slice() {
+			if f.Seq > cursor && (filter == nil || filter.Matches(&f)) {
+				seqs = append(seqs, f.Seq)
+			}
+		}
+	}
+	slices.SortFunc(seqs, cmp.Compare[uint64])
+	if limit > 0 && len(seqs) > limit {
+		return seqs[:limit], true
+	}
+	return seqs, false
+}
+
+func TestQueryAfter(t *testing.T) {
+	fs := cursorStore(t)
+	for _, expr := range []string{"", "dport=443", "proto=udp && inif=3", "dport=1"} {
+		filter := ParseFilter(expr)
+		for _, limit := range []int{1, 7, 1000, 0} {
+			var cursor uint64
+			for pages := 0; ; pages++ {
+				page := fs.QueryAfter(&filter, cursor, limit)
+				want, more := queryAfterAll(fs, &filter, cursor, limit)
+
+				got := make([]uint64, len(page.Flows))
+				for i := range page.Flows {
+					got[i] = page.Flows[i].Seq
+				}
+				if !slices.Equal(got, want) || page.More != more {
+					t.Fatalf("%q limit %d cursor %d: got %d flows (more %v), want %d (more %v)",
+						expr, limit, cursor, len(got), page.More, len(want), more)
+				}
+				if !page.More {
+					break
+				}
+				if page.Next <= cursor {
+					t.Fatalf("%q limit %d: cursor did not advance from %d", expr, limit, cursor)
+				}
+				cursor = page.Next
+				if pages == 30 {
+					break // Enough small pages
+				}
+			}
+		}
+	}
+
+	// Tailing: a page after the latest flow is empty and keeps the cursor
+	latest := fs.QueryAfter(nil, 0, 0).Latest
+	if page := fs.QueryAfter(nil, latest, 10); len(page.Flows) != 0 || page.More || page.Next != latest {
+		t.Errorf("page after latest = %+v", page)
+	}
+}
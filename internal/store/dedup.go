@@ -0,0 +1,399 @@
+package store
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Cross-exporter deduplication. When traffic crosses several exporters (say the
+// core router and the firewall) each of them exports its own record of the same
+// flow, and stats, Sankey and top talkers would count it twice. The dedup stage
+// runs in Add before anything else sees a flow: per 5-tuple it remembers the
+// exporter whose records are stored (the canonical exporter) and drops records
+// of other exporters describing the same traffic, keeping them as observation
+// points. A record is a duplicate if it was received within the window of a
+// stored record or if its start and end overlap the stored records, widened by
+// the window. The overlap catches exporters whose active timeouts are out of
+// phase and that export the same long-lived flow at different times.
+//
+// Without a policy the first exporter to report a flow becomes canonical. With
+// a primary exporter configured for a prefix, the primary becomes canonical as
+// soon as it reports the flow, and records of other exporters for matching
+// flows are held back for the window so the primary's record wins if it
+// arrives in time; otherwise the held record is stored after all. Released
+// records keep their receive time, so segments are in arrival order only to
+// within the window.
+
+// dedupPruneInterval is how often state of flows no longer stored is dropped
+const dedupPruneInterval = 10 * time.Second
+
+// PrimaryExporter prefers one exporter for flows from or to a prefix
+type PrimaryExporter struct {
+	Prefix   netip.Prefix
+	Exporter netip.Addr
+}
+
+// ParsePrimaryExporter parses "prefix=exporter", e.g. "10.0.0.0/8=192.168.1.1".
+// A plain address as prefix stands for a single host.
+func ParsePrimaryExporter(spec string) (PrimaryExporter, error) {
+	prefixStr, exporterStr, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return PrimaryExporter{}, fmt.Errorf("expected prefix=exporter, got %q", spec)
+	}
+	prefixStr = strings.TrimSpace(prefixStr)
+	prefix, err := netip.ParsePrefix(prefixStr)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(prefixStr)
+		if addrErr != nil {
+			return PrimaryExporter{}, fmt.Errorf("invalid prefix %q", prefixStr)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	exporter, err := netip.ParseAddr(strings.TrimSpace(exporterStr))
+	if err != nil {
+		return PrimaryExporter{}, fmt.Errorf("invalid exporter address %q", exporterStr)
+	}
+	return PrimaryExporter{Prefix: prefix.Masked(), Exporter: exporter.Unmap()}, nil
+}
+
+// String formats the policy as "prefix=exporter"
+func (p PrimaryExporter) String() string {
+	return p.Prefix.String() + "=" + p.Exporter.String()
+}
+
+// DedupConfig configures cross-exporter deduplication
+type DedupConfig struct {
+	Window  time.Duration     // Records of other exporters within this time or overlapping are duplicates, 0 disables
+	Primary []PrimaryExporter // Preferred exporter per prefix, the longest matching prefix wins
+}
+
+// Observation is one point where a flow was observed
+type Observation struct {
+	Exporter  netip.Addr
+	InputIf   uint16
+	OutputIf  uint16
+	Canonical bool   // Records of this exporter are the ones stored
+	Flows     uint64 // Records received, including dropped duplicates
+	Bytes     uint64
+	LastSeen  time.Time
+}
+
+// DedupStats describes the deduplication stage
+type DedupStats struct {
+	Window         time.Duration
+	Primary        []PrimaryExporter
+	Tracked        int    // Flows with dedup state
+	Duplicates     uint64 // Records dropped as duplicates
+	DuplicateBytes uint64
+	Held           int    // Records currently held back for a primary exporter
+	Released       uint64 // Held records stored because the primary did not report the flow in time
+}
+
+// dedupEntry is the dedup state of one 5-tuple
+type dedupEntry struct {
+	canonical    netip.Addr // Exporter whose records are stored, invalid while only held
+	lastSeen     time.Time  // Last stored record
+	start, end   time.Time  // Flow times covered by the canonical exporter's stored records
+	lastObserved time.Time  // Last record of any exporter
+	observations []Observation
+}
+
+// store records that the flow is stored, making its exporter canonical
+func (e *dedupEntry) store(flow *types.Flow) {
+	start, end := recordStart(flow), recordEnd(flow)
+	if flow.ExporterIP != e.canonical {
+		e.canonical = flow.ExporterIP
+		e.lastSeen = flow.ReceivedAt
+		e.start, e.end = start, end
+		return
+	}
+	if flow.ReceivedAt.After(e.lastSeen) {
+		e.lastSeen = flow.ReceivedAt
+	}
+	if start.Before(e.start) {
+		e.start = start
+	}
+	if end.After(e.end) {
+		e.end = end
+	}
+}
+
+// observe records the flow's observation point
+func (e *dedupEntry) observe(flow *types.Flow) {
+	if flow.ReceivedAt.After(e.lastObserved) {
+		e.lastObserved = flow.ReceivedAt
+	}
+	for i := range e.observations {
+		o := &e.observations[i]
+		if o.Exporter == flow.ExporterIP && o.InputIf == flow.InputIf && o.OutputIf == flow.OutputIf {
+			o.Flows++
+			o.Bytes += flow.Bytes
+			o.LastSeen = flow.ReceivedAt
+			return
+		}
+	}
+	e.observations = append(e.observations, Observation{
+		Exporter: flow.ExporterIP,
+		InputIf:  flow.InputIf,
+		OutputIf: flow.OutputIf,
+		Flows:    1,
+		Bytes:    flow.Bytes,
+		LastSeen: flow.ReceivedAt,
+	})
+}
+
+// exporters returns the number of distinct exporters that observed the flow
+func (e *dedupEntry) exporters() int {
+	n := 0
+	for i, o := range e.observations {
+		if !slices.ContainsFunc(e.observations[:i], func(p Observation) bool { return p.Exporter == o.Exporter }) {
+			n++
+		}
+	}
+	return n
+}
+
+// dedup holds the deduplication state. Has its own lock so lookups from the
+// API and TUI don't wait for ingest; config is only written with fs.mu held as
+// well, so Add may read it without mu.
+type dedup struct {
+	mu        sync.Mutex
+	config    DedupConfig
+	entries   map[types.FlowKey]*dedupEntry
+	held      []types.Flow // Held back for a primary exporter, in arrival order
+	stats     DedupStats
+	lastPrune time.Time
+}
+
+func newDedup() *dedup {
+	return &dedup{entries: make(map[types.FlowKey]*dedupEntry)}
+}
+
+// enabled reports whether deduplication is configured
+func (d *dedup) enabled() bool {
+	return d.config.Window > 0
+}
+
+// configure replaces the configuration and drops all state
+func (d *dedup) configure(config DedupConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.config = config
+	d.config.Primary = slices.Clone(config.Primary)
+	d.entries = make(map[types.FlowKey]*dedupEntry)
+	d.held = nil
+}
+
+// admit decides whether a record is stored now. Duplicates are dropped and
+// records waiting for a primary exporter are held back until release. The
+// primary exporter takes over from any other canonical exporter; records
+// already stored from that one stay.
+func (d *dedup) admit(flow *types.Flow) bool {
+	if !flow.ExporterIP.IsValid() {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := flow.FlowKey()
+	e := d.entries[key]
+	if e == nil {
+		e = &dedupEntry{}
+		d.entries[key] = e
+	}
+	e.observe(flow)
+
+	primary, hasPrimary := d.primaryFor(flow)
+	switch {
+	case flow.ExporterIP == e.canonical, hasPrimary && flow.ExporterIP == primary:
+	case d.fresh(e, flow):
+		d.duplicate(flow)
+		return false
+	case hasPrimary:
+		d.held = append(d.held, *flow)
+		return false
+	}
+	e.store(flow)
+	return true
+}
+
+// release returns held records whose window has passed and that the primary
+// exporter did not report in the meantime
+func (d *dedup) release(now time.Time) []types.Flow {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for n < len(d.held) && now.Sub(d.held[n].ReceivedAt) >= d.config.Window {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	var released []types.Flow
+	for i := range d.held[:n] {
+		flow := &d.held[i]
+		e := d.entries[flow.FlowKey()]
+		if e == nil {
+			// State already pruned, nothing to compare with
+			released = append(released, *flow)
+			continue
+		}
+		if e.canonical != flow.ExporterIP && d.fresh(e, flow) {
+			d.duplicate(flow)
+			continue
+		}
+		e.store(flow)
+		released = append(released, *flow)
+	}
+	d.held = slices.Delete(d.held, 0, n)
+	d.stats.Released += uint64(len(released))
+	return released
+}
+
+// fresh reports whether the canonical exporter reported the flow's traffic:
+// within the window of its receive time or overlapping its start and end
+func (d *dedup) fresh(e *dedupEntry, flow *types.Flow) bool {
+	if !e.canonical.IsValid() {
+		return false
+	}
+	window := d.config.Window
+	if diff := flow.ReceivedAt.Sub(e.lastSeen); diff <= window && diff >= -window {
+		return true
+	}
+	return !recordStart(flow).After(e.end.Add(window)) && !recordEnd(flow).Before(e.start.Add(-window))
+}
+
+func (d *dedup) duplicate(flow *types.Flow) {
+	d.stats.Duplicates++
+	d.stats.DuplicateBytes += flow.Bytes
+}
+
+// primaryFor returns the primary exporter of the longest prefix matching the
+// source or destination address
+func (d *dedup) primaryFor(flow *types.Flow) (netip.Addr, bool) {
+	var primary netip.Addr
+	bits := -1
+	for _, p := range d.config.Primary {
+		if p.Prefix.Bits() > bits && (p.Prefix.Contains(flow.SrcAddr) || p.Prefix.Contains(flow.DstAddr)) {
+			primary = p.Exporter
+			bits = p.Prefix.Bits()
+		}
+	}
+	return primary, bits >= 0
+}
+
+// pruneDue reports whether prune should run; it scans all entries
+func (d *dedup) pruneDue(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return now.Sub(d.lastPrune) >= dedupPruneInterval
+}
+
+// prune drops the state of flows outside the window and older than the oldest
+// stored flow, so observation points stay available as long as the flow is shown
+func (d *dedup) prune(now, oldest time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastPrune = now
+	cutoff := now.Add(-d.config.Window)
+	if !oldest.IsZero() && oldest.Before(cutoff) {
+		cutoff = oldest
+	}
+	for key, e := range d.entries {
+		if e.lastObserved.Before(cutoff) {
+			delete(d.entries, key)
+		}
+	}
+}
+
+// observations returns the observation points of a flow, nil unless several
+// exporters reported it
+func (d *dedup) observations(key types.FlowKey) []Observation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := d.entries[key]
+	if e == nil || e.exporters() < 2 {
+		return nil
+	}
+	obs := slices.Clone(e.observations)
+	for i := range obs {
+		obs[i].Canonical = obs[i].Exporter == e.canonical
+	}
+	return obs
+}
+
+// SetDedup configures cross-exporter deduplication; a zero window disables it.
+// Changing the configuration drops the dedup state.
+func (fs *FlowStore) SetDedup(config DedupConfig) {
+	fs.mu.Lock()
+	if fs.dedup.enabled() {
+		// Store what is still held back rather than losing it
+		fs.queuePersist(fs.releaseHeld(time.Now().Add(fs.dedup.config.Window)))
+	}
+	fs.dedup.configure(config)
+	fs.mu.Unlock()
+
+	fs.scheduleMaintenance()
+}
+
+// GetDedupStats returns deduplication statistics, false if disabled
+func (fs *FlowStore) GetDedupStats() (DedupStats, bool) {
+	fs.mu.RLock()
+	enabled := fs.dedup.enabled()
+	fs.mu.RUnlock()
+	if !enabled {
+		return DedupStats{}, false
+	}
+
+	d := fs.dedup
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.Window = d.config.Window
+	stats.Primary = slices.Clone(d.config.Primary)
+	stats.Tracked = len(d.entries)
+	stats.Held = len(d.held)
+	return stats, true
+}
+
+// Observations returns where the flow was observed, nil unless several
+// exporters reported it. Only the canonical exporter's records are stored.
+func (fs *FlowStore) Observations(flow *types.Flow) []Observation {
+	return fs.dedup.observations(flow.FlowKey())
+}
+
+// releaseHeld stores held-back records whose primary exporter did not report
+// them in time and occasionally prunes the dedup state. Returns the released
+// records for the archive and history. Must be called with fs.mu held.
+func (fs *FlowStore) releaseHeld(now time.Time) []types.Flow {
+	released := fs.dedup.release(now)
+	for i := range released {
+		fs.addFlow(&released[i])
+	}
+	if fs.dedup.pruneDue(now) {
+		fs.dedup.prune(now, fs.oldestFlow())
+	}
+	return released
+}
+
+// oldestFlow returns the receive time of the oldest stored flow
+func (fs *FlowStore) oldestFlow() time.Time {
+	var oldest time.Time
+	for _, seg := range fs.snapshot().segments {
+		if t := seg.oldest(); !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	return oldest
+}
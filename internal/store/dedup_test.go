@@ -0,0 +1,293 @@
+package store
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// dedupFlow returns a record of one TCP flow from 10.1.1.1; start and end are
+// left unset if zero
+func dedupFlow(exporter string, received, start, end time.Time) types.Flow {
+	return types.Flow{
+		SrcAddr:    netip.MustParseAddr("10.1.1.1"),
+		DstAddr:    netip.MustParseAddr("198.51.100.80"),
+		SrcPort:    40000,
+		DstPort:    443,
+		Protocol:   6,
+		Bytes:      1000,
+		ExporterIP: netip.MustParseAddr(exporter),
+		ReceivedAt: received,
+		StartTime:  start,
+		EndTime:    end,
+	}
+}
+
+func testDedup(config DedupConfig) *dedup {
+	d := newDedup()
+	d.configure(config)
+	return d
+}
+
+func TestDedupDropsDuplicates(t *testing.T) {
+	d := testDedup(DedupConfig{Window: 5 * time.Second})
+	at := func(d time.Duration) time.Time { return testEpoch.Add(d) }
+
+	for _, step := range []struct {
+		name  string
+		flow  types.Flow
+		admit bool
+	}{
+		{"first exporter", dedupFlow("192.0.2.1", at(0), time.Time{}, time.Time{}), true},
+		{"second exporter within the window", dedupFlow("192.0.2.2", at(3*time.Second), time.Time{}, time.Time{}), false},
+		{"second exporter before the first", dedupFlow("192.0.2.2", at(-5*time.Second), time.Time{}, time.Time{}), false},
+		{"canonical exporter again", dedupFlow("192.0.2.1", at(time.Minute), time.Time{}, time.Time{}), true},
+		{"second exporter after the window", dedupFlow("192.0.2.2", at(2*time.Minute), time.Time{}, time.Time{}), true},
+		{"first exporter, now a duplicate", dedupFlow("192.0.2.1", at(2*time.Minute+time.Second), time.Time{}, time.Time{}), false},
+	} {
+		if got := d.admit(&step.flow); got != step.admit {
+			t.Errorf("%s: admitted %v, want %v", step.name, got, step.admit)
+		}
+	}
+
+	// Other 5-tuples and flows without exporter are independent
+	other := dedupFlow("192.0.2.2", at(0), time.Time{}, time.Time{})
+	other.SrcPort = 40001
+	noExporter := dedupFlow("192.0.2.2", at(0), time.Time{}, time.Time{})
+	noExporter.ExporterIP = netip.Addr{}
+	if !d.admit(&other) || !d.admit(&noExporter) {
+		t.Error("independent records dropped")
+	}
+
+	if d.stats.Duplicates != 3 || d.stats.DuplicateBytes != 3000 || len(d.entries) != 2 {
+		t.Errorf("stats %+v, %d entries", d.stats, len(d.entries))
+	}
+}
+
+func TestDedupOverlappingFlowTimes(t *testing.T) {
+	// Both exporters report the same long-lived flow every minute, 30 s apart
+	d := testDedup(DedupConfig{Window: 2 * time.Second})
+	at := func(d time.Duration) time.Time { return testEpoch.Add(d) }
+	record := func(exporter string, end time.Duration) types.Flow {
+		return dedupFlow(exporter, at(end+time.Second), at(end-time.Minute), at(end))
+	}
+
+	for _, step := range []struct {
+		name  string
+		flow  types.Flow
+		admit bool
+	}{
+		{"first active timeout", record("192.0.2.1", 0), true},
+		{"other exporter, half a minute later", record("192.0.2.2", 30*time.Second), false},
+		{"next active timeout", record("192.0.2.1", time.Minute), true},
+		{"other exporter again", record("192.0.2.2", 90*time.Second), false},
+		{"touching the span within the window", dedupFlow("192.0.2.2", at(5*time.Minute), at(time.Minute+time.Second), at(time.Minute+2*time.Second)), false},
+
+		// The first exporter stops reporting: records beyond its span take over
+		{"other exporter after a gap", record("192.0.2.2", 4*time.Minute), true},
+		{"first exporter within the new span", dedupFlow("192.0.2.1", at(10*time.Minute), at(3*time.Minute+30*time.Second), at(4*time.Minute)), false},
+	} {
+		if got := d.admit(&step.flow); got != step.admit {
+			t.Errorf("%s: admitted %v, want %v", step.name, got, step.admit)
+		}
+	}
+
+	// Implausible times fall back to the receive time
+	f := record("192.0.2.1", 4*time.Minute)
+	f.ReceivedAt = at(time.Hour)
+	f.TimeImplausible = true
+	if !d.admit(&f) {
+		t.Error("record with implausible times matched the span")
+	}
+}
+
+func TestDedupPrimaryExporter(t *testing.T) {
+	window := 5 * time.Second
+	d := testDedup(DedupConfig{Window: window, Primary: []PrimaryExporter{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Exporter: netip.MustParseAddr("192.0.2.1")},
+		{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Exporter: netip.MustParseAddr("192.0.2.2")},
+	}})
+
+	// The longest prefix wins, for source or destination
+	for _, tc := range []struct {
+		src, dst string
+		want     string
+	}{
+		{"10.1.1.1", "198.51.100.1", "192.0.2.2"},
+		{"10.2.1.1", "198.51.100.1", "192.0.2.1"},
+		{"198.51.100.1", "10.1.255.255", "192.0.2.2"},
+		{"10.2.1.1", "10.1.1.1", "192.0.2.2"},
+		{"198.51.100.1", "198.51.100.2", ""},
+	} {
+		f := types.Flow{SrcAddr: netip.MustParseAddr(tc.src), DstAddr: netip.MustParseAddr(tc.dst)}
+		var got string
+		if primary, ok := d.primaryFor(&f); ok {
+			got = primary.String()
+		}
+		if got != tc.want {
+			t.Errorf("%s -> %s: primary %q, want %q", tc.src, tc.dst, got, tc.want)
+		}
+	}
+
+	// Another exporter's record is held; the primary reports in time and wins
+	held := dedupFlow("192.0.2.9", testEpoch, time.Time{}, time.Time{})
+	primary := dedupFlow("192.0.2.2", testEpoch.Add(2*time.Second), time.Time{}, time.Time{})
+	if d.admit(&held) || !d.admit(&primary) || len(d.held) != 1 {
+		t.Fatalf("%d records held, want the other exporter's", len(d.held))
+	}
+	if released := d.release(testEpoch.Add(window)); len(released) != 0 || len(d.held) != 0 {
+		t.Errorf("released %d records reported by the primary, %d still held", len(released), len(d.held))
+	}
+	if d.stats.Duplicates != 1 || d.stats.Released != 0 {
+		t.Errorf("stats %+v", d.stats)
+	}
+}
+
+func TestDedupPrimaryTakesOver(t *testing.T) {
+	window := 5 * time.Second
+	d := testDedup(DedupConfig{Window: window, Primary: []PrimaryExporter{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Exporter: netip.MustParseAddr("192.0.2.1")},
+	}})
+	at := func(d time.Duration) time.Time { return testEpoch.Add(d) }
+
+	// The primary does not report in time: the held record is stored after the window
+	other := dedupFlow("192.0.2.9", at(0), time.Time{}, time.Time{})
+	if d.admit(&other) {
+		t.Fatal("record of another exporter not held")
+	}
+	if released := d.release(at(window - time.Millisecond)); len(released) != 0 {
+		t.Fatalf("released %d records before the window passed", len(released))
+	}
+	released := d.release(at(window))
+	if len(released) != 1 || released[0].ExporterIP != other.ExporterIP || !released[0].ReceivedAt.Equal(at(0)) {
+		t.Fatalf("released %+v", released)
+	}
+	if d.stats.Released != 1 || len(d.held) != 0 {
+		t.Errorf("stats %+v, %d held", d.stats, len(d.held))
+	}
+
+	// The released exporter is canonical until the primary reports the flow,
+	// even within the window of the other exporter's records
+	next := dedupFlow("192.0.2.9", at(10*time.Second), time.Time{}, time.Time{})
+	late := dedupFlow("192.0.2.1", at(11*time.Second), time.Time{}, time.Time{})
+	again := dedupFlow("192.0.2.9", at(12*time.Second), time.Time{}, time.Time{})
+	if !d.admit(&next) || !d.admit(&late) || d.admit(&again) {
+		t.Error("primary exporter did not take over")
+	}
+	if e := d.entries[other.FlowKey()]; e.canonical != late.ExporterIP {
+		t.Errorf("canonical %v, want the primary", e.canonical)
+	}
+	if len(d.held) != 0 || d.stats.Duplicates != 1 {
+		t.Errorf("stats %+v, %d held", d.stats, len(d.held))
+	}
+}
+
+func TestDedupObservations(t *testing.T) {
+	d := testDedup(DedupConfig{Window: 5 * time.Second})
+	a := dedupFlow("192.0.2.1", testEpoch, time.Time{}, time.Time{})
+	a.InputIf, a.OutputIf = 1, 2
+	d.admit(&a)
+
+	// One exporter, even on several interfaces, is no list
+	a2 := a
+	a2.InputIf = 3
+	d.admit(&a2)
+	if obs := d.observations(a.FlowKey()); obs != nil {
+		t.Errorf("single exporter: %+v", obs)
+	}
+
+	b := dedupFlow("192.0.2.2", testEpoch.Add(time.Second), time.Time{}, time.Time{})
+	b.InputIf, b.OutputIf, b.Bytes = 7, 8, 500
+	d.admit(&b)
+	d.admit(&b)
+
+	want := []Observation{
+		{Exporter: a.ExporterIP, InputIf: 1, OutputIf: 2, Canonical: true, Flows: 1, Bytes: 1000, LastSeen: testEpoch},
+		{Exporter: a.ExporterIP, InputIf: 3, OutputIf: 2, Canonical: true, Flows: 1, Bytes: 1000, LastSeen: testEpoch},
+		{Exporter: b.ExporterIP, InputIf: 7, OutputIf: 8, Flows: 2, Bytes: 1000, LastSeen: b.ReceivedAt},
+	}
+	obs := d.observations(a.FlowKey())
+	if len(obs) != len(want) {
+		t.Fatalf("observations %+v", obs)
+	}
+	for i := range want {
+		if obs[i] != want[i] {
+			t.Errorf("observation %d = %+v, want %+v", i, obs[i], want[i])
+		}
+	}
+
+	// The list is a copy
+	obs[0].Flows = 99
+	if d.observations(a.FlowKey())[0].Flows != 1 {
+		t.Error("observations share the dedup state")
+	}
+}
+
+func TestParsePrimaryExporter(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want string // Empty for an error
+	}{
+		{"10.0.0.0/8=192.0.2.1", "10.0.0.0/8=192.0.2.1"},
+		{" 10.1.2.3/8 = 192.0.2.1 ", "10.0.0.0/8=192.0.2.1"},
+		{"10.1.2.3=192.0.2.1", "10.1.2.3/32=192.0.2.1"},
+		{"2001:db8::/32=::ffff:192.0.2.1", "2001:db8::/32=192.0.2.1"},
+		{"10.0.0.0/8", ""},
+		{"10.0.0/8=192.0.2.1", ""},
+		{"10.0.0.0/8=router", ""},
+	} {
+		p, err := ParsePrimaryExporter(tc.spec)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%q: no error", tc.spec)
+			}
+			continue
+		}
+		if err != nil || p.String() != tc.want {
+			t.Errorf("%q = %v, %v; want %s", tc.spec, p, err, tc.want)
+		}
+	}
+}
+
+func TestDedupReleasedRecordsKeepSegmentBounds(t *testing.T) {
+	fs := NewWithConfig(1000, EvictionConfig{MaxAge: 3 * time.Second})
+	fs.SetDedup(DedupConfig{Window: time.Second, Primary: []PrimaryExporter{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Exporter: netip.MustParseAddr("192.0.2.1")},
+	}})
+
+	// The held record is released at the end of Add, after a newer record
+	now := time.Now()
+	held := dedupFlow("192.0.2.9", now.Add(-5*time.Second), time.Time{}, time.Time{})
+	newer := dedupFlow("192.0.2.9", now, time.Time{}, time.Time{})
+	newer.SrcAddr = netip.MustParseAddr("198.51.100.1")
+	fs.Add([]types.Flow{held, newer})
+
+	head := fs.snapshot().head()
+	if flows := head.slice(); len(flows) != 2 || !flows[1].ReceivedAt.Equal(held.ReceivedAt) {
+		t.Fatalf("head holds %+v", flows)
+	}
+	if !head.oldest().Equal(held.ReceivedAt) || !head.newest().Equal(now) {
+		t.Errorf("head from %v to %v", head.oldest(), head.newest())
+	}
+	if !fs.oldestFlow().Equal(held.ReceivedAt) {
+		t.Errorf("oldest flow %v", fs.oldestFlow())
+	}
+
+	// Sealed, the segment still holds a flow younger than max-age and is kept
+	fs.mu.Lock()
+	fs.sealHead()
+	fs.mu.Unlock()
+	fs.maintain()
+	seg := fs.snapshot().segments[0]
+	if fs.GetFlowCount() != 2 || !seg.oldest().Equal(held.ReceivedAt) || !seg.newest().Equal(now) {
+		t.Errorf("%d flows after expiry, segment from %v to %v", fs.GetFlowCount(), seg.oldest(), seg.newest())
+	}
+
+	// Queries since the released record find both
+	filter := Filter{Since: held.ReceivedAt}
+	if got := fs.Query(&filter, SortByTime, false, 0); len(got) != 2 {
+		t.Errorf("query since the released record: %d flows", len(got))
+	}
+}
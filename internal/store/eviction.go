@@ -0,0 +1,353 @@
+package store
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+	"unsafe"
+
+	"netflow-collector/pkg/types"
+)
+
+// Eviction works one segment at a time: when the store is over its limit, the
+// oldest sealed segment is dropped. Flows in it that are still protected (Top-K
+// elephants and recently viewed flows) are moved into a "retained" segment that
+// sits in front of all others and is rebuilt on every eviction step. The cost
+// of a step is bounded by the segment and retained sizes instead of the store
+// size, and readers keep working on the previous snapshot meanwhile.
+
+// maxRetainedFraction bounds the retained segment relative to the flow limit so
+// eviction always makes progress
+const maxRetainedFraction = 0.5
+
+// With max-age the head is sealed once its oldest flow is older than
+// MaxAge/maxAgeSegmentFraction. Expiry drops whole segments, so flows live at
+// most about that much longer than max-age.
+const maxAgeSegmentFraction = 8
+
+// Memory estimate of a stored flow: the Flow value in its segment plus its index
+// postings. indexEntrySize is the average cost of one posting including its share
+// of the map entry, measured with BenchmarkFill.
+const (
+	flowValueSize     = int64(unsafe.Sizeof(types.Flow{}))
+	indexEntrySize    = 30
+	fixedIndexEntries = 7 // Ports, protocol, interfaces, exporter and minute
+
+	// typicalFlowSize is the estimate for an IPv4 flow, used before any flow is stored
+	typicalFlowSize = flowValueSize + (fixedIndexEntries+8)*indexEntrySize
+)
+
+// estimateFlowSize returns the estimated memory use of a stored flow in bytes.
+// IPv6 addresses have more indexed prefixes than IPv4 addresses.
+func estimateFlowSize(f *types.Flow) int64 {
+	entries := fixedIndexEntries + addressKeyCount(f.SrcAddr) + addressKeyCount(f.DstAddr)
+	return flowValueSize + int64(len(f.AppName)) + int64(entries)*indexEntrySize
+}
+
+// Byte histogram: byte counts below 16 are exact, larger values use 16
+// sub-buckets per power of two (relative error below 1/16)
+const (
+	histSubBuckets = 16
+	histBuckets    = histSubBuckets + (64-4)*histSubBuckets
+)
+
+// byteHistogram counts stored flows by byte count. It yields the Top-K byte
+// threshold without sorting all flows.
+type byteHistogram struct {
+	counts [histBuckets]int
+}
+
+func histBucket(b uint64) int {
+	if b < histSubBuckets {
+		return int(b)
+	}
+	e := bits.Len64(b) // 5..64
+	mant := int(b>>(e-5)) & (histSubBuckets - 1)
+	return histSubBuckets + (e-5)*histSubBuckets + mant
+}
+
+// histLowerBound returns the smallest byte count falling into a bucket
+func histLowerBound(i int) uint64 {
+	if i < histSubBuckets {
+		return uint64(i)
+	}
+	e := (i-histSubBuckets)/histSubBuckets + 5
+	mant := uint64((i - histSubBuckets) % histSubBuckets)
+	return (histSubBuckets + mant) << (e - 5)
+}
+
+func (h *byteHistogram) add(b uint64) {
+	h.counts[histBucket(b)]++
+}
+
+// subtract removes the counts of another histogram
+func (h *byteHistogram) subtract(o *byteHistogram) {
+	for i, n := range o.counts {
+		h.counts[i] -= n
+	}
+}
+
+// threshold returns a byte count such that roughly the k largest flows are at or
+// above it (bucket resolution), 0 if k is not smaller than the number of flows
+func (h *byteHistogram) threshold(k int) uint64 {
+	if k <= 0 {
+		return 0
+	}
+	seen := 0
+	for i := histBuckets - 1; i >= 0; i-- {
+		seen += h.counts[i]
+		if seen >= k {
+			if i == 0 {
+				return 0
+			}
+			return histLowerBound(i)
+		}
+	}
+	return 0
+}
+
+// recentlyAccessed returns the access time of a flow if it is within the LRU window
+func (fs *FlowStore) recentlyAccessed(f *types.Flow, now time.Time) (time.Time, bool) {
+	fs.accessMu.Lock()
+	defer fs.accessMu.Unlock()
+	if len(fs.accessed) == 0 {
+		return time.Time{}, false
+	}
+	t, ok := fs.accessed[f.FlowKey()]
+	if !ok || now.Sub(t) >= fs.evictionConfig.LRUWindow {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// pruneAccessed forgets access times outside the LRU window
+func (fs *FlowStore) pruneAccessed(now time.Time) {
+	fs.accessMu.Lock()
+	defer fs.accessMu.Unlock()
+	for key, t := range fs.accessed {
+		if now.Sub(t) >= fs.evictionConfig.LRUWindow {
+			delete(fs.accessed, key)
+		}
+	}
+}
+
+// flowLimit returns the number of flows the store may hold: max-flows, or the
+// number of flows of the current average size that fit into the memory budget
+// if that is lower. Must be called with fs.mu or fs.maintMu held.
+func (fs *FlowStore) flowLimit() int {
+	limit := fs.maxFlows
+	if budget := fs.evictionConfig.MaxMemory; budget > 0 {
+		size := typicalFlowSize
+		if n := fs.count.Load(); n > 0 {
+			size = max(fs.memory.Load()/n, 1)
+		}
+		if byMemory := int(max(budget/size, 1)); limit == 0 || byMemory < limit {
+			limit = byMemory
+		}
+	}
+	return limit
+}
+
+// overLimit reports whether the store exceeds max-flows or the memory budget.
+// Must be called with fs.mu or fs.maintMu held.
+func (fs *FlowStore) overLimit() bool {
+	if fs.maxFlows > 0 && fs.count.Load() > int64(fs.maxFlows) {
+		return true
+	}
+	budget := fs.evictionConfig.MaxMemory
+	return budget > 0 && fs.memory.Load() > budget
+}
+
+// expiryCutoff returns the receive time before which flows are expired, zero if
+// max-age is disabled
+func (fs *FlowStore) expiryCutoff(now time.Time) time.Time {
+	if fs.evictionConfig.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-fs.evictionConfig.MaxAge)
+}
+
+// evictFlows implements the hybrid eviction strategy (Top-K + LRU + FIFO) and
+// max-age retention in steps of one segment. Must be called with fs.maintMu
+// held; takes fs.mu only to change the segment list.
+func (fs *FlowStore) evictFlows() {
+	now := time.Now()
+	fs.pruneAccessed(now)
+	cutoff := fs.expiryCutoff(now)
+
+	for {
+		view := fs.snapshot()
+
+		victim := -1
+		for i, seg := range view.segments[:len(view.segments)-1] {
+			if seg != fs.retained {
+				victim = i
+				break
+			}
+		}
+		expired := victim >= 0 && !cutoff.IsZero() && view.segments[victim].newest().Before(cutoff)
+		if !expired && !fs.overLimit() {
+			// Keep segments short in time so they expire close to max-age
+			head := view.head()
+			if !cutoff.IsZero() && head.len() > 0 &&
+				now.Sub(head.oldest()) > fs.evictionConfig.MaxAge/maxAgeSegmentFraction {
+				fs.mu.Lock()
+				fs.sealHead()
+				fs.mu.Unlock()
+			}
+			return
+		}
+
+		if victim < 0 {
+			if view.head().len() == 0 {
+				return // Only protected flows left
+			}
+			fs.mu.Lock()
+			fs.sealHead()
+			fs.mu.Unlock()
+			continue
+		}
+
+		fs.evictSegment(view, victim, now)
+	}
+}
+
+// evictSegment drops one sealed segment, moving the flows the eviction policies
+// keep into the retained segment. The flows are classified without fs.mu; the
+// result is swapped in under fs.mu against the then current segment list,
+// which ingest may have extended meanwhile.
+func (fs *FlowStore) evictSegment(view *storeView, victim int, now time.Time) {
+	policies := fs.evictionPolicies()
+	step := &EvictionStep{Now: now, FlowLimit: fs.flowLimit(), fs: fs}
+	policyLimits := make([]int, len(policies))
+	for i, p := range policies {
+		policyLimits[i] = p.Begin(step)
+	}
+
+	stats := fs.evictionStats.Policies
+	if len(stats) != len(policies) {
+		stats = make([]PolicyStats, len(policies))
+	}
+	for i, p := range policies {
+		if stats[i].Name != p.Name() {
+			stats[i] = PolicyStats{Name: p.Name()}
+		}
+	}
+
+	type candidate struct {
+		flow   *types.Flow
+		policy int
+		score  float64
+	}
+
+	var candidates []candidate
+	var dropped []*types.Flow
+	fifoEvicted := 0
+	evicted := make([]int, len(policies))
+	classify := func(seg *segment) {
+		flows := seg.slice()
+	next:
+		for i := range flows {
+			f := &flows[i]
+			for j, p := range policies {
+				switch decision, score := p.Decide(f); decision {
+				case DecisionKeep:
+					candidates = append(candidates, candidate{flow: f, policy: j, score: score})
+					continue next
+				case DecisionEvict:
+					dropped = append(dropped, f)
+					evicted[j]++
+					continue next
+				}
+			}
+			dropped = append(dropped, f)
+			fifoEvicted++
+		}
+	}
+	if fs.retained != nil {
+		classify(fs.retained)
+	}
+	classify(view.segments[victim])
+
+	// Bound the kept flows: each policy to its own limit, everything to the
+	// retained limit (earlier policies first, then by score)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.policy != b.policy {
+			return a.policy < b.policy
+		}
+		return a.score > b.score
+	})
+	retainedLimit := int(float64(step.FlowLimit) * maxRetainedFraction)
+	kept := candidates[:0]
+	protected := make([]int, len(policies))
+	for _, c := range candidates {
+		if len(kept) >= retainedLimit || (policyLimits[c.policy] >= 0 && protected[c.policy] >= policyLimits[c.policy]) {
+			dropped = append(dropped, c.flow)
+			continue
+		}
+		kept = append(kept, c)
+		protected[c.policy]++
+	}
+
+	// Keep arrival order inside the retained segment
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].flow.ReceivedAt.Before(kept[j].flow.ReceivedAt)
+	})
+	retainedFlows := make([]types.Flow, len(kept))
+	for i, c := range kept {
+		retainedFlows[i] = *c.flow
+		if t, ok := step.LastAccess(c.flow); ok {
+			retainedFlows[i].LastAccessed = t
+		}
+	}
+
+	var droppedSize int64
+	var droppedHist byteHistogram
+	for _, f := range dropped {
+		droppedHist.add(f.Bytes)
+		droppedSize += estimateFlowSize(f)
+	}
+	var retained *segment
+	if len(retainedFlows) > 0 {
+		retained = newSealedSegment(retainedFlows)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	current := fs.snapshot()
+	segments := make([]*segment, 0, len(current.segments))
+	if retained != nil {
+		segments = append(segments, retained)
+	}
+	for _, seg := range current.segments {
+		if seg != view.segments[victim] && seg != fs.retained {
+			segments = append(segments, seg)
+		}
+	}
+	fs.retained = retained
+	fs.replaceSegments(segments)
+	fs.hist.subtract(&droppedHist)
+	fs.count.Add(-int64(len(dropped)))
+	fs.memory.Add(-droppedSize)
+
+	// Update eviction stats
+	fs.evictionStats.TotalEvicted += uint64(len(dropped))
+	fs.evictionStats.FIFOEvicted += uint64(fifoEvicted)
+	fs.evictionStats.TopKProtected = 0
+	fs.evictionStats.LRUProtected = 0
+	for i := range stats {
+		stats[i].Protected = protected[i]
+		stats[i].Evicted += uint64(evicted[i])
+		switch stats[i].Name {
+		case "topk":
+			fs.evictionStats.TopKProtected += protected[i]
+		case "lru":
+			fs.evictionStats.LRUProtected += protected[i]
+		case "max-age":
+			fs.evictionStats.AgeEvicted += uint64(evicted[i])
+		}
+	}
+	fs.evictionStats.Policies = stats
+}
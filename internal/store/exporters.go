@@ -0,0 +1,181 @@
+package store
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+const (
+	// clockOffsetAlpha is the smoothing factor for the exporter clock offset (EWMA)
+	clockOffsetAlpha = 0.1
+
+	// MinClockCorrection is the smallest offset that gets corrected. NetFlow v9 and
+	// IPFIX headers only carry whole seconds, so smaller offsets are measurement noise.
+	MinClockCorrection = 2 * time.Second
+
+	// minClockSamples is the number of export packets needed before correcting
+	minClockSamples = 5
+
+	// driftWindow is the time constant of the decayed drift fit: older samples
+	// weigh e^(-age/driftWindow)
+	driftWindow = 6 * time.Hour
+)
+
+// ExporterStats describes one exporter and the state of its clock relative to the collector
+type ExporterStats struct {
+	Address    string
+	Flows      uint64
+	Packets    uint64 // Export packets seen (distinct header timestamps)
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Offset     time.Duration // Smoothed clock offset (positive = exporter clock ahead)
+	LastOffset time.Duration // Offset measured on the most recent packet
+	Drift      float64       // Change of the offset in milliseconds per hour
+	Corrected  bool          // Flow timestamps from this exporter are shifted by -Offset
+}
+
+// exporterClock tracks the offset between an exporter's header time and our receive time
+type exporterClock struct {
+	stats          ExporterStats
+	lastExportTime time.Time
+
+	// Decayed sums for a least-squares fit of offset (s) over time (s relative
+	// to the latest sample). Old samples fade out and the times stay small, so
+	// the fit keeps its precision on long-running exporters.
+	n, sumT, sumO, sumTT, sumTO float64
+	lastSample                  time.Time
+}
+
+// observe records a flow and, for each new export packet, a clock offset sample
+func (c *exporterClock) observe(flow *types.Flow) {
+	c.stats.Flows++
+	c.stats.LastSeen = flow.ReceivedAt
+	if c.stats.FirstSeen.IsZero() {
+		c.stats.FirstSeen = flow.ReceivedAt
+	}
+
+	// All flows of one packet share the header time; sample once per packet
+	if flow.ExportTime.IsZero() || flow.ExportTime.Equal(c.lastExportTime) {
+		return
+	}
+	c.lastExportTime = flow.ExportTime
+	c.stats.Packets++
+
+	offset := flow.ExportTime.Sub(flow.ReceivedAt)
+	c.stats.LastOffset = offset
+	if c.stats.Packets == 1 {
+		c.stats.Offset = offset
+	} else {
+		c.stats.Offset += time.Duration(clockOffsetAlpha * float64(offset-c.stats.Offset))
+	}
+
+	c.addDriftSample(flow.ReceivedAt, offset.Seconds())
+
+	// Slope of the fit in s/s, reported as ms per hour
+	if denom := c.n*c.sumTT - c.sumT*c.sumT; c.stats.Packets >= 2 && denom > 0 {
+		slope := (c.n*c.sumTO - c.sumT*c.sumO) / denom
+		c.stats.Drift = slope * 1000 * 3600
+	}
+}
+
+// addDriftSample moves the time origin of the fit to the new sample, decays
+// the previous samples and adds the new one at t=0
+func (c *exporterClock) addDriftSample(at time.Time, o float64) {
+	if !c.lastSample.IsZero() {
+		d := max(at.Sub(c.lastSample).Seconds(), 0)
+
+		// Shift t -> t-d for all previous samples
+		c.sumTT += -2*d*c.sumT + c.n*d*d
+		c.sumTO -= d * c.sumO
+		c.sumT -= c.n * d
+
+		w := math.Exp(-d / driftWindow.Seconds())
+		c.n *= w
+		c.sumT *= w
+		c.sumO *= w
+		c.sumTT *= w
+		c.sumTO *= w
+	}
+	c.lastSample = at
+
+	c.n++
+	c.sumO += o
+}
+
+// correction returns the shift to apply to flow timestamps, 0 if the clock is fine
+func (c *exporterClock) correction() time.Duration {
+	if c.stats.Packets < minClockSamples {
+		return 0
+	}
+	if math.Abs(float64(c.stats.Offset)) < float64(MinClockCorrection) {
+		return 0
+	}
+	return -c.stats.Offset
+}
+
+// trackExporter updates the exporter's clock and optionally corrects the flow's timestamps.
+// Must be called with fs.mu held.
+func (fs *FlowStore) trackExporter(flow *types.Flow) {
+	if !flow.ExporterIP.IsValid() {
+		return
+	}
+	clock := fs.exporters[flow.ExporterIP]
+	if clock == nil {
+		clock = &exporterClock{stats: ExporterStats{Address: flow.ExporterIP.String()}}
+		fs.exporters[flow.ExporterIP] = clock
+	}
+	clock.observe(flow)
+
+	if !fs.clockCorrection {
+		return
+	}
+	shift := clock.correction()
+	clock.stats.Corrected = shift != 0
+	if shift == 0 {
+		return
+	}
+	if !flow.StartTime.IsZero() {
+		flow.StartTime = flow.StartTime.Add(shift)
+	}
+	if !flow.EndTime.IsZero() {
+		flow.EndTime = flow.EndTime.Add(shift)
+	}
+	flow.ClockCorrection = shift
+	flow.TimeImplausible = flow.HasImplausibleTimestamps()
+}
+
+// SetClockCorrection enables shifting flow timestamps by the measured exporter clock offset
+func (fs *FlowStore) SetClockCorrection(enabled bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.clockCorrection = enabled
+}
+
+// ClockCorrection reports whether exporter clock correction is enabled
+func (fs *FlowStore) ClockCorrection() bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.clockCorrection
+}
+
+// GetExporterStats returns per-exporter statistics sorted by address
+func (fs *FlowStore) GetExporterStats() []ExporterStats {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	addrs := make([]netip.Addr, 0, len(fs.exporters))
+	for addr := range fs.exporters {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+
+	result := make([]ExporterStats, len(addrs))
+	for i, addr := range addrs {
+		result[i] = fs.exporters[addr].stats
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// clockSamples feeds an exporter clock one packet per interval whose header
+// time is offset(t) ahead of the receive time
+func clockSamples(c *exporterClock, n int, interval time.Duration, offset func(time.Duration) time.Duration) {
+	for i := range n {
+		since := time.Duration(i) * interval
+		at := testEpoch.Add(since)
+		c.observe(&types.Flow{ReceivedAt: at, ExportTime: at.Add(offset(since))})
+	}
+}
+
+func TestExporterClockOffset(t *testing.T) {
+	var c exporterClock
+	clockSamples(&c, 100, time.Minute, func(time.Duration) time.Duration { return 30 * time.Second })
+	if c.stats.Offset != 30*time.Second || c.stats.LastOffset != 30*time.Second {
+		t.Errorf("offset %v, last %v, want 30s", c.stats.Offset, c.stats.LastOffset)
+	}
+	if math.Abs(c.stats.Drift) > 1e-6 {
+		t.Errorf("drift %v ms/h for a constant offset", c.stats.Drift)
+	}
+	if c.stats.Packets != 100 || c.stats.Flows != 100 {
+		t.Errorf("%d packets, %d flows", c.stats.Packets, c.stats.Flows)
+	}
+
+	// Flows of one packet share the header time and are one sample
+	at := testEpoch.Add(200 * time.Minute)
+	for range 10 {
+		c.observe(&types.Flow{ReceivedAt: at, ExportTime: at.Add(-time.Minute)})
+	}
+	if c.stats.Packets != 101 || c.stats.Flows != 110 {
+		t.Errorf("%d packets, %d flows after one packet of 10 flows", c.stats.Packets, c.stats.Flows)
+	}
+	if c.stats.LastOffset != -time.Minute {
+		t.Errorf("last offset %v, want -1m", c.stats.LastOffset)
+	}
+
+	// The smoothed offset moves by clockOffsetAlpha of the step
+	if want := 30*time.Second - time.Duration(clockOffsetAlpha*float64(90*time.Second)); c.stats.Offset != want {
+		t.Errorf("smoothed offset %v, want %v", c.stats.Offset, want)
+	}
+
+	// Flows without a header time count but don't sample
+	c.observe(&types.Flow{ReceivedAt: at.Add(time.Minute)})
+	if c.stats.Packets != 101 || c.stats.Flows != 111 || c.stats.LastSeen != at.Add(time.Minute) || c.stats.FirstSeen != testEpoch {
+		t.Errorf("stats after a flow without export time: %+v", c.stats)
+	}
+}
+
+func TestExporterClockDrift(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		n        int
+		interval time.Duration
+		drift    float64 // ms per hour
+	}{
+		{"two hours", 120, time.Minute, 60},
+		{"slow clock", 120, time.Minute, -250},
+		{"a month", 30 * 24 * 60, time.Minute, 10}, // Offset far from 0, times stay precise
+		{"sparse packets", 50, 30 * time.Minute, 100},
+	} {
+		var c exporterClock
+		clockSamples(&c, tc.n, tc.interval, func(since time.Duration) time.Duration {
+			return 5*time.Second + time.Duration(tc.drift*since.Hours()*float64(time.Millisecond))
+		})
+		if math.Abs(c.stats.Drift-tc.drift) > math.Abs(tc.drift)*0.01 {
+			t.Errorf("%s: drift %.3f ms/h, want %v", tc.name, c.stats.Drift, tc.drift)
+		}
+	}
+
+	// A drift change shows after a few drift windows; the old rate fades out
+	var c exporterClock
+	clockSamples(&c, 48*60, time.Minute, func(since time.Duration) time.Duration {
+		if since < 24*time.Hour {
+			return time.Duration(100 * since.Hours() * float64(time.Millisecond))
+		}
+		return 2400*time.Millisecond - time.Duration(100*(since-24*time.Hour).Hours()*float64(time.Millisecond))
+	})
+	if c.stats.Drift > -80 {
+		t.Errorf("drift %.1f ms/h a day after it changed to -100", c.stats.Drift)
+	}
+}
+
+func TestClockCorrection(t *testing.T) {
+	fs := New(1000)
+	fs.SetClockCorrection(true)
+	ahead := netip.MustParseAddr("192.0.2.1")   // Clock 30 s ahead
+	precise := netip.MustParseAddr("192.0.2.2") // Within MinClockCorrection
+
+	for i := range 2 * minClockSamples {
+		at := testEpoch.Add(time.Duration(i) * time.Minute)
+		fs.Add([]types.Flow{
+			{ExporterIP: ahead, ReceivedAt: at, ExportTime: at.Add(30 * time.Second),
+				StartTime: at.Add(20 * time.Second), EndTime: at.Add(30 * time.Second)},
+			{ExporterIP: precise, ReceivedAt: at, ExportTime: at.Add(time.Second),
+				StartTime: at.Add(-10 * time.Second), EndTime: at},
+		})
+	}
+
+	for _, seg := range fs.snapshot().segments {
+		for _, f := range seg.slice() {
+			at := f.ReceivedAt
+			// Corrected from the minClockSamples-th packet on
+			want := f.ExporterIP == ahead && at.Sub(testEpoch) >= (minClockSamples-1)*time.Minute
+			if got := f.ClockCorrection != 0; got != want {
+				t.Errorf("%v at %v: correction %v", f.ExporterIP, at, f.ClockCorrection)
+			}
+			if want && (f.ClockCorrection != -30*time.Second || !f.EndTime.Equal(at) || !f.StartTime.Equal(at.Add(-10*time.Second))) {
+				t.Errorf("%v at %v: corrected to %v - %v by %v", f.ExporterIP, at, f.StartTime, f.EndTime, f.ClockCorrection)
+			}
+		}
+	}
+
+	stats := fs.GetExporterStats()
+	if len(stats) != 2 || !stats[0].Corrected || stats[1].Corrected {
+		t.Errorf("exporter stats = %+v", stats)
+	}
+
+	// Disabled correction leaves the times alone
+	fs.SetClockCorrection(false)
+	at := testEpoch.Add(time.Hour)
+	fs.Add([]types.Flow{{ExporterIP: ahead, ReceivedAt: at, ExportTime: at.Add(30 * time.Second), EndTime: at.Add(30 * time.Second)}})
+	if f := fs.GetRecent(1); len(f) != 1 || f[0].ClockCorrection != 0 || !f[0].EndTime.Equal(at.Add(30*time.Second)) {
+		t.Errorf("flow with correction disabled: %+v", f)
+	}
+}
+
+func TestExporterStatsOrder(t *testing.T) {
+	fs := New(100)
+	for _, addr := range []string{"2001:db8::1", "10.0.0.2", "9.0.0.1", "10.0.0.10"} {
+		fs.Add([]types.Flow{{ExporterIP: netip.MustParseAddr(addr), ReceivedAt: testEpoch}})
+	}
+	fs.Add([]types.Flow{{ReceivedAt: testEpoch}}) // No exporter, not tracked
+
+	var got []string
+	for _, s := range fs.GetExporterStats() {
+		got = append(got, s.Address)
+	}
+	want := []string{"9.0.0.1", "10.0.0.2", "10.0.0.10", "2001:db8::1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("exporters %v, want %v", got, want)
+	}
+}
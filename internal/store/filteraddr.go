@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Address conditions (src, dst, ip, exporter). The value is parsed once when
+// the filter is compiled and matched against the flow's netip.Addr:
+//
+//	src=10.0.0.1              exact address
+//	src=10.0.0.0/8            prefix (IPv4 and IPv6)
+//	src=10.0.0.5-10.0.0.50    inclusive range of one address family
+//	src=10.0.*.*, src=10.*.0.1  IPv4 wildcard per octet, trailing * form a prefix
+//	src~10.0.                 substring of the address text (!~ negated)
+//
+// IPv4-mapped IPv6 addresses (::ffff:10.0.0.1) are the IPv4 address, in flows
+// as well as in values; ::ffff:10.0.0.0/104 is 10.0.0.0/8.
+
+// AddressFields are the fields whose values are addresses
+var AddressFields = map[string]bool{
+	"src": true, "sip": true, "srcip": true,
+	"dst": true, "dip": true, "dstip": true,
+	"ip": true, "exporter": true, "exp": true,
+}
+
+// ipv4Wildcard matches IPv4 addresses octet by octet, zero if not set
+type ipv4Wildcard struct {
+	value uint32
+	mask  uint32 // 0xff for every fixed octet
+}
+
+func (w ipv4Wildcard) matches(a netip.Addr) bool {
+	if w.mask == 0 || !a.Is4() {
+		return false
+	}
+	b := a.As4()
+	return binary.BigEndian.Uint32(b[:])&w.mask == w.value
+}
+
+// matchAddr reports whether an address satisfies the condition's address value
+func (c *ConditionNode) matchAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	switch {
+	case c.Set != nil:
+		return c.Set.hasAddr(a)
+	case c.Op == OpContains:
+		return strings.Contains(a.String(), c.Value)
+	case c.Network.IsValid():
+		return c.Network.Contains(a)
+	case c.First.IsValid():
+		return a.BitLen() == c.First.BitLen() && c.First.Compare(a) <= 0 && a.Compare(c.Last) <= 0
+	}
+	return c.Wildcard.matches(a)
+}
+
+// parseAddrValue compiles an address value into the condition: exact
+// addresses and prefixes into Network, ranges into First/Last and wildcards
+// into Network (trailing * only) or Wildcard
+func parseAddrValue(c *ConditionNode, value string) error {
+	switch {
+	case strings.Contains(value, "/"):
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR")
+		}
+		if addr := network.Addr(); addr.Is4In6() && network.Bits() >= 96 {
+			network = netip.PrefixFrom(addr.Unmap(), network.Bits()-96)
+		}
+		c.Network = network.Masked()
+
+	case strings.Contains(value, "-"):
+		first, last, _ := strings.Cut(value, "-")
+		a, errA := netip.ParseAddr(first)
+		b, errB := netip.ParseAddr(last)
+		if errA != nil || errB != nil {
+			return fmt.Errorf("invalid address range")
+		}
+		a, b = a.Unmap(), b.Unmap()
+		if a.BitLen() != b.BitLen() || b.Less(a) {
+			return fmt.Errorf("invalid address range, expected first-last of one address family")
+		}
+		c.First, c.Last = a, b
+
+	case strings.Contains(value, "*"):
+		return parseIPv4Wildcard(c, value)
+
+	default:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return fmt.Errorf("not an address, use %s~%s for a substring or %s=%s.* for a wildcard",
+				c.Field, value, c.Field, strings.TrimSuffix(value, "."))
+		}
+		addr = addr.Unmap()
+		c.Network = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	return nil
+}
+
+// parseIPv4Wildcard compiles a wildcard like 10.0.*.* (missing octets count as
+// *), a prefix if all wildcards are trailing
+func parseIPv4Wildcard(c *ConditionNode, value string) error {
+	octets := strings.Split(value, ".")
+	if len(octets) > 4 {
+		return fmt.Errorf("invalid wildcard")
+	}
+	for len(octets) < 4 {
+		octets = append(octets, "*")
+	}
+
+	var w ipv4Wildcard
+	var fixed [4]byte
+	prefixBits, trailing := 0, true
+	for i, o := range octets {
+		if o == "*" {
+			trailing = false
+			continue
+		}
+		n, err := strconv.ParseUint(o, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid wildcard")
+		}
+		if trailing {
+			prefixBits += 8
+		}
+		fixed[i] = byte(n)
+		shift := 8 * (3 - i)
+		w.value |= uint32(n) << shift
+		w.mask |= 0xff << shift
+	}
+
+	if prefix := netip.PrefixFrom(netip.AddrFrom4(fixed), prefixBits); w.mask == ipv4PrefixMask(prefixBits) {
+		c.Network = prefix.Masked()
+	} else {
+		c.Wildcard = w
+	}
+	return nil
+}
+
+// ipv4PrefixMask returns the mask of an IPv4 prefix length
+func ipv4PrefixMask(bits int) uint32 {
+	if bits == 0 {
+		return 0
+	}
+	return ^uint32(0) << (32 - bits)
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"netflow-collector/pkg/types"
+)
+
+func TestAddressConditions(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		addr string
+		want bool
+	}{
+		// Exact addresses
+		{"src=10.0.0.1", "10.0.0.1", true},
+		{"src=10.0.0.1", "10.0.0.10", false},
+		{"src=10.0.0.1", "110.0.0.1", false},
+		{"src=10.0.0.1", "::ffff:10.0.0.1", true}, // v4-mapped is the IPv4 address
+		{"src=::ffff:10.0.0.1", "10.0.0.1", true},
+		{"src=10.0.0.1", "::a00:1", false}, // IPv4-compatible IPv6 is IPv6
+		{"src=2001:db8::1", "2001:db8::1", true},
+		{"src=2001:DB8:0::1", "2001:db8::1", true},
+		{"src=2001:db8::1", "2001:db8::2", false},
+		{"src!=10.0.0.1", "10.0.0.2", true},
+
+		// Prefixes
+		{"src=10.0.0.0/8", "10.255.255.255", true},
+		{"src=10.0.0.0/8", "11.0.0.0", false},
+		{"src=10.0.0.0/8", "::ffff:10.1.1.1", true},
+		{"src=10.1.2.3/8", "10.9.9.9", true}, // Host bits are masked
+		{"src=10.0.0.1/32", "10.0.0.1", true},
+		{"src=0.0.0.0/0", "1.2.3.4", true},
+		{"src=0.0.0.0/0", "2001:db8::1", false},
+		{"src=::/0", "2001:db8::1", true},
+		{"src=::/0", "1.2.3.4", false},
+		{"src=::ffff:0:0/96", "1.2.3.4", true}, // v4-mapped prefix is the IPv4 prefix
+		{"src=::ffff:10.0.0.0/104", "10.1.2.3", true},
+		{"src=::ffff:10.0.0.0/104", "11.1.2.3", false},
+		{"src=::ffff:0:0/96", "2001:db8::1", false},
+		{"src=2001:db8::/32", "2001:db8:ffff::1", true},
+		{"src=2001:db8::/32", "2001:db9::1", false},
+		{"src=2001:db8::/32", "32.1.13.184", false}, // Same leading bytes, other family
+
+		// Ranges
+		{"src=10.0.0.5-10.0.0.50", "10.0.0.5", true},
+		{"src=10.0.0.5-10.0.0.50", "10.0.0.50", true},
+		{"src=10.0.0.5-10.0.0.50", "10.0.0.51", false},
+		{"src=10.0.0.5-10.0.0.50", "10.0.0.4", false},
+		{"src=10.0.0.5-10.0.0.50", "::ffff:10.0.0.6", true},
+		{"src=::ffff:10.0.0.5-10.0.0.50", "10.0.0.6", true},
+		{"src=2001:db8::1-2001:db8::ff", "2001:db8::80", true},
+		{"src=2001:db8::1-2001:db8::ff", "10.0.0.128", false},
+		{"src=::-::ffff", "0.0.0.1", false},
+
+		// Wildcards
+		{"src=10.0.*.*", "10.0.200.1", true},
+		{"src=10.0.*.*", "10.1.0.1", false},
+		{"src=10.*", "10.9.9.9", true},
+		{"src=10.*.0.1", "10.77.0.1", true},
+		{"src=10.*.0.1", "10.77.0.2", false},
+		{"src=10.*.0.1", "::ffff:10.77.0.1", true},
+		{"src=*.*.*.1", "1.2.3.1", true},
+		{"src=*.*.*.1", "2001:db8::1", false},
+		{"src=*", "2001:db8::1", false},
+		{"src=*", "1.2.3.4", true},
+
+		// Substrings of the address text
+		{"src~10.0.0.1", "10.0.0.10", true},
+		{"src~10.0.0.1", "110.0.0.1", true},
+		{"src~db8", "2001:db8::1", true},
+		{"src!~192.168", "10.0.0.1", true},
+		{"src!~192.168", "192.168.1.1", false},
+	} {
+		filter := ParseFilter(tc.expr)
+		if !filter.IsValid() {
+			t.Errorf("%s: %s", tc.expr, filter.Error)
+			continue
+		}
+		flow := types.Flow{SrcAddr: netip.MustParseAddr(tc.addr)}
+		if got := filter.Matches(&flow); got != tc.want {
+			t.Errorf("%s on %s = %v, want %v", tc.expr, tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestAddressFields(t *testing.T) {
+	flows := testFlows()
+	for _, tc := range []struct {
+		expr string
+		want []int // Matching flows of testFlows
+	}{
+		{"src=10.0.0.1", []int{0}},
+		{"dst=10.0.0.1", []int{2}},
+		{"ip=10.0.0.1", []int{0, 2}},
+		{"ip=192.168.1.10", []int{0, 3}},
+		{"sip=2001:db8::/32", []int{4}},
+		{"dstip=ff02::1", []int{5}},
+		{"exporter=172.16.0.2", []int{2, 3}},
+		{"exp=2001:db8:ffff::/48", []int{4, 5}},
+		{"!ip=10.0.0.0/8", []int{3, 4, 5}},
+	} {
+		filter := ParseFilter(tc.expr)
+		if !filter.IsValid() {
+			t.Fatalf("%s: %s", tc.expr, filter.Error)
+		}
+		var got []int
+		for i := range flows {
+			if filter.Matches(&flows[i]) {
+				got = append(got, i)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s matches %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseAddrValue(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		network  string // Compiled prefix, "" if none
+		first    string // Compiled range start, "" if none
+		wildcard ipv4Wildcard
+	}{
+		{value: "10.0.0.1", network: "10.0.0.1/32"},
+		{value: "::ffff:10.0.0.1", network: "10.0.0.1/32"},
+		{value: "2001:db8::1", network: "2001:db8::1/128"},
+		{value: "10.1.2.3/16", network: "10.1.0.0/16"},
+		{value: "::ffff:10.0.0.0/104", network: "10.0.0.0/8"},
+		{value: "::ffff:0:0/96", network: "0.0.0.0/0"},
+		{value: "::ffff:0:0/95", network: "::fffe:0:0/95"},
+		{value: "10.0.*.*", network: "10.0.0.0/16"},
+		{value: "10.0", network: ""}, // Error, see TestAddressConditionErrors
+		{value: "10.*", network: "10.0.0.0/8"},
+		{value: "*.*.*.*", network: "0.0.0.0/0"},
+		{value: "10.*.0.1", wildcard: ipv4Wildcard{value: 0x0a000001, mask: 0xff00ffff}},
+		{value: "*.1", wildcard: ipv4Wildcard{value: 0x00010000, mask: 0x00ff0000}},
+		{value: "10.0.0.1-10.0.0.9", first: "10.0.0.1"},
+		{value: "::ffff:10.0.0.1-10.0.0.9", first: "10.0.0.1"},
+	} {
+		c := &ConditionNode{Field: "src"}
+		err := parseAddrValue(c, tc.value)
+		if tc.network == "" && tc.first == "" && tc.wildcard.mask == 0 {
+			if err == nil {
+				t.Errorf("%s: no error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.value, err)
+			continue
+		}
+		if tc.network != "" && c.Network != netip.MustParsePrefix(tc.network) {
+			t.Errorf("%s: network %v, want %s", tc.value, c.Network, tc.network)
+		}
+		if tc.first != "" && c.First != netip.MustParseAddr(tc.first) {
+			t.Errorf("%s: range from %v, want %s", tc.value, c.First, tc.first)
+		}
+		if c.Wildcard != tc.wildcard {
+			t.Errorf("%s: wildcard %+v, want %+v", tc.value, c.Wildcard, tc.wildcard)
+		}
+	}
+}
+
+func TestAddressConditionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{"src=10.0", "not an address"},
+		{"src=10.0.", "src=10.0.*"},
+		{"src=example.com", "not an address"},
+		{"src=10.0.0.0/33", "invalid CIDR"},
+		{"src=2001:db8::/129", "invalid CIDR"},
+		{"src=10.0.0.0/x", "invalid CIDR"},
+		{"src=10.0.0.50-10.0.0.5", "one address family"},
+		{"src=10.0.0.1-2001:db8::1", "one address family"},
+		{"src=10.0.0.1-x", "invalid address range"},
+		{"src=10.0.0.1-", "invalid address range"},
+		{"src=10.0.0.256.*", "invalid wildcard"},
+		{"src=10.x.*", "invalid wildcard"},
+		{"src=256.*", "invalid wildcard"},
+		{"src=2001:db8::*", "invalid wildcard"},
+		{"src>10.0.0.1", "does not support"},
+	} {
+		filter := ParseFilter(tc.expr)
+		if filter.IsValid() {
+			t.Errorf("%s: parsed without error", tc.expr)
+		} else if !strings.Contains(filter.Error, tc.err) {
+			t.Errorf("%s: error %q, want %q", tc.expr, filter.Error, tc.err)
+		}
+	}
+}
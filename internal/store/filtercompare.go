@@ -0,0 +1,134 @@
+package store
+
+import (
+	"cmp"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// CompareOp is the operator of a filter condition
+type CompareOp uint8
+
+const (
+	OpEqual        CompareOp = iota // = or : (!= is OpEqual negated)
+	OpLess                          // <
+	OpLessEqual                     // <=
+	OpGreater                       // >
+	OpGreaterEqual                  // >=
+	OpContains                      // ~ substring of the address text (!~ negated)
+)
+
+// conditionOperators are the operators between field and value, longer ones first
+var conditionOperators = []struct {
+	text string
+	op   CompareOp
+}{
+	{"!=", OpEqual},
+	{"!~", OpContains},
+	{">=", OpGreaterEqual},
+	{"<=", OpLessEqual},
+	{">", OpGreater},
+	{"<", OpLess},
+	{"=", OpEqual},
+	{":", OpEqual},
+	{"~", OpContains},
+}
+
+// NumericFields are the fields that also accept <, <=, > and >=
+var NumericFields = map[string]bool{
+	"sport": true, "srcport": true, "dport": true, "dstport": true, "port": true,
+	"if": true, "inif": true, "outif": true,
+	"bytes": true, "packets": true, "pkts": true, "bps": true,
+	"duration": true, "dur": true,
+	"srcas": true, "dstas": true, "as": true,
+}
+
+// SplitCondition splits a condition like "bytes>=1M" at its operator. ok is
+// false if the condition has no operator (e.g. a bare protocol name).
+func SplitCondition(s string) (field, op, value string, ok bool) {
+	idx := strings.IndexAny(s, "!<>=:~")
+	if idx <= 0 {
+		return "", "", "", false
+	}
+	for _, o := range conditionOperators {
+		if strings.HasPrefix(s[idx:], o.text) {
+			return strings.ToLower(s[:idx]), o.text, s[idx+len(o.text):], true
+		}
+	}
+	return "", "", "", false
+}
+
+// operatorOf returns the operator for its text as returned by SplitCondition
+func operatorOf(text string) CompareOp {
+	for _, o := range conditionOperators {
+		if o.text == text {
+			return o.op
+		}
+	}
+	return OpEqual
+}
+
+// compareValues applies the operator to a flow value and the condition value
+func compareValues[T cmp.Ordered](op CompareOp, v, ref T) bool {
+	switch op {
+	case OpLess:
+		return v < ref
+	case OpLessEqual:
+		return v <= ref
+	case OpGreater:
+		return v > ref
+	case OpGreaterEqual:
+		return v >= ref
+	}
+	return v == ref
+}
+
+// quantitySuffixes are the unit suffixes of byte, packet and rate values
+var quantitySuffixes = map[byte]float64{
+	'k': 1e3, 'K': 1e3,
+	'm': 1e6, 'M': 1e6,
+	'g': 1e9, 'G': 1e9,
+}
+
+// parseQuantity parses a finite non-negative number with an optional k/M/G
+// suffix (powers of 1000), e.g. 1500, 1.5M or 10G
+func parseQuantity(s string) (float64, bool) {
+	factor := 1.0
+	if n := len(s); n > 1 {
+		if f, ok := quantitySuffixes[s[n-1]]; ok {
+			factor = f
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v >= 0) || math.IsInf(v, 1) {
+		return 0, false
+	}
+	return v * factor, true
+}
+
+// parseDurationSeconds parses a duration in seconds: a Go duration (500ms,
+// 30s, 5m, 1h) or a plain number of seconds
+func parseDurationSeconds(s string) (float64, bool) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil && v >= 0 && !math.IsInf(v, 1) {
+		return v, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d.Seconds(), true
+}
+
+// flowDuration returns the flow duration in seconds, 0 without valid timestamps
+func flowDuration(f *types.Flow) float64 {
+	d := f.Duration().Seconds()
+	if d < 0 || f.StartTime.IsZero() {
+		return 0
+	}
+	return d
+}
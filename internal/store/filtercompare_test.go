@@ -0,0 +1,177 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitCondition(t *testing.T) {
+	for _, tc := range []struct {
+		in               string
+		field, op, value string
+		ok               bool
+	}{
+		{"bytes>=1M", "bytes", ">=", "1M", true},
+		{"bytes<=1k", "bytes", "<=", "1k", true},
+		{"port>1023", "port", ">", "1023", true},
+		{"port<1024", "port", "<", "1024", true},
+		{"dport!=53", "dport", "!=", "53", true},
+		{"src!~192.168", "src", "!~", "192.168", true},
+		{"src~10.0.", "src", "~", "10.0.", true},
+		{"Port:443", "port", ":", "443", true},
+		{"SRC=2001:db8::1", "src", "=", "2001:db8::1", true}, // Value keeps its colons
+		{"bytes<", "bytes", "<", "", true},
+		{"tcp", "", "", "", false},
+		{"=443", "", "", "", false},
+	} {
+		field, op, value, ok := SplitCondition(tc.in)
+		if field != tc.field || op != tc.op || value != tc.value || ok != tc.ok {
+			t.Errorf("SplitCondition(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+				tc.in, field, op, value, ok, tc.field, tc.op, tc.value, tc.ok)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1500", 1500, true},
+		{"10k", 10e3, true},
+		{"10K", 10e3, true},
+		{"1.5M", 1.5e6, true},
+		{"1m", 1e6, true}, // Units are decimal multiples, m is not milli
+		{"2G", 2e9, true},
+		{"0.5g", 0.5e9, true},
+		{"1e3", 1000, true},
+		{"", 0, false},
+		{"k", 0, false},
+		{"-1", 0, false},
+		{"-1k", 0, false},
+		{"1T", 0, false},
+		{"1kk", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"infk", 0, false},
+	} {
+		got, ok := parseQuantity(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseQuantity(%q) = %v, %v, want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseDurationSeconds(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"90", 90, true},
+		{"1.5", 1.5, true},
+		{"500ms", 0.5, true},
+		{"30s", 30, true},
+		{"5m", 300, true},
+		{"1h30m", 5400, true},
+		{"0", 0, true},
+		{"-5", 0, false},
+		{"-5s", 0, false},
+		{"5x", 0, false},
+		{"NaN", 0, false},
+		{"+Inf", 0, false},
+	} {
+		got, ok := parseDurationSeconds(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseDurationSeconds(%q) = %v, %v, want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestCompareConditions(t *testing.T) {
+	// Flow 0: 10.0.0.1:51000 -> :443, 1.5 MB, 1200 packets, if 1/2, AS 64512/3320, no duration
+	// Flow 2: :8080 -> :40000, 64 kB, 50 packets, 60 s, if 4/1, AS 4134/0
+	// Flow 6: :65535 -> :0, if 65535/0, AS 4294967295/0
+	flows := testFlows()
+	for _, tc := range []struct {
+		expr string
+		flow int
+		want bool
+	}{
+		{"port<1024", 0, true},
+		{"port<1024", 2, false},
+		{"sport<1024", 0, false},
+		{"dport>443", 0, false},
+		{"dport>=443", 0, true},
+		{"dport<=443", 0, true},
+		{"port>65534", 6, true},
+		{"port<1", 6, true},
+		{"dport!=443", 0, false},
+		{"port:443", 0, true},
+		{"bytes>1M", 0, true},
+		{"bytes>1.5M", 0, false},
+		{"bytes>=1.5M", 0, true},
+		{"bytes<=1500k", 0, true},
+		{"bytes<64k", 2, false},
+		{"bytes=64000", 2, true},
+		{"packets>1k", 0, true},
+		{"pkts<=50", 2, true},
+		{"duration>=1m", 2, true},
+		{"duration>60", 2, false},
+		{"dur<500ms", 0, true}, // No duration counts as 0
+		{"bps>1k", 2, true},
+		{"bps>1.1k", 2, false},
+		{"bps=0", 0, true}, // No duration, no rate
+		{"srcas<=64512", 0, true},
+		{"srcas>64512", 0, false},
+		{"as>=4000000000", 6, true},
+		{"as<1", 2, true}, // DstAS 0
+		{"dstas!=3320", 0, false},
+		{"inif<2", 0, true},
+		{"outif>1", 0, true},
+		{"if>=65535", 6, true},
+		{"if<1", 6, true},
+		{"inif!=4", 2, false},
+	} {
+		filter := ParseFilter(tc.expr)
+		if !filter.IsValid() {
+			t.Errorf("%s: %s", tc.expr, filter.Error)
+			continue
+		}
+		if got := filter.Matches(&flows[tc.flow]); got != tc.want {
+			t.Errorf("%s on flow %d = %v, want %v", tc.expr, tc.flow, got, tc.want)
+		}
+	}
+}
+
+func TestCompareConditionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{"proto<6", "does not support <"},
+		{"src>10.0.0.1", "does not support >"},
+		{"state>=reset", "does not support >="},
+		{"port~44", "does not support ~"},
+		{"bytes~1k", "does not support ~"},
+		{"port<65536", "invalid port"},
+		{"port>-1", "invalid port"},
+		{"if<=70000", "invalid interface"},
+		{"bytes>1X", "invalid number"},
+		{"bytes>NaN", "invalid number"},
+		{"packets<-1", "invalid number"},
+		{"duration>5 days", "invalid syntax"},
+		{"duration>5d", "invalid duration"},
+		{"srcas>4294967296", "invalid AS number"},
+		{"bytes>", "empty value"},
+		{"size>1", "unknown field"},
+	} {
+		filter := ParseFilter(tc.expr)
+		if filter.IsValid() {
+			t.Errorf("%s: parsed without error", tc.expr)
+		} else if !strings.Contains(filter.Error, tc.err) {
+			t.Errorf("%s: error %q, want %q", tc.expr, filter.Error, tc.err)
+		}
+	}
+}
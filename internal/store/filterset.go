@@ -0,0 +1,282 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"netflow-collector/pkg/types"
+)
+
+// Set conditions: field in {a, b, …}. Members are parsed once into structures
+// that answer membership without walking the list:
+//
+//	port in {80,443,8000-8999}          ports and interfaces: 64 Kbit bitset
+//	proto in {tcp,udp,47}               protocol numbers: 256 bit bitset
+//	srcas in {3320,64512-65534}         AS numbers: sorted ranges, binary search
+//	ip in {10.0.0.0/8, 192.168.1.1}     addresses and prefixes: binary prefix trie,
+//	                                    ranges and wildcards are checked one by one
+
+// SetFields are the fields that accept "in {…}"
+var SetFields = map[string]bool{
+	"src": true, "sip": true, "srcip": true,
+	"dst": true, "dip": true, "dstip": true,
+	"ip": true, "exporter": true, "exp": true,
+	"sport": true, "srcport": true, "dport": true, "dstport": true, "port": true,
+	"if": true, "inif": true, "outif": true,
+	"proto": true, "protocol": true,
+	"srcas": true, "dstas": true, "as": true,
+}
+
+// numberRange is an inclusive range of set members
+type numberRange struct {
+	lo, hi uint32
+}
+
+// valueSet holds the members of a set condition
+type valueSet struct {
+	ranges []numberRange // Numeric members, sorted and merged
+	bits   []uint64      // Bitset of the ranges for ports, interfaces and protocols
+
+	prefixes   []netip.Prefix // Address members (exact addresses as /32, /128), also in trie
+	trie       prefixTrie
+	addrRanges [][2]netip.Addr
+	wildcards  []ipv4Wildcard
+}
+
+// hasNumber reports whether a port, interface, protocol or AS number is a member
+func (s *valueSet) hasNumber(v uint32) bool {
+	if s.bits != nil {
+		i := int(v / 64)
+		return i < len(s.bits) && s.bits[i]&(1<<(v%64)) != 0
+	}
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].hi >= v })
+	return i < len(s.ranges) && s.ranges[i].lo <= v
+}
+
+// hasAddr reports whether an address is a member, v4-mapped addresses as IPv4
+func (s *valueSet) hasAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	if s.trie.contains(a) {
+		return true
+	}
+	for _, r := range s.addrRanges {
+		if a.BitLen() == r[0].BitLen() && r[0].Compare(a) <= 0 && a.Compare(r[1]) <= 0 {
+			return true
+		}
+	}
+	for _, w := range s.wildcards {
+		if w.matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyPrefixes reports whether all address members are addresses or prefixes
+func (s *valueSet) onlyPrefixes() bool {
+	return len(s.addrRanges) == 0 && len(s.wildcards) == 0
+}
+
+// evaluateSet evaluates a set condition (without negation)
+func (c *ConditionNode) evaluateSet(flow *types.Flow) bool {
+	s := c.Set
+	switch c.Field {
+	case "sport", "srcport":
+		return s.hasNumber(uint32(flow.SrcPort))
+	case "dport", "dstport":
+		return s.hasNumber(uint32(flow.DstPort))
+	case "port":
+		return s.hasNumber(uint32(flow.SrcPort)) || s.hasNumber(uint32(flow.DstPort))
+	case "if":
+		return s.hasNumber(uint32(flow.InputIf)) || s.hasNumber(uint32(flow.OutputIf))
+	case "inif":
+		return s.hasNumber(uint32(flow.InputIf))
+	case "outif":
+		return s.hasNumber(uint32(flow.OutputIf))
+	case "proto", "protocol":
+		return s.hasNumber(uint32(flow.Protocol))
+	case "srcas":
+		return s.hasNumber(flow.SrcAS)
+	case "dstas":
+		return s.hasNumber(flow.DstAS)
+	case "as":
+		return s.hasNumber(flow.SrcAS) || s.hasNumber(flow.DstAS)
+	case "src", "sip", "srcip":
+		return s.hasAddr(flow.SrcAddr)
+	case "dst", "dip", "dstip":
+		return s.hasAddr(flow.DstAddr)
+	case "ip":
+		return s.hasAddr(flow.SrcAddr) || s.hasAddr(flow.DstAddr)
+	case "exporter", "exp":
+		return s.hasAddr(flow.ExporterIP)
+	}
+	return true
+}
+
+// SplitSetCondition splits a condition like "port in {80,443}" into the field
+// and the members. ok is false if it is no set condition.
+func SplitSetCondition(s string) (field string, members []string, ok bool) {
+	open := strings.IndexByte(s, '{')
+	if open < 0 {
+		return "", nil, false
+	}
+	head := strings.TrimSpace(s[:open])
+	if len(head) < 3 || !strings.EqualFold(head[len(head)-2:], "in") || (head[len(head)-3] != ' ' && head[len(head)-3] != '\t') {
+		return "", nil, false
+	}
+	field = strings.ToLower(strings.TrimSpace(head[:len(head)-2]))
+	body := strings.TrimSuffix(s[open+1:], "}")
+	for _, m := range strings.Split(body, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return field, members, true
+}
+
+// parseSet parses the members of a set condition for a field
+func parseSet(field string, members []string) (*valueSet, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("empty set")
+	}
+
+	s := &valueSet{}
+	switch field {
+	case "sport", "srcport", "dport", "dstport", "port":
+		return s, s.parseNumbers(members, 16, "port", nil)
+	case "if", "inif", "outif":
+		return s, s.parseNumbers(members, 16, "interface", nil)
+	case "srcas", "dstas", "as":
+		return s, s.parseNumbers(members, 32, "AS number", nil)
+	case "proto", "protocol":
+		return s, s.parseNumbers(members, 8, "protocol", protocolNumbers)
+	}
+
+	for _, m := range members {
+		member := &ConditionNode{Field: field}
+		if err := parseAddrValue(member, m); err != nil {
+			return nil, fmt.Errorf("%s: %v", m, err)
+		}
+		switch {
+		case member.Network.IsValid():
+			s.prefixes = append(s.prefixes, member.Network)
+			s.trie.insert(member.Network)
+		case member.First.IsValid():
+			s.addrRanges = append(s.addrRanges, [2]netip.Addr{member.First, member.Last})
+		default:
+			s.wildcards = append(s.wildcards, member.Wildcard)
+		}
+	}
+	return s, nil
+}
+
+// parseNumbers parses numeric members and ranges (lo-hi) of the given bit size,
+// names resolves non-numeric members (protocol names). Sets of up to 16 bit
+// values also get a bitset.
+func (s *valueSet) parseNumbers(members []string, bitSize int, what string, names func(string) []int) error {
+	for _, m := range members {
+		if names != nil {
+			if numbers := names(m); len(numbers) > 0 {
+				for _, n := range numbers {
+					s.ranges = append(s.ranges, numberRange{uint32(n), uint32(n)})
+				}
+				continue
+			}
+		}
+		loStr, hiStr, isRange := strings.Cut(m, "-")
+		lo, errLo := strconv.ParseUint(strings.TrimSpace(loStr), 10, bitSize)
+		hi, errHi := lo, error(nil)
+		if isRange {
+			hi, errHi = strconv.ParseUint(strings.TrimSpace(hiStr), 10, bitSize)
+		}
+		if errLo != nil || errHi != nil || hi < lo {
+			return fmt.Errorf("invalid %s %s", what, m)
+		}
+		s.ranges = append(s.ranges, numberRange{uint32(lo), uint32(hi)})
+	}
+
+	// Sort and merge overlapping or adjacent ranges
+	slices.SortFunc(s.ranges, func(a, b numberRange) int { return cmp.Compare(a.lo, b.lo) })
+	merged := s.ranges[:1]
+	for _, r := range s.ranges[1:] {
+		last := &merged[len(merged)-1]
+		if uint64(r.lo) <= uint64(last.hi)+1 {
+			last.hi = max(last.hi, r.hi)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	s.ranges = merged
+
+	if bitSize <= 16 {
+		s.bits = make([]uint64, (1<<bitSize)/64)
+		for _, r := range s.ranges {
+			for v := r.lo; v <= r.hi; v++ {
+				s.bits[v/64] |= 1 << (v % 64)
+			}
+		}
+	}
+	return nil
+}
+
+// prefixTrie is a binary trie per address family, IPv4 over 32 bits and
+// IPv6 over 128, so ::/0 does not cover IPv4; a lookup follows the address
+// bits and matches on the first prefix end
+type prefixTrie struct {
+	root [2]*trieNode // IPv4, IPv6
+}
+
+type trieNode struct {
+	child [2]*trieNode
+	end   bool // A prefix ends here
+}
+
+func (t *prefixTrie) insert(p netip.Prefix) {
+	family, addr := trieKey(p.Addr())
+	if t.root[family] == nil {
+		t.root[family] = &trieNode{}
+	}
+	n := t.root[family]
+	for i := 0; i < p.Bits() && !n.end; i++ {
+		b := addr[i/8] >> (7 - i%8) & 1
+		if n.child[b] == nil {
+			n.child[b] = &trieNode{}
+		}
+		n = n.child[b]
+	}
+	n.end = true
+	n.child = [2]*trieNode{} // Covered by the shorter prefix
+}
+
+func (t *prefixTrie) contains(a netip.Addr) bool {
+	if !a.IsValid() {
+		return false
+	}
+	family, addr := trieKey(a.Unmap())
+	n := t.root[family]
+	for i := 0; n != nil; i++ {
+		if n.end {
+			return true
+		}
+		if i == len(addr)*8 {
+			break
+		}
+		n = n.child[addr[i/8]>>(7-i%8)&1]
+	}
+	return false
+}
+
+// trieKey returns the root index and address bytes of an address
+func trieKey(a netip.Addr) (int, []byte) {
+	if a.Is4() {
+		b := a.As4()
+		return 0, b[:]
+	}
+	b := a.As16()
+	return 1, b[:]
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"netflow-collector/pkg/types"
+)
+
+func TestSplitSetCondition(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		field   string
+		members []string
+		ok      bool
+	}{
+		{"port in {80,443}", "port", []string{"80", "443"}, true},
+		{"Port IN { 80 , 443 }", "port", []string{"80", "443"}, true},
+		{"src in {10.0.0.0/8,  ::1 }", "src", []string{"10.0.0.0/8", "::1"}, true},
+		{"port\tin\t{80}", "port", []string{"80"}, true},
+		{"port in {}", "port", nil, true},
+		{"port in { , }", "port", nil, true},
+		{"port in {80", "port", []string{"80"}, true}, // Missing } is reported by the parser
+		{"portin {80}", "", nil, false},
+		{"port in 80", "", nil, false},
+		{"in {80}", "", nil, false},
+	} {
+		field, members, ok := SplitSetCondition(tc.in)
+		if field != tc.field || !slices.Equal(members, tc.members) || ok != tc.ok {
+			t.Errorf("SplitSetCondition(%q) = %q, %q, %v, want %q, %q, %v",
+				tc.in, field, members, ok, tc.field, tc.members, tc.ok)
+		}
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		field   string
+		members []string
+		want    []numberRange // nil: error
+	}{
+		{"port", []string{"443"}, []numberRange{{443, 443}}},
+		{"port", []string{"80", "443", "81", "79"}, []numberRange{{79, 81}, {443, 443}}},
+		{"port", []string{"1-10", "5-20", "21", "30-40", "22-29"}, []numberRange{{1, 40}}},
+		{"port", []string{"8000-8999", "8080"}, []numberRange{{8000, 8999}}},
+		{"port", []string{"10-20", "22-30"}, []numberRange{{10, 20}, {22, 30}}},
+		{"port", []string{"0", "65535"}, []numberRange{{0, 0}, {65535, 65535}}},
+		{"port", []string{"0-65535"}, []numberRange{{0, 65535}}},
+		{"port", []string{" 80 - 90 "}, []numberRange{{80, 90}}},
+		{"port", []string{"65536"}, nil},
+		{"port", []string{"10-5"}, nil},
+		{"port", []string{"-5"}, nil},
+		{"port", []string{"5-"}, nil},
+		{"port", []string{"http"}, nil},
+		{"if", []string{"1-2", "65535"}, []numberRange{{1, 2}, {65535, 65535}}},
+		{"as", []string{"4294967295", "0"}, []numberRange{{0, 0}, {4294967295, 4294967295}}},
+		{"as", []string{"64512-65534", "65535", "4200000000-4294967295"}, []numberRange{{64512, 65535}, {4200000000, 4294967295}}},
+		{"as", []string{"4294967296"}, nil},
+		{"proto", []string{"tcp", "udp", "6"}, []numberRange{{6, 6}, {17, 17}}},
+		{"proto", []string{"ICMP", "icmpv6", "47-50"}, []numberRange{{1, 1}, {47, 50}, {58, 58}}},
+		{"proto", []string{"256"}, nil},
+		{"proto", []string{"nosuchproto"}, nil},
+	} {
+		s, err := parseSet(tc.field, tc.members)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s in %v: no error", tc.field, tc.members)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s in %v: %v", tc.field, tc.members, err)
+			continue
+		}
+		if !slices.Equal(s.ranges, tc.want) {
+			t.Errorf("%s in %v: ranges %v, want %v", tc.field, tc.members, s.ranges, tc.want)
+		}
+
+		// The bitset (up to 16 bit) and the ranges agree on every value
+		if tc.field == "as" {
+			if s.bits != nil {
+				t.Errorf("%s in %v: bitset for 32 bit values", tc.field, tc.members)
+			}
+		} else if s.bits == nil {
+			t.Errorf("%s in %v: no bitset", tc.field, tc.members)
+		}
+		for _, v := range []uint32{0, 1, 5, 6, 17, 47, 50, 51, 79, 80, 81, 82, 443, 8080, 65534, 65535, 4294967295} {
+			want := false
+			for _, r := range tc.want {
+				want = want || r.lo <= v && v <= r.hi
+			}
+			if got := s.hasNumber(v); got != want {
+				t.Errorf("%s in %v: has %d = %v, want %v", tc.field, tc.members, v, got, want)
+			}
+		}
+	}
+}
+
+func TestPrefixTrie(t *testing.T) {
+	var trie prefixTrie
+	if trie.contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Error("empty trie contains 10.0.0.1")
+	}
+	for _, p := range []string{"10.1.0.0/16", "10.0.0.0/8", "192.168.1.1/32", "2001:db8::/32", "2001:db8:1::/48", "fe80::1/128"} {
+		trie.insert(netip.MustParsePrefix(p))
+	}
+	for addr, want := range map[string]bool{
+		"10.0.0.1":         true,
+		"10.1.2.3":         true, // Under both, the longer was dropped
+		"10.255.255.255":   true,
+		"11.0.0.0":         false,
+		"9.255.255.255":    false,
+		"192.168.1.1":      true,
+		"192.168.1.2":      false,
+		"::ffff:10.0.0.1":  true, // v4-mapped is the IPv4 address
+		"::a00:1":          false,
+		"2001:db8::1":      true,
+		"2001:db8:ffff::1": true,
+		"2001:db9::1":      false,
+		"fe80::1":          true,
+		"fe80::2":          false,
+		"32.1.13.184":      false, // 2001:db8 in an IPv4 address
+	} {
+		if got := trie.contains(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("contains(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if trie.contains(netip.Addr{}) {
+		t.Error("contains(invalid address)")
+	}
+
+	// Default routes of one family don't cover the other
+	var v4, v6 prefixTrie
+	v4.insert(netip.MustParsePrefix("0.0.0.0/0"))
+	v6.insert(netip.MustParsePrefix("::/0"))
+	for _, tc := range []struct {
+		trie *prefixTrie
+		addr string
+		want bool
+	}{
+		{&v4, "1.2.3.4", true},
+		{&v4, "255.255.255.255", true},
+		{&v4, "::", false},
+		{&v4, "2001:db8::1", false},
+		{&v4, "::ffff:1.2.3.4", true},
+		{&v6, "2001:db8::1", true},
+		{&v6, "::", true},
+		{&v6, "1.2.3.4", false},
+		{&v6, "::ffff:1.2.3.4", false},
+	} {
+		if got := tc.trie.contains(netip.MustParseAddr(tc.addr)); got != tc.want {
+			t.Errorf("default route contains(%s) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestSetConditions(t *testing.T) {
+	addr := netip.MustParseAddr
+	for _, tc := range []struct {
+		expr string
+		flow types.Flow
+		want bool
+	}{
+		{"port in {65535}", types.Flow{SrcPort: 65535}, true},
+		{"port in {65535}", types.Flow{SrcPort: 65534}, false},
+		{"port in {0}", types.Flow{SrcPort: 1}, true}, // DstPort 0
+		{"sport in {0}", types.Flow{SrcPort: 1}, false},
+		{"dport in {80,443,8000-8999}", types.Flow{DstPort: 8500}, true},
+		{"dport in {80,443,8000-8999}", types.Flow{DstPort: 9000}, false},
+		{"dport in {80,443,8000-8999}", types.Flow{DstPort: 7999}, false},
+		{"proto in {tcp, 47}", types.Flow{Protocol: 47}, true},
+		{"proto in {tcp, 47}", types.Flow{Protocol: 17}, false},
+		{"proto in {255}", types.Flow{Protocol: 255}, true},
+		{"if in {1-2, 65535}", types.Flow{InputIf: 9, OutputIf: 65535}, true},
+		{"inif in {1-2, 65535}", types.Flow{InputIf: 9, OutputIf: 65535}, false},
+		{"outif in {3}", types.Flow{OutputIf: 3}, true},
+		{"srcas in {4294967295}", types.Flow{SrcAS: 4294967295}, true},
+		{"as in {64512-65534}", types.Flow{DstAS: 65534}, true},
+		{"dstas in {64512-65534}", types.Flow{DstAS: 65535}, false},
+		{"!port in {53}", types.Flow{SrcPort: 53}, false},
+
+		{"ip in {0.0.0.0/0}", types.Flow{SrcAddr: addr("1.2.3.4")}, true},
+		{"ip in {0.0.0.0/0}", types.Flow{SrcAddr: addr("2001:db8::1"), DstAddr: addr("::1")}, false},
+		{"ip in {::/0}", types.Flow{SrcAddr: addr("1.2.3.4"), DstAddr: addr("5.6.7.8")}, false},
+		{"ip in {::/0}", types.Flow{SrcAddr: addr("1.2.3.4"), DstAddr: addr("2001:db8::1")}, true},
+		{"src in {::ffff:10.0.0.0/104}", types.Flow{SrcAddr: addr("10.1.1.1")}, true},
+		{"src in {10.0.0.0/8}", types.Flow{SrcAddr: addr("::ffff:10.1.1.1")}, true},
+		{"src in {10.0.0.1}", types.Flow{SrcAddr: addr("10.0.0.2")}, false},
+		{"src in {10.0.0.1}", types.Flow{SrcAddr: addr("110.0.0.1")}, false},
+		{"src in {10.1.0.0/16, 10.0.0.0/8}", types.Flow{SrcAddr: addr("10.2.0.0")}, true},
+		{"src in {10.0.0.0/8, 10.1.0.0/16}", types.Flow{SrcAddr: addr("10.1.0.1")}, true},
+		{"src in {10.0.0.0/8, 10.1.0.0/16}", types.Flow{SrcAddr: addr("11.0.0.0")}, false},
+		{"src in {2001:db8::/32, 10.0.0.0/8}", types.Flow{SrcAddr: addr("2001:db8::5")}, true},
+		{"src in {2001:db8::/32}", types.Flow{SrcAddr: addr("32.1.13.184")}, false},
+		{"dst in {10.0.0.1-10.0.0.5, 8.*.8.8}", types.Flow{DstAddr: addr("10.0.0.3")}, true},
+		{"dst in {10.0.0.1-10.0.0.5, 8.*.8.8}", types.Flow{DstAddr: addr("::ffff:8.1.8.8")}, true},
+		{"dst in {10.0.0.1-10.0.0.5, 8.*.8.8}", types.Flow{DstAddr: addr("8.1.8.9")}, false},
+		{"exporter in {192.0.2.1, 2001:db8::1}", types.Flow{ExporterIP: addr("2001:db8::1")}, true},
+		{"src in {10.0.0.1}", types.Flow{}, false}, // No address
+	} {
+		filter := ParseFilter(tc.expr)
+		if !filter.IsValid() {
+			t.Errorf("%s: %s", tc.expr, filter.Error)
+			continue
+		}
+		if got := filter.Matches(&tc.flow); got != tc.want {
+			t.Errorf("%s on %+v = %v, want %v", tc.expr, tc.flow, got, tc.want)
+		}
+	}
+}
+
+func TestSetConditionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{"port in {}", "empty set"},
+		{"port in { , }", "empty set"},
+		{"port in {80", "missing }"},
+		{"port in {65536}", "invalid port 65536"},
+		{"port in {90-80}", "invalid port 90-80"},
+		{"if in {x}", "invalid interface x"},
+		{"as in {-1}", "invalid AS number"},
+		{"proto in {foo}", "invalid protocol foo"},
+		{"src in {10.0}", "10.0: not an address"},
+		{"src in {10.0.0.0/33}", "invalid CIDR"},
+		{"src in {10.0.0.9-10.0.0.1}", "one address family"},
+		{"bytes in {1}", "does not support in"},
+		{"size in {1}", "unknown field"},
+	} {
+		filter := ParseFilter(tc.expr)
+		if filter.IsValid() {
+			t.Errorf("%s: parsed without error", tc.expr)
+		} else if !strings.Contains(filter.Error, tc.err) {
+			t.Errorf("%s: error %q, want %q", tc.expr, filter.Error, tc.err)
+		}
+	}
+}
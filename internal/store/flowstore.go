@@ -1,12 +1,13 @@
 package store
 
 import (
-	"fmt"
-	"net"
+	"net/netip"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"netflow-collector/internal/resolver"
@@ -55,40 +56,50 @@ type ConditionNode struct {
 	Value     string
 	Port      uint16
 	Interface uint16
-	Network   *net.IPNet // For CIDR notation like 192.168.0.0/24
+	Network   netip.Prefix // Exact address (/32, /128) or CIDR like 192.168.0.0/24, invalid if not set
+	First     netip.Addr   // Address range First-Last, invalid if not set
+	Last      netip.Addr
+	Wildcard  ipv4Wildcard // IPv4 wildcard like 10.*.0.1 (see filteraddr.go)
+	State     types.FlowState
+	Op        CompareOp // Comparison for numeric fields (see NumericFields)
+	Number    float64   // bytes, packets, duration (seconds), bps (bytes/s) and AS values
+	Set       *valueSet // Members of "field in {…}", nil otherwise (see filterset.go)
 	Negated   bool
 }
 
 func (c *ConditionNode) Evaluate(flow *types.Flow) bool {
-	srcIP := flow.SrcAddr.String()
-	dstIP := flow.DstAddr.String()
+	if c.Set != nil {
+		return c.evaluateSet(flow) != c.Negated
+	}
 
 	var result bool
 	switch c.Field {
 	case "src", "sip", "srcip":
-		if c.Network != nil {
-			result = c.Network.Contains(flow.SrcAddr)
-		} else {
-			result = strings.Contains(srcIP, c.Value)
-		}
+		result = c.matchAddr(flow.SrcAddr)
 	case "dst", "dip", "dstip":
-		if c.Network != nil {
-			result = c.Network.Contains(flow.DstAddr)
-		} else {
-			result = strings.Contains(dstIP, c.Value)
-		}
+		result = c.matchAddr(flow.DstAddr)
 	case "ip":
-		if c.Network != nil {
-			result = c.Network.Contains(flow.SrcAddr) || c.Network.Contains(flow.DstAddr)
-		} else {
-			result = strings.Contains(srcIP, c.Value) || strings.Contains(dstIP, c.Value)
-		}
+		result = c.matchAddr(flow.SrcAddr) || c.matchAddr(flow.DstAddr)
 	case "sport", "srcport":
-		result = flow.SrcPort == c.Port
+		result = compareValues(c.Op, flow.SrcPort, c.Port)
 	case "dport", "dstport":
-		result = flow.DstPort == c.Port
+		result = compareValues(c.Op, flow.DstPort, c.Port)
 	case "port":
-		result = flow.SrcPort == c.Port || flow.DstPort == c.Port
+		result = compareValues(c.Op, flow.SrcPort, c.Port) || compareValues(c.Op, flow.DstPort, c.Port)
+	case "bytes":
+		result = compareValues(c.Op, float64(flow.Bytes), c.Number)
+	case "packets", "pkts":
+		result = compareValues(c.Op, float64(flow.Packets), c.Number)
+	case "duration", "dur":
+		result = compareValues(c.Op, flowDuration(flow), c.Number)
+	case "bps":
+		result = compareValues(c.Op, flow.BytesPerSecond(), c.Number)
+	case "srcas":
+		result = compareValues(c.Op, float64(flow.SrcAS), c.Number)
+	case "dstas":
+		result = compareValues(c.Op, float64(flow.DstAS), c.Number)
+	case "as":
+		result = compareValues(c.Op, float64(flow.SrcAS), c.Number) || compareValues(c.Op, float64(flow.DstAS), c.Number)
 	case "proto", "protocol":
 		result = strings.EqualFold(flow.ProtocolName(), c.Value)
 	case "service", "svc":
@@ -101,19 +112,27 @@ func (c *ConditionNode) Evaluate(flow *types.Flow) bool {
 		} else {
 			result = strings.EqualFold(srcSvc, c.Value) || strings.EqualFold(dstSvc, c.Value)
 		}
+	case "app", "application":
+		// Match exporter-reported application name or ID (e.g. "13:453")
+		result = (flow.AppName != "" && strings.EqualFold(flow.AppName, c.Value)) ||
+			(!flow.AppID.IsZero() && flow.AppID.String() == c.Value)
+	case "state":
+		result = flow.State() == c.State
 	case "if":
 		// Match either input or output interface
-		result = flow.InputIf == c.Interface || flow.OutputIf == c.Interface
+		result = compareValues(c.Op, flow.InputIf, c.Interface) || compareValues(c.Op, flow.OutputIf, c.Interface)
 	case "inif":
-		result = flow.InputIf == c.Interface
+		result = compareValues(c.Op, flow.InputIf, c.Interface)
 	case "outif":
-		result = flow.OutputIf == c.Interface
+		result = compareValues(c.Op, flow.OutputIf, c.Interface)
+	case "exporter", "exp":
+		result = c.matchAddr(flow.ExporterIP)
 	case "self", "local":
 		// Match flows where source == destination (self-traffic)
-		result = srcIP == dstIP
+		result = flow.SrcAddr == flow.DstAddr
 	case "version", "ipversion":
 		// Match IPv4 (4) or IPv6 (6)
-		isV4 := flow.SrcAddr.To4() != nil
+		isV4 := flow.SrcAddr.Is4()
 		if c.Value == "4" || c.Value == "v4" || c.Value == "ipv4" {
 			result = isV4
 		} else if c.Value == "6" || c.Value == "v6" || c.Value == "ipv6" {
@@ -169,17 +188,34 @@ func (n *NotNode) Evaluate(flow *types.Flow) bool {
 }
 
 // Filter defines criteria for filtering flows
-// Supports: src=x dst=x ip=x sport=x dport=x port=x proto=x
+// Supports: src=x dst=x ip=x (address, CIDR, range, wildcard; ~ substring) sport=x dport=x port=x proto=x app=x state=x exporter=x
+// Numeric fields also compare: bytes>1M packets<3 duration>=5m bps>10k port<1024
+// Sets with ranges: port in {80,443,8000-8999} proto in {tcp,udp} ip in {10.0.0.0/8, 192.168.0.0/16}
 // Operators: && (AND), || (OR), ! (NOT), () (grouping)
 type Filter struct {
 	Root  ExprNode // Root of expression tree
 	Raw   string   // original filter string for display
 	Error string   // parse error message, empty if valid
+
+	// Optional receive-time range. Query reads archived flows for ranges that
+	// are no longer in memory.
+	Since time.Time
+	Until time.Time
+
+	// Optional flow-time range [From, To): flows whose start/end overlaps it,
+	// clipped to it with bytes and packets apportioned (see timerange.go)
+	From time.Time
+	To   time.Time
 }
 
 // IsEmpty returns true if no filters are set
 func (f *Filter) IsEmpty() bool {
-	return f.Root == nil
+	return f.Root == nil && !f.HasTimeRange() && !f.HasFlowTimeRange()
+}
+
+// HasTimeRange returns true if the filter restricts the receive time
+func (f *Filter) HasTimeRange() bool {
+	return !f.Since.IsZero() || !f.Until.IsZero()
 }
 
 // IsValid returns true if the filter has no parse errors
@@ -189,6 +225,15 @@ func (f *Filter) IsValid() bool {
 
 // Matches returns true if the flow matches the filter
 func (f *Filter) Matches(flow *types.Flow) bool {
+	if !f.Since.IsZero() && flow.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && flow.ReceivedAt.After(f.Until) {
+		return false
+	}
+	if f.HasFlowTimeRange() && !f.overlaps(flow) {
+		return false
+	}
 	if f.Root == nil {
 		return true
 	}
@@ -205,9 +250,15 @@ var ValidFields = map[string]bool{
 	"port": true,
 	"proto": true, "protocol": true,
 	"service": true, "svc": true,
+	"app": true, "application": true,
+	"state": true,
+	"exporter": true, "exp": true,
 	"if": true, "inif": true, "outif": true,
 	"self": true, "local": true,
 	"version": true, "ipversion": true,
+	"bytes": true, "packets": true, "pkts": true,
+	"duration": true, "dur": true, "bps": true,
+	"srcas": true, "dstas": true, "as": true,
 }
 
 // Token types for the filter parser
@@ -318,6 +369,10 @@ func tokenize(s string) []token {
 			}
 			i++
 		}
+		// A set condition "field in {…}" is one token up to the closing brace
+		if end := setConditionEnd(s, i); i > start && end > 0 {
+			i = end
+		}
 		if i > start {
 			tokens = append(tokens, token{tokenCondition, s[start:i]})
 		}
@@ -327,6 +382,29 @@ func tokenize(s string) []token {
 	return tokens
 }
 
+// setConditionEnd returns the end of " in {…}" following a field name at i
+// (the end of the string if the brace is not closed), 0 if none follows
+func setConditionEnd(s string, i int) int {
+	j := i
+	for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+		j++
+	}
+	if j == i || j+2 > len(s) || !strings.EqualFold(s[j:j+2], "in") {
+		return 0
+	}
+	j += 2
+	for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+		j++
+	}
+	if j >= len(s) || s[j] != '{' {
+		return 0
+	}
+	if end := strings.IndexByte(s[j:], '}'); end >= 0 {
+		return j + end + 1
+	}
+	return len(s)
+}
+
 // parser holds the parser state
 type parser struct {
 	tokens  []token
@@ -467,41 +545,38 @@ var knownProtocols = map[string]bool{
 func (p *parser) parseCondition(s string) ExprNode {
 	var key, value string
 	var negated bool
+	op := OpEqual
 
-	// Check for != operator
-	if idx := strings.Index(s, "!="); idx > 0 {
-		key = strings.ToLower(s[:idx])
-		value = s[idx+2:]
-		negated = true
+	// Set membership: key in {a, b, lo-hi, …}
+	if field, members, ok := SplitSetCondition(s); ok {
+		return p.parseSetCondition(s, field, members)
+	}
+
+	// key=value, key:value, key!=value or a comparison like key>=value
+	field, opText, v, ok := SplitCondition(s)
+	if ok {
+		key, value = field, v
+		op = operatorOf(opText)
+		negated = strings.HasPrefix(opText, "!")
 	} else {
-		// Try key=value or key:value format
-		idx := strings.Index(s, "=")
-		if idx < 0 {
-			idx = strings.Index(s, ":")
-		}
-		if idx <= 0 {
-			// No operator found - try implicit detection
-			lowerS := strings.ToLower(s)
-
-			// Check for special keywords
-			if lowerS == "self" || lowerS == "local" {
-				key = "self"
-				value = "true"
-			} else if knownProtocols[lowerS] {
-				// Check if it's a known protocol
-				key = "proto"
-				value = lowerS
-			} else if resolver.IsKnownService(lowerS) {
-				// Check if it's a known service
-				key = "service"
-				value = lowerS
-			} else {
-				p.errors = append(p.errors, s+" (invalid syntax)")
-				return nil
-			}
+		// No operator found - try implicit detection
+		lowerS := strings.ToLower(s)
+
+		// Check for special keywords
+		if lowerS == "self" || lowerS == "local" {
+			key = "self"
+			value = "true"
+		} else if knownProtocols[lowerS] {
+			// Check if it's a known protocol
+			key = "proto"
+			value = lowerS
+		} else if resolver.IsKnownService(lowerS) {
+			// Check if it's a known service
+			key = "service"
+			value = lowerS
 		} else {
-			key = strings.ToLower(s[:idx])
-			value = s[idx+1:]
+			p.errors = append(p.errors, s+" (invalid syntax)")
+			return nil
 		}
 	}
 
@@ -517,19 +592,19 @@ func (p *parser) parseCondition(s string) ExprNode {
 		return nil
 	}
 
-	cond := &ConditionNode{Field: key, Value: value, Negated: negated}
+	// Comparisons only for numeric fields, substrings only for addresses
+	if op == OpContains && !AddressFields[key] || op != OpEqual && op != OpContains && !NumericFields[key] {
+		p.errors = append(p.errors, s+" (field does not support "+opText+")")
+		return nil
+	}
 
-	// Parse CIDR notation for IP fields
-	if key == "src" || key == "sip" || key == "srcip" ||
-		key == "dst" || key == "dip" || key == "dstip" ||
-		key == "ip" {
-		if strings.Contains(value, "/") {
-			_, network, err := net.ParseCIDR(value)
-			if err != nil {
-				p.errors = append(p.errors, s+" (invalid CIDR)")
-				return nil
-			}
-			cond.Network = network
+	cond := &ConditionNode{Field: key, Value: value, Op: op, Negated: negated}
+
+	// Parse addresses, prefixes, ranges and wildcards once
+	if AddressFields[key] && op != OpContains {
+		if err := parseAddrValue(cond, value); err != nil {
+			p.errors = append(p.errors, s+" ("+err.Error()+")")
+			return nil
 		}
 	}
 
@@ -553,6 +628,41 @@ func (p *parser) parseCondition(s string) ExprNode {
 		cond.Interface = uint16(iface)
 	}
 
+	// Parse numeric values with unit suffixes
+	switch key {
+	case "bytes", "packets", "pkts", "bps":
+		n, ok := parseQuantity(value)
+		if !ok {
+			p.errors = append(p.errors, s+" (invalid number, e.g. 1500, 10k, 1.5M, 2G)")
+			return nil
+		}
+		cond.Number = n
+	case "duration", "dur":
+		n, ok := parseDurationSeconds(value)
+		if !ok {
+			p.errors = append(p.errors, s+" (invalid duration, e.g. 500ms, 30s, 5m)")
+			return nil
+		}
+		cond.Number = n
+	case "srcas", "dstas", "as":
+		as, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			p.errors = append(p.errors, s+" (invalid AS number)")
+			return nil
+		}
+		cond.Number = float64(as)
+	}
+
+	// Parse connection state
+	if key == "state" {
+		state, ok := types.ParseFlowState(value)
+		if !ok {
+			p.errors = append(p.errors, s+" (unknown state)")
+			return nil
+		}
+		cond.State = state
+	}
+
 	// Validate protocol
 	if key == "proto" || key == "protocol" {
 		validProtos := map[string]bool{
@@ -568,12 +678,34 @@ func (p *parser) parseCondition(s string) ExprNode {
 	return cond
 }
 
+// parseSetCondition parses a set condition like "port in {80,443,8000-8999}"
+func (p *parser) parseSetCondition(s, key string, members []string) ExprNode {
+	if !ValidFields[key] {
+		p.errors = append(p.errors, s+" (unknown field)")
+		return nil
+	}
+	if !SetFields[key] {
+		p.errors = append(p.errors, s+" (field does not support in)")
+		return nil
+	}
+	if !strings.HasSuffix(s, "}") {
+		p.errors = append(p.errors, s+" (missing })")
+		return nil
+	}
+	set, err := parseSet(key, members)
+	if err != nil {
+		p.errors = append(p.errors, s+" ("+err.Error()+")")
+		return nil
+	}
+	return &ConditionNode{Field: key, Value: strings.Join(members, ","), Set: set}
+}
+
 // ParseFilter parses a Wireshark-like filter string with full expression support
 // Examples:
-//   - "src=192.168 && proto=tcp" - AND
+//   - "src=192.168.0.0/16 && proto=tcp" - AND
 //   - "port=80 || port=443" - OR
 //   - "!proto=udp" or "not proto=udp" - NOT
-//   - "src=192.168 proto=tcp" - space = implicit AND
+//   - "src=192.168.1.10 proto=tcp" - space = implicit AND
 //   - "!(src=10.0.0.1 && port=53)" - parentheses for grouping
 func ParseFilter(s string) Filter {
 	f := Filter{Raw: strings.TrimSpace(s)}
@@ -618,13 +750,20 @@ type Stats struct {
 	V5Flows         uint64
 	V9Flows         uint64
 	IPFIXFlows      uint64
+	LegacyFlows     uint64 // NetFlow v1, v7 and v8
 	UniqueExporters int
 }
 
-// EvictionConfig configures the hybrid eviction strategy
+// EvictionConfig configures the hybrid eviction strategy and retention limits
 type EvictionConfig struct {
 	TopKPercent float64       // Percent of max-flows to protect as elephant flows (e.g., 1.0 = 1%)
 	LRUWindow   time.Duration // Protect flows accessed within this window
+	MaxMemory   int64         // Memory budget for stored flows in bytes (estimated), 0 = unlimited
+	MaxAge      time.Duration // Drop flows received longer ago than this, 0 = unlimited
+
+	// Policies decide which flows survive eviction, in order (see policy.go).
+	// nil uses the hybrid strategy: Top-K (TopKPercent), then LRU (LRUWindow).
+	Policies []EvictionPolicy
 }
 
 // DefaultEvictionConfig returns sensible defaults
@@ -635,26 +774,66 @@ func DefaultEvictionConfig() EvictionConfig {
 	}
 }
 
-// FlowStore stores flows in memory
+// FlowStore stores flows in memory. Flows live in segments (see segment.go):
+// readers work on lock-free snapshots, mu only guards the ingest-side state.
 type FlowStore struct {
 	mu              sync.RWMutex
-	flows           []types.Flow
 	maxFlows        int
 	stats           Stats
-	exporters       map[string]bool
+	exporters       map[netip.Addr]*exporterClock
+	clockCorrection bool // Shift flow timestamps by the measured exporter clock offset
 	lastStatsUpdate time.Time
 	flowsInWindow   int
 	bytesInWindow   uint64
 	evictionConfig  EvictionConfig
 	evictionStats   EvictionStats
+	archive         *Archive // Optional on-disk archive, nil if disabled
+	history         *History // Optional SQLite history, nil if disabled
+	rollups         *rollups // Traffic time series per exporter, interface and protocol
+	hitters         *heavyHitters // Top talkers over sliding windows, independent of eviction
+	cardinality     *cardinality  // Distinct hosts per host, interface and exporter over sliding windows
+	dedup           *dedup        // Cross-exporter deduplication, disabled unless configured
+
+	view            atomic.Pointer[storeView] // Current segment list
+	count           atomic.Int64              // Number of stored flows
+	seq             atomic.Uint64             // Last sequence number assigned on Add (see cursor.go)
+	memory          atomic.Int64              // Estimated memory use of the stored flows in bytes
+	segmentCapacity int
+	retained        *segment      // Protected flows kept from evicted segments, nil if none, written under maintMu and mu
+	hist            byteHistogram // Byte counts of stored flows for the Top-K threshold
+
+	// Persistence and eviction run outside mu (see maintain.go): maintMu
+	// serializes them and guards evictionConfig reads during eviction,
+	// persistMu guards the queue and the goroutine state
+	maintMu      sync.Mutex
+	persistMu    sync.Mutex
+	toPersist    []types.Flow
+	maintWanted  bool
+	maintRunning bool
+	maintDone    chan struct{} // Closed when the running maintenance goroutine exits
+	maintClosed  bool          // Set by Close, no more maintenance is scheduled
+
+	// Access times for LRU protection by FlowKey, separate from mu so marking
+	// flows from the TUI never waits for ingest
+	accessMu sync.Mutex
+	accessed map[types.FlowKey]time.Time
+
+	// Snapshot file and last snapshot, snapshotMu also serializes snapshot writes
+	snapshotMu   sync.Mutex
+	snapshotPath string
+	lastSnapshot SnapshotInfo
+
+	subscriptions []*Subscription // Consumers of newly added flows (see subscription.go)
 }
 
 // EvictionStats tracks eviction statistics
 type EvictionStats struct {
 	TotalEvicted   uint64
 	FIFOEvicted    uint64
+	AgeEvicted     uint64 // Dropped by max-age
 	TopKProtected  int
 	LRUProtected   int
+	Policies       []PolicyStats // Per policy in evaluation order, set after the first eviction
 }
 
 // New creates a new flow store
@@ -662,19 +841,26 @@ func New(maxFlows int) *FlowStore {
 	return NewWithConfig(maxFlows, DefaultEvictionConfig())
 }
 
-// NewWithConfig creates a new flow store with custom eviction config
+// NewWithConfig creates a new flow store with custom eviction config. maxFlows
+// may be 0 if a memory budget is configured, which then is the only limit.
 func NewWithConfig(maxFlows int, evictionConfig EvictionConfig) *FlowStore {
-	if maxFlows == 0 {
+	if maxFlows == 0 && evictionConfig.MaxMemory <= 0 {
 		maxFlows = 100000
 	}
 
 	fs := &FlowStore{
-		flows:           make([]types.Flow, 0, maxFlows),
 		maxFlows:        maxFlows,
-		exporters:       make(map[string]bool),
+		exporters:       make(map[netip.Addr]*exporterClock),
 		lastStatsUpdate: time.Now(),
 		evictionConfig:  evictionConfig,
+		rollups:         newRollups(DefaultRollupTiers),
+		hitters:         newHeavyHitters(DefaultHeavyHitterWindows),
+		cardinality:     newCardinality(),
+		dedup:           newDedup(),
+		accessed:        make(map[types.FlowKey]time.Time),
 	}
+	fs.segmentCapacity = segmentCapacityFor(fs.flowLimit())
+	fs.replaceSegments([]*segment{newHeadSegment(fs.segmentCapacity)})
 
 	return fs
 }
@@ -686,36 +872,32 @@ func (fs *FlowStore) Add(flows []types.Flow) {
 	}
 
 	fs.mu.Lock()
-	defer fs.mu.Unlock()
 
+	// Flows as stored (with clock correction) for the archive and history
+	var stored []types.Flow
+	if fs.archive != nil || fs.history != nil {
+		stored = make([]types.Flow, 0, len(flows))
+	}
+
+	dedupe := fs.dedup.enabled()
 	for _, flow := range flows {
-		// Update stats
-		fs.stats.TotalFlows++
-		fs.stats.TotalBytes += flow.Bytes
-		fs.stats.TotalPackets += flow.Packets
-		fs.flowsInWindow++
-		fs.bytesInWindow += flow.Bytes
-
-		switch flow.Version {
-		case types.NetFlowV5:
-			fs.stats.V5Flows++
-		case types.NetFlowV9:
-			fs.stats.V9Flows++
-		case types.IPFIX:
-			fs.stats.IPFIXFlows++
+		fs.trackExporter(&flow)
+		if dedupe && !fs.dedup.admit(&flow) {
+			continue
 		}
 
-		if flow.ExporterIP != nil {
-			fs.exporters[flow.ExporterIP.String()] = true
+		fs.addFlow(&flow)
+		if stored != nil {
+			stored = append(stored, flow)
 		}
-
-		fs.flows = append(fs.flows, flow)
 	}
-
-	// Hybrid eviction if over max
-	if len(fs.flows) > fs.maxFlows {
-		fs.evictFlows()
+	if dedupe {
+		released := fs.releaseHeld(time.Now())
+		if stored != nil {
+			stored = append(stored, released...)
+		}
 	}
+	fs.queuePersist(stored)
 
 	// Update rates every second
 	now := time.Now()
@@ -728,203 +910,211 @@ func (fs *FlowStore) Add(flows []types.Flow) {
 		fs.bytesInWindow = 0
 		fs.lastStatsUpdate = now
 	}
-}
 
-// evictFlows implements the hybrid eviction strategy: Top-K + LRU + FIFO
-func (fs *FlowStore) evictFlows() {
-	now := time.Now()
-	toEvict := len(fs.flows) - fs.maxFlows
-	if toEvict <= 0 {
-		return
-	}
+	// Persistence and eviction (hybrid if over a limit, expiry with max-age)
+	// run in the background (see maintain.go), unless eviction falls behind
+	maintenance := len(stored) > 0 || fs.overLimit() || fs.evictionConfig.MaxAge > 0
+	behind := fs.farOverLimit()
+	fs.mu.Unlock()
 
-	// Calculate Top-K count from percentage of max-flows
-	topKCount := int(float64(fs.maxFlows) * fs.evictionConfig.TopKPercent / 100.0)
-	if topKCount < 0 {
-		topKCount = 0
+	if behind {
+		fs.maintain()
+	} else if maintenance {
+		fs.scheduleMaintenance()
 	}
+}
 
-	// Step 1: Find Top-K flows by bytes (elephant flows)
-	topKThreshold := uint64(0)
-	if topKCount > 0 && topKCount < len(fs.flows) {
-		// Find the Kth largest byte count
-		byteCounts := make([]uint64, len(fs.flows))
-		for i, f := range fs.flows {
-			byteCounts[i] = f.Bytes
-		}
-		sort.Slice(byteCounts, func(i, j int) bool {
-			return byteCounts[i] > byteCounts[j] // descending
-		})
-		if topKCount < len(byteCounts) {
-			topKThreshold = byteCounts[topKCount-1]
-		}
+// addFlow counts and stores one flow. Must be called with fs.mu held.
+func (fs *FlowStore) addFlow(flow *types.Flow) {
+	flow.Seq = fs.seq.Add(1)
+
+	// Update stats
+	fs.stats.TotalFlows++
+	fs.stats.TotalBytes += flow.Bytes
+	fs.stats.TotalPackets += flow.Packets
+	fs.flowsInWindow++
+	fs.bytesInWindow += flow.Bytes
+
+	switch flow.Version {
+	case types.NetFlowV5:
+		fs.stats.V5Flows++
+	case types.NetFlowV9:
+		fs.stats.V9Flows++
+	case types.IPFIX:
+		fs.stats.IPFIXFlows++
+	case types.NetFlowV1, types.NetFlowV7, types.NetFlowV8:
+		fs.stats.LegacyFlows++
+	}
+
+	fs.rollups.add(flow)
+	fs.hitters.add(flow)
+	fs.cardinality.add(flow)
+
+	fs.appendFlow(flow)
+	fs.hist.add(flow.Bytes)
+	fs.publish(flow)
+}
+
+// Query returns flows matching the filter, sorted by the specified field
+func (fs *FlowStore) Query(filter *Filter, sortBy SortField, ascending bool, limit int) []types.Flow {
+	// Filter flows
+	var filtered []types.Flow
+	if filter == nil || filter.IsEmpty() {
+		filtered = make([]types.Flow, 0, fs.GetFlowCount())
+	} else {
+		filtered = make([]types.Flow, 0)
 	}
+	fs.forEachMatch(filter, func(f *types.Flow) {
+		filtered = append(filtered, *f)
+	})
 
-	// Step 2: Classify flows into protected and evictable
-	type flowWithIndex struct {
-		index     int
-		protected bool
-		reason    string // "topk", "lru", or ""
+	// Time ranges reaching back before the oldest flow in memory also read the archive
+	fs.mu.RLock()
+	archive := fs.archive
+	fs.mu.RUnlock()
+	if filter != nil && !filter.receivedSince().IsZero() && archive != nil {
+		filtered = append(filtered, fs.queryArchive(archive, filter)...)
 	}
 
-	classification := make([]flowWithIndex, len(fs.flows))
-	topKProtected := 0
-	lruCount := 0
+	sortFlows(filtered, sortBy, ascending)
 
-	for i, f := range fs.flows {
-		classification[i].index = i
+	// Limit results
+	if limit > 0 && limit < len(filtered) {
+		filtered = filtered[:limit]
+	}
 
-		// Check Top-K protection (elephant flows)
-		if topKThreshold > 0 && f.Bytes >= topKThreshold && topKProtected < topKCount {
-			classification[i].protected = true
-			classification[i].reason = "topk"
-			topKProtected++
-			continue
-		}
+	return filtered
+}
 
-		// Check LRU protection (recently accessed)
-		if !f.LastAccessed.IsZero() && now.Sub(f.LastAccessed) < fs.evictionConfig.LRUWindow {
-			classification[i].protected = true
-			classification[i].reason = "lru"
-			lruCount++
-			continue
+// sortFlows sorts flows by a sort field, keeping the order of equal flows
+func sortFlows(flows []types.Flow, sortBy SortField, ascending bool) {
+	less := func(a, b *types.Flow) bool {
+		switch sortBy {
+		case SortByBytes:
+			return a.Bytes < b.Bytes
+		case SortByPackets:
+			return a.Packets < b.Packets
+		case SortBySrcIP:
+			return a.SrcAddr.Compare(b.SrcAddr) < 0
+		case SortByDstIP:
+			return a.DstAddr.Compare(b.DstAddr) < 0
+		case SortByProtocol:
+			return a.Protocol < b.Protocol
 		}
+		return a.ReceivedAt.Before(b.ReceivedAt)
 	}
-
-	// Step 3: Collect evictable flows (FIFO order - oldest first)
-	evictable := make([]int, 0, len(fs.flows)-topKProtected-lruCount)
-	for _, c := range classification {
-		if !c.protected {
-			evictable = append(evictable, c.index)
+	sort.SliceStable(flows, func(i, j int) bool {
+		if ascending {
+			return less(&flows[i], &flows[j])
 		}
-	}
+		return less(&flows[j], &flows[i])
+	})
+}
 
-	// Step 4: Mark flows to remove (oldest first from evictable)
-	toRemove := make(map[int]bool)
-	removed := 0
-	for _, idx := range evictable {
-		if removed >= toEvict {
-			break
-		}
-		toRemove[idx] = true
-		removed++
-	}
+// queryArchive returns archived flows matching the filter that are no longer in
+// memory, clipped to the filter's flow-time range
+func (fs *FlowStore) queryArchive(archive *Archive, filter *Filter) []types.Flow {
+	since := filter.receivedSince()
+	fs.mu.RLock()
+	view := fs.snapshot()
+	retained := fs.retained
+	fs.mu.RUnlock()
 
-	// If still need to evict more, take from LRU pool (oldest accessed first)
-	if removed < toEvict {
-		// Sort LRU flows by LastAccessed
-		type lruFlow struct {
-			index      int
-			lastAccess time.Time
-		}
-		lruFlows := make([]lruFlow, 0)
-		for _, c := range classification {
-			if c.reason == "lru" {
-				lruFlows = append(lruFlows, lruFlow{c.index, fs.flows[c.index].LastAccessed})
-			}
-		}
-		sort.Slice(lruFlows, func(i, j int) bool {
-			return lruFlows[i].lastAccess.Before(lruFlows[j].lastAccess)
-		})
-		for _, lf := range lruFlows {
-			if removed >= toEvict {
-				break
-			}
-			toRemove[lf.index] = true
-			removed++
-			lruCount--
+	// Everything received before the oldest flow of the FIFO order (the
+	// non-retained segments) has been evicted, apart from retained flows. The
+	// first of them usually holds it, but released dedup records can be older.
+	// The retained segment itself can be arbitrarily old and doesn't count.
+	frontier := time.Now()
+	for _, seg := range view.segments {
+		if seg != retained && seg.len() > 0 && seg.oldest().Before(frontier) {
+			frontier = seg.oldest()
 		}
 	}
+	if !since.Before(frontier) {
+		return nil
+	}
 
-	// Step 5: Build new flow slice without removed flows
-	newFlows := make([]types.Flow, 0, fs.maxFlows)
-	for i, f := range fs.flows {
-		if !toRemove[i] {
-			newFlows = append(newFlows, f)
+	// Retained flows are in memory and in the archive
+	retainedKeys := make(map[archiveKey]bool)
+	if retained != nil {
+		flows := retained.slice()
+		for i := range flows {
+			retainedKeys[archiveKeyOf(&flows[i])] = true
 		}
 	}
 
-	// Update eviction stats
-	fs.evictionStats.TotalEvicted += uint64(removed)
-	fs.evictionStats.FIFOEvicted += uint64(removed)
-	fs.evictionStats.TopKProtected = topKProtected
-	fs.evictionStats.LRUProtected = lruCount
-
-	fs.flows = newFlows
-}
-
-// Query returns flows matching the filter, sorted by the specified field
-func (fs *FlowStore) Query(filter *Filter, sortBy SortField, ascending bool, limit int) []types.Flow {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
-	// Filter flows
-	var filtered []types.Flow
-	if filter == nil || filter.IsEmpty() {
-		filtered = make([]types.Flow, len(fs.flows))
-		copy(filtered, fs.flows)
-	} else {
-		filtered = make([]types.Flow, 0)
-		for i := range fs.flows {
-			if filter.Matches(&fs.flows[i]) {
-				filtered = append(filtered, fs.flows[i])
+	// Flows received after the frontier may have been evicted or may still be
+	// in memory (eviction protects elephant and recently viewed flows)
+	var inMemory map[archiveKey]bool
+	isInMemory := func(f *types.Flow) bool {
+		if f.ReceivedAt.Before(frontier) {
+			return retainedKeys[archiveKeyOf(f)]
+		}
+		if inMemory == nil {
+			inMemory = make(map[archiveKey]bool)
+			for _, seg := range view.segments {
+				flows := seg.slice()
+				for i := range flows {
+					inMemory[archiveKeyOf(&flows[i])] = true
+				}
 			}
 		}
+		return inMemory[archiveKeyOf(f)]
 	}
 
-	// Sort flows
-	sort.Slice(filtered, func(i, j int) bool {
-		var less bool
-		switch sortBy {
-		case SortByTime:
-			less = filtered[i].ReceivedAt.Before(filtered[j].ReceivedAt)
-		case SortByBytes:
-			less = filtered[i].Bytes < filtered[j].Bytes
-		case SortByPackets:
-			less = filtered[i].Packets < filtered[j].Packets
-		case SortBySrcIP:
-			less = compareIPs(filtered[i].SrcAddr, filtered[j].SrcAddr) < 0
-		case SortByDstIP:
-			less = compareIPs(filtered[i].DstAddr, filtered[j].DstAddr) < 0
-		case SortByProtocol:
-			less = filtered[i].Protocol < filtered[j].Protocol
-		default:
-			less = filtered[i].ReceivedAt.Before(filtered[j].ReceivedAt)
+	var result []types.Flow
+	archive.Read(since, filter.Until, func(f *types.Flow) bool {
+		if isInMemory(f) {
+			return true
 		}
-		if ascending {
-			return less
+		if filter.Matches(f) {
+			result = append(result, *filter.clip(f))
 		}
-		return !less
+		return true
 	})
+	return result
+}
 
-	// Limit results
-	if limit > 0 && limit < len(filtered) {
-		filtered = filtered[:limit]
-	}
+// archiveKey identifies a stored flow record (same 5-tuple and receive time)
+type archiveKey struct {
+	flow       types.FlowKey
+	receivedAt int64
+}
 
-	return filtered
+func archiveKeyOf(f *types.Flow) archiveKey {
+	return archiveKey{f.FlowKey(), f.ReceivedAt.UnixNano()}
 }
 
-// compareIPs compares two IP addresses
-func compareIPs(a, b net.IP) int {
-	if a == nil && b == nil {
-		return 0
-	}
+// SetArchive attaches an on-disk archive; new flows are appended to it
+func (fs *FlowStore) SetArchive(a *Archive) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.archive = a
+}
+
+// GetArchiveStats returns archive statistics, ok is false if no archive is attached
+func (fs *FlowStore) GetArchiveStats() (ArchiveStats, bool) {
+	fs.mu.RLock()
+	a := fs.archive
+	fs.mu.RUnlock()
 	if a == nil {
-		return -1
-	}
-	if b == nil {
-		return 1
+		return ArchiveStats{}, false
 	}
-	aStr := a.String()
-	bStr := b.String()
-	if aStr < bStr {
-		return -1
-	}
-	if aStr > bStr {
-		return 1
-	}
-	return 0
+	return a.Stats(), true
+}
+
+// SetHistory attaches a SQLite history database; new flows are inserted into it
+func (fs *FlowStore) SetHistory(h *History) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.history = h
+}
+
+// History returns the attached history database, nil if disabled
+func (fs *FlowStore) History() *History {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.history
 }
 
 // GetRecent returns the most recent flows
@@ -951,14 +1141,33 @@ func (fs *FlowStore) GetStats() Stats {
 
 // GetFlowCount returns the current number of stored flows
 func (fs *FlowStore) GetFlowCount() int {
+	return int(fs.count.Load())
+}
+
+// GetMaxFlows returns the maximum number of flows that can be stored. With a
+// memory budget it is estimated from the current average flow size.
+func (fs *FlowStore) GetMaxFlows() int {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
-	return len(fs.flows)
+	return fs.flowLimit()
 }
 
-// GetMaxFlows returns the maximum number of flows that can be stored
-func (fs *FlowStore) GetMaxFlows() int {
-	return fs.maxFlows
+// GetMemoryUsage returns the estimated memory use of the stored flows in bytes
+func (fs *FlowStore) GetMemoryUsage() int64 {
+	return fs.memory.Load()
+}
+
+// ExpireFlows drops flows older than max-age and stores records held back for
+// a primary exporter that did not report them. Add does this as well; call it
+// periodically so it also happens while no flows arrive.
+func (fs *FlowStore) ExpireFlows() {
+	fs.mu.Lock()
+	if fs.dedup.enabled() {
+		fs.queuePersist(fs.releaseHeld(time.Now()))
+	}
+	fs.mu.Unlock()
+
+	fs.maintain()
 }
 
 // GetFilteredCount returns the count of flows matching a filter
@@ -967,15 +1176,10 @@ func (fs *FlowStore) GetFilteredCount(filter *Filter) int {
 		return fs.GetFlowCount()
 	}
 
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
 	count := 0
-	for i := range fs.flows {
-		if filter.Matches(&fs.flows[i]) {
-			count++
-		}
-	}
+	fs.forEachMatch(filter, func(*types.Flow) {
+		count++
+	})
 	return count
 }
 
@@ -988,17 +1192,12 @@ type FilteredStats struct {
 
 // GetFilteredStats returns count, bytes, and packets for flows matching a filter
 func (fs *FlowStore) GetFilteredStats(filter *Filter) FilteredStats {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
 	var stats FilteredStats
-	for i := range fs.flows {
-		if filter == nil || filter.IsEmpty() || filter.Matches(&fs.flows[i]) {
-			stats.Count++
-			stats.Bytes += fs.flows[i].Bytes
-			stats.Packets += fs.flows[i].Packets
-		}
-	}
+	fs.forEachMatch(filter, func(f *types.Flow) {
+		stats.Count++
+		stats.Bytes += f.Bytes
+		stats.Packets += f.Packets
+	})
 	return stats
 }
 
@@ -1011,43 +1210,52 @@ type SelfTrafficStats struct {
 
 // GetSelfTrafficStats returns stats for flows where source IP equals destination IP
 func (fs *FlowStore) GetSelfTrafficStats() SelfTrafficStats {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
 	var stats SelfTrafficStats
-	for i := range fs.flows {
-		if fs.flows[i].SrcAddr.Equal(fs.flows[i].DstAddr) {
+	fs.forEachMatch(nil, func(f *types.Flow) {
+		if f.SrcAddr == f.DstAddr {
 			stats.Count++
-			stats.Bytes += fs.flows[i].Bytes
-			stats.Packets += fs.flows[i].Packets
+			stats.Bytes += f.Bytes
+			stats.Packets += f.Packets
 		}
-	}
+	})
 	return stats
 }
 
 
 // Clear removes all flows
 func (fs *FlowStore) Clear() {
+	fs.maintMu.Lock()
+	defer fs.maintMu.Unlock()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	fs.flows = fs.flows[:0]
+	fs.replaceSegments([]*segment{newHeadSegment(fs.segmentCapacity)})
+	fs.count.Store(0)
+	fs.memory.Store(0)
+	fs.retained = nil
+	fs.hist = byteHistogram{}
 }
 
 // GetEvictionStats returns current eviction statistics
 func (fs *FlowStore) GetEvictionStats() EvictionStats {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
-	return fs.evictionStats
+	stats := fs.evictionStats
+	stats.Policies = slices.Clone(stats.Policies)
+	return stats
 }
 
 // GetEvictionConfig returns current eviction configuration
 func (fs *FlowStore) GetEvictionConfig() EvictionConfig {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.evictionConfig
 }
 
 // SetEvictionConfig updates eviction configuration
 func (fs *FlowStore) SetEvictionConfig(config EvictionConfig) {
+	fs.maintMu.Lock()
+	defer fs.maintMu.Unlock()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	fs.evictionConfig = config
@@ -1055,64 +1263,33 @@ func (fs *FlowStore) SetEvictionConfig(config EvictionConfig) {
 
 // MarkFlowAccessed marks a flow as recently accessed for LRU protection
 // flowKey is the FlowKey() of the flow to mark
-func (fs *FlowStore) MarkFlowAccessed(flowKey string) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-
-	now := time.Now()
-	for i := range fs.flows {
-		if fs.flows[i].FlowKey() == flowKey {
-			fs.flows[i].LastAccessed = now
-			break
-		}
-	}
+func (fs *FlowStore) MarkFlowAccessed(flowKey types.FlowKey) {
+	fs.MarkFlowsAccessed([]types.FlowKey{flowKey})
 }
 
 // MarkFlowsAccessed marks multiple flows as recently accessed
 // This is called when flows are displayed in the TUI
-func (fs *FlowStore) MarkFlowsAccessed(flowKeys []string) {
+func (fs *FlowStore) MarkFlowsAccessed(flowKeys []types.FlowKey) {
 	if len(flowKeys) == 0 {
 		return
 	}
 
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
-
-	keySet := make(map[string]bool, len(flowKeys))
-	for _, k := range flowKeys {
-		keySet[k] = true
-	}
+	fs.accessMu.Lock()
+	defer fs.accessMu.Unlock()
 
 	now := time.Now()
-	marked := 0
-	for i := range fs.flows {
-		if keySet[fs.flows[i].FlowKey()] {
-			fs.flows[i].LastAccessed = now
-			marked++
-			if marked >= len(flowKeys) {
-				break
-			}
-		}
+	for _, k := range flowKeys {
+		fs.accessed[k] = now
 	}
 }
 
 // QueryAggregatedFlows returns flows aggregated by 5-tuple (src, dst, sport, dport, proto)
 // Multiple flow exports for the same connection are merged into one entry
 func (fs *FlowStore) QueryAggregatedFlows(filter *Filter, sortBy SortField, ascending bool, limit int) []types.Flow {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
 	// Group flows by FlowKey (5-tuple)
-	flowMap := make(map[string]*types.Flow)
-
-	for i := range fs.flows {
-		flow := &fs.flows[i]
-
-		// Apply filter
-		if filter != nil && !filter.IsEmpty() && !filter.Matches(flow) {
-			continue
-		}
+	flowMap := make(map[types.FlowKey]*types.Flow)
 
+	fs.forEachMatch(filter, func(flow *types.Flow) {
 		key := flow.FlowKey()
 		if existing, ok := flowMap[key]; ok {
 			// Aggregate: sum bytes and packets
@@ -1126,9 +1303,14 @@ func (fs *FlowStore) QueryAggregatedFlows(filter *Filter, sortBy SortField, asce
 			if flow.EndTime.After(existing.EndTime) {
 				existing.EndTime = flow.EndTime
 			}
-			// Keep latest ReceivedAt (for sorting by time)
+			// Accumulate TCP flags so the derived state covers the whole connection
+			existing.TCPFlags |= flow.TCPFlags
+			// Keep latest ReceivedAt (for sorting by time) and the end reason of the latest record
 			if flow.ReceivedAt.After(existing.ReceivedAt) {
 				existing.ReceivedAt = flow.ReceivedAt
+				if flow.EndReason != types.EndReasonUnknown {
+					existing.EndReason = flow.EndReason
+				}
 			}
 			// Keep latest LastAccessed
 			if flow.LastAccessed.After(existing.LastAccessed) {
@@ -1139,7 +1321,7 @@ func (fs *FlowStore) QueryAggregatedFlows(filter *Filter, sortBy SortField, asce
 			flowCopy := *flow
 			flowMap[key] = &flowCopy
 		}
-	}
+	})
 
 	// Convert map to slice
 	flows := make([]types.Flow, 0, len(flowMap))
@@ -1158,9 +1340,9 @@ func (fs *FlowStore) QueryAggregatedFlows(filter *Filter, sortBy SortField, asce
 		case SortByPackets:
 			less = flows[i].Packets < flows[j].Packets
 		case SortBySrcIP:
-			less = compareIPs(flows[i].SrcAddr, flows[j].SrcAddr) < 0
+			less = flows[i].SrcAddr.Compare(flows[j].SrcAddr) < 0
 		case SortByDstIP:
-			less = compareIPs(flows[i].DstAddr, flows[j].DstAddr) < 0
+			less = flows[i].DstAddr.Compare(flows[j].DstAddr) < 0
 		case SortByProtocol:
 			less = flows[i].Protocol < flows[j].Protocol
 		default:
@@ -1182,56 +1364,35 @@ func (fs *FlowStore) QueryAggregatedFlows(filter *Filter, sortBy SortField, asce
 
 // QueryConversations groups flows into bidirectional conversations
 func (fs *FlowStore) QueryConversations(filter *Filter, sortBy SortField, ascending bool, limit int) []types.Conversation {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-
-	// Group flows by conversation key
-	convMap := make(map[string]*types.Conversation)
-
-	for i := range fs.flows {
-		flow := &fs.flows[i]
-
-		// Apply filter
-		if filter != nil && !filter.IsEmpty() && !filter.Matches(flow) {
-			continue
-		}
+	// Group flows by conversation key; the map points into conversations
+	var conversations []types.Conversation
+	convMap := make(map[types.ConversationKey]int)
 
+	fs.forEachMatch(filter, func(flow *types.Flow) {
 		key := flow.ConversationKey()
-		conv, exists := convMap[key]
+		i, exists := convMap[key]
 
 		if !exists {
-			// Determine A and B endpoints (A is lexicographically smaller)
-			src := fmt.Sprintf("%s:%d", flow.SrcAddr, flow.SrcPort)
-			dst := fmt.Sprintf("%s:%d", flow.DstAddr, flow.DstPort)
-
-			conv = &types.Conversation{
+			// The key already orders the endpoints (A is the smaller one)
+			i = len(conversations)
+			conversations = append(conversations, types.Conversation{
+				AddrA:      key.AddrA,
+				PortA:      key.PortA,
+				AddrB:      key.AddrB,
+				PortB:      key.PortB,
 				Protocol:   flow.Protocol,
 				FirstSeen:  flow.ReceivedAt,
 				LastSeen:   flow.ReceivedAt,
 				InputIf:    flow.InputIf,
 				OutputIf:   flow.OutputIf,
 				ExporterIP: flow.ExporterIP,
-			}
-
-			if src < dst {
-				conv.AddrA = flow.SrcAddr
-				conv.PortA = flow.SrcPort
-				conv.AddrB = flow.DstAddr
-				conv.PortB = flow.DstPort
-			} else {
-				conv.AddrA = flow.DstAddr
-				conv.PortA = flow.DstPort
-				conv.AddrB = flow.SrcAddr
-				conv.PortB = flow.SrcPort
-			}
-			convMap[key] = conv
+			})
+			convMap[key] = i
 		}
+		conv := &conversations[i]
 
 		// Determine direction and aggregate
-		src := fmt.Sprintf("%s:%d", flow.SrcAddr, flow.SrcPort)
-		convA := fmt.Sprintf("%s:%d", conv.AddrA, conv.PortA)
-
-		if src == convA {
+		if flow.IsForward() {
 			// A -> B direction
 			conv.BytesAtoB += flow.Bytes
 			conv.PacketsAtoB += flow.Packets
@@ -1250,13 +1411,7 @@ func (fs *FlowStore) QueryConversations(filter *Filter, sortBy SortField, ascend
 		if flow.ReceivedAt.After(conv.LastSeen) {
 			conv.LastSeen = flow.ReceivedAt
 		}
-	}
-
-	// Convert map to slice
-	conversations := make([]types.Conversation, 0, len(convMap))
-	for _, conv := range convMap {
-		conversations = append(conversations, *conv)
-	}
+	})
 
 	// Sort conversations
 	sort.Slice(conversations, func(i, j int) bool {
@@ -1269,9 +1424,9 @@ func (fs *FlowStore) QueryConversations(filter *Filter, sortBy SortField, ascend
 		case SortByPackets:
 			less = conversations[i].TotalPackets() < conversations[j].TotalPackets()
 		case SortBySrcIP:
-			less = compareIPs(conversations[i].AddrA, conversations[j].AddrA) < 0
+			less = conversations[i].AddrA.Compare(conversations[j].AddrA) < 0
 		case SortByDstIP:
-			less = compareIPs(conversations[i].AddrB, conversations[j].AddrB) < 0
+			less = conversations[i].AddrB.Compare(conversations[j].AddrB) < 0
 		case SortByProtocol:
 			less = conversations[i].Protocol < conversations[j].Protocol
 		default:
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAddWithConcurrentReaders(t *testing.T) {
+	const maxFlows = 20000
+	fs := New(maxFlows)
+	flows := generateFlows(100000, 1)
+	filter := ParseFilter("dport=443")
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for r := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := r; !stop.Load(); i++ {
+				switch i % 5 {
+				case 0:
+					fs.Query(&filter, SortByBytes, false, 10)
+				case 1:
+					fs.GetFilteredStats(&filter)
+				case 2:
+					fs.GetStats()
+					fs.GetEvictionStats()
+				case 3:
+					fs.QueryConversations(nil, SortByBytes, false, 10)
+				default:
+					page := fs.QueryAfter(nil, 0, 0)
+					for j := 1; j < len(page.Flows); j++ {
+						if page.Flows[j].Seq <= page.Flows[j-1].Seq {
+							t.Errorf("page not in sequence order at %d", j)
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < len(flows); i += 50 {
+		fs.Add(flows[i : i+50])
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	fs.maintain()
+	if n := fs.GetFlowCount(); n > maxFlows {
+		t.Errorf("store holds %d flows after maintenance, limit %d", n, maxFlows)
+	}
+	if n := fs.GetStats().TotalFlows; n != uint64(len(flows)) {
+		t.Errorf("TotalFlows = %d, want %d", n, len(flows))
+	}
+
+	var stored int64
+	for _, seg := range fs.snapshot().segments {
+		stored += int64(seg.len())
+	}
+	if stored != int64(fs.GetFlowCount()) {
+		t.Errorf("segments hold %d flows, count is %d", stored, fs.GetFlowCount())
+	}
+}
+
+func TestCloseArchivesAllFlows(t *testing.T) {
+	a := openTestArchive(t, ArchiveConfig{SegmentDuration: time.Minute})
+	flows := generateFlows(20000, 6)
+	fs := New(len(flows))
+	fs.SetArchive(a)
+
+	// The maintenance goroutine is blocked while the flows arrive, so they
+	// are still queued and it is still running when Close is called
+	fs.maintMu.Lock()
+	for i := 0; i < len(flows); i += 100 {
+		fs.Add(flows[i : i+100])
+	}
+	fs.maintMu.Unlock()
+	fs.Close()
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[uint64]bool)
+	for _, f := range readArchive(t, a, time.Time{}, time.Time{}) {
+		if seen[f.Seq] {
+			t.Fatalf("flow %d archived twice", f.Seq)
+		}
+		seen[f.Seq] = true
+	}
+	if len(seen) != len(flows) {
+		t.Errorf("%d of %d flows archived", len(seen), len(flows))
+	}
+
+	// No maintenance is scheduled after Close
+	fs.Add(generateFlows(100, 7))
+	fs.persistMu.Lock()
+	running, queued := fs.maintRunning, len(fs.toPersist)
+	fs.persistMu.Unlock()
+	if running || queued != 100 {
+		t.Errorf("after Close: maintenance running %v, %d flows queued", running, queued)
+	}
+}
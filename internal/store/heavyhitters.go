@@ -0,0 +1,573 @@
+package store
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Heavy hitters are the largest sources, destinations, conversations, ports and
+// ASes by bytes over sliding windows. They are counted from every added flow
+// with Space-Saving sketches, so they stay correct after the flows themselves
+// were evicted, in memory bounded by the sketch capacity.
+//
+// Each window consists of heavyHitterSlots completed slots plus the running
+// one. Flows are counted into the slots of the finest window; completed slots
+// are merged into the running slot of the next coarser window, like the rollup
+// tiers. The slot lengths of the default windows divide each other.
+
+// HeavyHitterWindow is one sliding window of the heavy-hitter sketches
+type HeavyHitterWindow struct {
+	Name   string
+	Length time.Duration
+}
+
+// DefaultHeavyHitterWindows are ordered from short to long
+var DefaultHeavyHitterWindows = []HeavyHitterWindow{
+	{Name: "1m", Length: time.Minute},
+	{Name: "5m", Length: 5 * time.Minute},
+	{Name: "15m", Length: 15 * time.Minute},
+	{Name: "1h", Length: time.Hour},
+}
+
+// HeavyHitterDimensions lists what heavy hitters are counted by
+var HeavyHitterDimensions = []string{"src", "dst", "conversation", "port", "as"}
+
+const (
+	// HeavyHitterCapacity is the number of counters per sketch. A key's bytes
+	// are overestimated by at most the traffic of a slot divided by the capacity.
+	HeavyHitterCapacity = 512
+
+	// heavyHitterSlots is the number of completed slots per window; the running
+	// slot extends a window by up to one slot length
+	heavyHitterSlots = 6
+)
+
+// Sketch dimensions, indexes into HeavyHitterDimensions
+const (
+	dimSrc = iota
+	dimDst
+	dimConversation
+	dimPort
+	dimAS
+	numDims
+)
+
+// hitterKey identifies a heavy hitter; only the fields of its dimension are
+// set. Addresses are kept in 16-byte form and the struct has no padding, so
+// hashing it is a single pass over its memory.
+type hitterKey struct {
+	as           uint32
+	addrA, addrB [16]byte
+	portA, portB uint16
+	proto        uint16
+	ipv4         uint16 // Bit 0: addrA is IPv4, bit 1: addrB is IPv4
+}
+
+func (k *hitterKey) setAddrs(a, b netip.Addr) {
+	k.addrA, k.addrB = a.As16(), b.As16()
+	if a.Is4() {
+		k.ipv4 |= 1
+	}
+	if b.Is4() {
+		k.ipv4 |= 2
+	}
+}
+
+func (k hitterKey) addrs() (a, b netip.Addr) {
+	a, b = netip.AddrFrom16(k.addrA), netip.AddrFrom16(k.addrB)
+	if k.ipv4&1 != 0 {
+		a = a.Unmap()
+	}
+	if k.ipv4&2 != 0 {
+		b = b.Unmap()
+	}
+	return a, b
+}
+
+// hitterEntry is one Space-Saving counter
+type hitterEntry struct {
+	key     hitterKey
+	bytes   uint64 // Estimated bytes, never below the true count
+	err     uint64 // Maximum overestimation of bytes
+	packets uint64 // Counted since the key entered the sketch
+	flows   uint64
+	pos     int32 // Position in the heap
+}
+
+// Count-Min sketch dimensions: 4 rows of 1024 counters (32 KB)
+const (
+	cmDepth = 4
+	cmWidth = 1024
+)
+
+// hitterSeed is shared by all sketches, so Count-Min sketches can be merged
+var hitterSeed = maphash.MakeSeed()
+
+func hitterHash(key hitterKey) uint64 {
+	return maphash.Comparable(hitterSeed, key)
+}
+
+// countMin estimates the bytes of any key, never below the true count. Uses
+// conservative update: only the counters at the current estimate grow.
+type countMin [cmDepth][cmWidth]uint64
+
+// cells returns the counter of each row for a key hash. Double hashing: row i
+// uses h1 + i*h2.
+func (c *countMin) cells(h uint64) [cmDepth]*uint64 {
+	h1, h2 := uint32(h), uint32(h>>32)|1
+	var cells [cmDepth]*uint64
+	for row := range c {
+		cells[row] = &c[row][(h1+uint32(row)*h2)%cmWidth]
+	}
+	return cells
+}
+
+// add counts bytes for a key and returns its new estimate
+func (c *countMin) add(h, bytes uint64) uint64 {
+	cells := c.cells(h)
+	est := uint64(math.MaxUint64)
+	for _, cell := range cells {
+		est = min(est, *cell)
+	}
+	est += bytes
+	for _, cell := range cells {
+		*cell = max(*cell, est)
+	}
+	return est
+}
+
+func (c *countMin) estimate(h uint64) uint64 {
+	est := uint64(math.MaxUint64)
+	for _, cell := range c.cells(h) {
+		est = min(est, *cell)
+	}
+	return est
+}
+
+func (c *countMin) merge(other *countMin) {
+	for row := range c {
+		for i := range c[row] {
+			c[row][i] += other[row][i]
+		}
+	}
+}
+
+// spaceSaving keeps the heaviest keys by bytes in a fixed number of counters
+// (Filtered Space-Saving): all traffic is counted in a Count-Min sketch, and a
+// key only replaces the smallest counter once its estimate exceeds it. Small
+// keys thus don't churn the counters.
+type spaceSaving struct {
+	cm      countMin
+	entries []hitterEntry       // Counters; an entry keeps its place when its key is replaced
+	heap    []int32             // Entry indexes, min-heap by bytes
+	index   map[hitterKey]int32 // Entry index of each key
+}
+
+func newSpaceSaving() *spaceSaving {
+	return &spaceSaving{index: make(map[hitterKey]int32)}
+}
+
+// add counts traffic for a key
+func (s *spaceSaving) add(key hitterKey, bytes, packets, flows uint64) {
+	h := hitterHash(key)
+	est := s.cm.add(h, bytes)
+	s.admit(key, est, bytes, 0, packets, flows)
+}
+
+// merge adds the counters of another sketch
+func (s *spaceSaving) merge(other *spaceSaving) {
+	// Keys the other sketch has no counter for may still have traffic there,
+	// known only from its Count-Min estimate
+	for i := range s.entries {
+		e := &s.entries[i]
+		if _, ok := other.index[e.key]; !ok {
+			if est := other.cm.estimate(hitterHash(e.key)); est > 0 {
+				e.bytes += est
+				e.err += est
+				s.down(int(e.pos))
+			}
+		}
+	}
+
+	s.cm.merge(&other.cm)
+	for _, e := range other.entries {
+		s.admit(e.key, s.cm.estimate(hitterHash(e.key)), e.bytes, e.err, e.packets, e.flows)
+	}
+}
+
+// admit counts traffic already in the Count-Min sketch into the counters; est
+// is the key's estimate including it, err the error the traffic carries
+func (s *spaceSaving) admit(key hitterKey, est, bytes, err, packets, flows uint64) {
+	if i, ok := s.index[key]; ok {
+		e := &s.entries[i]
+		e.bytes += bytes
+		e.err += err
+		e.packets += packets
+		e.flows += flows
+		s.down(int(e.pos))
+		return
+	}
+
+	if len(s.entries) < HeavyHitterCapacity {
+		i := int32(len(s.entries))
+		s.entries = append(s.entries, hitterEntry{key: key, bytes: bytes, err: err, packets: packets, flows: flows, pos: i})
+		s.heap = append(s.heap, i)
+		s.index[key] = i
+		s.up(int(i))
+		return
+	}
+
+	// Replace the smallest counter if the key is larger. Traffic before this
+	// is only known from the Count-Min estimate, so it counts as error.
+	i := s.heap[0]
+	e := &s.entries[i]
+	if est <= e.bytes {
+		return
+	}
+	delete(s.index, e.key)
+	*e = hitterEntry{key: key, bytes: est, err: est - (bytes - err), packets: packets, flows: flows}
+	s.index[key] = i
+	s.down(0)
+}
+
+func (s *spaceSaving) less(i, j int) bool {
+	return s.entries[s.heap[i]].bytes < s.entries[s.heap[j]].bytes
+}
+
+func (s *spaceSaving) swap(i, j int) {
+	s.heap[i], s.heap[j] = s.heap[j], s.heap[i]
+	s.entries[s.heap[i]].pos = int32(i)
+	s.entries[s.heap[j]].pos = int32(j)
+}
+
+func (s *spaceSaving) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !s.less(i, parent) {
+			return
+		}
+		s.swap(i, parent)
+		i = parent
+	}
+}
+
+// down restores the heap after the counter at heap position i grew
+func (s *spaceSaving) down(i int) {
+	n := len(s.heap)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && s.less(l, smallest) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && s.less(r, smallest) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		s.swap(i, smallest)
+		i = smallest
+	}
+}
+
+// hitterSlot holds the sketches of one time slot
+type hitterSlot struct {
+	start    time.Time
+	total    RollupCounters // Exact traffic of the slot
+	sketches [numDims]*spaceSaving
+}
+
+func newHitterSlot(start time.Time) *hitterSlot {
+	slot := &hitterSlot{start: start}
+	for d := range slot.sketches {
+		slot.sketches[d] = newSpaceSaving()
+	}
+	return slot
+}
+
+// add counts a flow into all dimensions
+func (s *hitterSlot) add(flow *types.Flow) {
+	flows := uint64(1)
+	if flow.FlowCount > 1 {
+		flows = uint64(flow.FlowCount) // NetFlow v8 aggregates
+	}
+	s.total.add(RollupCounters{Bytes: flow.Bytes, Packets: flow.Packets, Flows: flows})
+
+	var src, dst, conv hitterKey
+	src.setAddrs(flow.SrcAddr, netip.Addr{})
+	dst.setAddrs(flow.DstAddr, netip.Addr{})
+	s.sketches[dimSrc].add(src, flow.Bytes, flow.Packets, flows)
+	s.sketches[dimDst].add(dst, flow.Bytes, flow.Packets, flows)
+
+	c := flow.ConversationKey()
+	conv.setAddrs(c.AddrA, c.AddrB)
+	conv.portA, conv.portB, conv.proto = c.PortA, c.PortB, uint16(c.Protocol)
+	s.sketches[dimConversation].add(conv, flow.Bytes, flow.Packets, flows)
+
+	// Destination port as the service, like the services page
+	s.sketches[dimPort].add(hitterKey{portA: flow.DstPort, proto: uint16(flow.Protocol)}, flow.Bytes, flow.Packets, flows)
+
+	// Traffic counts for both ASes it touches; AS 0 means unknown
+	if flow.SrcAS != 0 {
+		s.sketches[dimAS].add(hitterKey{as: flow.SrcAS}, flow.Bytes, flow.Packets, flows)
+	}
+	if flow.DstAS != 0 && flow.DstAS != flow.SrcAS {
+		s.sketches[dimAS].add(hitterKey{as: flow.DstAS}, flow.Bytes, flow.Packets, flows)
+	}
+}
+
+// merge adds the counters of another slot
+func (s *hitterSlot) merge(other *hitterSlot) {
+	s.total.add(other.total)
+	for d, sketch := range other.sketches {
+		s.sketches[d].merge(sketch)
+	}
+}
+
+// hitterWindow holds the slots of one window, oldest first. The last slot is the
+// running one.
+type hitterWindow struct {
+	HeavyHitterWindow
+	slotLength time.Duration
+	slots      []*hitterSlot
+}
+
+// running returns the slot for ts, creating it if ts is past the running slot.
+// The completed slot, if any, is returned too.
+func (w *hitterWindow) running(ts time.Time) (running, completed *hitterSlot) {
+	start := ts.Truncate(w.slotLength)
+	if n := len(w.slots); n > 0 {
+		last := w.slots[n-1]
+		if !start.After(last.start) {
+			// Late flows are counted into the running slot
+			return last, nil
+		}
+		completed = last
+	}
+
+	running = newHitterSlot(start)
+	w.slots = append(w.slots, running)
+
+	// Drop slots that left the window
+	cutoff := start.Add(-heavyHitterSlots * w.slotLength)
+	n := 0
+	for n < len(w.slots) && w.slots[n].start.Before(cutoff) {
+		n++
+	}
+	if n > 0 {
+		w.slots = append(w.slots[:0], w.slots[n:]...)
+	}
+	return running, completed
+}
+
+// heavyHitters maintains the heavy-hitter sketches of all windows. Has its own
+// lock so queries don't hold up the rest of the ingest path.
+type heavyHitters struct {
+	mu      sync.Mutex
+	windows []*hitterWindow
+}
+
+func newHeavyHitters(windows []HeavyHitterWindow) *heavyHitters {
+	h := &heavyHitters{}
+	for _, w := range windows {
+		h.windows = append(h.windows, &hitterWindow{
+			HeavyHitterWindow: w,
+			slotLength:        w.Length / heavyHitterSlots,
+		})
+	}
+	return h
+}
+
+// add counts a flow into the running slot of the finest window
+func (h *heavyHitters) add(flow *types.Flow) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.advance(0, flow.ReceivedAt).add(flow)
+}
+
+// advance returns the running slot of window i for ts. A slot completed by
+// moving on is merged into the next window, which may complete a slot there.
+// Must be called with h.mu held.
+func (h *heavyHitters) advance(i int, ts time.Time) *hitterSlot {
+	running, completed := h.windows[i].running(ts)
+	if completed != nil && i+1 < len(h.windows) {
+		h.advance(i+1, completed.start).merge(completed)
+	}
+	return running
+}
+
+// HeavyHitter is one heavy hitter of a window
+type HeavyHitter struct {
+	Key      string     // Display form, e.g. "10.0.0.1", "443/TCP", "AS64500"
+	Filter   string     // Filter expression for the flows of this key, empty if none
+	Addr     netip.Addr // Address for the src and dst dimensions
+	Port     uint16     // Port and protocol for the port dimension
+	Protocol uint8
+
+	Bytes   uint64 // Estimated bytes, an upper bound
+	Error   uint64 // Maximum overestimation: the true bytes are in [Bytes-Error, Bytes]
+	Packets uint64 // Lower bounds, counted while the key was in the sketches
+	Flows   uint64
+	Share   float64 // Bytes in percent of the window's total
+}
+
+// HeavyHitterResult is the answer to QueryHeavyHitters
+type HeavyHitterResult struct {
+	Dimension string
+	Window    string
+	Since     time.Time      // Start of the covered range; the running slot extends the window
+	Total     RollupCounters // Exact traffic in the range
+	Hitters   []HeavyHitter  // Largest first
+}
+
+// hitterMerge accumulates one key over several slots
+type hitterMerge struct {
+	key            hitterKey
+	bytes, lower   uint64
+	packets, flows uint64
+}
+
+// QueryHeavyHitters returns the largest keys of a dimension (HeavyHitterDimensions)
+// by bytes in a window (DefaultHeavyHitterWindows), limit 0 for all tracked keys
+func (fs *FlowStore) QueryHeavyHitters(dimension, window string, limit int) (HeavyHitterResult, error) {
+	dim := -1
+	for d, name := range HeavyHitterDimensions {
+		if name == dimension {
+			dim = d
+		}
+	}
+	if dim < 0 {
+		return HeavyHitterResult{}, fmt.Errorf("unknown dimension %q (valid: %s)", dimension, strings.Join(HeavyHitterDimensions, ", "))
+	}
+
+	h := fs.hitters
+	w := -1
+	var names []string
+	for i, hw := range h.windows {
+		names = append(names, hw.Name)
+		if hw.Name == window {
+			w = i
+		}
+	}
+	if w < 0 {
+		return HeavyHitterResult{}, fmt.Errorf("unknown window %q (valid: %s)", window, strings.Join(names, ", "))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Move all windows to now, so idle periods leave the windows too
+	now := time.Now()
+	for i := range h.windows {
+		h.advance(i, now)
+	}
+
+	// The window's slots, plus the running slots of the finer windows that are
+	// not merged into it yet
+	slots := append([]*hitterSlot(nil), h.windows[w].slots...)
+	for i := 0; i < w; i++ {
+		slots = append(slots, h.windows[i].slots[len(h.windows[i].slots)-1])
+	}
+
+	result := HeavyHitterResult{
+		Dimension: dimension,
+		Window:    window,
+		Since:     h.windows[w].slots[0].start,
+	}
+
+	merged := make(map[hitterKey]*hitterMerge)
+	for _, slot := range slots {
+		result.Total.add(slot.total)
+		for _, e := range slot.sketches[dim].entries {
+			if merged[e.key] == nil {
+				merged[e.key] = &hitterMerge{key: e.key}
+			}
+		}
+	}
+
+	list := make([]*hitterMerge, 0, len(merged))
+	for _, m := range merged {
+		h := hitterHash(m.key)
+		for _, slot := range slots {
+			sketch := slot.sketches[dim]
+			i, ok := sketch.index[m.key]
+			if !ok {
+				// The slot may have seen the key without keeping a counter
+				m.bytes += sketch.cm.estimate(h)
+				continue
+			}
+			e := &sketch.entries[i]
+			m.bytes += e.bytes
+			m.lower += e.bytes - e.err
+			m.packets += e.packets
+			m.flows += e.flows
+		}
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].bytes > list[j].bytes
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+
+	result.Hitters = make([]HeavyHitter, len(list))
+	for i, m := range list {
+		hitter := HeavyHitter{
+			Bytes:   m.bytes,
+			Error:   m.bytes - m.lower,
+			Packets: m.packets,
+			Flows:   m.flows,
+		}
+		hitter.Key, hitter.Filter = m.key.label(dim)
+		switch dim {
+		case dimSrc, dimDst:
+			hitter.Addr, _ = m.key.addrs()
+		case dimPort:
+			hitter.Port, hitter.Protocol = m.key.portA, uint8(m.key.proto)
+		}
+		if result.Total.Bytes > 0 {
+			hitter.Share = float64(m.bytes) / float64(result.Total.Bytes) * 100
+		}
+		result.Hitters[i] = hitter
+	}
+	return result, nil
+}
+
+// label returns the display form and the filter expression of a key
+func (k hitterKey) label(dim int) (string, string) {
+	a, b := k.addrs()
+	protocol := (&types.Flow{Protocol: uint8(k.proto)}).ProtocolName()
+	switch dim {
+	case dimSrc:
+		return a.String(), "src=" + a.String()
+	case dimDst:
+		return a.String(), "dst=" + a.String()
+	case dimConversation:
+		return fmt.Sprintf("%s ↔ %s %s", netip.AddrPortFrom(a, k.portA), netip.AddrPortFrom(b, k.portB), protocol),
+			fmt.Sprintf("ip=%s && ip=%s && port=%d && port=%d", a, b, k.portA, k.portB) + protocolCondition(protocol)
+	case dimPort:
+		return fmt.Sprintf("%d/%s", k.portA, protocol), fmt.Sprintf("dport=%d", k.portA) + protocolCondition(protocol)
+	case dimAS:
+		return fmt.Sprintf("AS%d", k.as), ""
+	}
+	return "", ""
+}
+
+// protocolCondition returns " && proto=name" if the filter knows the protocol
+func protocolCondition(name string) string {
+	cond := "proto=" + strings.ToLower(name)
+	if f := ParseFilter(cond); !f.IsValid() {
+		return ""
+	}
+	return " && " + cond
+}
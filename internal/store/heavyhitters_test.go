@@ -0,0 +1,331 @@
+package store
+
+import (
+	"cmp"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// zipfStream returns n records over keys skewed like real traffic, key 0 the
+// largest, and the true bytes per key
+func zipfStream(n int, keys uint64, seed int64) ([]hitterKey, map[hitterKey]uint64) {
+	rng := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(rng, 1.1, 1, keys-1)
+	stream := make([]hitterKey, n)
+	truth := make(map[hitterKey]uint64)
+	for i := range stream {
+		stream[i] = hitterKey{as: uint32(zipf.Uint64())}
+		truth[stream[i]] += 1000
+	}
+	return stream, truth
+}
+
+// topKeys returns the n keys with the most bytes
+func topKeys(truth map[hitterKey]uint64, n int) []hitterKey {
+	keys := make([]hitterKey, 0, len(truth))
+	for k := range truth {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b hitterKey) int {
+		if c := cmp.Compare(truth[b], truth[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.as, b.as)
+	})
+	return keys[:min(n, len(keys))]
+}
+
+// checkSketchBounds checks that every counter brackets the true bytes
+func checkSketchBounds(t *testing.T, s *spaceSaving, truth map[hitterKey]uint64) {
+	t.Helper()
+	for _, e := range s.entries {
+		if want := truth[e.key]; e.bytes < want || e.bytes-e.err > want {
+			t.Errorf("AS%d: %d bytes (error %d), true %d", e.key.as, e.bytes, e.err, want)
+		}
+		if e.packets > truth[e.key]/1000 {
+			t.Errorf("AS%d: %d packets, true %d", e.key.as, e.packets, truth[e.key]/1000)
+		}
+	}
+}
+
+func TestCountMin(t *testing.T) {
+	stream, truth := zipfStream(100000, 20000, 1)
+	var a, b countMin
+	var total uint64
+	for i, k := range stream {
+		if i%2 == 0 {
+			a.add(hitterHash(k), 1000)
+		} else {
+			b.add(hitterHash(k), 1000)
+		}
+		total += 1000
+	}
+	a.merge(&b)
+
+	// Never below the true count; the overestimate averages well below the
+	// Count-Min bound of total/width per row
+	var over uint64
+	for k, want := range truth {
+		est := a.estimate(hitterHash(k))
+		if est < want {
+			t.Fatalf("AS%d: estimate %d below true %d", k.as, est, want)
+		}
+		over += est - want
+	}
+	if avg := over / uint64(len(truth)); avg > total/cmWidth/4 {
+		t.Errorf("average overestimate %d, more than a quarter of the bound %d", avg, total/cmWidth)
+	}
+
+	var empty countMin
+	if est := empty.estimate(hitterHash(stream[0])); est != 0 {
+		t.Errorf("empty sketch estimates %d", est)
+	}
+}
+
+func TestSpaceSavingTopN(t *testing.T) {
+	stream, truth := zipfStream(200000, 50000, 2)
+	s := newSpaceSaving()
+	for _, k := range stream {
+		s.add(k, 1000, 1, 1)
+	}
+	if len(s.entries) != HeavyHitterCapacity || len(truth) <= HeavyHitterCapacity {
+		t.Fatalf("%d counters for %d keys", len(s.entries), len(truth))
+	}
+	checkSketchBounds(t, s, truth)
+
+	// The heaviest keys all have a counter, the largest ones in order of the
+	// bytes they are guaranteed. (A key replacing a counter late may collide
+	// with heavy keys in all Count-Min rows and carry a large error.)
+	var got []hitterKey
+	for _, e := range s.entries {
+		got = append(got, e.key)
+	}
+	lower := func(k hitterKey) uint64 {
+		e := s.entries[s.index[k]]
+		return e.bytes - e.err
+	}
+	slices.SortFunc(got, func(a, b hitterKey) int {
+		return cmp.Compare(lower(b), lower(a))
+	})
+	if want := topKeys(truth, 10); !slices.Equal(got[:10], want) {
+		t.Errorf("top 10 %v, want %v", got[:10], want)
+	}
+	for _, k := range topKeys(truth, 50) {
+		if _, ok := s.index[k]; !ok {
+			t.Errorf("AS%d (%d bytes) has no counter", k.as, truth[k])
+		}
+	}
+
+	// The heap keeps the smallest counter on top
+	for _, e := range s.entries {
+		if e.bytes < s.entries[s.heap[0]].bytes {
+			t.Fatalf("counter of %d bytes below the heap top %d", e.bytes, s.entries[s.heap[0]].bytes)
+		}
+	}
+}
+
+func TestSpaceSavingMerge(t *testing.T) {
+	// Below capacity, merging is exact
+	a, b := newSpaceSaving(), newSpaceSaving()
+	a.add(hitterKey{as: 1}, 100, 1, 1)
+	a.add(hitterKey{as: 2}, 50, 1, 1)
+	b.add(hitterKey{as: 1}, 10, 2, 1)
+	b.add(hitterKey{as: 3}, 70, 1, 1)
+	a.merge(b)
+	for as, want := range map[uint32]hitterEntry{
+		1: {bytes: 110, packets: 3, flows: 2},
+		2: {bytes: 50, packets: 1, flows: 1},
+		3: {bytes: 70, packets: 1, flows: 1},
+	} {
+		i, ok := a.index[hitterKey{as: as}]
+		if !ok {
+			t.Errorf("AS%d missing after merge", as)
+			continue
+		}
+		if e := a.entries[i]; e.bytes != want.bytes || e.err != 0 || e.packets != want.packets || e.flows != want.flows {
+			t.Errorf("AS%d: %+v", as, e)
+		}
+	}
+
+	// Full sketches with different heavy keys: the merged sketch finds the
+	// heaviest keys of both and its counters still bracket the true bytes
+	first, truth := zipfStream(100000, 20000, 3)
+	second, truthB := zipfStream(100000, 20000, 4)
+	for i := range second {
+		second[i].as += 10000 // Heavy keys of the second half are others
+	}
+	for k, n := range truthB {
+		truth[hitterKey{as: k.as + 10000}] += n
+	}
+	a, b = newSpaceSaving(), newSpaceSaving()
+	for _, k := range first {
+		a.add(k, 1000, 1, 1)
+	}
+	for _, k := range second {
+		b.add(k, 1000, 1, 1)
+	}
+	a.merge(b)
+
+	checkSketchBounds(t, a, truth)
+	for _, k := range topKeys(truth, 20) {
+		if _, ok := a.index[k]; !ok {
+			t.Errorf("AS%d (%d bytes) has no counter after merge", k.as, truth[k])
+		}
+	}
+	if len(a.index) != len(a.entries) || len(a.heap) != len(a.entries) {
+		t.Errorf("%d entries, %d indexed, heap %d", len(a.entries), len(a.index), len(a.heap))
+	}
+}
+
+// hitterFlow returns a flow of bytes from src to dst on dport, received at
+func hitterFlow(src, dst string, dport uint16, bytes uint64, at time.Time) types.Flow {
+	return types.Flow{
+		SrcAddr:    netip.MustParseAddr(src),
+		DstAddr:    netip.MustParseAddr(dst),
+		SrcPort:    40000,
+		DstPort:    dport,
+		Protocol:   6,
+		Bytes:      bytes,
+		Packets:    bytes / 1000,
+		ReceivedAt: at,
+	}
+}
+
+func TestHeavyHitterWindows(t *testing.T) {
+	fs := New(1000)
+	now := time.Now()
+	fs.Add([]types.Flow{hitterFlow("10.0.0.1", "198.51.100.1", 443, 10_000_000, now.Add(-50*time.Minute))})
+	fs.Add([]types.Flow{hitterFlow("10.0.0.2", "198.51.100.1", 443, 5_000_000, now.Add(-10*time.Minute))})
+	fs.Add([]types.Flow{hitterFlow("10.0.0.3", "198.51.100.1", 443, 1_000_000, now.Add(-30*time.Second))})
+
+	// Flows leave the windows as slots complete and are merged into the
+	// coarser windows
+	for _, tc := range []struct {
+		window string
+		length time.Duration
+		want   []string
+	}{
+		{"1m", time.Minute, []string{"10.0.0.3"}},
+		{"5m", 5 * time.Minute, []string{"10.0.0.3"}},
+		{"15m", 15 * time.Minute, []string{"10.0.0.2", "10.0.0.3"}},
+		{"1h", time.Hour, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+	} {
+		result, err := fs.QueryHeavyHitters("src", tc.window, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		var total uint64
+		for _, h := range result.Hitters {
+			got = append(got, h.Key)
+			total += h.Bytes
+			if h.Error != 0 {
+				t.Errorf("%s: %s has error %d", tc.window, h.Key, h.Error)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: hitters %v, want %v", tc.window, got, tc.want)
+		}
+		if result.Total.Bytes != total || result.Total.Flows != uint64(len(tc.want)) {
+			t.Errorf("%s: total %+v, hitters sum to %d bytes", tc.window, result.Total, total)
+		}
+		if earliest := now.Add(-tc.length - tc.length/heavyHitterSlots); result.Since.Before(earliest) {
+			t.Errorf("%s: window since %v, before %v", tc.window, result.Since, earliest)
+		}
+	}
+
+	// Without new flows, old traffic leaves the windows too
+	idle := New(1000)
+	idle.Add([]types.Flow{hitterFlow("10.0.0.1", "198.51.100.1", 443, 1000, now.Add(-2*time.Hour))})
+	for _, w := range DefaultHeavyHitterWindows {
+		if result, _ := idle.QueryHeavyHitters("src", w.Name, 0); len(result.Hitters) != 0 || result.Total.Bytes != 0 {
+			t.Errorf("%s after two idle hours: %+v", w.Name, result)
+		}
+	}
+}
+
+func TestHeavyHitterDimensions(t *testing.T) {
+	fs := New(1000)
+	now := time.Now()
+	request := hitterFlow("10.0.0.1", "10.0.0.2", 443, 3000, now)
+	request.SrcAS, request.DstAS = 64500, 64501
+	response := hitterFlow("10.0.0.2", "10.0.0.1", 40000, 1000, now)
+	response.SrcPort = 443
+	response.SrcAS, response.DstAS = 64501, 64500
+	dns := hitterFlow("10.0.0.3", "10.0.0.2", 53, 500, now)
+	dns.Protocol = 17
+	dns.SrcAS, dns.DstAS = 64500, 64500
+	fs.Add([]types.Flow{request, response, dns})
+
+	type hitter struct {
+		key    string
+		filter string
+		bytes  uint64
+		flows  uint64
+	}
+	for dim, want := range map[string][]hitter{
+		"src": {{"10.0.0.1", "src=10.0.0.1", 3000, 1}, {"10.0.0.2", "src=10.0.0.2", 1000, 1}, {"10.0.0.3", "src=10.0.0.3", 500, 1}},
+		"dst": {{"10.0.0.2", "dst=10.0.0.2", 3500, 2}, {"10.0.0.1", "dst=10.0.0.1", 1000, 1}},
+		"port": {{"443/TCP", "dport=443 && proto=tcp", 3000, 1}, {"40000/TCP", "dport=40000 && proto=tcp", 1000, 1},
+			{"53/UDP", "dport=53 && proto=udp", 500, 1}},
+		"as": {{"AS64500", "", 4500, 3}, {"AS64501", "", 4000, 2}}, // Both ASes of a flow, once each
+	} {
+		result, err := fs.QueryHeavyHitters(dim, "1m", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []hitter
+		for _, h := range result.Hitters {
+			got = append(got, hitter{h.Key, h.Filter, h.Bytes, h.Flows})
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: %+v, want %+v", dim, got, want)
+		}
+	}
+
+	// Both directions are one conversation
+	result, _ := fs.QueryHeavyHitters("conversation", "1m", 1)
+	if len(result.Hitters) != 1 || result.Hitters[0].Bytes != 4000 || result.Hitters[0].Flows != 2 {
+		t.Fatalf("top conversation %+v", result.Hitters)
+	}
+	h := result.Hitters[0]
+	filter := ParseFilter(h.Filter)
+	if h.Share != 4000.0/4500*100 || !filter.Matches(&request) || !filter.Matches(&response) || filter.Matches(&dns) {
+		t.Errorf("conversation %+v", h)
+	}
+
+	if _, err := fs.QueryHeavyHitters("host", "1m", 0); err == nil {
+		t.Error("unknown dimension: no error")
+	}
+	if _, err := fs.QueryHeavyHitters("src", "2m", 0); err == nil {
+		t.Error("unknown window: no error")
+	}
+}
+
+// BenchmarkHeavyHittersAdd feeds flows into the sketches of all windows
+func BenchmarkHeavyHittersAdd(b *testing.B) {
+	h := newHeavyHitters(DefaultHeavyHitterWindows)
+	flows := generateFlows(100000, 1)
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		h.add(&flows[i])
+		i = (i + 1) % len(flows)
+	}
+}
+
+func BenchmarkQueryHeavyHitters(b *testing.B) {
+	fs := benchStore(b)
+	for _, dim := range []string{"src", "conversation"} {
+		b.Run(dim, func(b *testing.B) {
+			for b.Loop() {
+				fs.QueryHeavyHitters(dim, "1h", 50)
+			}
+		})
+	}
+}
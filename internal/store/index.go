@@ -0,0 +1,421 @@
+package store
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Secondary indexes map a key (address prefix, port, protocol, ...) to the
+// positions of the matching flows within one sealed segment. Segments never
+// change after sealing, so every index is built once and posting lists are
+// sorted by construction; eviction simply drops a segment with its index.
+
+// Prefix lengths indexed for IPv4 and IPv6 addresses. A CIDR condition uses the
+// longest indexed prefix that covers the network.
+var (
+	v4IndexBits = []int{8, 16, 24, 32}
+	v6IndexBits = []int{16, 32, 48, 64, 128}
+)
+
+// plannerMaxFraction is the share of all flows above which a full scan is cheaper
+// than following an index
+const plannerMaxFraction = 0.5
+
+// prefixKey is an address prefix in 16-byte form (IPv4 as IPv4-mapped, bits
+// including the 96-bit mapping prefix). Smaller than netip.Prefix, which matters
+// for the host-level keys that exist roughly once per flow.
+type prefixKey struct {
+	addr [16]byte
+	bits uint8
+}
+
+func makePrefixKey(p netip.Prefix) prefixKey {
+	bits := p.Bits()
+	if p.Addr().Is4() {
+		bits += 96
+	}
+	return prefixKey{addr: p.Addr().As16(), bits: uint8(bits)}
+}
+
+// postingIndex maps keys to sorted lists of flow positions within a segment
+type postingIndex[K comparable] map[K][]int32
+
+func (ix postingIndex[K]) add(key K, pos int32) {
+	ix[key] = append(ix[key], pos)
+}
+
+// flowIndex holds the secondary indexes of one sealed segment. Read-only once built.
+type flowIndex struct {
+	src      postingIndex[prefixKey]
+	dst      postingIndex[prefixKey]
+	srcPort  postingIndex[uint16]
+	dstPort  postingIndex[uint16]
+	protocol postingIndex[uint8]
+	inIf     postingIndex[uint16]
+	outIf    postingIndex[uint16]
+	exporter postingIndex[netip.Addr]
+	minute   postingIndex[int64] // ReceivedAt in Unix minutes
+}
+
+func newFlowIndex() *flowIndex {
+	return &flowIndex{
+		src:      make(postingIndex[prefixKey]),
+		dst:      make(postingIndex[prefixKey]),
+		srcPort:  make(postingIndex[uint16]),
+		dstPort:  make(postingIndex[uint16]),
+		protocol: make(postingIndex[uint8]),
+		inIf:     make(postingIndex[uint16]),
+		outIf:    make(postingIndex[uint16]),
+		exporter: make(postingIndex[netip.Addr]),
+		minute:   make(postingIndex[int64]),
+	}
+}
+
+// indexBits returns the indexed prefix lengths for an address family
+func indexBits(ip netip.Addr) []int {
+	if ip.Is4() {
+		return v4IndexBits
+	}
+	return v6IndexBits
+}
+
+// addressKeyCount returns the number of index keys of an address
+func addressKeyCount(ip netip.Addr) int {
+	if !ip.IsValid() {
+		return 0
+	}
+	return len(indexBits(ip.Unmap()))
+}
+
+// addressKeys appends the index keys of an address to keys, one per indexed
+// prefix length. IPv4-mapped addresses are indexed as IPv4, as filters match them.
+func addressKeys(ip netip.Addr, keys []prefixKey) []prefixKey {
+	if !ip.IsValid() {
+		return keys
+	}
+	ip = ip.Unmap()
+	for _, b := range indexBits(ip) {
+		p, _ := ip.Prefix(b)
+		keys = append(keys, makePrefixKey(p))
+	}
+	return keys
+}
+
+// buildFlowIndex indexes the flows of a segment
+func buildFlowIndex(flows []types.Flow) *flowIndex {
+	x := newFlowIndex()
+	for i := range flows {
+		x.add(int32(i), &flows[i])
+	}
+	return x
+}
+
+// add indexes a flow
+func (x *flowIndex) add(pos int32, f *types.Flow) {
+	var buf [8]prefixKey
+	for _, key := range addressKeys(f.SrcAddr, buf[:0]) {
+		x.src.add(key, pos)
+	}
+	for _, key := range addressKeys(f.DstAddr, buf[:0]) {
+		x.dst.add(key, pos)
+	}
+	x.srcPort.add(f.SrcPort, pos)
+	x.dstPort.add(f.DstPort, pos)
+	x.protocol.add(f.Protocol, pos)
+	x.inIf.add(f.InputIf, pos)
+	x.outIf.add(f.OutputIf, pos)
+	x.exporter.add(f.ExporterIP, pos)
+	x.minute.add(f.ReceivedAt.Unix()/60, pos)
+}
+
+// networkKey returns the index key covering a network, ok is false if the
+// network is shorter than the shortest indexed prefix
+func networkKey(n netip.Prefix) (prefixKey, bool) {
+	best := -1
+	for _, b := range indexBits(n.Addr()) {
+		if b <= n.Bits() {
+			best = b
+		}
+	}
+	if best < 0 {
+		return prefixKey{}, false
+	}
+	key, _ := n.Addr().Prefix(best)
+	return makePrefixKey(key), true
+}
+
+// conditionPostings returns the posting lists whose union contains all flows
+// matching the condition, ok is false if the condition can't use an index
+func (x *flowIndex) conditionPostings(c *ConditionNode) ([][]int32, bool) {
+	if c.Negated || c.Op != OpEqual && c.Op != OpContains {
+		return nil, false // Comparisons are scanned
+	}
+	if c.Set != nil && !(c.Field == "exporter" || c.Field == "exp") {
+		return x.setPostings(c)
+	}
+
+	switch c.Field {
+	case "src", "sip", "srcip", "dst", "dip", "dstip", "ip":
+		if c.Op == OpContains || !c.Network.IsValid() {
+			return nil, false // Substring, range or wildcard
+		}
+		key, ok := networkKey(c.Network)
+		if !ok {
+			return nil, false
+		}
+		switch c.Field {
+		case "src", "sip", "srcip":
+			return [][]int32{x.src[key]}, true
+		case "dst", "dip", "dstip":
+			return [][]int32{x.dst[key]}, true
+		}
+		return [][]int32{x.src[key], x.dst[key]}, true
+	case "sport", "srcport":
+		return [][]int32{x.srcPort[c.Port]}, true
+	case "dport", "dstport":
+		return [][]int32{x.dstPort[c.Port]}, true
+	case "port":
+		return [][]int32{x.srcPort[c.Port], x.dstPort[c.Port]}, true
+	case "proto", "protocol":
+		var lists [][]int32
+		for _, p := range protocolNumbers(c.Value) {
+			lists = append(lists, x.protocol[uint8(p)])
+		}
+		return lists, true
+	case "if":
+		return [][]int32{x.inIf[c.Interface], x.outIf[c.Interface]}, true
+	case "inif":
+		return [][]int32{x.inIf[c.Interface]}, true
+	case "outif":
+		return [][]int32{x.outIf[c.Interface]}, true
+	case "exporter", "exp":
+		// Few exporters: check every indexed exporter against the condition
+		var lists [][]int32
+		for key, p := range x.exporter {
+			if c.matchAddr(key) {
+				lists = append(lists, p)
+			}
+		}
+		return lists, true
+	}
+	return nil, false
+}
+
+// setPostings returns the posting lists for a set condition: the indexed
+// values that are members for ports, interfaces and protocols, the network
+// keys of the members for addresses
+func (x *flowIndex) setPostings(c *ConditionNode) ([][]int32, bool) {
+	s := c.Set
+	switch c.Field {
+	case "sport", "srcport":
+		return memberPostings(x.srcPort, s), true
+	case "dport", "dstport":
+		return memberPostings(x.dstPort, s), true
+	case "port":
+		return append(memberPostings(x.srcPort, s), memberPostings(x.dstPort, s)...), true
+	case "proto", "protocol":
+		return memberPostings(x.protocol, s), true
+	case "if":
+		return append(memberPostings(x.inIf, s), memberPostings(x.outIf, s)...), true
+	case "inif":
+		return memberPostings(x.inIf, s), true
+	case "outif":
+		return memberPostings(x.outIf, s), true
+	case "src", "sip", "srcip", "dst", "dip", "dstip", "ip":
+		if !s.onlyPrefixes() {
+			return nil, false // Ranges and wildcards are scanned
+		}
+		var lists [][]int32
+		for _, n := range s.prefixes {
+			key, ok := networkKey(n)
+			if !ok {
+				return nil, false
+			}
+			if c.Field != "dst" && c.Field != "dip" && c.Field != "dstip" {
+				lists = append(lists, x.src[key])
+			}
+			if c.Field != "src" && c.Field != "sip" && c.Field != "srcip" {
+				lists = append(lists, x.dst[key])
+			}
+		}
+		return lists, true
+	}
+	return nil, false
+}
+
+// memberPostings returns the posting lists of all indexed values in the set
+func memberPostings[K uint8 | uint16](ix postingIndex[K], s *valueSet) [][]int32 {
+	var lists [][]int32
+	for key, p := range ix {
+		if s.hasNumber(uint32(key)) {
+			lists = append(lists, p)
+		}
+	}
+	return lists
+}
+
+// timePostings returns the posting lists of all minutes overlapping the filter's
+// receive-time range, bounded below by the flow-time range as well
+func (x *flowIndex) timePostings(filter *Filter) [][]int32 {
+	since := filter.receivedSince()
+	var lists [][]int32
+	for minute, p := range x.minute {
+		if !since.IsZero() && minute < since.Unix()/60 {
+			continue
+		}
+		if !filter.Until.IsZero() && minute > filter.Until.Unix()/60 {
+			continue
+		}
+		lists = append(lists, p)
+	}
+	return lists
+}
+
+// plan returns the positions of candidate flows in a segment for a filter, chosen
+// from the most selective indexed condition of the top-level AND. ok is false if
+// no condition is indexable or the best candidate set is too large to pay off.
+func (x *flowIndex) plan(filter *Filter, segmentLen int) ([]int32, bool) {
+	if filter == nil {
+		return nil, false
+	}
+
+	var options [][][]int32
+	if filter.HasTimeRange() || !filter.From.IsZero() {
+		options = append(options, x.timePostings(filter))
+	}
+
+	var conditions []ExprNode
+	switch root := filter.Root.(type) {
+	case *AndNode:
+		conditions = root.Children
+	case *ConditionNode:
+		conditions = []ExprNode{root}
+	}
+	for _, node := range conditions {
+		if c, ok := node.(*ConditionNode); ok {
+			if lists, ok := x.conditionPostings(c); ok {
+				options = append(options, lists)
+			}
+		}
+	}
+
+	type option struct {
+		lists [][]int32
+		size  int
+	}
+	candidates := make([]option, 0, len(options))
+	for _, lists := range options {
+		size := 0
+		for _, l := range lists {
+			size += len(l)
+		}
+		candidates = append(candidates, option{lists, size})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].size < candidates[j].size })
+
+	if len(candidates) == 0 || candidates[0].size > int(float64(segmentLen)*plannerMaxFraction) {
+		return nil, false
+	}
+
+	// Narrow the most selective candidate set with other single-list conditions
+	positions := unionPostings(candidates[0].lists)
+	for _, c := range candidates[1:] {
+		if len(positions) == 0 || c.size > 4*len(positions) {
+			break
+		}
+		if len(c.lists) == 1 {
+			positions = intersectPostings(positions, c.lists[0])
+		}
+	}
+	return positions, true
+}
+
+// intersectPostings returns the positions contained in both sorted lists
+func intersectPostings(a, b []int32) []int32 {
+	result := make([]int32, 0, min(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// unionPostings merges sorted posting lists into one sorted list without duplicates
+func unionPostings(lists [][]int32) []int32 {
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+
+	total := 0
+	for _, l := range lists {
+		total += len(l)
+	}
+	result := make([]int32, 0, total)
+	for _, l := range lists {
+		result = append(result, l...)
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// forEachMatch calls fn for every stored flow matching the filter, oldest segment
+// first. Indexed segments use their index when possible, the others are scanned. Works
+// on a snapshot without locking; fn must not modify the flow. With a flow-time range,
+// flows reaching across it are passed as clipped copies.
+func (fs *FlowStore) forEachMatch(filter *Filter, fn func(*types.Flow)) {
+	var since time.Time
+	if filter != nil && filter.HasFlowTimeRange() {
+		since = filter.receivedSince()
+		match := fn
+		fn = func(f *types.Flow) {
+			match(filter.clip(f))
+		}
+	}
+
+	for _, seg := range fs.snapshot().segments {
+		flows := seg.slice()
+		if !since.IsZero() && seg.newest().Before(since) {
+			continue // Received before any flow overlapping the range
+		}
+
+		if filter == nil || filter.IsEmpty() {
+			for i := range flows {
+				fn(&flows[i])
+			}
+			continue
+		}
+
+		if index := seg.index.Load(); index != nil {
+			if positions, ok := index.plan(filter, len(flows)); ok {
+				for _, i := range positions {
+					if filter.Matches(&flows[i]) {
+						fn(&flows[i])
+					}
+				}
+				continue
+			}
+		}
+
+		for i := range flows {
+			if filter.Matches(&flows[i]) {
+				fn(&flows[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// indexedStore returns a store whose flows are spread over sealed, indexed
+// segments and the head, with unusual values mixed into every segment
+func indexedStore(t *testing.T) (*FlowStore, []types.Flow) {
+	t.Helper()
+	flows := generateFlows(5000, 5)
+	for i := range flows {
+		f := &flows[i]
+		switch i % 50 {
+		case 0:
+			f.SrcAddr = netip.MustParseAddr("2001:db8::1")
+			f.DstAddr = netip.AddrFrom16([16]byte{15: byte(i)})
+		case 1:
+			f.SrcAddr = netip.MustParseAddr("::ffff:10.1.2.3") // v4-mapped, matches as 10.1.2.3
+			f.DstAddr = netip.MustParseAddr("::ffff:192.168.1.1")
+		case 2:
+			f.SrcPort, f.DstPort, f.Protocol = 0, 65535, 47
+		case 3:
+			f.InputIf, f.OutputIf = 0, 65535
+		case 4:
+			f.ExporterIP = netip.MustParseAddr("2001:db8:ffff::1")
+		case 5:
+			f.ExporterIP = netip.MustParseAddr("::ffff:192.0.2.9")
+		}
+	}
+
+	fs := New(len(flows))
+	for i := 0; i < len(flows); i += 100 {
+		fs.Add(flows[i : i+100])
+	}
+
+	// Wait for the background index builds of the sealed segments
+	segments := fs.snapshot().segments
+	deadline := time.Now().Add(10 * time.Second)
+	for _, seg := range segments[:len(segments)-1] {
+		for seg.index.Load() == nil {
+			if time.Now().After(deadline) {
+				t.Fatal("segment index not built")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(segments) < 3 || segments[len(segments)-1].len() == 0 {
+		t.Fatalf("%d segments, head holds %d flows", len(segments), segments[len(segments)-1].len())
+	}
+	return fs, flows
+}
+
+func TestIndexedQueryMatchesScan(t *testing.T) {
+	fs, flows := indexedStore(t)
+	since := flows[3000].ReceivedAt
+
+	for _, expr := range []string{
+		// Single conditions
+		"dport=443",
+		"sport=0",
+		"port=65535",
+		"proto=tcp",
+		"proto=udp",
+		"proto=gre",
+		"inif=3",
+		"if=65535",
+		"outif=0",
+		"exporter=192.0.2.2",
+		"exporter=192.0.2.0/24",
+		"exporter=192.0.2.9",
+		"exporter=2001:db8:ffff::/48",
+
+		// Prefixes at, between and beyond the indexed lengths
+		"src=10.1.0.0/16",
+		"src=10.1.2.0/23",
+		"src=10.1.2.3",
+		"src=10.0.0.0/6",
+		"dst=192.168.1.1",
+		"ip=10.2.3.0/24",
+		"ip=::ffff:10.1.0.0/112",
+		"src=2001:db8::/32",
+		"src=2001:db8::1",
+		"dst=::/64",
+		"ip=::/0",
+		"ip=0.0.0.0/0",
+
+		// Ranges, wildcards and substrings are scanned but combine with indexed conditions
+		"src=10.1.0.0-10.1.255.255 && dport=53",
+		"dst=10.*.*.1 && proto=udp",
+		"src~10.1. && dport=443",
+
+		// AND, OR, NOT
+		"dport=443 && proto=tcp",
+		"src=10.1.0.0/16 && dport=53 && inif=3",
+		"dport=53 || dport=123",
+		"(dport=53 || dport=123) && src=10.0.0.0/8",
+		"!dport=443",
+		"dport=443 && !src=10.1.0.0/16",
+		"!(dport=443 || proto=udp)",
+		"src=10.0.0.0/8 && !!dport=22",
+
+		// Comparisons are scanned
+		"bytes>100k && dport=443",
+		"port<1024 && proto=udp",
+
+		// Sets
+		"dport in {80,443,8000-8999}",
+		"port in {0, 65535}",
+		"proto in {tcp, 47}",
+		"if in {1-2, 65535}",
+		"src in {10.1.0.0/16, 10.2.0.0/16}",
+		"ip in {2001:db8::/32, 192.168.1.1}",
+		"ip in {::ffff:10.1.2.0/120}",
+		"ip in {::/0}",
+		"dst in {10.0.0.1-10.0.0.255, 1.*.*.*}",
+		"exporter in {192.0.2.1, 2001:db8:ffff::1}",
+		"src in {10.1.0.0/16} && dport in {443, 53}",
+	} {
+		filter := ParseFilter(expr)
+		if !filter.IsValid() {
+			t.Fatalf("%s: %s", expr, filter.Error)
+		}
+		for _, withTime := range []bool{false, true} {
+			name := expr
+			if withTime {
+				filter.Since = since
+				name += " since flow 3000"
+			}
+
+			var want []uint64
+			for _, seg := range fs.snapshot().segments {
+				for _, f := range seg.slice() {
+					if filter.Matches(&f) {
+						want = append(want, f.Seq)
+					}
+				}
+			}
+			var got []uint64
+			fs.forEachMatch(&filter, func(f *types.Flow) {
+				got = append(got, f.Seq)
+			})
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: index returns %d flows, scan %d", name, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestPlanUsesIndex(t *testing.T) {
+	fs, _ := indexedStore(t)
+	seg := fs.snapshot().segments[0]
+	index := seg.index.Load()
+
+	for expr, indexed := range map[string]bool{
+		"dport=53":                   true,
+		"src=10.1.2.3":               true,
+		"src=10.1.2.3 && bytes>1":    true,
+		"dport in {53,123}":          true,
+		"src in {10.1.2.0/24}":       true,
+		"proto=tcp":                  false, // Most flows: a scan is cheaper
+		"dport=53 || dport=123":      false,
+		"!dport=53":                  false,
+		"src=0.0.0.0/0":              false,
+		"src in {10.0.0.1-10.0.0.9}": false,
+		"bytes>1k":                   false,
+	} {
+		filter := ParseFilter(expr)
+		if _, ok := index.plan(&filter, seg.len()); ok != indexed {
+			t.Errorf("%s: indexed = %v, want %v", expr, ok, indexed)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Add only publishes flows to the head segment under mu. Writing them to the
+// archive and history and evicting segments is maintenance work: Add queues it
+// and a goroutine does it while there is any, holding mu only to seal the head
+// and to swap in the segment list of an eviction step. Readers holding mu
+// therefore never wait for SQLite or eviction, and ingest never waits for them.
+//
+// Lock order: maintMu before mu. persistMu is only held for queue operations.
+
+// maintenanceSlack is how many segments the store may grow beyond its limit
+// before Add evicts itself instead of leaving it to the maintenance goroutine
+const maintenanceSlack = 2
+
+// queuePersist queues stored flows for the archive and history. Must be called
+// with fs.mu held, so flows are queued before their segment can be evicted.
+func (fs *FlowStore) queuePersist(flows []types.Flow) {
+	if len(flows) == 0 {
+		return
+	}
+	fs.persistMu.Lock()
+	fs.toPersist = append(fs.toPersist, flows...)
+	fs.persistMu.Unlock()
+}
+
+// scheduleMaintenance makes sure the maintenance goroutine runs (again),
+// unless the store is closed
+func (fs *FlowStore) scheduleMaintenance() {
+	fs.persistMu.Lock()
+	defer fs.persistMu.Unlock()
+	if fs.maintClosed {
+		return
+	}
+	fs.maintWanted = true
+	if !fs.maintRunning {
+		fs.maintRunning = true
+		fs.maintDone = make(chan struct{})
+		go fs.maintenanceLoop(fs.maintDone)
+	}
+}
+
+// maintenanceLoop runs maintenance until no more is requested, then closes done
+func (fs *FlowStore) maintenanceLoop(done chan struct{}) {
+	defer close(done)
+	for {
+		fs.persistMu.Lock()
+		if !fs.maintWanted || fs.maintClosed {
+			fs.maintRunning = false
+			fs.persistMu.Unlock()
+			return
+		}
+		fs.maintWanted = false
+		fs.persistMu.Unlock()
+
+		fs.maintain()
+	}
+}
+
+// maintain persists queued flows, then evicts. Queued flows are written before
+// any eviction, so evicted flows are always in the archive.
+func (fs *FlowStore) maintain() {
+	fs.maintMu.Lock()
+	defer fs.maintMu.Unlock()
+
+	fs.persistMu.Lock()
+	flows := fs.toPersist
+	fs.toPersist = nil
+	fs.persistMu.Unlock()
+
+	if len(flows) > 0 {
+		fs.mu.RLock()
+		archive, history := fs.archive, fs.history
+		fs.mu.RUnlock()
+		if archive != nil {
+			archive.Append(flows)
+		}
+		if history != nil {
+			history.Append(flows)
+		}
+	}
+
+	fs.evictFlows()
+}
+
+// Close stops background maintenance and persists all queued flows, including
+// records still held back by deduplication. Call it before closing the archive
+// and history so they receive every stored flow. Flows added later are kept in
+// memory but no longer persisted.
+func (fs *FlowStore) Close() {
+	fs.mu.Lock()
+	if fs.dedup.enabled() {
+		fs.queuePersist(fs.releaseHeld(time.Now().Add(fs.dedup.config.Window)))
+	}
+	fs.mu.Unlock()
+
+	fs.persistMu.Lock()
+	fs.maintClosed = true
+	var running chan struct{}
+	if fs.maintRunning {
+		running = fs.maintDone
+	}
+	fs.persistMu.Unlock()
+	if running != nil {
+		<-running
+	}
+
+	fs.maintain()
+}
+
+// farOverLimit reports whether the store is more than maintenanceSlack
+// segments over its limit. Must be called with fs.mu held.
+func (fs *FlowStore) farOverLimit() bool {
+	slack := int64(maintenanceSlack * fs.segmentCapacity)
+	if fs.maxFlows > 0 && fs.count.Load() > int64(fs.maxFlows)+slack {
+		return true
+	}
+	budget := fs.evictionConfig.MaxMemory
+	return budget > 0 && fs.memory.Load() > budget+slack*typicalFlowSize
+}
@@ -0,0 +1,338 @@
+package store
+
+import (
+	"fmt"
+	"hash/maphash"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Eviction policies decide which flows of an evicted segment survive. For every
+// flow of the evicted and the retained segment the policies are asked in order;
+// the first one that doesn't abstain decides. Kept flows move into the retained
+// segment, ranked by policy order and then by the policy's score when the
+// retained segment is full. Flows no policy keeps are dropped (FIFO).
+
+// EvictionDecision is a policy's verdict on a single flow
+type EvictionDecision int
+
+const (
+	DecisionAbstain EvictionDecision = iota // Leave the flow to the next policy
+	DecisionKeep                            // Keep the flow in the retained segment
+	DecisionEvict                           // Drop the flow, later policies are not asked
+)
+
+// EvictionPolicy is one rule of the eviction chain
+type EvictionPolicy interface {
+	// Name identifies the policy in EvictionStats
+	Name() string
+	// Begin prepares an eviction step and returns the maximum number of flows
+	// the policy may keep, or -1 for no limit of its own
+	Begin(step *EvictionStep) int
+	// Decide judges a flow. The score ranks kept flows of the same policy,
+	// higher scores are kept first.
+	Decide(f *types.Flow) (EvictionDecision, float64)
+}
+
+// EvictionStep gives policies access to the store state of one eviction step
+type EvictionStep struct {
+	Now       time.Time
+	FlowLimit int // Flows the store may hold (max-flows or memory budget)
+
+	fs *FlowStore
+}
+
+// ByteThreshold returns a byte count such that about the k largest stored flows
+// are at or above it, 0 if there are no more than k flows
+func (s *EvictionStep) ByteThreshold(k int) uint64 {
+	s.fs.mu.RLock()
+	defer s.fs.mu.RUnlock()
+	return s.fs.hist.threshold(k)
+}
+
+// LastAccess returns when a flow was last viewed, if within the LRU window
+func (s *EvictionStep) LastAccess(f *types.Flow) (time.Time, bool) {
+	return s.fs.recentlyAccessed(f, s.Now)
+}
+
+// PolicyStats holds the statistics of one eviction policy
+type PolicyStats struct {
+	Name      string
+	Protected int    // Flows kept by the policy after the last eviction step
+	Evicted   uint64 // Flows the policy decided to drop
+}
+
+// DefaultEvictionPolicies returns the hybrid strategy: Top-K elephants, then
+// recently viewed flows
+func DefaultEvictionPolicies(config EvictionConfig) []EvictionPolicy {
+	return []EvictionPolicy{
+		NewTopKPolicy(config.TopKPercent),
+		NewLRUPolicy(),
+	}
+}
+
+// topKPolicy keeps the largest flows by bytes
+type topKPolicy struct {
+	percent   float64
+	threshold uint64
+}
+
+// NewTopKPolicy keeps the largest flows by bytes, up to percent of the flow limit
+func NewTopKPolicy(percent float64) EvictionPolicy {
+	return &topKPolicy{percent: percent}
+}
+
+func (p *topKPolicy) Name() string { return "topk" }
+
+func (p *topKPolicy) Begin(step *EvictionStep) int {
+	count := int(float64(step.FlowLimit) * p.percent / 100.0)
+	p.threshold = step.ByteThreshold(count)
+	return count
+}
+
+func (p *topKPolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	if p.threshold > 0 && f.Bytes >= p.threshold {
+		return DecisionKeep, float64(f.Bytes)
+	}
+	return DecisionAbstain, 0
+}
+
+// lruPolicy keeps flows viewed within the LRU window
+type lruPolicy struct {
+	step *EvictionStep
+}
+
+// NewLRUPolicy keeps flows viewed (MarkFlowAccessed) within the LRU window,
+// most recently viewed first
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{}
+}
+
+func (p *lruPolicy) Name() string { return "lru" }
+
+func (p *lruPolicy) Begin(step *EvictionStep) int {
+	p.step = step
+	return -1
+}
+
+func (p *lruPolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	if t, ok := p.step.LastAccess(f); ok {
+		return DecisionKeep, float64(t.UnixNano())
+	}
+	return DecisionAbstain, 0
+}
+
+// watchPolicy keeps flows from or to watched networks
+type watchPolicy struct {
+	networks []netip.Prefix
+}
+
+// NewWatchPolicy keeps flows whose source or destination is in one of the
+// networks, newest first
+func NewWatchPolicy(networks []netip.Prefix) EvictionPolicy {
+	return &watchPolicy{networks: networks}
+}
+
+func (p *watchPolicy) Name() string { return "watch" }
+
+func (p *watchPolicy) Begin(*EvictionStep) int { return -1 }
+
+func (p *watchPolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	for _, n := range p.networks {
+		if n.Contains(f.SrcAddr) || n.Contains(f.DstAddr) {
+			return DecisionKeep, float64(f.ReceivedAt.UnixNano())
+		}
+	}
+	return DecisionAbstain, 0
+}
+
+// pinPolicy keeps flows matching a filter expression
+type pinPolicy struct {
+	filter Filter
+}
+
+// NewPinPolicy keeps flows matching the filter, newest first
+func NewPinPolicy(filter Filter) EvictionPolicy {
+	return &pinPolicy{filter: filter}
+}
+
+func (p *pinPolicy) Name() string { return "pin" }
+
+func (p *pinPolicy) Begin(*EvictionStep) int { return -1 }
+
+func (p *pinPolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	if p.filter.Matches(f) {
+		return DecisionKeep, float64(f.ReceivedAt.UnixNano())
+	}
+	return DecisionAbstain, 0
+}
+
+// samplePolicy keeps a uniform sample of the flows below the Top-K threshold
+type samplePolicy struct {
+	percent     float64
+	topKPercent float64
+	seed        maphash.Seed
+	threshold   uint64
+}
+
+// NewSamplePolicy keeps percent of the small flows (below the Top-K threshold of
+// topKPercent), up to percent of the flow limit. A flow is picked by a hash of
+// its key and receive time, so it stays sampled in later eviction steps.
+func NewSamplePolicy(percent, topKPercent float64) EvictionPolicy {
+	return &samplePolicy{percent: percent, topKPercent: topKPercent, seed: maphash.MakeSeed()}
+}
+
+func (p *samplePolicy) Name() string { return "sample" }
+
+func (p *samplePolicy) Begin(step *EvictionStep) int {
+	p.threshold = step.ByteThreshold(int(float64(step.FlowLimit) * p.topKPercent / 100.0))
+	return int(float64(step.FlowLimit) * p.percent / 100.0)
+}
+
+func (p *samplePolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	if p.threshold > 0 && f.Bytes >= p.threshold {
+		return DecisionAbstain, 0
+	}
+	key := struct {
+		flow       types.FlowKey
+		receivedAt int64
+	}{f.FlowKey(), f.ReceivedAt.UnixNano()}
+	if float64(maphash.Comparable(p.seed, key)%1000000) < p.percent*10000 {
+		return DecisionKeep, float64(f.ReceivedAt.UnixNano())
+	}
+	return DecisionAbstain, 0
+}
+
+// agePolicy drops flows received longer ago than maxAge
+type agePolicy struct {
+	name   string
+	maxAge time.Duration
+	step   *EvictionStep
+}
+
+// NewAgePolicy drops flows received longer ago than maxAge, even if a later
+// policy would keep them. Recently viewed flows are left to the later policies.
+func NewAgePolicy(maxAge time.Duration) EvictionPolicy {
+	return &agePolicy{name: "age", maxAge: maxAge}
+}
+
+func (p *agePolicy) Name() string { return p.name }
+
+func (p *agePolicy) Begin(step *EvictionStep) int {
+	p.step = step
+	return -1
+}
+
+func (p *agePolicy) Decide(f *types.Flow) (EvictionDecision, float64) {
+	if p.step.Now.Sub(f.ReceivedAt) <= p.maxAge {
+		return DecisionAbstain, 0
+	}
+	if _, ok := p.step.LastAccess(f); ok {
+		return DecisionAbstain, 0
+	}
+	return DecisionEvict, 0
+}
+
+// EvictionPolicyNames lists the policies ParseEvictionPolicy understands
+var EvictionPolicyNames = []string{"topk", "lru", "watch", "pin", "sample", "age"}
+
+// ParseEvictionPolicy creates a policy from a "name" or "name:argument" spec:
+//
+//	topk[:percent]         largest flows (default --topk-percent)
+//	lru                    recently viewed flows
+//	watch:net[,net...]     flows from or to the networks (CIDR or address)
+//	pin:filter             flows matching a filter expression
+//	sample:percent         uniform sample of small flows
+//	age:duration           drop flows older than duration
+func ParseEvictionPolicy(spec string, config EvictionConfig) (EvictionPolicy, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+	arg = strings.TrimSpace(arg)
+
+	switch strings.ToLower(name) {
+	case "topk":
+		percent := config.TopKPercent
+		if hasArg {
+			var err error
+			if percent, err = parsePercent(arg); err != nil {
+				return nil, fmt.Errorf("topk: %w", err)
+			}
+		}
+		return NewTopKPolicy(percent), nil
+	case "lru":
+		if hasArg {
+			return nil, fmt.Errorf("lru takes no argument (window is --lru-window)")
+		}
+		return NewLRUPolicy(), nil
+	case "watch":
+		var networks []netip.Prefix
+		for s := range strings.SplitSeq(arg, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			n, err := netip.ParsePrefix(s)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(s)
+				if addrErr != nil {
+					return nil, fmt.Errorf("watch: invalid network %q", s)
+				}
+				n = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			networks = append(networks, n.Masked())
+		}
+		if len(networks) == 0 {
+			return nil, fmt.Errorf("watch needs at least one network")
+		}
+		return NewWatchPolicy(networks), nil
+	case "pin":
+		filter := ParseFilter(arg)
+		if filter.IsEmpty() {
+			return nil, fmt.Errorf("pin needs a filter expression")
+		}
+		if !filter.IsValid() {
+			return nil, fmt.Errorf("pin: %s", filter.Error)
+		}
+		return NewPinPolicy(filter), nil
+	case "sample":
+		percent, err := parsePercent(arg)
+		if err != nil {
+			return nil, fmt.Errorf("sample: %w", err)
+		}
+		return NewSamplePolicy(percent, config.TopKPercent), nil
+	case "age":
+		maxAge, err := time.ParseDuration(arg)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("age: invalid duration %q", arg)
+		}
+		return NewAgePolicy(maxAge), nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %q (valid: %s)", name, strings.Join(EvictionPolicyNames, ", "))
+}
+
+// parsePercent parses "1.5" or "1.5%" as a percentage between 0 and 100
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || v < 0 || v > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return v, nil
+}
+
+// evictionPolicies returns the policy chain: max-age first if configured, then
+// the configured policies or the default hybrid strategy. Must be called with
+// fs.mu held.
+func (fs *FlowStore) evictionPolicies() []EvictionPolicy {
+	policies := fs.evictionConfig.Policies
+	if policies == nil {
+		policies = DefaultEvictionPolicies(fs.evictionConfig)
+	}
+	if fs.evictionConfig.MaxAge > 0 {
+		maxAge := &agePolicy{name: "max-age", maxAge: fs.evictionConfig.MaxAge}
+		policies = append([]EvictionPolicy{maxAge}, policies...)
+	}
+	return policies
+}
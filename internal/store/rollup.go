@@ -0,0 +1,515 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// RollupTier is one resolution of the traffic time series
+type RollupTier struct {
+	Name       string
+	Resolution time.Duration // Bucket width
+	Retention  time.Duration // How long buckets are kept
+}
+
+// DefaultRollupTiers are ordered from fine to coarse. Flows are counted into the
+// finest tier by receive time; completed buckets are folded into the next tier.
+var DefaultRollupTiers = []RollupTier{
+	{Name: "10s", Resolution: 10 * time.Second, Retention: time.Hour},
+	{Name: "1m", Resolution: time.Minute, Retention: 24 * time.Hour},
+	{Name: "5m", Resolution: 5 * time.Minute, Retention: 7 * 24 * time.Hour},
+	{Name: "1h", Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+}
+
+// maxTimeSeriesPoints limits the points per series; larger ranges use a coarser step
+const maxTimeSeriesPoints = 2000
+
+// RollupKey identifies one rolled-up series
+type RollupKey struct {
+	Exporter netip.Addr
+	InputIf  uint16
+	OutputIf uint16
+	Protocol uint8
+}
+
+// RollupCounters holds the traffic volume of one bucket
+type RollupCounters struct {
+	Bytes   uint64
+	Packets uint64
+	Flows   uint64
+}
+
+func (c *RollupCounters) add(o RollupCounters) {
+	c.Bytes += o.Bytes
+	c.Packets += o.Packets
+	c.Flows += o.Flows
+}
+
+// rollupBucket holds the counters of all series for one time slot
+type rollupBucket struct {
+	start  time.Time
+	series map[RollupKey]*RollupCounters
+}
+
+func (b *rollupBucket) add(key RollupKey, c RollupCounters) {
+	counters := b.series[key]
+	if counters == nil {
+		counters = &RollupCounters{}
+		b.series[key] = counters
+	}
+	counters.add(c)
+}
+
+// rollupTier holds the buckets of one resolution
+type rollupTier struct {
+	RollupTier
+	buckets []*rollupBucket // Sorted by start
+	folded  time.Time       // Data before this time has been folded into the next tier
+}
+
+// bucket returns the bucket for t, creating it if needed
+func (t *rollupTier) bucket(ts time.Time) *rollupBucket {
+	start := ts.Truncate(t.Resolution)
+
+	// Flows arrive roughly in order, so search from the end
+	i := len(t.buckets)
+	for i > 0 && t.buckets[i-1].start.After(start) {
+		i--
+	}
+	if i > 0 && t.buckets[i-1].start.Equal(start) {
+		return t.buckets[i-1]
+	}
+
+	b := &rollupBucket{start: start, series: make(map[RollupKey]*RollupCounters)}
+	t.buckets = append(t.buckets, nil)
+	copy(t.buckets[i+1:], t.buckets[i:])
+	t.buckets[i] = b
+	return b
+}
+
+// prune drops buckets that ended before the tier's retention
+func (t *rollupTier) prune(now time.Time) {
+	cutoff := now.Add(-t.Retention)
+	n := 0
+	for n < len(t.buckets) && t.buckets[n].start.Add(t.Resolution).Before(cutoff) {
+		n++
+	}
+	if n > 0 {
+		t.buckets = append(t.buckets[:0], t.buckets[n:]...)
+	}
+}
+
+// rollups maintains traffic counters per exporter, interface and protocol in
+// several resolutions. Tier i+1 holds all data received before tiers[i].folded;
+// newer data is still only in the finer tiers. Has its own lock so time series
+// queries don't hold up the rest of the ingest path.
+type rollups struct {
+	mu    sync.Mutex
+	tiers []*rollupTier
+}
+
+func newRollups(tiers []RollupTier) *rollups {
+	r := &rollups{}
+	for _, t := range tiers {
+		r.tiers = append(r.tiers, &rollupTier{RollupTier: t})
+	}
+	return r
+}
+
+// add counts a flow into the rollups
+func (r *rollups) add(flow *types.Flow) {
+	key := RollupKey{
+		Exporter: flow.ExporterIP,
+		InputIf:  flow.InputIf,
+		OutputIf: flow.OutputIf,
+		Protocol: flow.Protocol,
+	}
+
+	counters := RollupCounters{Bytes: flow.Bytes, Packets: flow.Packets, Flows: 1}
+	if flow.FlowCount > 1 {
+		counters.Flows = uint64(flow.FlowCount) // NetFlow v8 aggregates
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := flow.ReceivedAt
+	r.tiers[0].bucket(t).add(key, counters)
+
+	// Late flows for buckets that were already folded also go into the coarser tiers
+	for i := 1; i < len(r.tiers) && t.Before(r.tiers[i-1].folded); i++ {
+		r.tiers[i].bucket(t).add(key, counters)
+	}
+
+	r.fold(t)
+}
+
+// fold merges all buckets completed before now into the next coarser tier
+func (r *rollups) fold(now time.Time) {
+	advanced := false
+	for i := 0; i < len(r.tiers)-1; i++ {
+		tier, next := r.tiers[i], r.tiers[i+1]
+		upTo := now.Truncate(tier.Resolution)
+		if !upTo.After(tier.folded) {
+			break // Coarser tiers can't have completed buckets either
+		}
+
+		for _, b := range tier.buckets {
+			if b.start.Before(tier.folded) || b.start.Add(tier.Resolution).After(upTo) {
+				continue
+			}
+			target := next.bucket(b.start)
+			for key, c := range b.series {
+				target.add(key, *c)
+			}
+		}
+		tier.folded = upTo
+		advanced = true
+	}
+
+	if advanced {
+		for _, tier := range r.tiers {
+			tier.prune(now)
+		}
+	}
+}
+
+// view calls fn for all counters of tier k in [since, until), including data of
+// finer tiers that has not been folded into tier k yet
+func (r *rollups) view(k int, since, until time.Time, fn func(ts time.Time, key RollupKey, c *RollupCounters)) {
+	for j := k; j >= 0; j-- {
+		tier := r.tiers[j]
+		for _, b := range tier.buckets {
+			if j < k && b.start.Before(tier.folded) {
+				continue // Already contained in tier j+1
+			}
+			if !b.start.Add(tier.Resolution).After(since) || !b.start.Before(until) {
+				continue
+			}
+			for key, c := range b.series {
+				fn(b.start, key, c)
+			}
+		}
+	}
+}
+
+// TimeSeriesGroups lists the dimensions a time series can be grouped by
+var TimeSeriesGroups = []string{"exporter", "inif", "outif", "protocol"}
+
+// rollupFilterFields are the filter fields that can be evaluated on rollup keys
+var rollupFilterFields = map[string]bool{
+	"exporter": true, "exp": true,
+	"if": true, "inif": true, "outif": true,
+	"proto": true, "protocol": true,
+}
+
+// TimeSeriesQuery selects a traffic time series
+type TimeSeriesQuery struct {
+	Filter  *Filter       // Optional; filters on other fields than exporter/interface/protocol use the stored flows
+	Since   time.Time     // Start of the range (default: 1h ago)
+	Until   time.Time     // End of the range (default: now)
+	Step    time.Duration // Point spacing (default: resolution of the chosen tier)
+	GroupBy []string      // Subset of TimeSeriesGroups, empty = total only
+
+	// FlowTime makes Since/Until a flow-time range: the series comes from the
+	// stored flows clipped to the range, each spread over the slots its duration
+	// covers. Otherwise the range and slots refer to the receive time.
+	FlowTime bool
+}
+
+// TimePoint is one point of a time series
+type TimePoint struct {
+	Time time.Time
+	RollupCounters
+}
+
+// TimeSeries is the traffic of one group over time
+type TimeSeries struct {
+	Labels map[string]string // Group values, e.g. {"exporter": "10.0.0.1", "protocol": "TCP"}
+	Points []TimePoint
+	Total  RollupCounters
+}
+
+// TimeSeriesResult is the answer to a TimeSeriesQuery
+type TimeSeriesResult struct {
+	Tier      string // Rollup tier used, empty if computed from stored flows
+	Step      time.Duration
+	Since     time.Time
+	Until     time.Time
+	FromFlows bool // Filter needed per-flow fields or FlowTime was set, so stored flows were used
+	FlowTime  bool // Slots refer to flow start/end instead of receive time
+	Series    []TimeSeries
+}
+
+// QueryTimeSeries returns bytes/packets/flows over time, grouped as requested
+func (fs *FlowStore) QueryTimeSeries(q TimeSeriesQuery) (TimeSeriesResult, error) {
+	for _, g := range q.GroupBy {
+		if !validTimeSeriesGroup(g) {
+			return TimeSeriesResult{}, fmt.Errorf("unknown group %q (valid: %s)", g, strings.Join(TimeSeriesGroups, ", "))
+		}
+	}
+
+	now := time.Now()
+	if q.Until.IsZero() || q.Until.After(now) {
+		q.Until = now
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-time.Hour)
+	}
+	if !q.Since.Before(q.Until) {
+		return TimeSeriesResult{}, fmt.Errorf("empty time range")
+	}
+
+	// Finest tier that still covers the range
+	tierIndex := len(fs.rollups.tiers) - 1
+	for i, tier := range fs.rollups.tiers {
+		if now.Sub(q.Since) <= tier.Retention && (q.Step == 0 || tier.Resolution <= q.Step) {
+			tierIndex = i
+			break
+		}
+	}
+	tier := fs.rollups.tiers[tierIndex].RollupTier
+
+	// Step: multiple of the tier resolution for rollups, bounded number of points
+	step := tier.Resolution
+	if q.FlowTime && q.Step > 0 {
+		step = q.Step // Computed from the flows, not bound to the tier
+	} else if q.Step > step {
+		step = (q.Step + tier.Resolution - 1) / tier.Resolution * tier.Resolution
+	}
+	for q.Until.Sub(q.Since)/step > maxTimeSeriesPoints {
+		step *= 2
+	}
+
+	result := TimeSeriesResult{
+		Tier:  tier.Name,
+		Step:  step,
+		Since: q.Since.Truncate(step),
+		Until: q.Until,
+	}
+	acc := newSeriesAccumulator(q.GroupBy)
+
+	var root ExprNode
+	if q.Filter != nil {
+		root = q.Filter.Root
+	}
+
+	if q.FlowTime {
+		result.Tier = ""
+		result.FromFlows = true
+		result.FlowTime = true
+
+		var filter Filter
+		if q.Filter != nil {
+			filter = *q.Filter
+		}
+		filter.From, filter.To = q.Since, q.Until
+		for _, f := range fs.Query(&filter, SortByTime, true, 0) {
+			acc.spread(result.Since, step, &f)
+		}
+	} else if root != nil && !exprUsesOnly(root, rollupFilterFields) {
+		// Per-flow filter: bucket the stored flows (memory and archive) instead
+		result.Tier = ""
+		result.FromFlows = true
+
+		filter := *q.Filter
+		filter.Since, filter.Until = q.Since, q.Until
+		for _, f := range fs.Query(&filter, SortByTime, true, 0) {
+			counters := RollupCounters{Bytes: f.Bytes, Packets: f.Packets, Flows: 1}
+			if f.FlowCount > 1 {
+				counters.Flows = uint64(f.FlowCount)
+			}
+			key := RollupKey{Exporter: f.ExporterIP, InputIf: f.InputIf, OutputIf: f.OutputIf, Protocol: f.Protocol}
+			acc.add(f.ReceivedAt.Truncate(step), key, counters)
+		}
+	} else {
+		fs.rollups.mu.Lock()
+		matches := make(map[RollupKey]bool)
+		fs.rollups.view(tierIndex, result.Since, q.Until, func(ts time.Time, key RollupKey, c *RollupCounters) {
+			if root != nil {
+				match, ok := matches[key]
+				if !ok {
+					match = root.Evaluate(key.flow())
+					matches[key] = match
+				}
+				if !match {
+					return
+				}
+			}
+			acc.add(ts.Truncate(step), key, *c)
+		})
+		fs.rollups.mu.Unlock()
+	}
+
+	result.Series = acc.series(result.Since, q.Until, step)
+	return result, nil
+}
+
+// flow builds a flow carrying only the key fields, for filter evaluation
+func (k RollupKey) flow() *types.Flow {
+	return &types.Flow{
+		ExporterIP: k.Exporter,
+		InputIf:    k.InputIf,
+		OutputIf:   k.OutputIf,
+		Protocol:   k.Protocol,
+	}
+}
+
+// label returns the value of a group dimension
+func (k RollupKey) label(group string) string {
+	switch group {
+	case "exporter":
+		if !k.Exporter.IsValid() {
+			return ""
+		}
+		return k.Exporter.String()
+	case "inif":
+		return strconv.Itoa(int(k.InputIf))
+	case "outif":
+		return strconv.Itoa(int(k.OutputIf))
+	case "protocol":
+		f := types.Flow{Protocol: k.Protocol}
+		return f.ProtocolName()
+	}
+	return ""
+}
+
+func validTimeSeriesGroup(g string) bool {
+	for _, valid := range TimeSeriesGroups {
+		if g == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesAccumulator sums counters per group and time slot
+type seriesAccumulator struct {
+	groupBy []string
+	groups  map[string]*seriesGroup
+}
+
+type seriesGroup struct {
+	labels map[string]string
+	points map[time.Time]*RollupCounters
+	total  RollupCounters
+}
+
+func newSeriesAccumulator(groupBy []string) *seriesAccumulator {
+	return &seriesAccumulator{groupBy: groupBy, groups: make(map[string]*seriesGroup)}
+}
+
+func (a *seriesAccumulator) add(ts time.Time, key RollupKey, c RollupCounters) {
+	values := make([]string, len(a.groupBy))
+	for i, g := range a.groupBy {
+		values[i] = key.label(g)
+	}
+	id := strings.Join(values, "\x00")
+
+	group := a.groups[id]
+	if group == nil {
+		group = &seriesGroup{labels: make(map[string]string), points: make(map[time.Time]*RollupCounters)}
+		for i, g := range a.groupBy {
+			group.labels[g] = values[i]
+		}
+		a.groups[id] = group
+	}
+
+	point := group.points[ts]
+	if point == nil {
+		point = &RollupCounters{}
+		group.points[ts] = point
+	}
+	point.add(c)
+	group.total.add(c)
+}
+
+// spread adds a flow to the slots from since on that its duration covers, each
+// with the share of bytes and packets inside. The flow counts in its first slot.
+func (a *seriesAccumulator) spread(since time.Time, step time.Duration, f *types.Flow) {
+	key := RollupKey{Exporter: f.ExporterIP, InputIf: f.InputIf, OutputIf: f.OutputIf, Protocol: f.Protocol}
+	start, end := recordStart(f), recordEnd(f)
+	slot := since.Add(start.Sub(since) / step * step)
+
+	flows := uint64(1)
+	if f.FlowCount > 1 {
+		flows = uint64(f.FlowCount)
+	}
+	c := RollupCounters{Flows: flows}
+	bytes, packets := f.Bytes, f.Packets
+	for {
+		next := slot.Add(step)
+		if !next.Before(end) {
+			c.Bytes, c.Packets = bytes, packets
+			a.add(slot, key, c)
+			return
+		}
+		from := slot
+		if from.Before(start) {
+			from = start
+		}
+		share := float64(next.Sub(from)) / float64(end.Sub(start))
+		c.Bytes = min(uint64(math.Round(float64(f.Bytes)*share)), bytes)
+		c.Packets = min(uint64(math.Round(float64(f.Packets)*share)), packets)
+		bytes -= c.Bytes
+		packets -= c.Packets
+		a.add(slot, key, c)
+
+		slot = next
+		c = RollupCounters{}
+	}
+}
+
+// series returns all groups with zero-filled points, largest total first
+func (a *seriesAccumulator) series(since, until time.Time, step time.Duration) []TimeSeries {
+	result := make([]TimeSeries, 0, len(a.groups))
+	for _, group := range a.groups {
+		s := TimeSeries{Labels: group.labels, Total: group.total}
+		for ts := since; ts.Before(until); ts = ts.Add(step) {
+			point := TimePoint{Time: ts}
+			if c := group.points[ts]; c != nil {
+				point.RollupCounters = *c
+			}
+			s.Points = append(s.Points, point)
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Total.Bytes > result[j].Total.Bytes
+	})
+	return result
+}
+
+// exprUsesOnly reports whether all conditions of an expression use the given fields
+func exprUsesOnly(node ExprNode, fields map[string]bool) bool {
+	switch n := node.(type) {
+	case *ConditionNode:
+		return fields[n.Field]
+	case *AndNode:
+		for _, child := range n.Children {
+			if !exprUsesOnly(child, fields) {
+				return false
+			}
+		}
+		return true
+	case *OrNode:
+		for _, child := range n.Children {
+			if !exprUsesOnly(child, fields) {
+				return false
+			}
+		}
+		return true
+	case *NotNode:
+		return exprUsesOnly(n.Child, fields)
+	}
+	return false
+}
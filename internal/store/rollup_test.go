@@ -0,0 +1,53 @@
+package store
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+func TestTimeSeriesFlowTime(t *testing.T) {
+	fs := New(100)
+	fs.Add([]types.Flow{
+		{SrcAddr: netip.MustParseAddr("10.0.0.1"), DstAddr: netip.MustParseAddr("10.0.0.2"), Protocol: 6,
+			Bytes: 1200, Packets: 12, StartTime: testEpoch, EndTime: testEpoch.Add(2 * time.Minute),
+			ReceivedAt: testEpoch.Add(2 * time.Minute)},
+		{SrcAddr: netip.MustParseAddr("10.0.0.3"), DstAddr: netip.MustParseAddr("10.0.0.4"), Protocol: 17,
+			Bytes: 100, Packets: 1, StartTime: testEpoch.Add(150 * time.Second), EndTime: testEpoch.Add(150 * time.Second),
+			ReceivedAt: testEpoch.Add(3 * time.Minute), FlowCount: 3},
+	})
+
+	for _, tc := range []struct {
+		name         string
+		since, until time.Time
+		bytes        []uint64 // Per minute from since
+		flows        []uint64
+	}{
+		{"spread", testEpoch.Add(-time.Minute), testEpoch.Add(4 * time.Minute),
+			[]uint64{0, 600, 600, 100, 0}, []uint64{0, 1, 0, 3, 0}},
+		{"clipped", testEpoch.Add(90 * time.Second), testEpoch.Add(3 * time.Minute),
+			[]uint64{300, 100}, []uint64{1, 3}},
+	} {
+		result, err := fs.QueryTimeSeries(TimeSeriesQuery{Since: tc.since, Until: tc.until, Step: time.Minute, FlowTime: true})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !result.FlowTime || !result.FromFlows || len(result.Series) != 1 {
+			t.Fatalf("%s: result %+v", tc.name, result)
+		}
+		points := result.Series[0].Points
+		if len(points) != len(tc.bytes) {
+			t.Fatalf("%s: %d points, want %d", tc.name, len(points), len(tc.bytes))
+		}
+		for i, p := range points {
+			if want := tc.since.Truncate(time.Minute).Add(time.Duration(i) * time.Minute); !p.Time.Equal(want) {
+				t.Errorf("%s: point %d at %v, want %v", tc.name, i, p.Time, want)
+			}
+			if p.Bytes != tc.bytes[i] || p.Flows != tc.flows[i] {
+				t.Errorf("%s: point %d = %d bytes, %d flows, want %d, %d", tc.name, i, p.Bytes, p.Flows, tc.bytes[i], tc.flows[i])
+			}
+		}
+	}
+}
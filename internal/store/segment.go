@@ -0,0 +1,167 @@
+package store
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Flows are kept in segments of up to segmentCapacity flows in arrival order.
+// Only the newest segment (the head) receives flows: it is written by the single
+// ingest path (under fs.mu) and publishes its length atomically after each flow,
+// so readers see a consistent prefix without locking. All other segments are
+// sealed and never modified; their index is built in the background and used
+// once published (until then they are scanned). Readers work on an immutable
+// snapshot of the segment list, so ingest never waits for a query, and eviction
+// replaces single segments instead of rebuilding the whole store.
+//
+// Arrival order is receive-time order except for records held back by
+// deduplication (see dedup.go), which are stored up to the dedup window late.
+// Segments therefore track their earliest and latest flow instead of relying
+// on the first and last.
+
+const (
+	minSegmentCapacity = 64
+	maxSegmentCapacity = 8192
+)
+
+// segmentCapacityFor returns the segment size for a store size; eviction works in
+// steps of one segment, so small stores use small segments
+func segmentCapacityFor(maxFlows int) int {
+	return min(max(maxFlows/16, minSegmentCapacity), maxSegmentCapacity)
+}
+
+// segment is a block of flows in arrival order
+type segment struct {
+	flows    []types.Flow              // Head: allocated at full capacity, only flows[:n] is valid
+	n        atomic.Int64              // Number of valid flows
+	index    atomic.Pointer[flowIndex] // Secondary indexes, nil for the head and until built
+	oldestAt atomic.Int64              // Position of the earliest received flow
+	newestAt atomic.Int64              // Position of the latest received flow
+}
+
+func newHeadSegment(capacity int) *segment {
+	return &segment{flows: make([]types.Flow, capacity)}
+}
+
+// newSealedSegment creates an immutable segment and starts indexing it. flows
+// must not be modified afterwards.
+func newSealedSegment(flows []types.Flow) *segment {
+	seg := &segment{flows: flows}
+	for i := range flows {
+		seg.bound(i)
+	}
+	seg.n.Store(int64(len(flows)))
+	go func() {
+		seg.index.Store(buildFlowIndex(flows))
+	}()
+	return seg
+}
+
+// slice returns the valid flows; callers must not modify them
+func (s *segment) slice() []types.Flow {
+	return s.flows[:s.n.Load()]
+}
+
+// oldest returns the earliest receive time of the segment's flows
+func (s *segment) oldest() time.Time {
+	if s.len() == 0 {
+		return time.Time{}
+	}
+	return s.flows[s.oldestAt.Load()].ReceivedAt
+}
+
+// newest returns the latest receive time of the segment's flows
+func (s *segment) newest() time.Time {
+	if s.len() == 0 {
+		return time.Time{}
+	}
+	return s.flows[s.newestAt.Load()].ReceivedAt
+}
+
+// bound updates the oldest and newest positions for the flow at position i,
+// which must be written before. Single writer only.
+func (s *segment) bound(i int) {
+	t := s.flows[i].ReceivedAt
+	if i == 0 || t.Before(s.flows[s.oldestAt.Load()].ReceivedAt) {
+		s.oldestAt.Store(int64(i))
+	}
+	if i == 0 || !t.Before(s.flows[s.newestAt.Load()].ReceivedAt) {
+		s.newestAt.Store(int64(i))
+	}
+}
+
+func (s *segment) len() int {
+	return int(s.n.Load())
+}
+
+// full reports whether the head has no space left
+func (s *segment) full() bool {
+	return s.len() == len(s.flows)
+}
+
+// append writes a flow into the head and publishes it. Single writer only.
+func (s *segment) append(flow *types.Flow) {
+	n := s.n.Load()
+	s.flows[n] = *flow
+	s.bound(int(n))
+	s.n.Store(n + 1)
+}
+
+// storeView is an immutable snapshot of the segment list, oldest first. The
+// last segment is the head.
+type storeView struct {
+	segments []*segment
+}
+
+func (v *storeView) head() *segment {
+	return v.segments[len(v.segments)-1]
+}
+
+// snapshot returns the current segment list
+func (fs *FlowStore) snapshot() *storeView {
+	return fs.view.Load()
+}
+
+// replaceSegments publishes a new segment list. Must be called with fs.mu held.
+func (fs *FlowStore) replaceSegments(segments []*segment) {
+	fs.view.Store(&storeView{segments: segments})
+}
+
+// appendFlow stores a flow in the head, sealing it first if full. Must be called with fs.mu held.
+func (fs *FlowStore) appendFlow(flow *types.Flow) {
+	head := fs.snapshot().head()
+	if head.full() {
+		fs.sealHead()
+		head = fs.snapshot().head()
+	}
+	head.append(flow)
+	fs.count.Add(1)
+	fs.memory.Add(estimateFlowSize(flow))
+}
+
+// sealHead seals the head and starts a new one. Must be called with fs.mu held.
+func (fs *FlowStore) sealHead() {
+	view := fs.snapshot()
+	head := view.head()
+	n := head.len()
+	if n == 0 {
+		return
+	}
+
+	// The sealed segment shares the head's array; the old head object is no
+	// longer written, so readers still holding it keep a valid prefix
+	flows := head.flows[:n:n]
+	if n < len(head.flows)/2 {
+		// Sealed early for max-age: don't keep the unused capacity alive
+		flows = slices.Clone(flows)
+	}
+	sealed := newSealedSegment(flows)
+
+	segments := make([]*segment, 0, len(view.segments)+1)
+	segments = append(segments, view.segments[:len(view.segments)-1]...)
+	segments = append(segments, sealed, newHeadSegment(fs.segmentCapacity))
+	fs.replaceSegments(segments)
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Session stitching. Exporters split long-lived flows into one record per
+// active timeout, so a 2-hour transfer shows up as dozens of fragments, while
+// merging everything with the same 5-tuple (QueryAggregatedFlows) also joins
+// unrelated connections that reused it hours apart. A session is a run of
+// records of the same 5-tuple and exporter whose times are contiguous: each
+// record starts at most the gap after the session's end so far, and the
+// previous record didn't close the connection (FIN, RST or end of flow).
+
+// DefaultSessionGap is the largest pause between two records of one session.
+// Connections idle for longer than the exporter's inactive timeout get a new
+// record once traffic resumes; pauses up to the gap don't split the session.
+const DefaultSessionGap = 2 * time.Minute
+
+// Session is a stitched run of records. The embedded flow holds the totals,
+// the session start and end, the accumulated TCP flags and the receive time
+// and end reason of the latest record.
+type Session struct {
+	types.Flow
+	Records int // Number of records stitched together
+}
+
+// sessionKey groups the records that can form sessions
+type sessionKey struct {
+	flow     types.FlowKey
+	exporter netip.Addr
+}
+
+// closesSession reports whether the record ends the connection
+func closesSession(f *types.Flow) bool {
+	state := f.State()
+	return state == types.StateCompleted || state == types.StateReset
+}
+
+// newSession starts a session with its first record
+func newSession(f *types.Flow) Session {
+	s := Session{Flow: *f, Records: 1}
+	s.StartTime = recordStart(f)
+	s.EndTime = recordEnd(f)
+	return s
+}
+
+// add stitches the next record onto the session
+func (s *Session) add(f *types.Flow) {
+	s.Records++
+	s.Bytes += f.Bytes
+	s.Packets += f.Packets
+	s.TCPFlags |= f.TCPFlags
+	if end := recordEnd(f); end.After(s.EndTime) {
+		s.EndTime = end
+	}
+	if f.ReceivedAt.After(s.ReceivedAt) {
+		s.ReceivedAt = f.ReceivedAt
+		s.EndReason = f.EndReason
+	}
+	if f.LastAccessed.After(s.LastAccessed) {
+		s.LastAccessed = f.LastAccessed
+	}
+	s.TimeImplausible = s.TimeImplausible || f.TimeImplausible
+}
+
+// stitchSessions appends the sessions formed by the records of one sessionKey
+func stitchSessions(sessions []Session, records []*types.Flow, gap time.Duration) []Session {
+	slices.SortFunc(records, func(a, b *types.Flow) int {
+		return recordStart(a).Compare(recordStart(b))
+	})
+
+	first := len(sessions)
+	closed := false
+	for _, f := range records {
+		n := len(sessions)
+		if n > first && !closed && !recordStart(f).After(sessions[n-1].EndTime.Add(gap)) {
+			sessions[n-1].add(f)
+		} else {
+			sessions = append(sessions, newSession(f))
+		}
+		closed = closesSession(f)
+	}
+	return sessions
+}
+
+// QuerySessions stitches the matching records into sessions, sorted by the
+// specified field. gap <= 0 uses DefaultSessionGap. With filter.Since set,
+// archived records are included, so sessions can start before the oldest
+// flow in memory.
+func (fs *FlowStore) QuerySessions(filter *Filter, gap time.Duration, sortBy SortField, ascending bool, limit int) []Session {
+	if gap <= 0 {
+		gap = DefaultSessionGap
+	}
+
+	// Pointers stay valid: stored flows are never modified
+	groups := make(map[sessionKey][]*types.Flow)
+	fs.forEachMatchWithArchive(filter, func(flow *types.Flow) {
+		key := sessionKey{flow: flow.FlowKey(), exporter: flow.ExporterIP}
+		groups[key] = append(groups[key], flow)
+	})
+
+	var sessions []Session
+	for _, records := range groups {
+		sessions = stitchSessions(sessions, records, gap)
+	}
+
+	// Sort sessions
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := &sessions[i], &sessions[j]
+		var less bool
+		switch sortBy {
+		case SortByTime:
+			less = a.ReceivedAt.Before(b.ReceivedAt)
+		case SortByBytes:
+			less = a.Bytes < b.Bytes
+		case SortByPackets:
+			less = a.Packets < b.Packets
+		case SortBySrcIP:
+			less = a.SrcAddr.Compare(b.SrcAddr) < 0
+		case SortByDstIP:
+			less = a.DstAddr.Compare(b.DstAddr) < 0
+		case SortByProtocol:
+			less = a.Protocol < b.Protocol
+		default:
+			less = a.ReceivedAt.Before(b.ReceivedAt)
+		}
+		if ascending {
+			return less
+		}
+		return !less
+	})
+
+	// Limit results
+	if limit > 0 && limit < len(sessions) {
+		sessions = sessions[:limit]
+	}
+
+	return sessions
+}
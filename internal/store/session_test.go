@@ -0,0 +1,144 @@
+package store
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// sessionRecord is a record of a test connection and the session it belongs to
+type sessionRecord struct {
+	session       string // Expected session
+	sport         uint16
+	exporter      byte
+	start, length time.Duration // From testEpoch
+	flags         uint8
+	reason        types.EndReason
+	bytes         uint64
+}
+
+func (r sessionRecord) flow() types.Flow {
+	start := testEpoch.Add(r.start)
+	return types.Flow{
+		SrcAddr:    netip.MustParseAddr("10.0.0.1"),
+		DstAddr:    netip.MustParseAddr("192.0.2.80"),
+		SrcPort:    r.sport,
+		DstPort:    443,
+		Protocol:   6,
+		Bytes:      r.bytes,
+		Packets:    r.bytes / 100,
+		TCPFlags:   r.flags,
+		EndReason:  r.reason,
+		ExporterIP: netip.AddrFrom4([4]byte{192, 0, 2, r.exporter}),
+		StartTime:  start,
+		EndTime:    start.Add(r.length),
+		ReceivedAt: start.Add(r.length + time.Second),
+	}
+}
+
+func TestQuerySessions(t *testing.T) {
+	const (
+		ack = 0x10
+		fin = 0x01 | ack
+		syn = 0x02 | ack
+		rst = 0x04 | ack
+		psh = 0x08 | ack
+	)
+	m := time.Minute
+	records := []sessionRecord{
+		// Active-timeout fragments of one transfer, stored out of order
+		{"transfer", 40000, 1, 10 * m, 5 * m, psh, types.EndReasonActiveTimeout, 5000},
+		{"transfer", 40000, 1, 0, 5 * m, syn, types.EndReasonActiveTimeout, 1000},
+		{"transfer", 40000, 1, 15*m + 30*time.Second, 2 * m, fin, types.EndReasonEndOfFlow, 300},
+		{"transfer", 40000, 1, 5 * m, 5 * m, ack, types.EndReasonActiveTimeout, 2000},
+
+		// A pause of exactly the gap continues the session, a longer one splits it
+		{"paused", 40001, 1, 0, m, ack, types.EndReasonIdleTimeout, 100},
+		{"paused", 40001, 1, 3 * m, m, ack, types.EndReasonIdleTimeout, 200},
+		{"resumed", 40001, 1, 6*m + time.Second, m, ack, types.EndReasonIdleTimeout, 400},
+
+		// FIN and RST close the connection; a reused tuple starts a new session
+		{"closed", 40002, 1, 0, m, fin, types.EndReasonEndOfFlow, 100},
+		{"reset", 40002, 1, m, m, rst, types.EndReasonUnknown, 200},
+		{"reopened", 40002, 1, 2 * m, m, syn, types.EndReasonActiveTimeout, 400},
+		{"reopened", 40002, 1, 3 * m, m, ack, types.EndReasonIdleTimeout, 800},
+
+		// The same connection seen by another exporter is its own session
+		{"other exporter", 40000, 2, 0, 5 * m, syn, types.EndReasonActiveTimeout, 1000},
+		{"other exporter", 40000, 2, 5 * m, 5 * m, ack, types.EndReasonActiveTimeout, 2000},
+	}
+
+	fs := New(100)
+	var total uint64
+	for _, r := range records {
+		fs.Add([]types.Flow{r.flow()})
+		total += r.bytes
+	}
+
+	// Expected sessions from their records
+	want := make(map[string]*Session)
+	for _, r := range records {
+		f := r.flow()
+		s := want[r.session]
+		if s == nil {
+			s = &Session{Flow: f}
+			s.Bytes, s.Packets = 0, 0
+			want[r.session] = s
+		}
+		s.Records++
+		s.Bytes += f.Bytes
+		s.Packets += f.Packets
+		s.TCPFlags |= f.TCPFlags
+		if f.StartTime.Before(s.StartTime) {
+			s.StartTime = f.StartTime
+		}
+		if f.EndTime.After(s.EndTime) {
+			s.EndTime = f.EndTime
+		}
+		if f.ReceivedAt.After(s.ReceivedAt) {
+			s.ReceivedAt = f.ReceivedAt
+			s.EndReason = f.EndReason
+		}
+	}
+
+	sessions := fs.QuerySessions(nil, 0, SortByTime, true, 0)
+	if len(sessions) != len(want) {
+		t.Fatalf("%d sessions, want %d", len(sessions), len(want))
+	}
+	var bytes uint64
+	for _, got := range sessions {
+		bytes += got.Bytes
+		var name string
+		for n, s := range want {
+			if s.SrcPort == got.SrcPort && s.ExporterIP == got.ExporterIP && s.StartTime.Equal(got.StartTime) {
+				name = n
+			}
+		}
+		s := want[name]
+		if s == nil {
+			t.Errorf("unexpected session: port %d from %v at %v", got.SrcPort, got.ExporterIP, got.StartTime)
+			continue
+		}
+		if got.Records != s.Records || got.Bytes != s.Bytes || got.Packets != s.Packets {
+			t.Errorf("%s: %d records, %d bytes, %d packets, want %d, %d, %d",
+				name, got.Records, got.Bytes, got.Packets, s.Records, s.Bytes, s.Packets)
+		}
+		if !got.EndTime.Equal(s.EndTime) || !got.ReceivedAt.Equal(s.ReceivedAt) {
+			t.Errorf("%s: ends %v, received %v, want %v, %v", name, got.EndTime, got.ReceivedAt, s.EndTime, s.ReceivedAt)
+		}
+		if got.TCPFlags != s.TCPFlags || got.EndReason != s.EndReason {
+			t.Errorf("%s: flags %#x, end reason %v, want %#x, %v", name, got.TCPFlags, got.EndReason, s.TCPFlags, s.EndReason)
+		}
+		delete(want, name)
+	}
+	if bytes != total {
+		t.Errorf("sessions hold %d bytes, records %d", bytes, total)
+	}
+
+	// A shorter gap splits the pause of 2 minutes as well, not the transfer
+	if sessions := fs.QuerySessions(nil, time.Minute, SortByTime, true, 0); len(sessions) != 8 {
+		t.Errorf("gap 1m: %d sessions, want 8", len(sessions))
+	}
+}
@@ -0,0 +1,430 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Snapshot file format: the magic "NFSNAP", a big-endian uint16 version and a
+// gzip stream. The stream holds one length-prefixed state record (counters,
+// eviction stats, exporter clocks), the number of retained and of all flows, and
+// the flows as length-prefixed records (codec.go), retained segment first, then
+// oldest to newest. Like flow records, the state record only ever grows at the
+// end and readers ignore trailing bytes they don't know.
+
+const (
+	snapshotMagic   = "NFSNAP"
+	snapshotVersion = 1
+
+	// Upper bounds for the record lengths read from a snapshot, so a corrupt
+	// length fails as a short record instead of a huge allocation. A flow record
+	// is at most an app name (16-bit length in IPFIX) plus the fixed fields, the
+	// state record about 150 bytes per exporter.
+	maxSnapshotStateLen = 16 << 20
+	maxSnapshotFlowLen  = 128 << 10
+)
+
+var errNotSnapshot = errors.New("not a flow store snapshot")
+
+// SnapshotInfo describes a written or restored snapshot
+type SnapshotInfo struct {
+	Path     string
+	Created  time.Time // When the snapshot was taken
+	Flows    int
+	Bytes    int64 // File size (compressed)
+	Duration time.Duration
+}
+
+// SetSnapshotFile sets the file used by SaveSnapshot without a path, "" disables it
+func (fs *FlowStore) SetSnapshotFile(path string) {
+	fs.snapshotMu.Lock()
+	defer fs.snapshotMu.Unlock()
+	fs.snapshotPath = path
+}
+
+// SnapshotFile returns the configured snapshot file, "" if none
+func (fs *FlowStore) SnapshotFile() string {
+	fs.snapshotMu.Lock()
+	defer fs.snapshotMu.Unlock()
+	return fs.snapshotPath
+}
+
+// LastSnapshot returns the most recently written or restored snapshot, ok is
+// false if there was none
+func (fs *FlowStore) LastSnapshot() (SnapshotInfo, bool) {
+	fs.snapshotMu.Lock()
+	defer fs.snapshotMu.Unlock()
+	return fs.lastSnapshot, !fs.lastSnapshot.Created.IsZero()
+}
+
+// SaveSnapshot writes the store to the configured snapshot file. The file is
+// replaced atomically, a crash while writing keeps the previous snapshot.
+func (fs *FlowStore) SaveSnapshot() (SnapshotInfo, error) {
+	fs.snapshotMu.Lock()
+	defer fs.snapshotMu.Unlock()
+
+	if fs.snapshotPath == "" {
+		return SnapshotInfo{}, fmt.Errorf("snapshot file not set")
+	}
+	start := time.Now()
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.snapshotPath), filepath.Base(fs.snapshotPath)+".tmp*")
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	info, err := fs.WriteSnapshot(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fs.snapshotPath); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	info.Path = fs.snapshotPath
+	info.Duration = time.Since(start)
+	fs.lastSnapshot = info
+	return info, nil
+}
+
+// LoadSnapshot restores the store from the configured snapshot file. A missing
+// file returns an error satisfying errors.Is(err, os.ErrNotExist).
+func (fs *FlowStore) LoadSnapshot() (SnapshotInfo, error) {
+	fs.snapshotMu.Lock()
+	defer fs.snapshotMu.Unlock()
+
+	if fs.snapshotPath == "" {
+		return SnapshotInfo{}, fmt.Errorf("snapshot file not set")
+	}
+	start := time.Now()
+
+	f, err := os.Open(fs.snapshotPath)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer f.Close()
+
+	info, err := fs.ReadSnapshot(f)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to read snapshot %s: %w", fs.snapshotPath, err)
+	}
+	if st, err := f.Stat(); err == nil {
+		info.Bytes = st.Size()
+	}
+	info.Path = fs.snapshotPath
+	info.Duration = time.Since(start)
+	fs.lastSnapshot = info
+	return info, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteSnapshot writes the flows, counters, exporter clocks and eviction stats
+// to w. Flows are read from a snapshot of the segment list, so ingest continues
+// meanwhile; flows added during the write are not included.
+func (fs *FlowStore) WriteSnapshot(w io.Writer) (SnapshotInfo, error) {
+	fs.mu.RLock()
+	created := time.Now()
+	view := fs.snapshot()
+	retained := fs.retained
+	state := fs.appendSnapshotState(nil, created)
+	fs.mu.RUnlock()
+
+	var retainedCount, total int
+	for _, seg := range view.segments {
+		total += seg.len()
+		if seg == retained {
+			retainedCount = seg.len()
+		}
+	}
+
+	cw := &countingWriter{w: w}
+	header := binary.BigEndian.AppendUint16([]byte(snapshotMagic), snapshotVersion)
+	if _, err := cw.Write(header); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	zw, _ := gzip.NewWriterLevel(cw, gzip.BestSpeed)
+	bw := bufio.NewWriterSize(zw, 256*1024)
+
+	buf := binary.AppendUvarint(nil, uint64(len(state)))
+	buf = append(buf, state...)
+	buf = binary.AppendUvarint(buf, uint64(retainedCount))
+	buf = binary.AppendUvarint(buf, uint64(total))
+	if _, err := bw.Write(buf); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	// The retained segment always comes first in the list
+	written := 0
+	for _, seg := range view.segments {
+		flows := seg.slice()
+		for i := range flows {
+			if written == total {
+				break // The head grew after counting
+			}
+			buf = appendFlow(buf[:0], &flows[i])
+			if _, err := bw.Write(buf); err != nil {
+				return SnapshotInfo{}, err
+			}
+			written++
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{Created: created, Flows: written, Bytes: cw.n}, nil
+}
+
+// ReadSnapshot replaces the stored flows, counters, exporter clocks and eviction
+// stats with the snapshot read from r. The archive, history and time series are
+// not touched. Flows beyond the current limits are evicted as usual.
+func (fs *FlowStore) ReadSnapshot(r io.Reader) (SnapshotInfo, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return SnapshotInfo{}, errNotSnapshot
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version > snapshotVersion {
+		return SnapshotInfo{}, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("invalid snapshot data: %w", err)
+	}
+	defer zr.Close()
+	zbr := bufio.NewReaderSize(zr, 256*1024)
+
+	// State record
+	stateLen, err := binary.ReadUvarint(zbr)
+	if err != nil || stateLen > maxSnapshotStateLen {
+		return SnapshotInfo{}, errShortRecord
+	}
+	rec := make([]byte, stateLen)
+	if _, err := io.ReadFull(zbr, rec); err != nil {
+		return SnapshotInfo{}, errShortRecord
+	}
+	var state snapshotState
+	if err := state.decode(rec); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	// Flows
+	retainedCount, err := binary.ReadUvarint(zbr)
+	if err != nil {
+		return SnapshotInfo{}, errShortRecord
+	}
+	total, err := binary.ReadUvarint(zbr)
+	if err != nil || retainedCount > total {
+		return SnapshotInfo{}, errShortRecord
+	}
+	flows := make([]types.Flow, 0, min(total, 1<<16)) // total is not trusted, append grows
+	for range total {
+		length, err := binary.ReadUvarint(zbr)
+		if err != nil || length > maxSnapshotFlowLen {
+			return SnapshotInfo{}, errShortRecord
+		}
+		if uint64(cap(rec)) < length {
+			rec = make([]byte, length)
+		}
+		rec = rec[:length]
+		if _, err := io.ReadFull(zbr, rec); err != nil {
+			return SnapshotInfo{}, errShortRecord
+		}
+		flow, err := decodeFlowRecord(rec)
+		if err != nil {
+			return SnapshotInfo{}, err
+		}
+		flows = append(flows, flow)
+	}
+
+	fs.restore(&state, flows, int(retainedCount))
+	return SnapshotInfo{Created: state.created, Flows: len(flows)}, nil
+}
+
+// restore replaces the store contents with restored state and flows
+func (fs *FlowStore) restore(state *snapshotState, flows []types.Flow, retainedCount int) {
+	fs.maintMu.Lock()
+	defer fs.maintMu.Unlock()
+
+	fs.mu.Lock()
+
+	fs.stats = state.stats
+	fs.stats.UniqueExporters = len(state.exporters)
+	fs.evictionStats = state.eviction
+	fs.exporters = state.exporters
+
+	// Sequence numbers continue after the restored ones and never go back, as
+	// clients may hold cursors; flows from older snapshots get new numbers
+	seq := fs.seq.Load()
+	for i := range flows {
+		seq = max(seq, flows[i].Seq)
+	}
+	for i := range flows {
+		if flows[i].Seq == 0 {
+			seq++
+			flows[i].Seq = seq
+		}
+	}
+	fs.seq.Store(seq)
+
+	var segments []*segment
+	fs.retained = nil
+	if retainedCount > 0 {
+		fs.retained = newSealedSegment(flows[:retainedCount:retainedCount])
+		segments = append(segments, fs.retained)
+	}
+	rest := flows[retainedCount:]
+	for len(rest) > 0 {
+		n := min(len(rest), fs.segmentCapacity)
+		segments = append(segments, newSealedSegment(rest[:n:n]))
+		rest = rest[n:]
+	}
+	segments = append(segments, newHeadSegment(fs.segmentCapacity))
+	fs.replaceSegments(segments)
+
+	fs.hist = byteHistogram{}
+	var memory int64
+	for i := range flows {
+		fs.hist.add(flows[i].Bytes)
+		memory += estimateFlowSize(&flows[i])
+	}
+	fs.count.Store(int64(len(flows)))
+	fs.memory.Store(memory)
+	fs.mu.Unlock()
+
+	fs.evictFlows()
+}
+
+// snapshotState is the non-flow part of a snapshot
+type snapshotState struct {
+	created   time.Time
+	stats     Stats
+	eviction  EvictionStats
+	exporters map[netip.Addr]*exporterClock
+}
+
+// appendSnapshotState encodes counters, eviction stats and exporter clocks. Must
+// be called with fs.mu held.
+func (fs *FlowStore) appendSnapshotState(buf []byte, created time.Time) []byte {
+	buf = appendTime(buf, created)
+
+	s := &fs.stats
+	for _, v := range []uint64{s.TotalFlows, s.TotalBytes, s.TotalPackets, s.V5Flows, s.V9Flows, s.IPFIXFlows, s.LegacyFlows} {
+		buf = binary.AppendUvarint(buf, v)
+	}
+
+	e := &fs.evictionStats
+	buf = binary.AppendUvarint(buf, e.TotalEvicted)
+	buf = binary.AppendUvarint(buf, e.FIFOEvicted)
+	buf = binary.AppendUvarint(buf, e.AgeEvicted)
+	buf = binary.AppendUvarint(buf, uint64(e.TopKProtected))
+	buf = binary.AppendUvarint(buf, uint64(e.LRUProtected))
+	buf = binary.AppendUvarint(buf, uint64(len(e.Policies)))
+	for _, p := range e.Policies {
+		buf = appendString(buf, p.Name)
+		buf = binary.AppendUvarint(buf, uint64(p.Protected))
+		buf = binary.AppendUvarint(buf, p.Evicted)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(fs.exporters)))
+	for addr, c := range fs.exporters {
+		buf = appendIP(buf, addr)
+		buf = binary.AppendUvarint(buf, c.stats.Flows)
+		buf = binary.AppendUvarint(buf, c.stats.Packets)
+		buf = appendTime(buf, c.stats.FirstSeen)
+		buf = appendTime(buf, c.stats.LastSeen)
+		buf = binary.AppendVarint(buf, int64(c.stats.Offset))
+		buf = binary.AppendVarint(buf, int64(c.stats.LastOffset))
+		buf = appendBool(buf, c.stats.Corrected)
+		buf = appendTime(buf, c.lastExportTime)
+		for _, v := range []float64{c.stats.Drift, c.n, c.sumT, c.sumO, c.sumTT, c.sumTO} {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	}
+	return buf
+}
+
+func (s *snapshotState) decode(rec []byte) error {
+	d := &decoder{data: rec}
+	s.created = d.time()
+
+	st := &s.stats
+	for _, v := range []*uint64{&st.TotalFlows, &st.TotalBytes, &st.TotalPackets, &st.V5Flows, &st.V9Flows, &st.IPFIXFlows, &st.LegacyFlows} {
+		*v = d.uvarint()
+	}
+
+	e := &s.eviction
+	e.TotalEvicted = d.uvarint()
+	e.FIFOEvicted = d.uvarint()
+	e.AgeEvicted = d.uvarint()
+	e.TopKProtected = int(d.uvarint())
+	e.LRUProtected = int(d.uvarint())
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		e.Policies = append(e.Policies, PolicyStats{
+			Name:      d.string(),
+			Protected: int(d.uvarint()),
+			Evicted:   d.uvarint(),
+		})
+	}
+
+	s.exporters = make(map[netip.Addr]*exporterClock)
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		addr := d.ip()
+		c := &exporterClock{}
+		c.stats.Address = addr.String()
+		c.stats.Flows = d.uvarint()
+		c.stats.Packets = d.uvarint()
+		c.stats.FirstSeen = d.time()
+		c.stats.LastSeen = d.time()
+		c.stats.Offset = time.Duration(d.varint())
+		c.stats.LastOffset = time.Duration(d.varint())
+		c.stats.Corrected = d.byte() != 0
+		c.lastExportTime = d.time()
+		for _, v := range []*float64{&c.stats.Drift, &c.n, &c.sumT, &c.sumO, &c.sumTT, &c.sumTO} {
+			if b := d.take(8); b != nil {
+				*v = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}
+		}
+		// The drift sums are relative to the last sample, which was received
+		// with the last flow of its packet
+		if c.n > 0 {
+			c.lastSample = c.stats.LastSeen
+		}
+		s.exporters[addr] = c
+	}
+	return d.err
+}
@@ -0,0 +1,379 @@
+package store
+
+import (
+	"bytes"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"netflow-collector/internal/resolver"
+	"netflow-collector/pkg/types"
+)
+
+// sqlExpr is a translated filter expression. Exact is false if the SQL only
+// selects a superset of the matching flows (e.g. service names, which depend on
+// the port/protocol tables); those rows must be checked with Filter.Matches.
+type sqlExpr struct {
+	SQL   string
+	Args  []any
+	Exact bool
+}
+
+var sqlTrue = sqlExpr{SQL: "1", Exact: true}
+
+// filterToSQL translates a filter (expression tree and time range) into a WHERE clause
+func filterToSQL(filter *Filter) sqlExpr {
+	if filter == nil {
+		return sqlTrue
+	}
+
+	var parts []sqlExpr
+	if !filter.Since.IsZero() {
+		parts = append(parts, sqlExpr{SQL: "received_at >= ?", Args: []any{filter.Since.UnixNano()}, Exact: true})
+	}
+	if !filter.Until.IsZero() {
+		parts = append(parts, sqlExpr{SQL: "received_at <= ?", Args: []any{filter.Until.UnixNano()}, Exact: true})
+	}
+	if filter.HasFlowTimeRange() {
+		// Start and end are only in the record: narrow by receive time, check with Matches
+		expr := sqlExpr{SQL: "1"}
+		if !filter.From.IsZero() {
+			expr = sqlExpr{SQL: "received_at >= ?", Args: []any{filter.From.Add(-flowTimeSlack).UnixNano()}}
+		}
+		parts = append(parts, expr)
+	}
+	if filter.Root != nil {
+		parts = append(parts, nodeToSQL(filter.Root))
+	}
+	return joinSQL(parts, " AND ")
+}
+
+// nodeToSQL translates one node of the filter expression tree
+func nodeToSQL(node ExprNode) sqlExpr {
+	switch n := node.(type) {
+	case *AndNode:
+		parts := make([]sqlExpr, 0, len(n.Children))
+		for _, child := range n.Children {
+			parts = append(parts, nodeToSQL(child))
+		}
+		return joinSQL(parts, " AND ")
+	case *OrNode:
+		parts := make([]sqlExpr, 0, len(n.Children))
+		for _, child := range n.Children {
+			parts = append(parts, nodeToSQL(child))
+		}
+		return joinSQL(parts, " OR ")
+	case *NotNode:
+		return notSQL(nodeToSQL(n.Child))
+	case *ConditionNode:
+		expr := conditionToSQL(n)
+		if n.Negated {
+			return notSQL(expr)
+		}
+		return expr
+	}
+
+	// Unknown node type: select everything and let Matches decide
+	return sqlExpr{SQL: "1"}
+}
+
+// notSQL negates an expression. The negation of a superset is not a superset,
+// so inexact expressions fall back to selecting all rows.
+func notSQL(e sqlExpr) sqlExpr {
+	if !e.Exact {
+		return sqlExpr{SQL: "1"}
+	}
+	return sqlExpr{SQL: "NOT coalesce(" + e.SQL + ", 0)", Args: e.Args, Exact: true}
+}
+
+// joinSQL combines expressions with AND or OR
+func joinSQL(parts []sqlExpr, op string) sqlExpr {
+	if len(parts) == 0 {
+		return sqlTrue
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	result := sqlExpr{Exact: true}
+	sqls := make([]string, len(parts))
+	for i, p := range parts {
+		sqls[i] = "(" + p.SQL + ")"
+		result.Args = append(result.Args, p.Args...)
+		result.Exact = result.Exact && p.Exact
+	}
+	result.SQL = strings.Join(sqls, op)
+	return result
+}
+
+// conditionToSQL translates a single condition, mirroring ConditionNode.Evaluate
+func conditionToSQL(c *ConditionNode) sqlExpr {
+	if c.Set != nil {
+		return setSQL(c)
+	}
+
+	switch c.Field {
+	case "src", "sip", "srcip":
+		return addrSQL(c, "src_addr", "src_ip")
+	case "dst", "dip", "dstip":
+		return addrSQL(c, "dst_addr", "dst_ip")
+	case "ip":
+		src, dst := addrSQL(c, "src_addr", "src_ip"), addrSQL(c, "dst_addr", "dst_ip")
+		return joinSQL([]sqlExpr{src, dst}, " OR ")
+	case "exporter", "exp":
+		return addrSQL(c, "exporter", "exporter_ip")
+	case "sport", "srcport":
+		return compareSQL(c.Op, c.Port, "src_port")
+	case "dport", "dstport":
+		return compareSQL(c.Op, c.Port, "dst_port")
+	case "port":
+		return compareSQL(c.Op, c.Port, "src_port", "dst_port")
+	case "bytes":
+		return compareSQL(c.Op, c.Number, "bytes")
+	case "packets", "pkts":
+		return compareSQL(c.Op, c.Number, "packets")
+	case "duration", "dur", "bps", "srcas", "dstas", "as":
+		// Only in the record: select all rows and let Matches decide
+		return sqlExpr{SQL: "1"}
+	case "proto", "protocol":
+		return inSQL("protocol", protocolNumbers(c.Value), true)
+	case "service", "svc":
+		return serviceSQL(c.Value)
+	case "app", "application":
+		e := sqlExpr{SQL: "app_name <> '' AND app_name = ? COLLATE NOCASE", Args: []any{c.Value}, Exact: true}
+		if engine, selector, ok := parseAppID(c.Value); ok {
+			e.SQL = "(" + e.SQL + ") OR (app_engine = ? AND app_selector = ?)"
+			e.Args = append(e.Args, engine, int64(selector))
+		}
+		return e
+	case "state":
+		return sqlExpr{SQL: "state = ?", Args: []any{int(c.State)}, Exact: true}
+	case "if":
+		return compareSQL(c.Op, c.Interface, "input_if", "output_if")
+	case "inif":
+		return compareSQL(c.Op, c.Interface, "input_if")
+	case "outif":
+		return compareSQL(c.Op, c.Interface, "output_if")
+	case "self", "local":
+		return sqlExpr{SQL: "src_addr = dst_addr", Exact: true}
+	case "version", "ipversion":
+		switch c.Value {
+		case "4", "v4", "ipv4":
+			return sqlExpr{SQL: "ip_version = 4", Exact: true}
+		case "6", "v6", "ipv6":
+			return sqlExpr{SQL: "ip_version = 6", Exact: true}
+		}
+	}
+	return sqlTrue
+}
+
+// sqlOperators are the SQL operators of the filter comparisons
+var sqlOperators = map[CompareOp]string{
+	OpEqual:        "=",
+	OpLess:         "<",
+	OpLessEqual:    "<=",
+	OpGreater:      ">",
+	OpGreaterEqual: ">=",
+}
+
+// compareSQL compares one or more columns (any of them matches) with a value
+func compareSQL(op CompareOp, value any, cols ...string) sqlExpr {
+	e := sqlExpr{Exact: true}
+	parts := make([]string, len(cols))
+	for i, col := range cols {
+		parts[i] = col + " " + sqlOperators[op] + " ?"
+		e.Args = append(e.Args, value)
+	}
+	e.SQL = strings.Join(parts, " OR ")
+	return e
+}
+
+// addrSQL matches an address column by address, CIDR or range (on the 16-byte
+// form) or substring. Wildcards select all rows and are checked with Matches.
+func addrSQL(c *ConditionNode, textCol, binCol string) sqlExpr {
+	switch {
+	case c.Op == OpContains:
+		return sqlExpr{SQL: "instr(" + textCol + ", ?) > 0", Args: []any{c.Value}, Exact: true}
+	case c.Network.IsValid():
+		lo, hi := cidrRange(c.Network)
+		return betweenSQL(binCol, lo, hi, c.Network.Addr().Is4())
+	case c.First.IsValid():
+		lo, hi := c.First.As16(), c.Last.As16()
+		return betweenSQL(binCol, lo[:], hi[:], c.First.Is4())
+	}
+	return sqlExpr{SQL: "1"}
+}
+
+// setSQL translates a set condition: IN and BETWEEN per column for numbers,
+// BETWEEN on the 16-byte form for addresses, prefixes and ranges
+func setSQL(c *ConditionNode) sqlExpr {
+	s := c.Set
+	switch c.Field {
+	case "sport", "srcport":
+		return rangesSQL(s, "src_port")
+	case "dport", "dstport":
+		return rangesSQL(s, "dst_port")
+	case "port":
+		return joinSQL([]sqlExpr{rangesSQL(s, "src_port"), rangesSQL(s, "dst_port")}, " OR ")
+	case "proto", "protocol":
+		return rangesSQL(s, "protocol")
+	case "if":
+		return joinSQL([]sqlExpr{rangesSQL(s, "input_if"), rangesSQL(s, "output_if")}, " OR ")
+	case "inif":
+		return rangesSQL(s, "input_if")
+	case "outif":
+		return rangesSQL(s, "output_if")
+	case "src", "sip", "srcip":
+		return addrSetSQL(s, "src_ip")
+	case "dst", "dip", "dstip":
+		return addrSetSQL(s, "dst_ip")
+	case "ip":
+		return joinSQL([]sqlExpr{addrSetSQL(s, "src_ip"), addrSetSQL(s, "dst_ip")}, " OR ")
+	case "exporter", "exp":
+		return addrSetSQL(s, "exporter_ip")
+	}
+	// AS numbers are only in the record: select all rows and let Matches decide
+	return sqlExpr{SQL: "1"}
+}
+
+// rangesSQL matches a column against the numeric members of a set
+func rangesSQL(s *valueSet, col string) sqlExpr {
+	var values []int
+	var parts []sqlExpr
+	for _, r := range s.ranges {
+		if r.lo == r.hi {
+			values = append(values, int(r.lo))
+		} else {
+			parts = append(parts, sqlExpr{SQL: col + " BETWEEN ? AND ?", Args: []any{r.lo, r.hi}, Exact: true})
+		}
+	}
+	if len(values) > 0 || len(parts) == 0 {
+		parts = append(parts, inSQL(col, values, true))
+	}
+	return joinSQL(parts, " OR ")
+}
+
+// addrSetSQL matches an address column against the members of a set.
+// Wildcards select all rows and are checked with Matches.
+func addrSetSQL(s *valueSet, binCol string) sqlExpr {
+	if len(s.wildcards) > 0 {
+		return sqlExpr{SQL: "1"}
+	}
+	var parts []sqlExpr
+	for _, n := range s.prefixes {
+		lo, hi := cidrRange(n)
+		parts = append(parts, betweenSQL(binCol, lo, hi, n.Addr().Is4()))
+	}
+	for _, r := range s.addrRanges {
+		lo, hi := r[0].As16(), r[1].As16()
+		parts = append(parts, betweenSQL(binCol, lo[:], hi[:], r[0].Is4()))
+	}
+	return joinSQL(parts, " OR ")
+}
+
+// ipv4Lo and ipv4Hi bound the IPv4 addresses in 16-byte form (::ffff:0:0/96)
+var ipv4Lo, ipv4Hi = cidrRange(netip.PrefixFrom(netip.IPv4Unspecified(), 0))
+
+// betweenSQL matches an address column against a range of the 16-byte form.
+// IPv4 rows are stored IPv4-mapped, so an IPv6 range covering ::ffff:0:0/96
+// also selects them and is left to Matches.
+func betweenSQL(binCol string, lo, hi []byte, ipv4 bool) sqlExpr {
+	exact := ipv4 || bytes.Compare(hi, ipv4Lo) < 0 || bytes.Compare(lo, ipv4Hi) > 0
+	return sqlExpr{SQL: binCol + " BETWEEN ? AND ?", Args: []any{lo, hi}, Exact: exact}
+}
+
+// inSQL builds "col IN (...)", or a false expression for an empty set
+func inSQL(col string, values []int, exact bool) sqlExpr {
+	if len(values) == 0 {
+		return sqlExpr{SQL: "0", Exact: exact}
+	}
+	e := sqlExpr{Exact: exact}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = "?"
+		e.Args = append(e.Args, v)
+	}
+	e.SQL = col + " IN (" + strings.Join(placeholders, ",") + ")"
+	return e
+}
+
+// serviceSQL selects flows on any port that may carry the service, or with a
+// matching protocol name (ICMP fallback). Service names are protocol-specific,
+// so the result is a superset.
+func serviceSQL(name string) sqlExpr {
+	var ports []int
+	for port := 1; port <= 65535; port++ {
+		for _, proto := range []uint8{6, 17, 0} {
+			if strings.EqualFold(resolver.GetServiceName(uint16(port), proto), name) {
+				ports = append(ports, port)
+				break
+			}
+		}
+	}
+
+	parts := []sqlExpr{
+		inSQL("src_port", ports, false),
+		inSQL("dst_port", ports, false),
+		inSQL("protocol", protocolNumbers(name), false),
+	}
+	return joinSQL(parts, " OR ")
+}
+
+// protocolNumbers returns all protocol numbers whose name matches (case-insensitive)
+func protocolNumbers(name string) []int {
+	var result []int
+	for p := 0; p < 256; p++ {
+		f := types.Flow{Protocol: uint8(p)}
+		if strings.EqualFold(f.ProtocolName(), name) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// parseAppID parses an application ID in "engine:selector" form
+func parseAppID(s string) (uint8, uint64, bool) {
+	engineStr, selectorStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, false
+	}
+	engine, err := strconv.ParseUint(engineStr, 10, 8)
+	if err != nil {
+		return 0, 0, false
+	}
+	selector, err := strconv.ParseUint(selectorStr, 10, 64)
+	if err != nil || (engine == 0 && selector == 0) {
+		return 0, 0, false
+	}
+	return uint8(engine), selector, true
+}
+
+// ipBytes returns the 16-byte form of an address (IPv4 as IPv4-mapped), empty for nil
+func ipBytes(ip netip.Addr) []byte {
+	if !ip.IsValid() {
+		return []byte{}
+	}
+	b := ip.Unmap().As16() // IPv4 as IPv4-mapped
+	return b[:]
+}
+
+// cidrRange returns the first and last address of a network in 16-byte form
+func cidrRange(n netip.Prefix) ([]byte, []byte) {
+	bits := n.Bits()
+	if n.Addr().Is4() {
+		bits += 96 // IPv4-mapped prefix
+	}
+
+	lo := n.Masked().Addr().As16()
+	hi := lo
+	for i := range hi {
+		switch {
+		case bits >= 8*(i+1):
+		case bits <= 8*i:
+			hi[i] = 0xff
+		default:
+			hi[i] |= 0xff >> (bits - 8*i)
+		}
+	}
+	return lo[:], hi[:]
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// testEpoch is the receive time of the first test flow
+var testEpoch = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testFlows returns a small mix of IPv4/IPv6 flows covering the filter fields
+func testFlows() []types.Flow {
+	addr := netip.MustParseAddr
+	flows := []types.Flow{
+		{SrcAddr: addr("10.0.0.1"), DstAddr: addr("192.168.1.10"), SrcPort: 51000, DstPort: 443, Protocol: 6,
+			Bytes: 1500000, Packets: 1200, InputIf: 1, OutputIf: 2, SrcAS: 64512, DstAS: 3320,
+			ExporterIP: addr("172.16.0.1"), EndReason: types.EndReasonEndOfFlow, TCPFlags: 0x1b},
+		{SrcAddr: addr("10.0.0.10"), DstAddr: addr("8.8.8.8"), SrcPort: 53000, DstPort: 53, Protocol: 17,
+			Bytes: 120, Packets: 2, InputIf: 1, OutputIf: 3, SrcAS: 64512, DstAS: 15169,
+			ExporterIP: addr("172.16.0.1"), EndReason: types.EndReasonIdleTimeout},
+		{SrcAddr: addr("110.0.0.1"), DstAddr: addr("10.0.0.1"), SrcPort: 8080, DstPort: 40000, Protocol: 6,
+			Bytes: 64000, Packets: 50, InputIf: 4, OutputIf: 1, SrcAS: 4134,
+			ExporterIP: addr("172.16.0.2"), EndReason: types.EndReasonEndOfFlow, TCPFlags: 0x04},
+		{SrcAddr: addr("192.168.1.10"), DstAddr: addr("192.168.1.10"), SrcPort: 123, DstPort: 123, Protocol: 17,
+			Bytes: 76, Packets: 1, InputIf: 2, OutputIf: 2,
+			ExporterIP: addr("172.16.0.2")},
+		{SrcAddr: addr("2001:db8::1"), DstAddr: addr("2001:db8:1::53"), SrcPort: 50000, DstPort: 8443, Protocol: 6,
+			Bytes: 2500000000, Packets: 1800000, InputIf: 5, OutputIf: 6, DstAS: 64600,
+			ExporterIP: addr("2001:db8:ffff::1"), AppID: types.AppID{Engine: 13, Selector: 453}, AppName: "ms-teams"},
+		{SrcAddr: addr("fe80::1"), DstAddr: addr("ff02::1"), Protocol: 58,
+			Bytes: 96, Packets: 1, InputIf: 5,
+			ExporterIP: addr("2001:db8:ffff::1")},
+		{SrcAddr: addr("10.1.2.3"), DstAddr: addr("10.200.0.1"), SrcPort: 65535, DstPort: 0, Protocol: 47,
+			Bytes: 1000, Packets: 10, InputIf: 65535, OutputIf: 0, SrcAS: 4294967295,
+			ExporterIP: addr("172.16.0.1"), EndReason: types.EndReasonActiveTimeout},
+	}
+	for i := range flows {
+		f := &flows[i]
+		f.ReceivedAt = testEpoch.Add(time.Duration(i) * time.Minute)
+		f.EndTime = f.ReceivedAt.Add(-time.Second)
+		f.StartTime = f.EndTime.Add(-time.Duration(i*30) * time.Second)
+		f.Version = types.IPFIX
+	}
+	return flows
+}
+
+// sqlFilterCases are filters whose SQL translation must agree with Matches
+var sqlFilterCases = []string{
+	"src=10.0.0.1",
+	"src=10.0.0.0/8",
+	"ip=192.168.1.10",
+	"!ip=10.0.0.1",
+	"src~10.0.0.1",
+	"ip!~192.168",
+	"dst=10.*.0.1",
+	"src=10.0.0.1-10.0.0.10",
+	"src=2001:db8::/32",
+	"src=::/0",
+	"dst=::/8",
+	"src=::ffff:10.0.0.0/104",
+	"dst=::-::1:0:0:0",
+	"dst=2001:db8:1::53",
+	"exporter=172.16.0.0/24",
+	"exporter=2001:db8:ffff::1",
+	"port:443",
+	"sport=123",
+	"dport!=53",
+	"port<1024",
+	"port>=8080",
+	"bytes>1M",
+	"bytes<=1k",
+	"packets<3",
+	"duration>1m",
+	"bps>10k",
+	"srcas=64512",
+	"as>=4000000000",
+	"proto=tcp",
+	"proto=icmpv6",
+	"!proto=udp",
+	"service=dns",
+	"app=ms-teams",
+	"app=13:453",
+	"state=reset",
+	"state=completed",
+	"if=2",
+	"inif=1 && outif=3",
+	"outif<2",
+	"self",
+	"version=6",
+	"tcp || udp",
+	"(port:53 || port:123) && !src=10.0.0.0/8",
+	"port in {53,123,8000-8999}",
+	"!sport in {65535}",
+	"proto in {tcp, 47}",
+	"if in {1-2, 65535}",
+	"ip in {192.168.0.0/16, 2001:db8::/32}",
+	"src in {10.0.0.1, 110.0.0.0/8}",
+	"dst in {10.0.0.1-10.0.0.5, 8.*.8.8}",
+	"srcas in {4134, 64512}",
+	"ip in {::/0}",
+	"src in {::ffff:10.0.0.0/104, ::/8}",
+	"ip in {0.0.0.0/0}",
+}
+
+func TestFilterToSQLAgreesWithMatches(t *testing.T) {
+	h, err := OpenHistory(HistoryConfig{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	flows := testFlows()
+	if err := h.insert(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expr := range sqlFilterCases {
+		filter := ParseFilter(expr)
+		if !filter.IsValid() {
+			t.Fatalf("%s: %s", expr, filter.Error)
+		}
+		where := filterToSQL(&filter)
+
+		rows, err := h.db.Query("SELECT id FROM flows WHERE "+where.SQL+" ORDER BY id", where.Args...)
+		if err != nil {
+			t.Fatalf("%s: %v (SQL %s)", expr, err, where.SQL)
+		}
+		selected := make(map[int]bool)
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			selected[id-1] = true
+		}
+		rows.Close()
+
+		for i := range flows {
+			matches := filter.Matches(&flows[i])
+			switch {
+			case matches && !selected[i]:
+				t.Errorf("%s: SQL drops matching flow %d (SQL %s)", expr, i, where.SQL)
+			case !matches && selected[i] && where.Exact:
+				t.Errorf("%s: exact SQL selects non-matching flow %d (SQL %s)", expr, i, where.SQL)
+			}
+		}
+
+		got, err := h.Query(&filter, SortByTime, true, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		want := 0
+		for i := range flows {
+			if filter.Matches(&flows[i]) {
+				want++
+			}
+		}
+		if len(got) != want {
+			t.Errorf("%s: Query returned %d flows, want %d", expr, len(got), want)
+		}
+	}
+}
+
+func TestHistoryQuerySortsAfterClipping(t *testing.T) {
+	h, err := OpenHistory(HistoryConfig{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// The larger flow lies mostly outside the range, so it is the smaller one
+	// after clipping
+	from := testEpoch
+	to := testEpoch.Add(10 * time.Second)
+	flows := []types.Flow{
+		{SrcAddr: netip.MustParseAddr("10.0.0.1"), DstAddr: netip.MustParseAddr("10.0.0.2"), Protocol: 6,
+			Bytes: 100000, Packets: 100, StartTime: to.Add(-time.Second), EndTime: to.Add(99 * time.Second),
+			ReceivedAt: to.Add(100 * time.Second)},
+		{SrcAddr: netip.MustParseAddr("10.0.0.3"), DstAddr: netip.MustParseAddr("10.0.0.4"), Protocol: 6,
+			Bytes: 5000, Packets: 10, StartTime: from, EndTime: to,
+			ReceivedAt: to.Add(time.Second)},
+	}
+	if err := h.insert(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := Filter{From: from, To: to}
+	got, err := h.Query(&filter, SortByBytes, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Bytes != 5000 {
+		t.Fatalf("top flow by clipped bytes: got %+v, want the 5000 byte flow", got)
+	}
+
+	got, err = h.Query(&filter, SortByBytes, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Bytes != 1000 || got[1].Bytes != 5000 {
+		t.Fatalf("ascending by clipped bytes: got %d flows %v", len(got), got)
+	}
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"netflow-collector/pkg/types"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver (no cgo)
+)
+
+const (
+	DefaultHistoryBatchSize     = 5000
+	DefaultHistoryFlushInterval = 2 * time.Second
+
+	// historyMaxPendingBatches bounds the insert buffer if the database falls behind
+	historyMaxPendingBatches = 20
+
+	// historyRetentionInterval is how often rows older than MaxAge are deleted
+	historyRetentionInterval = time.Minute
+)
+
+// Every flow is stored as its full binary record (see codec.go) plus the columns
+// needed for filtering, sorting and indexing.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS flows (
+	id           INTEGER PRIMARY KEY,
+	received_at  INTEGER NOT NULL,
+	ip_version   INTEGER NOT NULL,
+	src_addr     TEXT    NOT NULL,
+	dst_addr     TEXT    NOT NULL,
+	src_ip       BLOB    NOT NULL,
+	dst_ip       BLOB    NOT NULL,
+	src_port     INTEGER NOT NULL,
+	dst_port     INTEGER NOT NULL,
+	protocol     INTEGER NOT NULL,
+	state        INTEGER NOT NULL,
+	bytes        INTEGER NOT NULL,
+	packets      INTEGER NOT NULL,
+	input_if     INTEGER NOT NULL,
+	output_if    INTEGER NOT NULL,
+	exporter     TEXT    NOT NULL,
+	exporter_ip  BLOB    NOT NULL,
+	app_engine   INTEGER NOT NULL,
+	app_selector INTEGER NOT NULL,
+	app_name     TEXT    NOT NULL,
+	record       BLOB    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_received_at ON flows (received_at);
+CREATE INDEX IF NOT EXISTS flows_src_ip ON flows (src_ip, received_at);
+CREATE INDEX IF NOT EXISTS flows_dst_ip ON flows (dst_ip, received_at);
+CREATE INDEX IF NOT EXISTS flows_src_port ON flows (src_port, received_at);
+CREATE INDEX IF NOT EXISTS flows_dst_port ON flows (dst_port, received_at);
+CREATE INDEX IF NOT EXISTS flows_exporter_ip ON flows (exporter_ip, received_at);
+`
+
+const historyInsert = `INSERT INTO flows (
+	received_at, ip_version, src_addr, dst_addr, src_ip, dst_ip, src_port, dst_port,
+	protocol, state, bytes, packets, input_if, output_if, exporter, exporter_ip,
+	app_engine, app_selector, app_name, record
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// HistoryConfig configures the SQLite history database
+type HistoryConfig struct {
+	Path          string        // Database file
+	BatchSize     int           // Flows per insert transaction (default 5000)
+	FlushInterval time.Duration // Maximum time flows wait in the insert buffer (default 2s)
+	MaxAge        time.Duration // Delete flows older than this (0 = unlimited)
+}
+
+// HistoryStats describes the state of the history database
+type HistoryStats struct {
+	Path         string
+	FlowsWritten uint64
+	Pending      int       // Flows waiting for the next insert
+	Dropped      uint64    // Flows dropped because the database fell behind
+	Deleted      uint64    // Flows removed by retention
+	Oldest       time.Time // Receive time of the oldest stored flow
+	LastError    string
+}
+
+// History is a SQLite-backed flow history. Inserts are batched off the ingest path.
+type History struct {
+	cfg HistoryConfig
+	db  *sql.DB
+
+	mu            sync.Mutex
+	pending       []types.Flow
+	stats         HistoryStats
+	lastRetention time.Time
+
+	flushChan chan struct{}
+	stopChan  chan struct{}
+	done      chan struct{}
+}
+
+// OpenHistory opens (or creates) the history database and starts the background writer
+func OpenHistory(cfg HistoryConfig) (*History, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("history database path not set")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultHistoryBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultHistoryFlushInterval
+	}
+
+	dsn := "file:" + cfg.Path + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history schema: %w", err)
+	}
+
+	h := &History{
+		cfg:       cfg,
+		db:        db,
+		flushChan: make(chan struct{}, 1),
+		stopChan:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	h.stats.Path = cfg.Path
+
+	go h.writeLoop()
+
+	return h, nil
+}
+
+// Append buffers flows for the next batch insert. It never blocks on the database;
+// if the buffer is full the oldest buffered flows are dropped.
+func (h *History) Append(flows []types.Flow) {
+	h.mu.Lock()
+	h.pending = append(h.pending, flows...)
+	if limit := h.cfg.BatchSize * historyMaxPendingBatches; len(h.pending) > limit {
+		drop := len(h.pending) - limit
+		h.stats.Dropped += uint64(drop)
+		h.pending = append(h.pending[:0], h.pending[drop:]...)
+	}
+	full := len(h.pending) >= h.cfg.BatchSize
+	h.mu.Unlock()
+
+	if full {
+		select {
+		case h.flushChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// writeLoop inserts buffered flows when a batch is full or the flush interval elapsed
+func (h *History) writeLoop() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-h.flushChan:
+			h.Flush()
+		case <-ticker.C:
+			h.Flush()
+		}
+	}
+}
+
+// Flush inserts all buffered flows and applies retention
+func (h *History) Flush() error {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+
+	var err error
+	for len(pending) > 0 && err == nil {
+		n := min(len(pending), h.cfg.BatchSize)
+		err = h.insert(pending[:n])
+		pending = pending[n:]
+	}
+
+	if err == nil && h.cfg.MaxAge > 0 && time.Since(h.lastRetention) >= historyRetentionInterval {
+		h.lastRetention = time.Now()
+		err = h.applyRetention(time.Now().Add(-h.cfg.MaxAge))
+	}
+
+	if err != nil {
+		h.mu.Lock()
+		h.stats.LastError = err.Error()
+		h.mu.Unlock()
+	}
+	return err
+}
+
+// insert writes one batch in a single transaction
+func (h *History) insert(flows []types.Flow) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin insert: %w", err)
+	}
+	stmt, err := tx.Prepare(historyInsert)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	var record []byte
+	for i := range flows {
+		f := &flows[i]
+		ipVersion := 6
+		if f.SrcAddr.Is4() {
+			ipVersion = 4
+		}
+		record = appendFlow(record[:0], f)
+
+		_, err := stmt.Exec(
+			f.ReceivedAt.UnixNano(), ipVersion,
+			f.SrcAddr.String(), f.DstAddr.String(), ipBytes(f.SrcAddr), ipBytes(f.DstAddr),
+			f.SrcPort, f.DstPort, f.Protocol, int(f.State()),
+			int64(f.Bytes), int64(f.Packets), f.InputIf, f.OutputIf,
+			f.ExporterIP.String(), ipBytes(f.ExporterIP),
+			f.AppID.Engine, int64(f.AppID.Selector), f.AppName,
+			record,
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to insert flow: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flows: %w", err)
+	}
+
+	h.mu.Lock()
+	h.stats.FlowsWritten += uint64(len(flows))
+	h.mu.Unlock()
+	return nil
+}
+
+// applyRetention deletes flows received before cutoff
+func (h *History) applyRetention(cutoff time.Time) error {
+	res, err := h.db.Exec("DELETE FROM flows WHERE received_at < ?", cutoff.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to delete old flows: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		h.mu.Lock()
+		h.stats.Deleted += uint64(n)
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// historySortColumns maps sort fields to columns
+var historySortColumns = map[SortField]string{
+	SortByTime:     "received_at",
+	SortByBytes:    "bytes",
+	SortByPackets:  "packets",
+	SortBySrcIP:    "src_ip",
+	SortByDstIP:    "dst_ip",
+	SortByProtocol: "protocol",
+}
+
+// Query returns stored flows matching the filter. The filter expression is
+// translated to SQL; conditions without an exact SQL form are re-checked in Go.
+func (h *History) Query(filter *Filter, sortBy SortField, ascending bool, limit int) ([]types.Flow, error) {
+	where := filterToSQL(filter)
+
+	column, ok := historySortColumns[sortBy]
+	if !ok {
+		column = "received_at"
+	}
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+
+	// Clipping to a flow-time range changes bytes and packets, so those orders
+	// can only be established after clipping
+	resort := filter != nil && filter.HasFlowTimeRange() && (sortBy == SortByBytes || sortBy == SortByPackets)
+
+	query := "SELECT record FROM flows WHERE " + where.SQL + " ORDER BY " + column + " " + order + ", id " + order
+	args := where.Args
+	if where.Exact && limit > 0 && !resort {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []types.Flow
+	for rows.Next() {
+		var record []byte
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("history query failed: %w", err)
+		}
+		flow, _, err := decodeFlow(record)
+		if err != nil {
+			continue
+		}
+		if !where.Exact && !filter.Matches(&flow) {
+			continue
+		}
+		if filter != nil {
+			flow = *filter.clip(&flow)
+		}
+		result = append(result, flow)
+		if limit > 0 && len(result) >= limit && !resort {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+
+	if resort {
+		sortFlows(result, sortBy, ascending)
+		if limit > 0 && len(result) > limit {
+			result = result[:limit]
+		}
+	}
+	return result, nil
+}
+
+// Stats returns the current history statistics
+func (h *History) Stats() HistoryStats {
+	h.mu.Lock()
+	stats := h.stats
+	stats.Pending = len(h.pending)
+	h.mu.Unlock()
+
+	var oldest sql.NullInt64
+	if err := h.db.QueryRow("SELECT MIN(received_at) FROM flows").Scan(&oldest); err == nil && oldest.Valid {
+		stats.Oldest = time.Unix(0, oldest.Int64)
+	}
+	return stats
+}
+
+// Close stops the background writer, inserts remaining flows and closes the database
+func (h *History) Close() error {
+	close(h.stopChan)
+	<-h.done
+	err := h.Flush()
+	if cerr := h.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Subscriptions deliver newly added flows to consumers without polling. Each
+// subscription has a filter and a bounded channel; Add sends matching flows
+// without blocking, so a slow consumer loses flows (counted as dropped) instead
+// of stalling ingest.
+
+// DefaultSubscriptionBuffer is the channel size used when Subscribe gets 0
+const DefaultSubscriptionBuffer = 1024
+
+// Subscription receives newly added flows matching its filter
+type Subscription struct {
+	// C delivers the flows in arrival order (after clock correction). It is
+	// closed by Close.
+	C <-chan types.Flow
+
+	ch      chan types.Flow
+	fs      *FlowStore
+	name    string
+	filter  *Filter
+	created time.Time
+	closed  bool // Guarded by fs.mu
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// SubscriptionStats describes one active subscription
+type SubscriptionStats struct {
+	Name      string
+	Filter    string
+	Created   time.Time
+	Buffer    int    // Channel capacity
+	Queued    int    // Flows waiting in the channel
+	Delivered uint64 // Flows put into the channel
+	Dropped   uint64 // Flows lost because the channel was full
+}
+
+// Subscribe registers a consumer for newly added flows. filter may be nil to
+// receive all flows; buffer is the channel size (0 = DefaultSubscriptionBuffer).
+// The name identifies the subscription in GetSubscriptionStats. Close must be
+// called when done.
+func (fs *FlowStore) Subscribe(name string, filter *Filter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultSubscriptionBuffer
+	}
+	if filter != nil && filter.IsEmpty() {
+		filter = nil
+	}
+	if filter != nil {
+		f := *filter
+		filter = &f
+	}
+
+	ch := make(chan types.Flow, buffer)
+	sub := &Subscription{
+		C:       ch,
+		ch:      ch,
+		fs:      fs,
+		name:    name,
+		filter:  filter,
+		created: time.Now(),
+	}
+
+	fs.mu.Lock()
+	fs.subscriptions = append(fs.subscriptions, sub)
+	fs.mu.Unlock()
+	return sub
+}
+
+// Close unregisters the subscription and closes C. Flows still in the channel
+// can be drained afterwards. Safe to call more than once.
+func (s *Subscription) Close() {
+	fs := s.fs
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	fs.subscriptions = slices.DeleteFunc(fs.subscriptions, func(other *Subscription) bool {
+		return other == s
+	})
+	close(s.ch)
+}
+
+// Delivered returns the number of flows put into the channel
+func (s *Subscription) Delivered() uint64 {
+	return s.delivered.Load()
+}
+
+// Dropped returns the number of matching flows lost because the channel was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// stats returns the subscription's statistics
+func (s *Subscription) stats() SubscriptionStats {
+	stats := SubscriptionStats{
+		Name:      s.name,
+		Created:   s.created,
+		Buffer:    cap(s.ch),
+		Queued:    len(s.ch),
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+	if s.filter != nil {
+		stats.Filter = s.filter.String()
+	}
+	return stats
+}
+
+// publish hands a stored flow to all matching subscriptions without blocking.
+// Must be called with fs.mu held.
+func (fs *FlowStore) publish(flow *types.Flow) {
+	for _, sub := range fs.subscriptions {
+		if sub.filter != nil && !sub.filter.Matches(flow) {
+			continue
+		}
+		select {
+		case sub.ch <- *flow:
+			sub.delivered.Add(1)
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// GetSubscriptionStats returns the statistics of all active subscriptions
+func (fs *FlowStore) GetSubscriptionStats() []SubscriptionStats {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	stats := make([]SubscriptionStats, len(fs.subscriptions))
+	for i, sub := range fs.subscriptions {
+		stats[i] = sub.stats()
+	}
+	return stats
+}
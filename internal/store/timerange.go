@@ -0,0 +1,95 @@
+package store
+
+import (
+	"math"
+	"time"
+
+	"netflow-collector/pkg/types"
+)
+
+// Flow-time ranges. Filter.Since/Until select records by receive time, which
+// lags the traffic by up to the exporter's active timeout. Filter.From/To
+// select flows whose start/end overlaps the window instead, and a flow reaching
+// across a boundary is clipped to it: start and end are limited to the window
+// and bytes and packets apportioned by the share of its duration inside.
+
+// flowTimeSlack is how long before its end a flow may have been received
+// because of exporter clock offsets. A flow overlapping From was received
+// after From minus the slack, which bounds the segments, index minutes and
+// archive files to read.
+const flowTimeSlack = types.MaxTimestampAhead
+
+// recordStart returns the start of a record, the receive time if not exported
+// or implausible
+func recordStart(f *types.Flow) time.Time {
+	if !f.StartTime.IsZero() && !f.TimeImplausible {
+		return f.StartTime
+	}
+	return f.ReceivedAt
+}
+
+// recordEnd returns the end of a record, the receive time if not exported
+// or implausible
+func recordEnd(f *types.Flow) time.Time {
+	if !f.EndTime.IsZero() && !f.TimeImplausible {
+		return f.EndTime
+	}
+	return f.ReceivedAt
+}
+
+// HasFlowTimeRange returns true if the filter restricts the flow start/end
+func (f *Filter) HasFlowTimeRange() bool {
+	return !f.From.IsZero() || !f.To.IsZero()
+}
+
+// overlaps reports whether the flow's start/end overlaps [From, To)
+func (f *Filter) overlaps(flow *types.Flow) bool {
+	if !f.To.IsZero() && !recordStart(flow).Before(f.To) {
+		return false
+	}
+	if !f.From.IsZero() && recordEnd(flow).Before(f.From) {
+		return false
+	}
+	return true
+}
+
+// clip returns the part of a matching flow inside [From, To): the flow itself
+// if it lies within, otherwise a new copy with start, end, bytes and packets
+// reduced to the share of its duration inside the window
+func (f *Filter) clip(flow *types.Flow) *types.Flow {
+	if !f.HasFlowTimeRange() {
+		return flow
+	}
+	start, end := recordStart(flow), recordEnd(flow)
+	from, to := start, end
+	if !f.From.IsZero() && f.From.After(from) {
+		from = f.From
+	}
+	if !f.To.IsZero() && f.To.Before(to) {
+		to = f.To
+	}
+	if from.Equal(start) && to.Equal(end) {
+		return flow
+	}
+
+	// A boundary lies inside the flow, so its duration is positive
+	share := float64(to.Sub(from)) / float64(end.Sub(start))
+	clipped := *flow
+	clipped.StartTime = from
+	clipped.EndTime = to
+	clipped.Bytes = uint64(math.Round(float64(flow.Bytes) * share))
+	clipped.Packets = uint64(math.Round(float64(flow.Packets) * share))
+	return &clipped
+}
+
+// receivedSince returns the earliest receive time of a matching flow, zero if
+// the filter doesn't bound it
+func (f *Filter) receivedSince() time.Time {
+	since := f.Since
+	if !f.From.IsZero() {
+		if from := f.From.Add(-flowTimeSlack); since.IsZero() || from.After(since) {
+			since = from
+		}
+	}
+	return since
+}
@@ -2,7 +2,8 @@ package types
 
 import (
 	"fmt"
-	"net"
+	"net/netip"
+	"strings"
 	"time"
 )
 
@@ -10,13 +11,22 @@ import (
 type FlowVersion int
 
 const (
+	NetFlowV1 FlowVersion = 1
 	NetFlowV5 FlowVersion = 5
+	NetFlowV7 FlowVersion = 7
+	NetFlowV8 FlowVersion = 8
 	NetFlowV9 FlowVersion = 9
 	IPFIX     FlowVersion = 10
 )
 
 func (v FlowVersion) String() string {
 	switch v {
+	case NetFlowV1:
+		return "NetFlow v1"
+	case NetFlowV7:
+		return "NetFlow v7"
+	case NetFlowV8:
+		return "NetFlow v8"
 	case NetFlowV5:
 		return "NetFlow v5"
 	case NetFlowV9:
@@ -31,8 +41,8 @@ func (v FlowVersion) String() string {
 // Flow repräsentiert einen einzelnen Netzwerk-Flow-Datensatz
 type Flow struct {
 	Version      FlowVersion
-	SrcAddr      net.IP
-	DstAddr      net.IP
+	SrcAddr      netip.Addr
+	DstAddr      netip.Addr
 	SrcPort      uint16
 	DstPort      uint16
 	Protocol     uint8
@@ -40,14 +50,169 @@ type Flow struct {
 	Packets      uint64
 	StartTime    time.Time
 	EndTime      time.Time
-	TCPFlags     uint8
+	TCPFlags     uint8 // Kumulierte TCP-Flags (OR über alle Pakete des Flows)
+	EndReason    EndReason
 	SrcAS        uint32
 	DstAS        uint32
+	SrcMask      uint8 // Prefix-Länge der Quelle (0 wenn nicht exportiert)
+	DstMask      uint8 // Prefix-Länge des Ziels (0 wenn nicht exportiert)
 	InputIf      uint16
 	OutputIf     uint16
-	ExporterIP   net.IP
+	ExporterIP   netip.Addr
 	ReceivedAt   time.Time
 	LastAccessed time.Time // LRU-Tracking - wann der Flow zuletzt angezeigt/abgefragt wurde
+
+	// Zeitbezug des Exporters
+	ExportTime      time.Time     // Export-Zeit aus dem Paket-Header (Uhr des Exporters)
+	ClockCorrection time.Duration // Auf Start-/Endzeit angewendete Korrektur des Uhren-Offsets
+	TimeImplausible bool          // Start-/Endzeit unplausibel relativ zu ReceivedAt (falsche Exporter-Uhr, Uptime-Fehler)
+
+	// Applikationserkennung des Exporters (Cisco NBAR, Palo Alto App-ID)
+	AppID   AppID  // IPFIX IE 95 applicationId, leer wenn nicht exportiert
+	AppName string // IE 96 applicationName, Vendor App-ID oder Name aus der Options-Tabelle
+
+	// Router-seitige Aggregation (NetFlow v8): Felder außerhalb des Schemas sind leer
+	Aggregation Aggregation
+	FlowCount   uint32 // Anzahl der vom Router zusammengefassten Flows (nur v8)
+
+	Seq uint64 // Fortlaufende Nummer im Flow-Store, beim Speichern vergeben (0 = nicht gespeichert)
+}
+
+// Aggregation ist das NetFlow v8 Aggregationsschema, das einen Datensatz erzeugt hat
+type Aggregation uint8
+
+const (
+	AggregationNone      Aggregation = 0 // Einzelner Flow (kein Aggregat)
+	AggregationAS        Aggregation = 1
+	AggregationProtoPort Aggregation = 2
+	AggregationSrcPrefix Aggregation = 3
+	AggregationDstPrefix Aggregation = 4
+	AggregationPrefix    Aggregation = 5
+)
+
+func (a Aggregation) String() string {
+	switch a {
+	case AggregationNone:
+		return "-"
+	case AggregationAS:
+		return "as"
+	case AggregationProtoPort:
+		return "proto-port"
+	case AggregationSrcPrefix:
+		return "src-prefix"
+	case AggregationDstPrefix:
+		return "dst-prefix"
+	case AggregationPrefix:
+		return "prefix"
+	default:
+		return fmt.Sprintf("Unknown(%d)", a)
+	}
+}
+
+// EndReason ist der Grund für das Flow-Ende (IPFIX IE 136 flowEndReason)
+type EndReason uint8
+
+const (
+	EndReasonUnknown         EndReason = 0x00
+	EndReasonIdleTimeout     EndReason = 0x01
+	EndReasonActiveTimeout   EndReason = 0x02
+	EndReasonEndOfFlow       EndReason = 0x03 // FIN/RST erkannt
+	EndReasonForcedEnd       EndReason = 0x04
+	EndReasonLackOfResources EndReason = 0x05
+)
+
+func (r EndReason) String() string {
+	switch r {
+	case EndReasonUnknown:
+		return "-"
+	case EndReasonIdleTimeout:
+		return "idle timeout"
+	case EndReasonActiveTimeout:
+		return "active timeout"
+	case EndReasonEndOfFlow:
+		return "end of flow"
+	case EndReasonForcedEnd:
+		return "forced end"
+	case EndReasonLackOfResources:
+		return "lack of resources"
+	default:
+		return fmt.Sprintf("Unknown(%d)", r)
+	}
+}
+
+// FlowState ist der aus TCP-Flags und End-Reason abgeleitete Verbindungszustand
+type FlowState int
+
+const (
+	StateUnknown FlowState = iota
+	StateCompleted
+	StateReset
+	StateHalfOpen // Nur SYN, keine Antwort
+	StateIdleTimeout
+	StateActiveTimeout
+)
+
+func (s FlowState) String() string {
+	switch s {
+	case StateCompleted:
+		return "completed"
+	case StateReset:
+		return "reset"
+	case StateHalfOpen:
+		return "half-open"
+	case StateIdleTimeout:
+		return "idle-timeout"
+	case StateActiveTimeout:
+		return "active-timeout"
+	default:
+		return "-"
+	}
+}
+
+// ParseFlowState parst einen Zustandsnamen wie "reset" oder "half-open"
+func ParseFlowState(s string) (FlowState, bool) {
+	switch strings.ToLower(s) {
+	case "completed", "complete", "closed":
+		return StateCompleted, true
+	case "reset", "rst", "rejected":
+		return StateReset, true
+	case "half-open", "halfopen", "syn", "unanswered":
+		return StateHalfOpen, true
+	case "idle-timeout", "idle":
+		return StateIdleTimeout, true
+	case "active-timeout", "active":
+		return StateActiveTimeout, true
+	default:
+		return StateUnknown, false
+	}
+}
+
+// AppID identifiziert eine Applikation nach RFC 6759 (Classification Engine + Selector)
+type AppID struct {
+	Engine   uint8  // Classification Engine ID (z.B. 3 = IANA-L4, 13 = NBAR2)
+	Selector uint64 // Selector ID innerhalb der Engine
+}
+
+// IsZero gibt true zurück wenn keine Application-ID gesetzt ist
+func (a AppID) IsZero() bool {
+	return a.Engine == 0 && a.Selector == 0
+}
+
+// String gibt die Application-ID im Cisco-Format "engine:selector" zurück
+func (a AppID) String() string {
+	if a.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", a.Engine, a.Selector)
+}
+
+// ApplicationName gibt den vom Exporter gemeldeten Applikationsnamen zurück,
+// oder die Application-ID falls nur diese bekannt ist
+func (f *Flow) ApplicationName() string {
+	if f.AppName != "" {
+		return f.AppName
+	}
+	return f.AppID.String()
 }
 
 // ProtocolName gibt den lesbaren Protokollnamen zurück
@@ -106,6 +271,57 @@ func (f *Flow) TCPFlagsString() string {
 	return flags
 }
 
+// State leitet den Verbindungszustand aus den kumulierten TCP-Flags und der End-Reason ab.
+// TCP-Flags haben Vorrang: RST = reset, SYN ohne ACK = half-open, FIN = completed.
+func (f *Flow) State() FlowState {
+	if f.Protocol == 6 {
+		switch {
+		case f.TCPFlags&0x04 != 0:
+			return StateReset
+		case f.TCPFlags&0x02 != 0 && f.TCPFlags&0x10 == 0:
+			return StateHalfOpen
+		case f.TCPFlags&0x01 != 0:
+			return StateCompleted
+		}
+	}
+
+	switch f.EndReason {
+	case EndReasonIdleTimeout:
+		return StateIdleTimeout
+	case EndReasonActiveTimeout:
+		return StateActiveTimeout
+	case EndReasonEndOfFlow:
+		return StateCompleted
+	}
+	return StateUnknown
+}
+
+// Plausibilitätsfenster für Flow-Zeitstempel relativ zum Empfang. Flows dürfen wegen
+// Uhren-Jitter etwas nach dem Empfang enden; langlebige Flows werden spätestens nach
+// dem Active Timeout exportiert.
+const (
+	MaxTimestampAhead = 5 * time.Minute
+	MaxTimestampAge   = 24 * time.Hour
+)
+
+// HasImplausibleTimestamps prüft, ob Start-/Endzeit zu weit in der Zukunft oder
+// Vergangenheit relativ zu ReceivedAt liegen oder das Ende vor dem Start liegt
+func (f *Flow) HasImplausibleTimestamps() bool {
+	switch {
+	case f.StartTime.IsZero() && f.EndTime.IsZero():
+		return false
+	case !f.StartTime.IsZero() && !f.EndTime.IsZero() && f.EndTime.Before(f.StartTime):
+		return true
+	case f.EndTime.After(f.ReceivedAt.Add(MaxTimestampAhead)):
+		return true
+	case !f.EndTime.IsZero() && f.EndTime.Before(f.ReceivedAt.Add(-MaxTimestampAge)):
+		return true
+	case f.StartTime.After(f.ReceivedAt.Add(MaxTimestampAhead)):
+		return true
+	}
+	return false
+}
+
 // Duration gibt die Flow-Dauer zurück
 func (f *Flow) Duration() time.Duration {
 	return f.EndTime.Sub(f.StartTime)
@@ -120,32 +336,78 @@ func (f *Flow) BytesPerSecond() float64 {
 	return float64(f.Bytes) / d
 }
 
-// FlowKey generiert einen eindeutigen Schlüssel für den Flow (für Aggregation)
-func (f *Flow) FlowKey() string {
+// FlowKey identifiziert einen Flow über sein 5-Tupel. Vergleichbar und damit
+// direkt als Map-Schlüssel nutzbar, ohne Strings zu bauen.
+type FlowKey struct {
+	SrcAddr  netip.Addr
+	DstAddr  netip.Addr
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol uint8
+}
+
+// String formatiert den Schlüssel als "src:port-dst:port-proto"
+func (k FlowKey) String() string {
 	return fmt.Sprintf("%s:%d-%s:%d-%d",
-		f.SrcAddr, f.SrcPort,
-		f.DstAddr, f.DstPort,
-		f.Protocol)
+		k.SrcAddr, k.SrcPort,
+		k.DstAddr, k.DstPort,
+		k.Protocol)
+}
+
+// FlowKey liefert den Schlüssel des Flows (für Aggregation)
+func (f *Flow) FlowKey() FlowKey {
+	return FlowKey{
+		SrcAddr:  f.SrcAddr,
+		DstAddr:  f.DstAddr,
+		SrcPort:  f.SrcPort,
+		DstPort:  f.DstPort,
+		Protocol: f.Protocol,
+	}
+}
+
+// ConversationKey identifiziert eine bidirektionale Verbindung; Endpunkt A ist
+// der kleinere (Adresse, dann Port), damit beide Richtungen denselben Schlüssel haben
+type ConversationKey struct {
+	AddrA    netip.Addr
+	AddrB    netip.Addr
+	PortA    uint16
+	PortB    uint16
+	Protocol uint8
+}
+
+// String formatiert den Schlüssel als "a:port-b:port-proto"
+func (k ConversationKey) String() string {
+	return fmt.Sprintf("%s:%d-%s:%d-%d", k.AddrA, k.PortA, k.AddrB, k.PortB, k.Protocol)
+}
+
+// endpointLess vergleicht zwei Endpunkte nach Adresse, dann Port
+func endpointLess(addrA netip.Addr, portA uint16, addrB netip.Addr, portB uint16) bool {
+	if c := addrA.Compare(addrB); c != 0 {
+		return c < 0
+	}
+	return portA < portB
+}
+
+// IsForward gibt true zurück wenn der Flow von Endpunkt A nach B geht
+func (f *Flow) IsForward() bool {
+	return !endpointLess(f.DstAddr, f.DstPort, f.SrcAddr, f.SrcPort)
 }
 
 // ConversationKey generiert einen bidirektionalen Schlüssel (gleich für beide Richtungen)
-func (f *Flow) ConversationKey() string {
-	// Normalisieren: kleinere IP:Port zuerst
-	src := fmt.Sprintf("%s:%d", f.SrcAddr, f.SrcPort)
-	dst := fmt.Sprintf("%s:%d", f.DstAddr, f.DstPort)
-	if src < dst {
-		return fmt.Sprintf("%s-%s-%d", src, dst, f.Protocol)
+func (f *Flow) ConversationKey() ConversationKey {
+	if f.IsForward() {
+		return ConversationKey{f.SrcAddr, f.DstAddr, f.SrcPort, f.DstPort, f.Protocol}
 	}
-	return fmt.Sprintf("%s-%s-%d", dst, src, f.Protocol)
+	return ConversationKey{f.DstAddr, f.SrcAddr, f.DstPort, f.SrcPort, f.Protocol}
 }
 
 // Conversation repräsentiert einen bidirektionalen Flow (Anfrage + Antwort)
 type Conversation struct {
-	// Endpunkt A (die lexikografisch "kleinere" IP:Port)
-	AddrA net.IP
+	// Endpunkt A (der kleinere Endpunkt nach Adresse, dann Port)
+	AddrA netip.Addr
 	PortA uint16
 	// Endpunkt B
-	AddrB    net.IP
+	AddrB    netip.Addr
 	PortB    uint16
 	Protocol uint8
 
@@ -166,7 +428,7 @@ type Conversation struct {
 	// Für Anzeige
 	InputIf    uint16
 	OutputIf   uint16
-	ExporterIP net.IP
+	ExporterIP netip.Addr
 }
 
 // TotalBytes gibt die Gesamtbytes in beide Richtungen zurück
@@ -211,6 +473,6 @@ func (c *Conversation) ProtocolName() string {
 }
 
 // Key gibt einen eindeutigen Bezeichner für diese Conversation zurück
-func (c *Conversation) Key() string {
-	return fmt.Sprintf("%s:%d-%s:%d-%d", c.AddrA, c.PortA, c.AddrB, c.PortB, c.Protocol)
+func (c *Conversation) Key() ConversationKey {
+	return ConversationKey{c.AddrA, c.AddrB, c.PortA, c.PortB, c.Protocol}
 }